@@ -0,0 +1,493 @@
+////////////////////////////////////////////////////////////////////////////
+//
+// Summit Route End Point Protection
+//
+// This source code is licensed under the BSD-style license found in the
+// LICENSE file in the root directory of this source tree.
+//
+/////////////////////////////////////////////////////////////////////////////
+
+package api
+
+import (
+	"compress/gzip"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"regexp"
+	"sort"
+	"strings"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/coopernurse/gorp"
+	_ "github.com/lib/pq" // Needed for gorp
+	"github.com/zenazn/goji/web"
+
+	"qdserver/lib/command"
+	"qdserver/lib/models"
+	"qdserver/lib/utils"
+)
+
+const (
+	maxBatchEvents    = 10000            // Most events we'll take in one request
+	maxBatchSize      = 1024 * 1024 * 64 // Largest body we'll read, after decompressing
+	sha256QueryLength = 500              // Number of hashes looked up per query
+)
+
+var (
+	md5Regex    = regexp.MustCompile("^[a-f0-9]{32}$")
+	sha1Regex   = regexp.MustCompile("^[a-f0-9]{40}$")
+	sha256Regex = regexp.MustCompile("^[a-f0-9]{64}$")
+)
+
+// batchEvent is a ProcessEvent, ProcessExitEvent, or CatalogFileEvent in a batch
+type batchEvent struct {
+	EventType   string // "process", "exit", or "catalog"
+	TimeOfEvent int64
+	Path        string
+	Sha256      string
+	Size        int
+
+	// Only for process events
+	Type        int
+	PID         int64
+	PPID        int64
+	CommandLine string
+	Md5         string
+	Sha1        string
+	IsSigned    bool
+
+	// Only for exit events, which use TimeOfEvent as when the process exited
+	StartTime int64
+	ExitCode  int64
+}
+
+// batchEventStatus is the result of each event in a batch, which is sent back in the same order
+type batchEventStatus struct {
+	Status string // "ok" or "invalid"
+	Error  string `json:",omitempty"`
+}
+
+// idAndSha256 is used to look up files by their hash
+type idAndSha256 struct {
+	ID     int64
+	Sha256 []byte
+}
+
+// validate checks the event is well formed
+func (event *batchEvent) validate() error {
+	if event.EventType == "exit" {
+		// Exits only refer to a process we've already been told about
+		return nil
+	}
+
+	if !sha256Regex.MatchString(event.Sha256) {
+		return fmt.Errorf("Incorrectly formatted sha256")
+	}
+	if event.Size < 0 {
+		return fmt.Errorf("Negative size")
+	}
+
+	switch event.EventType {
+	case "process":
+		if !md5Regex.MatchString(event.Md5) {
+			return fmt.Errorf("Incorrectly formatted md5")
+		}
+		if !sha1Regex.MatchString(event.Sha1) {
+			return fmt.Errorf("Incorrectly formatted sha1")
+		}
+	case "catalog":
+	default:
+		return fmt.Errorf("Unknown event type \"%s\"", event.EventType)
+	}
+
+	return nil
+}
+
+// findIDsBySha256 returns the IDs of the files in the table with the given hashes, keyed by the hex encoded sha256
+func findIDsBySha256(db gorp.SqlExecutor, table string, sha256s [][]byte) (map[string]int64, error) {
+	ids := make(map[string]int64)
+
+	for start := 0; start < len(sha256s); start += sha256QueryLength {
+		end := start + sha256QueryLength
+		if end > len(sha256s) {
+			end = len(sha256s)
+		}
+
+		params := make(map[string]interface{})
+		var names []string
+		for i, sha256 := range sha256s[start:end] {
+			name := fmt.Sprintf("sha256_%d", i)
+			params[name] = sha256
+			names = append(names, ":"+name)
+		}
+
+		var rows []idAndSha256
+		_, err := db.Select(&rows, fmt.Sprintf("SELECT ID, Sha256 FROM %s WHERE Sha256 in (%s)", table, strings.Join(names, ",")), params)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, row := range rows {
+			ids[hex.EncodeToString(row.Sha256)] = row.ID
+		}
+	}
+
+	return ids, nil
+}
+
+// executableFileColumns are the columns insertFiles fills in for an executable file.  Every column that can't be read
+// back as NULL is given, while the hashes the worker adds are left NULL.
+var executableFileColumns = []string{"Md5", "Sha1", "Sha256", "Size", "IsSigned", "FirstSeen", "ExecutionType",
+	"UploadDate", "AnalysisDate", "CompanyName", "ProductVersion", "ProductName", "FileDescription", "InternalName",
+	"FileVersion", "OriginalFilename", "Architecture", "SignatureStatus"}
+
+// executableFileRow returns the values of executableFileColumns for the file
+func executableFileRow(executable *models.ExecutableFile) []interface{} {
+	return []interface{}{executable.Md5, executable.Sha1, executable.Sha256, executable.Size, executable.IsSigned,
+		executable.FirstSeen, executable.ExecutionType, executable.UploadDate, executable.AnalysisDate,
+		executable.CompanyName, executable.ProductVersion, executable.ProductName, executable.FileDescription,
+		executable.InternalName, executable.FileVersion, executable.OriginalFilename, executable.Architecture,
+		executable.SignatureStatus}
+}
+
+// catalogFileColumns are the columns insertFiles fills in for a catalog file
+var catalogFileColumns = []string{"FilePath", "Sha256", "Size", "FirstSeen", "UploadDate", "AnalysisDate", "SignerID",
+	"SignatureStatus"}
+
+// catalogFileRow returns the values of catalogFileColumns for the catalog
+func catalogFileRow(catalog *models.CatalogFile) []interface{} {
+	return []interface{}{catalog.FilePath, catalog.Sha256, catalog.Size, catalog.FirstSeen, catalog.UploadDate,
+		catalog.AnalysisDate, catalog.SignerID, catalog.SignatureStatus}
+}
+
+// insertFiles adds the files to the table, sha256QueryLength at a time, skipping those whose sha256 is already there.
+// The rows are keyed by the hex encoded sha256, and have a value for each of the columns.  It returns the ID of every
+// file keyed by its hex encoded sha256, and the sha256s of the files that were added.
+func insertFiles(tx gorp.SqlExecutor, table string, columns []string, rows map[string][]interface{}) (map[string]int64, []string, error) {
+	// Insert in a consistent order, so two batches with the same new files wait on each other rather than deadlock
+	var sha256s []string
+	for sha256 := range rows {
+		sha256s = append(sha256s, sha256)
+	}
+	sort.Strings(sha256s)
+
+	ids := make(map[string]int64)
+	var added []string
+	for start := 0; start < len(sha256s); start += sha256QueryLength {
+		end := start + sha256QueryLength
+		if end > len(sha256s) {
+			end = len(sha256s)
+		}
+
+		params := make(map[string]interface{})
+		var values []string
+		for i, sha256 := range sha256s[start:end] {
+			var names []string
+			for j, value := range rows[sha256] {
+				name := fmt.Sprintf("v%d_%d", i, j)
+				params[name] = value
+				names = append(names, ":"+name)
+			}
+			values = append(values, "("+strings.Join(names, ",")+")")
+		}
+
+		var inserted []idAndSha256
+		_, err := tx.Select(&inserted, fmt.Sprintf("INSERT INTO %s (%s) VALUES %s ON CONFLICT (Sha256) DO NOTHING RETURNING ID, Sha256",
+			table, strings.Join(columns, ","), strings.Join(values, ",")), params)
+		if err != nil {
+			return nil, nil, err
+		}
+		for _, row := range inserted {
+			sha256 := hex.EncodeToString(row.Sha256)
+			ids[sha256] = row.ID
+			added = append(added, sha256)
+		}
+	}
+
+	// Look up the files that were already there
+	var existing [][]byte
+	for _, sha256 := range sha256s {
+		if _, ok := ids[sha256]; !ok {
+			hash, _ := hex.DecodeString(sha256)
+			existing = append(existing, hash)
+		}
+	}
+	existingIDs, err := findIDsBySha256(tx, table, existing)
+	if err != nil {
+		return nil, nil, err
+	}
+	for sha256, id := range existingIDs {
+		ids[sha256] = id
+	}
+
+	return ids, added, nil
+}
+
+// BatchEvents route lets an agent send many process and catalog events at once, such as when it has been offline.
+// The body may be gzip compressed, in which case the Content-Encoding header must be "gzip".
+// Events are all stored in one transaction, so either every valid event is stored or none are.
+// Invalid events are skipped, and the status of each event is sent back in the same order.
+func (controller *Controller) BatchEvents(c web.C, r *http.Request) (string, int) {
+	var reader io.Reader = r.Body
+	if r.Header.Get("Content-Encoding") == "gzip" {
+		gzipReader, err := gzip.NewReader(r.Body)
+		if err != nil {
+			log.Errorf("Unable to decompress body, %v", err)
+			return "", http.StatusBadRequest
+		}
+		defer gzipReader.Close()
+		reader = gzipReader
+	}
+
+	// Read one extra byte so we can tell if the body is too big
+	body, err := ioutil.ReadAll(io.LimitReader(reader, maxBatchSize+1))
+	if err != nil {
+		log.Errorf("Unable to read body, %v", err)
+		return "", http.StatusBadRequest
+	}
+	if len(body) > maxBatchSize {
+		log.Errorf("Batch is too big")
+		return "", http.StatusRequestEntityTooLarge
+	}
+
+	type batchFromClient struct {
+		SystemUUID        string
+		CustomerUUID      string
+		CurrentClientTime int64
+		Events            []batchEvent
+	}
+
+	var batch batchFromClient
+	err = json.Unmarshal(body, &batch)
+	if err != nil {
+		log.Errorf("Unable to unmarshal json, %v", err)
+		return "", http.StatusBadRequest
+	}
+
+	if len(batch.Events) > maxBatchEvents {
+		log.Errorf("Batch has too many events (%d)", len(batch.Events))
+		return "", http.StatusRequestEntityTooLarge
+	}
+
+	db := controller.GetDatabase(c)
+
+	systemID, err := controller.getSystemID(c, batch.SystemUUID, batch.CustomerUUID)
+	if err != nil {
+		log.Errorf("Unable to find ID for System %s (customer: %s), %v", batch.SystemUUID, batch.CustomerUUID, err)
+		return "", http.StatusBadRequest
+	}
+
+	log.Infof("BatchEvents from system %d with %d events", systemID, len(batch.Events))
+
+	// Clock skew between the agent and us
+	clockOffset := utils.DBTimeNow() - batch.CurrentClientTime
+
+	//
+	// Validate the events, and collect the files they refer to
+	//
+	statuses := make([]batchEventStatus, len(batch.Events))
+	executables := make(map[string]*models.ExecutableFile)
+	catalogs := make(map[string]*models.CatalogFile)
+
+	for i := range batch.Events {
+		event := &batch.Events[i]
+		if err = event.validate(); err != nil {
+			statuses[i] = batchEventStatus{Status: "invalid", Error: err.Error()}
+			continue
+		}
+		statuses[i] = batchEventStatus{Status: "ok"}
+
+		event.TimeOfEvent += clockOffset
+		if event.EventType == "exit" {
+			event.StartTime += clockOffset
+			continue
+		}
+		sha256, _ := hex.DecodeString(event.Sha256)
+
+		if event.EventType == "process" {
+			if executable, ok := executables[event.Sha256]; ok {
+				if event.TimeOfEvent < executable.FirstSeen {
+					executable.FirstSeen = event.TimeOfEvent
+				}
+				continue
+			}
+
+			md5, _ := hex.DecodeString(event.Md5)
+			sha1, _ := hex.DecodeString(event.Sha1)
+			executables[event.Sha256] = &models.ExecutableFile{
+				Md5:           md5,
+				Sha1:          sha1,
+				Sha256:        sha256,
+				Size:          event.Size,
+				FirstSeen:     event.TimeOfEvent,
+				IsSigned:      event.IsSigned,
+				ExecutionType: models.ExecutionTypeExe,
+			}
+		} else {
+			if catalog, ok := catalogs[event.Sha256]; ok {
+				if event.TimeOfEvent < catalog.FirstSeen {
+					catalog.FirstSeen = event.TimeOfEvent
+				}
+				continue
+			}
+
+			catalogs[event.Sha256] = &models.CatalogFile{
+				FilePath:  event.Path,
+				Sha256:    sha256,
+				Size:      event.Size,
+				FirstSeen: event.TimeOfEvent,
+			}
+		}
+	}
+
+	//
+	// Store everything in one transaction
+	//
+	tx, err := db.Begin()
+	if err != nil {
+		log.Errorf("Unable to start transaction, %v", err)
+		return "", http.StatusBadRequest
+	}
+
+	if err = storeBatch(tx, systemID, batch.Events, statuses, executables, catalogs); err != nil {
+		log.Errorf("Unable to store batch from system %d, %v", systemID, err)
+		tx.Rollback()
+		return "", http.StatusBadRequest
+	}
+
+	if err = tx.Commit(); err != nil {
+		log.Errorf("Unable to commit batch from system %d, %v", systemID, err)
+		return "", http.StatusBadRequest
+	}
+
+	return controller.GenerateResponseToAgent(c, systemID, command.BatchSuccess(statuses))
+}
+
+// storeBatch adds any new files, the process events, and the file sightings for a batch, then records the exits
+func storeBatch(tx gorp.SqlExecutor, systemID int64, events []batchEvent, statuses []batchEventStatus,
+	executables map[string]*models.ExecutableFile, catalogs map[string]*models.CatalogFile) error {
+
+	// Add the executables we haven't seen before, and ask the agent for a copy
+	executableRows := make(map[string][]interface{})
+	for sha256, executable := range executables {
+		executableRows[sha256] = executableFileRow(executable)
+	}
+	executableIDs, added, err := insertFiles(tx, "ExecutableFiles", executableFileColumns, executableRows)
+	if err != nil {
+		return fmt.Errorf("Error while creating executable files: %v", err)
+	}
+	if len(added) != 0 {
+		log.Infof("%d new files added to the DB", len(added))
+	}
+	for _, sha256 := range added {
+		if err = command.AddTask(tx, systemID, command.GetFileByHash(sha256)); err != nil {
+			return fmt.Errorf("Unable to add task for agent, %v", err)
+		}
+	}
+
+	// Same for catalogs
+	catalogRows := make(map[string][]interface{})
+	for sha256, catalog := range catalogs {
+		catalogRows[sha256] = catalogFileRow(catalog)
+	}
+	_, added, err = insertFiles(tx, "CatalogFiles", catalogFileColumns, catalogRows)
+	if err != nil {
+		return fmt.Errorf("Error while creating catalog files: %v", err)
+	}
+	if len(added) != 0 {
+		log.Infof("%d new catalogs added to the DB", len(added))
+	}
+	for _, sha256 := range added {
+		if err = command.AddTask(tx, systemID, command.GetCatalogFileByHash(sha256)); err != nil {
+			return fmt.Errorf("Unable to add task for agent, %v", err)
+		}
+	}
+
+	// Store each path and command line once
+	var paths, commandLines []string
+	for i, event := range events {
+		if statuses[i].Status == "ok" && event.EventType == "process" {
+			paths = append(paths, event.Path)
+			commandLines = append(commandLines, event.CommandLine)
+		}
+	}
+
+	filePathIDs, err := utils.InternFilePaths(tx, paths)
+	if err != nil {
+		return fmt.Errorf("Error storing paths: %v", err)
+	}
+	commandLineIDs, err := utils.InternCommandLines(tx, commandLines)
+	if err != nil {
+		return fmt.Errorf("Error storing command lines: %v", err)
+	}
+
+	// Stash the process events, and collect when each file was seen
+	var processEventInserts []interface{}
+	sightings := make(map[int64]*utils.FileSighting)
+	for i, event := range events {
+		if statuses[i].Status != "ok" || event.EventType != "process" {
+			continue
+		}
+
+		filePathID := filePathIDs[event.Path]
+		executableID := executableIDs[event.Sha256]
+		processEventInserts = append(processEventInserts, &models.ProcessEvent{
+			SystemID:         systemID,
+			ExecutableFileID: executableID,
+			PID:              event.PID,
+			PPID:             event.PPID,
+			FilePathID:       filePathID,
+			CommandLineID:    commandLineIDs[event.CommandLine],
+			EventTime:        event.TimeOfEvent,
+			State:            models.ProcessStateRunning,
+		})
+
+		sighting, ok := sightings[executableID]
+		if !ok {
+			sightings[executableID] = &utils.FileSighting{
+				FirstSeen:  event.TimeOfEvent,
+				LastSeen:   event.TimeOfEvent,
+				FilePathID: filePathID,
+			}
+			continue
+		}
+		if event.TimeOfEvent < sighting.FirstSeen {
+			sighting.FirstSeen = event.TimeOfEvent
+		}
+		if event.TimeOfEvent >= sighting.LastSeen {
+			sighting.LastSeen = event.TimeOfEvent
+			sighting.FilePathID = filePathID
+		}
+	}
+
+	if len(processEventInserts) != 0 {
+		if err = tx.Insert(processEventInserts...); err != nil {
+			return fmt.Errorf("Error while creating process events: %v", err)
+		}
+	}
+
+	if err = utils.RecordFilesSeenOnSystem(tx, systemID, sightings); err != nil {
+		return fmt.Errorf("Error adding files to fileToSystemMap: %v", err)
+	}
+
+	// Exits are recorded last, as the process may have started in this same batch
+	for i, event := range events {
+		if statuses[i].Status != "ok" || event.EventType != "exit" {
+			continue
+		}
+
+		found, err := recordProcessExit(tx, systemID, event.PID, event.StartTime, event.TimeOfEvent, event.ExitCode)
+		if err != nil {
+			return fmt.Errorf("Error recording exit of process %d: %v", event.PID, err)
+		}
+		if !found {
+			log.Warningf("No running process %d on system %d started around %d", event.PID, systemID, event.StartTime)
+		}
+	}
+
+	return nil
+}
@@ -19,7 +19,7 @@ import (
 	_ "github.com/lib/pq" // Needed for gorp
 	"github.com/zenazn/goji/web"
 
-	"qdserver/CallbackServer/command"
+	"qdserver/lib/command"
 	"qdserver/lib/models"
 	"qdserver/lib/utils"
 )
@@ -52,7 +52,7 @@ func (controller *Controller) CatalogFileEvent(c web.C, r *http.Request) (string
 
 	db := controller.GetDatabase(c)
 
-	systemID, err := utils.GetSystemIDFromUUID(db, event.SystemUUID, event.CustomerUUID)
+	systemID, err := controller.getSystemID(c, event.SystemUUID, event.CustomerUUID)
 	if err != nil {
 		log.Errorf("Unable to parse get System ID, %v", err)
 		return "", http.StatusBadRequest
@@ -109,5 +109,5 @@ func (controller *Controller) CatalogFileEvent(c web.C, r *http.Request) (string
 	// Else if a catalogID exists, then we've seen this catalog before so we don't need to do anything
 	// TODO Might be smart to keep track of all the agents that have this catalog
 
-	return GenerateResponseToAgent(db, systemID, command.Success())
+	return controller.GenerateResponseToAgent(c, systemID, command.Success())
 }
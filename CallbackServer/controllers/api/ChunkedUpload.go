@@ -0,0 +1,469 @@
+////////////////////////////////////////////////////////////////////////////
+//
+// Summit Route End Point Protection
+//
+// This source code is licensed under the BSD-style license found in the
+// LICENSE file in the root directory of this source tree.
+//
+/////////////////////////////////////////////////////////////////////////////
+
+package api
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"database/sql"
+	"encoding"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path"
+	"regexp"
+	"strconv"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/coopernurse/gorp"
+	_ "github.com/lib/pq" // Needed for gorp
+	"github.com/zenazn/goji/web"
+
+	"qdserver/lib/command"
+	"qdserver/lib/models"
+	"qdserver/lib/utils"
+)
+
+// Chunked uploads work as:
+//  1. UploadInitiate with the sha256, size, and type of the file.  The response has the UploadID and the
+//     Offset to send from, which is non-zero when resuming an earlier upload of the same file.
+//  2. UploadChunk with a PUT of the bytes from Offset, using a Content-Range header.  Each response has the
+//     new Offset.  If the connection drops, whatever arrived is kept, so the agent re-initiates and continues.
+//  3. UploadFinalize once Offset equals the size, which checks the hash and hands the file to the workers.
+
+// contentRangeRegex matches "bytes start-end/total"
+var contentRangeRegex = regexp.MustCompile(`^bytes ([0-9]+)-([0-9]+)/([0-9]+)$`)
+
+// uploadStatus is returned to the agent from UploadInitiate and UploadChunk
+type uploadStatus struct {
+	UploadID     int64
+	Offset       int64
+	MaxChunkSize int64
+}
+
+// uploadPartPath returns where the bytes received so far are kept
+func uploadPartPath(uploadPath string, uploadID int64) string {
+	return path.Join(uploadPath, fmt.Sprintf("upload-%d.part", uploadID))
+}
+
+// getUploadedFileSize returns the size the agent reported for the file, or an error if we've never seen it
+func getUploadedFileSize(db *gorp.DbMap, fileType string, sha256ByteArray []byte) (int64, error) {
+	var table string
+	if fileType == "exe" {
+		table = "ExecutableFiles"
+	} else if fileType == "catalog" {
+		table = "CatalogFiles"
+	} else {
+		return 0, fmt.Errorf("Unknown file type %s", fileType)
+	}
+
+	return db.SelectInt(fmt.Sprintf("SELECT Size FROM %s WHERE Sha256=:sha256", table),
+		map[string]interface{}{
+			"sha256": sha256ByteArray,
+		})
+}
+
+// getFileUpload returns the upload if it belongs to the system
+func getFileUpload(db *gorp.DbMap, uploadID int64, systemID int64) (*models.FileUpload, error) {
+	var upload models.FileUpload
+	err := db.SelectOne(&upload, "select * from fileuploads where ID=:id and SystemID=:systemID",
+		map[string]interface{}{
+			"id":       uploadID,
+			"systemID": systemID,
+		})
+	if err != nil {
+		return nil, err
+	}
+	return &upload, nil
+}
+
+// lockFileUpload returns the upload if it belongs to the system, locking its row until the transaction ends
+func lockFileUpload(tx *gorp.Transaction, uploadID int64, systemID int64) (*models.FileUpload, error) {
+	var upload models.FileUpload
+	err := tx.SelectOne(&upload, "select * from fileuploads where ID=:id and SystemID=:systemID for update",
+		map[string]interface{}{
+			"id":       uploadID,
+			"systemID": systemID,
+		})
+	if err != nil {
+		return nil, err
+	}
+	return &upload, nil
+}
+
+// restartUpload throws away what has been received so the agent starts from the beginning
+func restartUpload(db gorp.SqlExecutor, uploadPath string, upload *models.FileUpload) error {
+	os.Remove(uploadPartPath(uploadPath, upload.ID))
+	upload.Offset = 0
+	upload.HashState = nil
+	upload.LastUpdate = utils.DBTimeNow()
+	_, err := db.Update(upload)
+	return err
+}
+
+// UploadInitiate starts, or resumes, a chunked upload
+func (controller *Controller) UploadInitiate(c web.C, r *http.Request) (string, int) {
+	db := controller.GetDatabase(c)
+	config := controller.GetConfiguration(c)
+
+	// Parse body into json
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		log.Errorf("Unable to read body")
+		return "", http.StatusBadRequest
+	}
+
+	type eventFromClient struct {
+		SystemUUID        string
+		CustomerUUID      string
+		CurrentClientTime int64
+		Sha256            string // Sha256 of the file
+		Size              int64
+		FileType          string // May be "exe" or "catalog"
+	}
+
+	var event eventFromClient
+	err = json.Unmarshal(body, &event)
+	if err != nil {
+		log.Errorf("Unable to unmarshal json, %v", err)
+		return "", http.StatusBadRequest
+	}
+
+	systemID, err := controller.getSystemID(c, event.SystemUUID, event.CustomerUUID)
+	if err != nil {
+		log.Errorf("Unable to parse get System ID, %v", err)
+		return "", http.StatusBadRequest
+	}
+
+	// Sanity check the hash
+	match, _ := regexp.MatchString("^[a-f0-9]{64}$", event.Sha256)
+	if !match {
+		log.Errorf("Incorrectly formatted sha256, %v", event.Sha256)
+		return "", http.StatusBadRequest
+	}
+	sha256ByteArray, err := hex.DecodeString(event.Sha256)
+	if err != nil {
+		log.Errorf("Unable to convert hex string to bytes, %v", err)
+		return "", http.StatusBadRequest
+	}
+
+	// Reject bad sizes before anything is sent
+	if event.Size <= 0 || event.Size > config.Uploads.MaxFileSize {
+		log.Errorf("Upload of %s has a size we won't accept (%d)", event.Sha256, event.Size)
+		return "", http.StatusBadRequest
+	}
+	expectedSize, err := getUploadedFileSize(db, event.FileType, sha256ByteArray)
+	if err != nil {
+		log.Errorf("Unable to find %s (%s) in DB (agent uploading a file we've never seen), %v", event.FileType, event.Sha256, err)
+		return "", http.StatusBadRequest
+	}
+	if expectedSize != event.Size {
+		log.Errorf("Upload size does not equal expected size (given: %d, expected: %d)", event.Size, expectedSize)
+		return "", http.StatusBadRequest
+	}
+
+	// Resume an earlier upload of this file from this system.  Its row is held until we're done, so a chunk can't be
+	// written while we throw away what was received.
+	tx, err := db.Begin()
+	if err != nil {
+		log.Errorf("Unable to start transaction, %v", err)
+		return "", http.StatusBadRequest
+	}
+	defer tx.Rollback() // Does nothing once committed
+
+	var upload models.FileUpload
+	err = tx.SelectOne(&upload, "select * from fileuploads where SystemID=:systemID and Sha256=:sha256 for update",
+		map[string]interface{}{
+			"systemID": systemID,
+			"sha256":   sha256ByteArray,
+		})
+	if err == sql.ErrNoRows {
+		upload = models.FileUpload{
+			SystemID:     systemID,
+			Sha256:       sha256ByteArray,
+			Size:         event.Size,
+			FileType:     event.FileType,
+			CreationDate: utils.DBTimeNow(),
+			LastUpdate:   utils.DBTimeNow(),
+		}
+		if err = tx.Insert(&upload); err != nil {
+			log.Errorf("Unable to create upload, %v", err)
+			return "", http.StatusBadRequest
+		}
+	} else if err != nil {
+		log.Errorf("Unable to search for upload, %v", err)
+		return "", http.StatusBadRequest
+	} else if upload.LastUpdate+config.Uploads.Expiration < utils.DBTimeNow() ||
+		!utils.CheckExists(uploadPartPath(config.UploadPath, upload.ID)) {
+		// Too old, or we lost what we had, so start over
+		if err = restartUpload(tx, config.UploadPath, &upload); err != nil {
+			log.Errorf("Unable to restart upload %d, %v", upload.ID, err)
+			return "", http.StatusBadRequest
+		}
+	}
+
+	if err = tx.Commit(); err != nil {
+		log.Errorf("Unable to commit upload %d, %v", upload.ID, err)
+		return "", http.StatusBadRequest
+	}
+
+	contents, err := json.Marshal(uploadStatus{
+		UploadID:     upload.ID,
+		Offset:       upload.Offset,
+		MaxChunkSize: config.Uploads.MaxChunkSize,
+	})
+	if err != nil {
+		log.Errorf("Unable to marshal json")
+		return "", http.StatusBadRequest
+	}
+
+	return string(contents), http.StatusOK
+}
+
+// UploadChunk receives the bytes of a chunked upload.
+// The SystemUUID, CustomerUUID, and UploadID are given as query parameters as the body is the raw file data.
+func (controller *Controller) UploadChunk(c web.C, r *http.Request) (string, int) {
+	db := controller.GetDatabase(c)
+	config := controller.GetConfiguration(c)
+
+	query := r.URL.Query()
+	systemID, err := controller.getSystemID(c, query.Get("SystemUUID"), query.Get("CustomerUUID"))
+	if err != nil {
+		log.Errorf("Unable to parse get System ID, %v", err)
+		return "", http.StatusBadRequest
+	}
+
+	uploadID, err := strconv.ParseInt(query.Get("UploadID"), 10, 64)
+	if err != nil {
+		log.Errorf("Unable to parse upload ID, %v", err)
+		return "", http.StatusBadRequest
+	}
+
+	// Hold the upload's row until the chunk is written, so two requests for the same upload can't both write at its offset
+	tx, err := db.Begin()
+	if err != nil {
+		log.Errorf("Unable to start transaction, %v", err)
+		return "", http.StatusBadRequest
+	}
+	defer tx.Rollback() // Does nothing once committed
+
+	upload, err := lockFileUpload(tx, uploadID, systemID)
+	if err != nil {
+		log.Errorf("Unable to find upload %d, %v", uploadID, err)
+		return "", http.StatusBadRequest
+	}
+
+	// Check the range is the next piece of the file
+	matches := contentRangeRegex.FindStringSubmatch(r.Header.Get("Content-Range"))
+	if matches == nil {
+		log.Errorf("Missing or malformed Content-Range for upload %d", uploadID)
+		return "", http.StatusBadRequest
+	}
+	start, _ := strconv.ParseInt(matches[1], 10, 64)
+	end, _ := strconv.ParseInt(matches[2], 10, 64)
+	total, _ := strconv.ParseInt(matches[3], 10, 64)
+	length := end - start + 1
+
+	if total != upload.Size || end >= upload.Size || length <= 0 || length > config.Uploads.MaxChunkSize {
+		log.Errorf("Bad range for upload %d (%d-%d/%d of %d)", uploadID, start, end, total, upload.Size)
+		return "", http.StatusBadRequest
+	}
+
+	status := uploadStatus{
+		UploadID:     upload.ID,
+		Offset:       upload.Offset,
+		MaxChunkSize: config.Uploads.MaxChunkSize,
+	}
+	if start != upload.Offset {
+		// Tell the agent where to continue from
+		contents, _ := json.Marshal(status)
+		return string(contents), http.StatusConflict
+	}
+
+	// Pick up the hash where the last chunk left off
+	hasher := sha256.New()
+	if upload.HashState != nil {
+		if err = hasher.(encoding.BinaryUnmarshaler).UnmarshalBinary(upload.HashState); err != nil {
+			log.Errorf("Unable to restore hash state of upload %d, %v", uploadID, err)
+			if restartUpload(tx, config.UploadPath, upload) == nil {
+				tx.Commit()
+			}
+			return "", http.StatusBadRequest
+		}
+	}
+
+	outfile, err := os.OpenFile(uploadPartPath(config.UploadPath, upload.ID), os.O_WRONLY|os.O_CREATE, 0600)
+	if err != nil {
+		log.Errorf("Unable to open upload file, %v", err)
+		return "", http.StatusBadRequest
+	}
+	defer outfile.Close()
+
+	// Throw away anything past what we committed, which can be left over from a crash
+	if err = outfile.Truncate(upload.Offset); err != nil {
+		log.Errorf("Unable to truncate upload file, %v", err)
+		return "", http.StatusBadRequest
+	}
+	if _, err = outfile.Seek(upload.Offset, 0); err != nil {
+		log.Errorf("Unable to seek upload file, %v", err)
+		return "", http.StatusBadRequest
+	}
+
+	// Stream to disk while hashing.  A dropped connection still keeps whatever arrived, which is checked along with
+	// the rest of the file against its sha256 once everything has arrived.
+	written, copyErr := io.Copy(io.MultiWriter(outfile, hasher), io.LimitReader(r.Body, length))
+	if copyErr == nil && written == length {
+		// Read to the end of the body, which is when a signed body is checked against its sha256
+		var extra int64
+		if extra, copyErr = io.CopyN(ioutil.Discard, r.Body, 1); extra != 0 {
+			log.Errorf("Chunk of upload %d is longer than its range", uploadID)
+			return "", http.StatusBadRequest
+		} else if copyErr == io.EOF {
+			copyErr = nil
+		}
+	}
+	if copyErr == utils.ErrBodyMismatch {
+		log.Errorf("Chunk of upload %d does not match its signature", uploadID)
+		return "", http.StatusBadRequest
+	}
+	if written == 0 && copyErr != nil {
+		log.Errorf("Unable to read chunk of upload %d, %v", uploadID, copyErr)
+		return "", http.StatusBadRequest
+	}
+
+	if err = outfile.Sync(); err != nil {
+		log.Errorf("Unable to sync upload file, %v", err)
+		return "", http.StatusBadRequest
+	}
+
+	hashState, err := hasher.(encoding.BinaryMarshaler).MarshalBinary()
+	if err != nil {
+		log.Errorf("Unable to save hash state of upload %d, %v", uploadID, err)
+		return "", http.StatusBadRequest
+	}
+
+	upload.Offset += written
+	upload.HashState = hashState
+	upload.LastUpdate = utils.DBTimeNow()
+	if _, err = tx.Update(upload); err != nil {
+		log.Errorf("Unable to update upload %d, %v", uploadID, err)
+		return "", http.StatusBadRequest
+	}
+
+	// Once everything has arrived, check the hash right away so a bad upload is retried sooner
+	if upload.Offset == upload.Size && !bytes.Equal(hasher.Sum(nil), upload.Sha256) {
+		log.Errorf("Hash of upload %d did not match expected value, starting over", uploadID)
+		if restartUpload(tx, config.UploadPath, upload) == nil {
+			tx.Commit()
+		}
+		return "", http.StatusBadRequest
+	}
+
+	if err = tx.Commit(); err != nil {
+		log.Errorf("Unable to commit upload %d, %v", uploadID, err)
+		return "", http.StatusBadRequest
+	}
+
+	if copyErr != nil || written != length {
+		log.Warningf("Only received %d of %d bytes for upload %d, %v", written, length, uploadID, copyErr)
+	}
+
+	status.Offset = upload.Offset
+	contents, err := json.Marshal(status)
+	if err != nil {
+		log.Errorf("Unable to marshal json")
+		return "", http.StatusBadRequest
+	}
+
+	return string(contents), http.StatusOK
+}
+
+// UploadFinalize checks a chunked upload is complete and hands it off to be stored and analyzed
+func (controller *Controller) UploadFinalize(c web.C, r *http.Request) (string, int) {
+	db := controller.GetDatabase(c)
+	config := controller.GetConfiguration(c)
+
+	// Parse body into json
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		log.Errorf("Unable to read body")
+		return "", http.StatusBadRequest
+	}
+
+	type eventFromClient struct {
+		SystemUUID        string
+		CustomerUUID      string
+		CurrentClientTime int64
+		UploadID          int64
+	}
+
+	var event eventFromClient
+	err = json.Unmarshal(body, &event)
+	if err != nil {
+		log.Errorf("Unable to unmarshal json, %v", err)
+		return "", http.StatusBadRequest
+	}
+
+	systemID, err := controller.getSystemID(c, event.SystemUUID, event.CustomerUUID)
+	if err != nil {
+		log.Errorf("Unable to parse get System ID, %v", err)
+		return "", http.StatusBadRequest
+	}
+
+	upload, err := getFileUpload(db, event.UploadID, systemID)
+	if err != nil {
+		log.Errorf("Unable to find upload %d, %v", event.UploadID, err)
+		return "", http.StatusBadRequest
+	}
+
+	if upload.Offset != upload.Size {
+		log.Errorf("Upload %d is not complete (%d of %d bytes)", upload.ID, upload.Offset, upload.Size)
+		return "", http.StatusBadRequest
+	}
+
+	partPath := uploadPartPath(config.UploadPath, upload.ID)
+	infile, err := os.Open(partPath)
+	if err != nil {
+		log.Errorf("Unable to open upload file, %v", err)
+		restartUpload(db, config.UploadPath, upload)
+		return "", http.StatusBadRequest
+	}
+	defer infile.Close()
+
+	// Check the whole file, not just the saved hash state
+	sha256OfUpload, err := utils.Sha256File(infile)
+	if err != nil {
+		log.Errorf("Unable to hash uploaded file, %v", err)
+		return "", http.StatusBadRequest
+	}
+	if !bytes.Equal(sha256OfUpload, upload.Sha256) {
+		log.Errorf("Hash of upload %d did not match expected value, starting over", upload.ID)
+		restartUpload(db, config.UploadPath, upload)
+		return "", http.StatusBadRequest
+	}
+
+	err = controller.recordUploadedFile(c, upload.FileType, hex.EncodeToString(upload.Sha256), upload.Sha256, infile, upload.Size)
+	if err != nil {
+		log.Errorf("Unable to record uploaded file, %v", err)
+		return "", http.StatusBadRequest
+	}
+
+	// Everything worked, so clean up
+	os.Remove(partPath)
+	if _, err = db.Delete(upload); err != nil {
+		log.Errorf("Unable to delete upload %d, %v", upload.ID, err)
+	}
+
+	return controller.GenerateResponseToAgent(c, systemID, command.Nop())
+}
@@ -0,0 +1,98 @@
+////////////////////////////////////////////////////////////////////////////
+//
+// Summit Route End Point Protection
+//
+// This source code is licensed under the BSD-style license found in the
+// LICENSE file in the root directory of this source tree.
+//
+/////////////////////////////////////////////////////////////////////////////
+
+package api
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+
+	log "github.com/Sirupsen/logrus"
+	_ "github.com/lib/pq" // Needed for gorp
+	"github.com/zenazn/goji/web"
+
+	"qdserver/lib/command"
+	"qdserver/lib/models"
+	"qdserver/lib/utils"
+)
+
+// DriverLoadEvent route is called by clients when a driver is loaded
+//
+// Test with: curl -d '{"SystemUUID":"631a838a-9509-46de-7612-91f0a246cce9","CustomerUUID":"3d794551-91a0-4db4-6296-ffcbfc5577f9","CurrentClientTime":1,"TimeOfEvent":1,"Path":"c:\\windows\\system32\\drivers\\this.sys","Md5":"4ec38625fdb2bd3cf7e237f4b1387c04","Sha1":"142124bc228f603235f537298a893a95b6af5e28","Sha256":"5e2091457a435e68cc669189432635442360d70cf3f44880ccf1bd35ef393be1"}' http://127.0.0.1:8080/api/v1/DriverLoadEvent
+func (controller *Controller) DriverLoadEvent(c web.C, r *http.Request) (string, int) {
+	// Parse body into json
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		log.Errorf("Unable to read body")
+		return "", http.StatusBadRequest
+	}
+
+	type eventFromClient struct {
+		SystemUUID        string
+		CustomerUUID      string
+		CurrentClientTime int64
+		TimeOfEvent       int64
+		executableFromClient
+	}
+
+	var event eventFromClient
+	err = json.Unmarshal(body, &event)
+	if err != nil {
+		log.Errorf("Unable to unmarshal json, %v", err)
+		return "", http.StatusBadRequest
+	}
+
+	db := controller.GetDatabase(c)
+
+	systemID, err := controller.getSystemID(c, event.SystemUUID, event.CustomerUUID)
+	if err != nil {
+		log.Errorf("Unable to find ID for System %s (customer: %s), %v", event.SystemUUID, event.CustomerUUID, err)
+		return "", http.StatusBadRequest
+	}
+
+	log.Infof("DriverLoadEvent from system: %d\n", systemID)
+
+	timeOfEvent := (utils.DBTimeNow() - event.CurrentClientTime) + event.TimeOfEvent
+
+	executableID, err := findOrAddExecutable(db, systemID, event.executableFromClient, models.ExecutionTypeSys, timeOfEvent)
+	if err != nil {
+		log.Errorf("Unable to add driver, %v", err)
+		return "", http.StatusBadRequest
+	}
+
+	filePathID, err := utils.InternFilePath(db, event.Path)
+	if err != nil {
+		log.Errorf("Unable to store path, %v", err)
+		return "", http.StatusBadRequest
+	}
+
+	// Stash the event in the DB
+	driverLoadEventInsert := &models.DriverLoadEvent{
+		SystemID:         systemID,
+		ExecutableFileID: executableID,
+		FilePathID:       filePathID,
+		EventTime:        timeOfEvent,
+	}
+
+	if err = db.Insert(driverLoadEventInsert); err != nil {
+		log.Errorf("Error while creating driverLoadEvent: %v", err)
+		return "", http.StatusBadRequest
+	}
+
+	//
+	// Record this file was seen on this system
+	//
+	if err = utils.RecordFileSeenOnSystem(db, executableID, systemID, timeOfEvent, filePathID); err != nil {
+		log.Errorf("Error adding file to fileToSystemMap: %v", err)
+		return "", http.StatusBadRequest
+	}
+
+	return controller.GenerateResponseToAgent(c, systemID, command.Success())
+}
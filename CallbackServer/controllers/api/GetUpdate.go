@@ -14,17 +14,18 @@ import (
 	"fmt"
 	"io/ioutil"
 	"net/http"
-	"path"
-	"qdserver/lib/utils"
 
 	log "github.com/Sirupsen/logrus"
 	_ "github.com/lib/pq" // Needed for gorp
 	"github.com/zenazn/goji/web"
+
+	"qdserver/lib/storage"
 )
 
 // GetUpdate route
 func (controller *Controller) GetUpdate(c web.C, r *http.Request) (string, int) {
 	db := controller.GetDatabase(c)
+	stores := controller.GetStores(c)
 
 	// Parse body into json
 	body, err := ioutil.ReadAll(r.Body)
@@ -62,17 +63,12 @@ func (controller *Controller) GetUpdate(c web.C, r *http.Request) (string, int)
 	}
 
 	updaterName := fmt.Sprintf("update-%s-%s.exe", clientData.Version, UpdateToVersion)
-	updatePath := path.Join("updates", updaterName)
 
-	if !utils.CheckExists(updatePath) {
-		// TODO Need to get file from S3 to local
-		log.Errorf("Update file does not exist: %v", err)
+	contents, err := storage.ReadAll(stores.Updates, updaterName)
+	if err == storage.ErrNotFound {
+		log.Errorf("Update file does not exist: %s", updaterName)
 		return "", http.StatusBadRequest
-	}
-
-	// File should now exist so read it
-	contents, err := ioutil.ReadFile(updatePath)
-	if err != nil {
+	} else if err != nil {
 		log.Errorf("Unable to read file, %v", err)
 		return "", http.StatusBadRequest
 	}
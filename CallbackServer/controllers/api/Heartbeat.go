@@ -13,17 +13,22 @@ import (
 	"encoding/json"
 	"io/ioutil"
 	"net/http"
+	"strings"
 
 	log "github.com/Sirupsen/logrus"
 	_ "github.com/lib/pq" // Needed for gorp
 	"github.com/zenazn/goji/web"
 
-	"qdserver/CallbackServer/command"
+	"qdserver/lib/command"
+	"qdserver/lib/models"
 	"qdserver/lib/utils"
 )
 
+// bootTimeSlack is how many seconds the boot time worked out from the agent's uptime can move before we believe it rebooted
+const bootTimeSlack = 60
+
 // Heartbeat route
-// curl -d '{"SystemUUID":"29c0b4f4-d6ab-46d8-604a-268863059f76","CustomerUUID":"3d794551-91a0-4db4-6296-ffcbfc5577f9","CurrentClientTime":1415296881 }' http://127.0.0.1:8080/api/v1/Heartbeat
+// curl -d '{"SystemUUID":"29c0b4f4-d6ab-46d8-604a-268863059f76","CustomerUUID":"3d794551-91a0-4db4-6296-ffcbfc5577f9","CurrentClientTime":1415296881,"PolicyVersion":0,"ProtocolVersion":2 }' http://127.0.0.1:8080/api/v1/Heartbeat
 func (controller *Controller) Heartbeat(c web.C, r *http.Request) (string, int) {
 	// Parse body into json
 	body, err := ioutil.ReadAll(r.Body)
@@ -36,6 +41,17 @@ func (controller *Controller) Heartbeat(c web.C, r *http.Request) (string, int)
 		SystemUUID        string
 		CustomerUUID      string
 		CurrentClientTime int64
+		PolicyVersion     int64    // Version of the policy the agent is enforcing, 0 if it has none
+		ProtocolVersion   int      // 0 for agents from before versioning
+		Commands          []string // Commands the agent supports, or empty for the defaults of its protocol version
+
+		// Inventory, which older agents don't send
+		AgentVersion string
+		OSHumanName  string
+		OSVersion    string
+		IPAddresses  []string
+		LoggedOnUser string
+		Uptime       int64 // Seconds since the system booted
 	}
 	var heartbeat Heartbeat
 	err = json.Unmarshal(body, &heartbeat)
@@ -46,12 +62,85 @@ func (controller *Controller) Heartbeat(c web.C, r *http.Request) (string, int)
 
 	db := controller.GetDatabase(c)
 
-	systemID, err := utils.GetSystemIDFromUUID(db, heartbeat.SystemUUID, heartbeat.CustomerUUID)
+	systemID, err := controller.getSystemID(c, heartbeat.SystemUUID, heartbeat.CustomerUUID)
 	if err != nil {
 		log.Errorf("Unable to parse get System ID, %v", err)
 		return "", http.StatusBadRequest
 	}
 	log.Infof("SystemID: %d", systemID)
 
-	return GenerateResponseToAgent(db, systemID, command.Nop())
+	var system models.System
+	err = db.SelectOne(&system, "select * from systems where ID=:id",
+		map[string]interface{}{
+			"id": systemID,
+		})
+	if err != nil {
+		log.Errorf("Unable to find system %d, %v", systemID, err)
+		return "", http.StatusBadRequest
+	}
+
+	// Agents may have been updated since we last heard from them
+	before := system
+	changed := command.NewAgentCapabilities(heartbeat.ProtocolVersion, heartbeat.Commands).Record(&system)
+	if system.ProtocolVersion != before.ProtocolVersion {
+		log.Infof("System %d now speaks protocol version %d", systemID, system.ProtocolVersion)
+	}
+
+	if applyHeartbeatInventory(&system, heartbeat.AgentVersion, heartbeat.OSHumanName, heartbeat.OSVersion,
+		heartbeat.IPAddresses, heartbeat.LoggedOnUser, heartbeat.Uptime) {
+		changed = true
+	}
+
+	if changed {
+		if err = utils.RecordSystemChanges(db, &before, &system); err != nil {
+			log.Errorf("Unable to record history of system %d, %v", systemID, err)
+			return "", http.StatusBadRequest
+		}
+		// Only what the heartbeat reports, so we don't overwrite changes made meanwhile, such as a new PolicyID
+		_, err = db.Exec(`UPDATE systems SET ProtocolVersion=$1, Capabilities=$2, AgentVersion=$3, OSHumanName=$4, OSVersion=$5,
+			IPAddresses=$6, LoggedOnUser=$7, LastBootTime=$8 WHERE ID=$9`,
+			system.ProtocolVersion, system.Capabilities, system.AgentVersion, system.OSHumanName, system.OSVersion,
+			system.IPAddresses, system.LoggedOnUser, system.LastBootTime, system.ID)
+		if err != nil {
+			log.Errorf("Unable to update system %d, %v", systemID, err)
+			return "", http.StatusBadRequest
+		}
+	}
+
+	// Make sure the agent is converging on the policy it should be running
+	if err = command.CheckAgentPolicy(db, &system, heartbeat.PolicyVersion); err != nil {
+		log.Errorf("Unable to check policy for system %d, %v", systemID, err)
+	}
+
+	return controller.GenerateResponseToAgent(c, systemID, command.Nop())
+}
+
+// applyHeartbeatInventory copies the inventory the agent sent onto the system.  Fields the agent left out are left alone.
+// Returns true if anything changed.
+func applyHeartbeatInventory(system *models.System, agentVersion string, osHumanName string, osVersion string,
+	ipAddresses []string, loggedOnUser string, uptime int64) bool {
+	changed := false
+	setString := func(field *string, value string) {
+		if value != "" && *field != value {
+			*field = value
+			changed = true
+		}
+	}
+
+	setString(&system.AgentVersion, agentVersion)
+	setString(&system.OSHumanName, osHumanName)
+	setString(&system.OSVersion, osVersion)
+	setString(&system.IPAddresses, strings.Join(ipAddresses, ","))
+	setString(&system.LoggedOnUser, loggedOnUser)
+
+	// The boot time drifts a little with each heartbeat, so only take it when the system has rebooted
+	if uptime > 0 {
+		bootTime := utils.DBTimeNow() - uptime
+		if bootTime-system.LastBootTime > bootTimeSlack || system.LastBootTime-bootTime > bootTimeSlack {
+			system.LastBootTime = bootTime
+			changed = true
+		}
+	}
+
+	return changed
 }
@@ -0,0 +1,125 @@
+////////////////////////////////////////////////////////////////////////////
+//
+// Summit Route End Point Protection
+//
+// This source code is licensed under the BSD-style license found in the
+// LICENSE file in the root directory of this source tree.
+//
+/////////////////////////////////////////////////////////////////////////////
+
+package api
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/coopernurse/gorp"
+	_ "github.com/lib/pq" // Needed for gorp
+	"github.com/zenazn/goji/web"
+
+	"qdserver/lib/command"
+	"qdserver/lib/models"
+	"qdserver/lib/utils"
+)
+
+// findHostProcessEvent returns the ID of the ProcessEvent of the process with the PID that was running at the time,
+// or 0 if we don't have it.  As PIDs are reused, the latest process to start before then that hadn't exited is used.
+func findHostProcessEvent(db gorp.SqlExecutor, systemID int64, pid int64, timeOfEvent int64) (int64, error) {
+	return db.SelectInt(`SELECT ID
+		FROM ProcessEvents
+		WHERE SystemID=:systemID and PID=:pid and EventTime<=:latest and (State!=:exited or EndTime>=:timeOfEvent)
+		ORDER BY EventTime DESC
+		LIMIT 1`,
+		map[string]interface{}{
+			"systemID":    systemID,
+			"pid":         pid,
+			"exited":      models.ProcessStateExited,
+			"timeOfEvent": timeOfEvent,
+			"latest":      timeOfEvent + processStartSlack,
+		})
+}
+
+// ModuleLoadEvent route is called by clients when a DLL is loaded into a process
+//
+// Test with: curl -d '{"SystemUUID":"631a838a-9509-46de-7612-91f0a246cce9","CustomerUUID":"3d794551-91a0-4db4-6296-ffcbfc5577f9","CurrentClientTime":1,"TimeOfEvent":1,"PID":1,"Path":"c:\\windows\\system32\\this.dll","Md5":"4ec38625fdb2bd3cf7e237f4b1387c04","Sha1":"142124bc228f603235f537298a893a95b6af5e28","Sha256":"5e2091457a435e68cc669189432635442360d70cf3f44880ccf1bd35ef393be1"}' http://127.0.0.1:8080/api/v1/ModuleLoadEvent
+func (controller *Controller) ModuleLoadEvent(c web.C, r *http.Request) (string, int) {
+	// Parse body into json
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		log.Errorf("Unable to read body")
+		return "", http.StatusBadRequest
+	}
+
+	type eventFromClient struct {
+		SystemUUID        string
+		CustomerUUID      string
+		CurrentClientTime int64
+		TimeOfEvent       int64
+		PID               int64 // Process the module was loaded into
+		executableFromClient
+	}
+
+	var event eventFromClient
+	err = json.Unmarshal(body, &event)
+	if err != nil {
+		log.Errorf("Unable to unmarshal json, %v", err)
+		return "", http.StatusBadRequest
+	}
+
+	db := controller.GetDatabase(c)
+
+	systemID, err := controller.getSystemID(c, event.SystemUUID, event.CustomerUUID)
+	if err != nil {
+		log.Errorf("Unable to find ID for System %s (customer: %s), %v", event.SystemUUID, event.CustomerUUID, err)
+		return "", http.StatusBadRequest
+	}
+
+	log.Infof("ModuleLoadEvent from system: %d\n", systemID)
+
+	timeOfEvent := (utils.DBTimeNow() - event.CurrentClientTime) + event.TimeOfEvent
+
+	executableID, err := findOrAddExecutable(db, systemID, event.executableFromClient, models.ExecutionTypeDll, timeOfEvent)
+	if err != nil {
+		log.Errorf("Unable to add module, %v", err)
+		return "", http.StatusBadRequest
+	}
+
+	processEventID, err := findHostProcessEvent(db, systemID, event.PID, timeOfEvent)
+	if err != nil {
+		log.Errorf("Unable to find process %d the module was loaded into, %v", event.PID, err)
+		return "", http.StatusBadRequest
+	}
+
+	filePathID, err := utils.InternFilePath(db, event.Path)
+	if err != nil {
+		log.Errorf("Unable to store path, %v", err)
+		return "", http.StatusBadRequest
+	}
+
+	// Stash the event in the DB
+	moduleLoadEventInsert := &models.ModuleLoadEvent{
+		SystemID:         systemID,
+		ExecutableFileID: executableID,
+		ProcessEventID:   processEventID,
+		PID:              event.PID,
+		FilePathID:       filePathID,
+		EventTime:        timeOfEvent,
+	}
+
+	if err = db.Insert(moduleLoadEventInsert); err != nil {
+		log.Errorf("Error while creating moduleLoadEvent: %v", err)
+		return "", http.StatusBadRequest
+	}
+
+	//
+	// Record this file was seen on this system
+	//
+	if err = utils.RecordFileSeenOnSystem(db, executableID, systemID, timeOfEvent, filePathID); err != nil {
+		log.Errorf("Error adding file to fileToSystemMap: %v", err)
+		return "", http.StatusBadRequest
+	}
+
+	return controller.GenerateResponseToAgent(c, systemID, command.Success())
+}
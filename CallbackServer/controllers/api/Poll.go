@@ -0,0 +1,86 @@
+////////////////////////////////////////////////////////////////////////////
+//
+// Summit Route End Point Protection
+//
+// This source code is licensed under the BSD-style license found in the
+// LICENSE file in the root directory of this source tree.
+//
+/////////////////////////////////////////////////////////////////////////////
+
+package api
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	_ "github.com/lib/pq" // Needed for gorp
+	"github.com/zenazn/goji/web"
+
+	"qdserver/lib/command"
+)
+
+// Poll route is held open by the agent until there is a task for it, or until the wait runs out, so tasks reach
+// the agent right away instead of on its next heartbeat.  The agent should poll again as soon as this returns.
+// The WebServer and commander wake the poll through the wake exchange on the queue when they add a task.
+//
+// Test with: curl -d '{"SystemUUID":"631a838a-9509-46de-7612-91f0a246cce9","CustomerUUID":"3d794551-91a0-4db4-6296-ffcbfc5577f9","CurrentClientTime":1,"Wait":30}' http://127.0.0.1:8080/api/v1/Poll
+func (controller *Controller) Poll(c web.C, r *http.Request) (string, int) {
+	// Parse body into json
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		log.Errorf("Unable to read body")
+		return "", http.StatusBadRequest
+	}
+
+	type pollFromClient struct {
+		SystemUUID        string
+		CustomerUUID      string
+		CurrentClientTime int64
+		Wait              int64 // Seconds the agent is willing to wait, which we may cut short
+	}
+
+	var poll pollFromClient
+	err = json.Unmarshal(body, &poll)
+	if err != nil {
+		log.Errorf("Unable to unmarshal json, %v", err)
+		return "", http.StatusBadRequest
+	}
+
+	db := controller.GetDatabase(c)
+	config := controller.GetConfiguration(c)
+
+	systemID, err := controller.getSystemID(c, poll.SystemUUID, poll.CustomerUUID)
+	if err != nil {
+		log.Errorf("Unable to find ID for System %s (customer: %s), %v", poll.SystemUUID, poll.CustomerUUID, err)
+		return "", http.StatusBadRequest
+	}
+
+	wait := poll.Wait
+	if wait <= 0 || wait > config.Poll.MaxWait {
+		wait = config.Poll.MaxWait
+	}
+
+	// Register before looking for tasks, so a task added in between still wakes us
+	waiters := controller.GetWaiters(c)
+	wake := waiters.Add(systemID)
+	defer waiters.Remove(systemID, wake)
+
+	waiting, err := hasTasksWaiting(db, config.Tasks, systemID)
+	if err != nil {
+		log.Errorf("Unable to check tasks for system %d, %v", systemID, err)
+		return "", http.StatusBadRequest
+	}
+
+	if !waiting {
+		select {
+		case <-wake:
+			log.Infof("Poll from system %d woken", systemID)
+		case <-time.After(time.Duration(wait) * time.Second):
+		}
+	}
+
+	return controller.GenerateResponseToAgent(c, systemID, command.Nop())
+}
@@ -10,7 +10,6 @@
 package api
 
 import (
-	"encoding/hex"
 	"encoding/json"
 	"io/ioutil"
 	"net/http"
@@ -19,7 +18,7 @@ import (
 	_ "github.com/lib/pq" // Needed for gorp
 	"github.com/zenazn/goji/web"
 
-	"qdserver/CallbackServer/command"
+	"qdserver/lib/command"
 	"qdserver/lib/models"
 	"qdserver/lib/utils"
 )
@@ -43,13 +42,8 @@ func (controller *Controller) ProcessEvent(c web.C, r *http.Request) (string, in
 		Type              int
 		PID               int64
 		PPID              int64
-		Path              string
 		CommandLine       string
-		Md5               string
-		Sha1              string
-		Sha256            string // Sha256 of the file
-		Size              int
-		IsSigned          bool
+		executableFromClient
 	}
 
 	var event eventFromClient
@@ -61,7 +55,7 @@ func (controller *Controller) ProcessEvent(c web.C, r *http.Request) (string, in
 
 	db := controller.GetDatabase(c)
 
-	systemID, err := utils.GetSystemIDFromUUID(db, event.SystemUUID, event.CustomerUUID)
+	systemID, err := controller.getSystemID(c, event.SystemUUID, event.CustomerUUID)
 	if err != nil {
 		log.Errorf("Unable to find ID for System %s (customer: %s), %v", event.SystemUUID, event.CustomerUUID, err)
 		return "", http.StatusBadRequest
@@ -69,69 +63,26 @@ func (controller *Controller) ProcessEvent(c web.C, r *http.Request) (string, in
 
 	log.Infof("ProcessEvent from system: %d\n", systemID)
 
-	// Add the Executable to the DB
-	Md5, err := hex.DecodeString(event.Md5)
-	if err != nil {
-		log.Errorf("Unable to decode MD5: %v", err)
-		return "", http.StatusBadRequest
-	}
+	timeOfEvent := (utils.DBTimeNow() - event.CurrentClientTime) + event.TimeOfEvent
 
-	Sha1, err := hex.DecodeString(event.Sha1)
+	// Add the Executable to the DB
+	executableID, err := findOrAddExecutable(db, systemID, event.executableFromClient, models.ExecutionTypeExe, timeOfEvent)
 	if err != nil {
-		log.Errorf("Unable to decode Sha1: %v", err)
+		log.Errorf("Unable to add executable, %v", err)
 		return "", http.StatusBadRequest
 	}
 
-	Sha256, err := hex.DecodeString(event.Sha256)
+	filePathID, err := utils.InternFilePath(db, event.Path)
 	if err != nil {
-		log.Errorf("Unable to decode Sha256: %v", err)
+		log.Errorf("Unable to store path, %v", err)
 		return "", http.StatusBadRequest
 	}
 
-	timeOfEvent := (utils.DBTimeNow() - event.CurrentClientTime) + event.TimeOfEvent
-
-	// Check if we've seen this executable before
-	var executableID int64
-	executableID, err = db.SelectInt(`SELECT ID
-		FROM ExecutableFiles
-		WHERE Sha256=:sha256`,
-		map[string]interface{}{
-			"sha256": Sha256,
-		})
+	commandLineID, err := utils.InternCommandLine(db, event.CommandLine)
 	if err != nil {
-		log.Errorf("Error checking for file: %v", err)
+		log.Errorf("Unable to store command line, %v", err)
 		return "", http.StatusBadRequest
 	}
-	if executableID == 0 {
-		log.Infof("New file, adding it to the DB")
-
-		// Assuming executable has not been found, so adding it to the DB
-		executableFileInsert := &models.ExecutableFile{
-			Md5:       Md5,
-			Sha1:      Sha1,
-			Sha256:    Sha256,
-			Size:      event.Size,
-			FirstSeen: timeOfEvent,
-			IsSigned:  event.IsSigned,
-		}
-
-		// Save it
-		if err = db.Insert(executableFileInsert); err != nil {
-			// If you get an error about duplicate values, one fix is to run: select setval('executablefiles_id_seq', (select max(id) + 1 from executablefiles));
-			// I don't know why it forget about that sequence number
-			log.Errorf("Error while creating executable file: %v", err)
-			return "", http.StatusBadRequest
-		}
-
-		executableID = executableFileInsert.ID
-
-		// Create a task to tell this agent to get that file
-		agentCommand := command.GetFileByHash(event.Sha256)
-		if err = command.AddTask(db, systemID, agentCommand); err != nil {
-			log.Errorf("Unable to add task for agent, %v", err)
-			return "", http.StatusBadRequest
-		}
-	}
 
 	// Stash the event in the DB
 	processEventInsert := &models.ProcessEvent{
@@ -139,9 +90,10 @@ func (controller *Controller) ProcessEvent(c web.C, r *http.Request) (string, in
 		ExecutableFileID: executableID,
 		PID:              event.PID,
 		PPID:             event.PPID,
-		FilePath:         event.Path,
-		CommandLine:      event.CommandLine,
+		FilePathID:       filePathID,
+		CommandLineID:    commandLineID,
 		EventTime:        timeOfEvent,
+		State:            models.ProcessStateRunning,
 	}
 
 	// Save it
@@ -153,10 +105,10 @@ func (controller *Controller) ProcessEvent(c web.C, r *http.Request) (string, in
 	//
 	// Record this file was seen on this system
 	//
-	if err = utils.RecordFileSeenOnSystem(db, executableID, systemID, timeOfEvent, event.Path); err != nil {
+	if err = utils.RecordFileSeenOnSystem(db, executableID, systemID, timeOfEvent, filePathID); err != nil {
 		log.Errorf("Error adding file to fileToSystemMap: %v", err)
 		return "", http.StatusBadRequest
 	}
 
-	return GenerateResponseToAgent(db, systemID, command.Success())
+	return controller.GenerateResponseToAgent(c, systemID, command.Success())
 }
@@ -0,0 +1,116 @@
+////////////////////////////////////////////////////////////////////////////
+//
+// Summit Route End Point Protection
+//
+// This source code is licensed under the BSD-style license found in the
+// LICENSE file in the root directory of this source tree.
+//
+/////////////////////////////////////////////////////////////////////////////
+
+package api
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/coopernurse/gorp"
+	_ "github.com/lib/pq" // Needed for gorp
+	"github.com/zenazn/goji/web"
+
+	"qdserver/lib/command"
+	"qdserver/lib/models"
+	"qdserver/lib/utils"
+)
+
+// processStartSlack is how many seconds the start time of an exiting process may be off from the start event we
+// recorded, as both are adjusted for the agent's clock, which may have drifted in between
+const processStartSlack = 10
+
+// recordProcessExit finds the start event of the process and marks it exited.  Processes are matched on the PID and
+// start time, as PIDs are reused.  Returns false if no running process matched.  The db may be a transaction.
+func recordProcessExit(db gorp.SqlExecutor, systemID int64, pid int64, startTime int64, endTime int64, exitCode int64) (bool, error) {
+	var processEvents []models.ProcessEvent
+	_, err := db.Select(&processEvents, `SELECT *
+		FROM ProcessEvents
+		WHERE SystemID=:systemID and PID=:pid and State=:running and EventTime>=:earliest and EventTime<=:latest
+		ORDER BY abs(EventTime - :startTime)
+		LIMIT 1`,
+		map[string]interface{}{
+			"systemID":  systemID,
+			"pid":       pid,
+			"running":   models.ProcessStateRunning,
+			"earliest":  startTime - processStartSlack,
+			"latest":    startTime + processStartSlack,
+			"startTime": startTime,
+		})
+	if err != nil {
+		return false, err
+	}
+	if len(processEvents) == 0 {
+		return false, nil
+	}
+
+	processEvent := processEvents[0]
+	processEvent.State = models.ProcessStateExited
+	processEvent.EndTime = endTime
+	processEvent.ExitCode = exitCode
+	if _, err = db.Update(&processEvent); err != nil {
+		return false, err
+	}
+
+	return true, nil
+}
+
+// ProcessExitEvent route is called by clients when a process exits.  StartTime is the TimeOfEvent the agent sent for
+// the process starting, and together with the PID identifies the process.
+//
+// Test with: curl -d '{"SystemUUID":"631a838a-9509-46de-7612-91f0a246cce9","CustomerUUID":"3d794551-91a0-4db4-6296-ffcbfc5577f9","CurrentClientTime":5,"TimeOfEvent":5,"PID":1,"StartTime":1,"ExitCode":0}' http://127.0.0.1:8080/api/v1/ProcessExitEvent
+func (controller *Controller) ProcessExitEvent(c web.C, r *http.Request) (string, int) {
+	// Parse body into json
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		log.Errorf("Unable to read body")
+		return "", http.StatusBadRequest
+	}
+
+	type eventFromClient struct {
+		SystemUUID        string
+		CustomerUUID      string
+		CurrentClientTime int64
+		TimeOfEvent       int64 // When the process exited
+		PID               int64
+		StartTime         int64
+		ExitCode          int64
+	}
+
+	var event eventFromClient
+	err = json.Unmarshal(body, &event)
+	if err != nil {
+		log.Errorf("Unable to unmarshal json, %v", err)
+		return "", http.StatusBadRequest
+	}
+
+	db := controller.GetDatabase(c)
+
+	systemID, err := controller.getSystemID(c, event.SystemUUID, event.CustomerUUID)
+	if err != nil {
+		log.Errorf("Unable to find ID for System %s (customer: %s), %v", event.SystemUUID, event.CustomerUUID, err)
+		return "", http.StatusBadRequest
+	}
+
+	clockOffset := utils.DBTimeNow() - event.CurrentClientTime
+
+	found, err := recordProcessExit(db, systemID, event.PID, clockOffset+event.StartTime, clockOffset+event.TimeOfEvent, event.ExitCode)
+	if err != nil {
+		log.Errorf("Unable to record exit of process %d on system %d, %v", event.PID, systemID, err)
+		return "", http.StatusBadRequest
+	}
+	if !found {
+		// Nothing the agent can do about it, so don't make it resend
+		log.Warningf("No running process %d on system %d started around %d", event.PID, systemID, clockOffset+event.StartTime)
+	}
+
+	return controller.GenerateResponseToAgent(c, systemID, command.Success())
+}
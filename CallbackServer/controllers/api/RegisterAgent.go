@@ -10,20 +10,173 @@
 package api
 
 import (
+	"bytes"
+	"crypto/hmac"
+	"encoding/hex"
 	"encoding/json"
+	"fmt"
 	"io/ioutil"
 	"net/http"
+	"time"
 
 	log "github.com/Sirupsen/logrus"
+	"github.com/coopernurse/gorp"
 	_ "github.com/lib/pq" // Needed for gorp
 	uuid "github.com/nu7hatch/gouuid"
 	"github.com/zenazn/goji/web"
 
-	"qdserver/CallbackServer/command"
+	"qdserver/CallbackServer/system"
+	"qdserver/lib/agentca"
+	"qdserver/lib/command"
 	"qdserver/lib/models"
 	"qdserver/lib/utils"
 )
 
+// agentRegistration is sent by the agent when it registers
+type agentRegistration struct {
+	CustomerUUID string
+	AgentVersion string
+
+	OSHumanName  string
+	OSVersion    string
+	Manufacturer string
+	Model        string
+	Arch         string
+	MachineName  string
+	MachineGUID  string
+
+	CSR string // PEM encoded certificate request, so we can issue a client certificate
+
+	// A reinstalled agent that kept its old credentials sends them, so its old system can be reused
+	PreviousSystemUUID string
+	PreviousSecret     string // Hex encoded
+
+	ProtocolVersion int      // 0 for agents from before versioning
+	Commands        []string // Commands the agent supports, or empty for the defaults of its protocol version
+}
+
+// apply copies what the agent told us about its machine onto the system
+func (registration *agentRegistration) apply(system *models.System) {
+	system.AgentVersion = registration.AgentVersion
+
+	system.OSHumanName = registration.OSHumanName
+	system.OSVersion = registration.OSVersion
+	system.Manufacturer = registration.Manufacturer
+	system.Model = registration.Model
+	system.Arch = registration.Arch
+	system.MachineName = registration.MachineName
+	system.MachineGUID = registration.MachineGUID
+
+	command.NewAgentCapabilities(registration.ProtocolVersion, registration.Commands).Record(system)
+}
+
+// findDuplicateSystem looks for a system of the customer's on the same machine, which happens when the agent is
+// reinstalled or the machine is re-imaged.  The MachineGUID is checked first, as it survives reinstalling the agent,
+// then the MachineName and hardware, which survive re-imaging.  Systems that already have a successor are skipped.
+// Returns nil if there isn't one.
+func findDuplicateSystem(db *gorp.DbMap, customerID int64, registration *agentRegistration) (*models.System, error) {
+	type match struct {
+		where  string
+		params map[string]interface{}
+	}
+	var matches []match
+
+	if registration.MachineGUID != "" {
+		matches = append(matches, match{
+			"s.MachineGUID=:machineGUID",
+			map[string]interface{}{
+				"machineGUID": registration.MachineGUID,
+			}})
+	}
+	if registration.MachineName != "" {
+		matches = append(matches, match{
+			"s.MachineName=:machineName and s.Manufacturer=:manufacturer and s.Model=:model and s.Arch=:arch",
+			map[string]interface{}{
+				"machineName":  registration.MachineName,
+				"manufacturer": registration.Manufacturer,
+				"model":        registration.Model,
+				"arch":         registration.Arch,
+			}})
+	}
+
+	for _, m := range matches {
+		m.params["customerID"] = customerID
+
+		var systems []models.System
+		_, err := db.Select(&systems, fmt.Sprintf(`SELECT s.*
+			FROM systemSets ss, systems s
+			WHERE ss.CustomerID=:customerID and ss.ID = s.SystemSetID and %s
+			and not exists (SELECT 1 FROM systems successor WHERE successor.PredecessorID = s.ID)
+			ORDER BY s.LastSeen DESC LIMIT 1`, m.where),
+			m.params)
+		if err != nil {
+			return nil, err
+		}
+		if len(systems) != 0 {
+			return &systems[0], nil
+		}
+	}
+
+	return nil, nil
+}
+
+// retireAgentCredentials cuts off the agent that was using a system before it was handed to a new one.
+// Its certificates are revoked and its outstanding tasks are expired.
+func retireAgentCredentials(db *gorp.DbMap, systemID int64) error {
+	_, err := db.Exec("UPDATE agentcertificates SET RevocationDate=$1 WHERE SystemID=$2 and RevocationDate=0", utils.DBTimeNow(), systemID)
+	if err != nil {
+		return err
+	}
+
+	_, err = db.Exec("UPDATE tasks SET State=$1 WHERE SystemID=$2 and (State=$3 or State=$4)",
+		models.TaskStateExpired, systemID, models.TaskStatePending, models.TaskStateDeployed)
+	return err
+}
+
+// canTakeOverSystem returns true if the agent has proven it is the one that was using the system, either with the
+// system's client certificate, or by sending the system's UUID and secret.  Only then may the agent reuse the system
+// or retire it for a successor.  Retired systems are never taken over.
+func canTakeOverSystem(c web.C, duplicate *models.System, registration *agentRegistration) bool {
+	if duplicate.RetiredDate != 0 {
+		return false
+	}
+
+	if authenticatedSystemID, _ := c.Env["AuthenticatedSystemID"].(int64); authenticatedSystemID == duplicate.ID {
+		return true
+	}
+
+	previousSystemUUID, err := utils.UUIDStringToBytes(registration.PreviousSystemUUID)
+	if err != nil || !bytes.Equal(previousSystemUUID, duplicate.SystemUUID) {
+		return false
+	}
+	previousSecret, err := hex.DecodeString(registration.PreviousSecret)
+	if err != nil || len(previousSecret) == 0 {
+		return false
+	}
+	return hmac.Equal(previousSecret, duplicate.Secret) || hmac.Equal(previousSecret, duplicate.PendingSecret)
+}
+
+// newSystemUUID generates a UUID that no other system has
+func newSystemUUID(db *gorp.DbMap) (*uuid.UUID, error) {
+	for {
+		systemUUID, err := uuid.NewV4()
+		if err != nil {
+			return nil, err
+		}
+
+		count, err := db.SelectInt("select count(*) from systems where SystemUUID=:systemUUID",
+			map[string]interface{}{
+				"systemUUID": systemUUID[0:16],
+			})
+		if err != nil {
+			return nil, err
+		}
+		if count == 0 {
+			return systemUUID, nil
+		}
+	}
+}
+
 // RegisterAgent route
 func (controller *Controller) RegisterAgent(c web.C, r *http.Request) (string, int) {
 	// Parse body into json
@@ -33,33 +186,25 @@ func (controller *Controller) RegisterAgent(c web.C, r *http.Request) (string, i
 		return "", http.StatusBadRequest
 	}
 
-	type Registration struct {
-		CustomerUUID string
-		AgentVersion string
-
-		OSHumanName  string
-		OSVersion    string
-		Manufacturer string
-		Model        string
-		Arch         string
-		MachineName  string
-		MachineGUID  string
-	}
-	var registration Registration
+	var registration agentRegistration
 	err = json.Unmarshal(body, &registration)
 	if err != nil {
 		log.Errorf("Unable to unmarshal json")
 		return "", http.StatusBadRequest
 	}
 
-	// Generate SystemUUID for the agent
-	SystemUUID, _ := uuid.NewV4()
-	// TODO Check for collisions on the UUID
-
 	//
 	// Record this in the database
 	//
 	db := controller.GetDatabase(c)
+	config := controller.GetConfiguration(c)
+
+	// Generate SystemUUID for the agent
+	SystemUUID, err := newSystemUUID(db)
+	if err != nil {
+		log.Errorf("Unable to generate system UUID: %v", err)
+		return "", http.StatusBadRequest
+	}
 
 	// Convert Customer UUID into a byte slice
 	customerUUIDslice, err := utils.UUIDStringToBytes(registration.CustomerUUID)
@@ -84,11 +229,14 @@ func (controller *Controller) RegisterAgent(c web.C, r *http.Request) (string, i
 	var systemSet models.SystemSet
 	var systemSetID int64
 
-	err = db.SelectOne(&systemSet, "select * from systemsets where CustomerID=:customerID and Name like :name",
-		map[string]interface{}{
-			"customerID": customer.ID,
-			"name":       "Default",
-		})
+	findDefault := func() error {
+		return db.SelectOne(&systemSet, "select * from systemsets where CustomerID=:customerID and lower(Name)=lower(:name)",
+			map[string]interface{}{
+				"customerID": customer.ID,
+				"name":       "Default",
+			})
+	}
+	err = findDefault()
 	if err != nil {
 		// TODO Need to check the err means "not found" and not something bad
 
@@ -99,12 +247,16 @@ func (controller *Controller) RegisterAgent(c web.C, r *http.Request) (string, i
 			CreationDate: utils.DBTimeNow(),
 		}
 
-		// Save it
+		// Save it.  Names are unique, so if another registration just added it, use theirs.
 		if err = db.Insert(systemSetInsert); err != nil {
-			log.Errorf("Error while creating systemset: %v", err)
-			return "", http.StatusBadRequest
+			if findDefault() != nil {
+				log.Errorf("Error while creating systemset: %v", err)
+				return "", http.StatusBadRequest
+			}
+			systemSetID = systemSet.ID
+		} else {
+			systemSetID = systemSetInsert.ID
 		}
-		systemSetID = systemSetInsert.ID
 	} else {
 		systemSetID = systemSet.ID
 	}
@@ -112,31 +264,138 @@ func (controller *Controller) RegisterAgent(c web.C, r *http.Request) (string, i
 	var SystemUUIDslice []byte
 	SystemUUIDslice = SystemUUID[0:16]
 
-	// Create system DB object
-	systemInsert := &models.System{
-		SystemSetID:  systemSetID,
-		SystemUUID:   SystemUUIDslice,
-		AgentVersion: registration.AgentVersion,
+	// Secret the agent will sign its requests with
+	secret, err := utils.GenerateSecret()
+	if err != nil {
+		log.Errorf("Unable to generate secret: %v", err)
+		return "", http.StatusBadRequest
+	}
 
-		OSHumanName:  registration.OSHumanName,
-		OSVersion:    registration.OSVersion,
-		Manufacturer: registration.Manufacturer,
-		Model:        registration.Model,
-		Arch:         registration.Arch,
-		MachineName:  registration.MachineName,
-		MachineGUID:  registration.MachineGUID,
+	// Check if this machine already has a system from an earlier install
+	duplicate, err := findDuplicateSystem(db, customer.ID, &registration)
+	if err != nil {
+		log.Errorf("Unable to check for duplicate systems: %v", err)
+		return "", http.StatusBadRequest
+	}
 
-		FirstSeen: utils.DBTimeNow(),
-		LastSeen:  utils.DBTimeNow(),
+	duplicateAction := config.Registration.DuplicateAction
+	if duplicate != nil && duplicateAction != system.DuplicateActionNew && !canTakeOverSystem(c, duplicate, &registration) {
+		log.Infof("Agent on %s did not prove it was using system %d, so it gets a new system", registration.MachineName, duplicate.ID)
+		duplicateAction = system.DuplicateActionNew
 	}
 
-	// Save it
-	if err = db.Insert(systemInsert); err != nil {
-		log.Errorf("Error while creating system: %v", err)
-		return "", http.StatusBadRequest
+	var systemID int64
+	if duplicate != nil && duplicateAction == system.DuplicateActionReuse {
+		log.Infof("Reusing system %d for agent on %s", duplicate.ID, registration.MachineName)
+
+		if err = retireAgentCredentials(db, duplicate.ID); err != nil {
+			log.Errorf("Unable to retire old agent of system %d: %v", duplicate.ID, err)
+			return "", http.StatusBadRequest
+		}
+
+		before := *duplicate
+		registration.apply(duplicate)
+		if err = utils.RecordSystemChanges(db, &before, duplicate); err != nil {
+			log.Errorf("Unable to record history of system %d: %v", duplicate.ID, err)
+			return "", http.StatusBadRequest
+		}
+
+		duplicate.SystemUUID = SystemUUIDslice
+		duplicate.LastSeen = utils.DBTimeNow()
+		duplicate.Secret = secret
+		duplicate.PendingSecret = nil
+
+		// The new agent has no policy yet, so make sure one is queued for it
+		duplicate.PolicyID = 0
+		duplicate.AgentPolicyID = 0
+
+		if _, err = db.Update(duplicate); err != nil {
+			log.Errorf("Error while updating system: %v", err)
+			return "", http.StatusBadRequest
+		}
+
+		systemID = duplicate.ID
+	} else {
+		// Create system DB object
+		systemInsert := &models.System{
+			SystemSetID: systemSetID,
+			SystemUUID:  SystemUUIDslice,
+
+			FirstSeen: utils.DBTimeNow(),
+			LastSeen:  utils.DBTimeNow(),
+
+			Secret: secret,
+		}
+		registration.apply(systemInsert)
+
+		if duplicate != nil && duplicateAction == system.DuplicateActionSuccessor {
+			log.Infof("New system for agent on %s is the successor of system %d", registration.MachineName, duplicate.ID)
+
+			// Keep it where the user had put the old one
+			systemInsert.SystemSetID = duplicate.SystemSetID
+			systemInsert.Comment = duplicate.Comment
+			systemInsert.PredecessorID = duplicate.ID
+		}
+
+		// Save it, retiring the old system in the same transaction as it won't be checking in any more
+		tx, err := db.Begin()
+		if err != nil {
+			log.Errorf("Unable to start transaction, %v", err)
+			return "", http.StatusBadRequest
+		}
+		defer tx.Rollback() // Does nothing once committed
+
+		if err = tx.Insert(systemInsert); err != nil {
+			log.Errorf("Error while creating system: %v", err)
+			return "", http.StatusBadRequest
+		}
+
+		if systemInsert.PredecessorID != 0 {
+			duplicate.RetiredDate = utils.DBTimeNow()
+			if _, err = tx.Update(duplicate); err != nil {
+				log.Errorf("Unable to retire system %d: %v", duplicate.ID, err)
+				return "", http.StatusBadRequest
+			}
+		}
+
+		if err = tx.Commit(); err != nil {
+			log.Errorf("Unable to commit new system, %v", err)
+			return "", http.StatusBadRequest
+		}
+
+		systemID = systemInsert.ID
 	}
 
-	systemID := systemInsert.ID
+	// Issue a client certificate if we are running the CA
+	var certificatePEM, caCertificatePEM string
+	if ca := controller.GetCA(c); ca != nil && registration.CSR != "" {
+		cert, certPEM, err := ca.SignCSR([]byte(registration.CSR), SystemUUID.String(), time.Duration(config.TLS.ClientCertValidity)*time.Second)
+		if err != nil {
+			log.Errorf("Unable to sign certificate request for system %d: %v", systemID, err)
+			return "", http.StatusBadRequest
+		}
+
+		agentCertificate := &models.AgentCertificate{
+			SystemID:     systemID,
+			SerialNumber: cert.SerialNumber.Bytes(),
+			Fingerprint:  agentca.Fingerprint(cert),
+			NotBefore:    cert.NotBefore.Unix(),
+			NotAfter:     cert.NotAfter.Unix(),
+			CreationDate: utils.DBTimeNow(),
+		}
+		if err = db.Insert(agentCertificate); err != nil {
+			log.Errorf("Error while recording certificate: %v", err)
+			return "", http.StatusBadRequest
+		}
+
+		certificatePEM = string(certPEM)
+		caCertificatePEM = string(ca.CertificatePEM)
+	}
+
+	// Queue up the rules this system should be running
+	if err = command.QueuePolicyForSystem(db, systemID); err != nil {
+		log.Errorf("Unable to queue policy for system %d: %v", systemID, err)
+	}
 
-	return GenerateResponseToAgent(db, systemID, command.SetSystemUUID(SystemUUID.String()))
+	return controller.GenerateResponseToAgent(c, systemID, command.SetSystemUUID(SystemUUID.String(), hex.EncodeToString(secret), certificatePEM, caCertificatePEM))
 }
@@ -0,0 +1,112 @@
+////////////////////////////////////////////////////////////////////////////
+//
+// Summit Route End Point Protection
+//
+// This source code is licensed under the BSD-style license found in the
+// LICENSE file in the root directory of this source tree.
+//
+/////////////////////////////////////////////////////////////////////////////
+
+package api
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+
+	log "github.com/Sirupsen/logrus"
+	_ "github.com/lib/pq" // Needed for gorp
+	"github.com/zenazn/goji/web"
+
+	"qdserver/lib/command"
+	"qdserver/lib/models"
+	"qdserver/lib/utils"
+)
+
+// TaskResult route is called by agents to report on a task they were given
+//
+// Test with: curl -d '{"SystemUUID":"631a838a-9509-46de-7612-91f0a246cce9","CustomerUUID":"3d794551-91a0-4db4-6296-ffcbfc5577f9","CurrentClientTime":1,"TaskID":1,"Success":true,"Result":{}}' http://127.0.0.1:8080/api/v1/TaskResult
+func (controller *Controller) TaskResult(c web.C, r *http.Request) (string, int) {
+	// Parse body into json
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		log.Errorf("Unable to read body")
+		return "", http.StatusBadRequest
+	}
+
+	type resultFromClient struct {
+		SystemUUID        string
+		CustomerUUID      string
+		CurrentClientTime int64
+		TaskID            int64
+		Success           bool
+		Result            json.RawMessage // Command specific data
+	}
+
+	var result resultFromClient
+	err = json.Unmarshal(body, &result)
+	if err != nil {
+		log.Errorf("Unable to unmarshal json, %v", err)
+		return "", http.StatusBadRequest
+	}
+
+	db := controller.GetDatabase(c)
+
+	systemID, err := controller.getSystemID(c, result.SystemUUID, result.CustomerUUID)
+	if err != nil {
+		log.Errorf("Unable to find ID for System %s (customer: %s), %v", result.SystemUUID, result.CustomerUUID, err)
+		return "", http.StatusBadRequest
+	}
+
+	// Ensure the task belongs to this system
+	var task models.Task
+	err = db.SelectOne(&task, `SELECT *
+		FROM Tasks
+		WHERE ID=:taskID and SystemID=:systemID`,
+		map[string]interface{}{
+			"taskID":   result.TaskID,
+			"systemID": systemID,
+		})
+	if err != nil {
+		log.Errorf("Unable to find task %d for system %d, %v", result.TaskID, systemID, err)
+		return "", http.StatusBadRequest
+	}
+
+	if task.State != models.TaskStateDeployed {
+		// Agent is repeating itself, maybe because it didn't get our last response, or the task was expired or
+		// handed out again since
+		log.Infof("Task %d is no longer deployed (state %d), ignoring result", task.ID, task.State)
+		return controller.GenerateResponseToAgent(c, systemID, command.Nop())
+	}
+	state, attempts := task.State, task.Attempts
+
+	if len(result.Result) != 0 {
+		task.Result = string(result.Result)
+	}
+
+	if result.Success {
+		task.State = models.TaskStateAcknowledged
+		task.CompletionDate = utils.DBTimeNow()
+	} else if task.Attempts < controller.GetConfiguration(c).Tasks.MaxAttempts {
+		// Put it back in the queue so it is sent again
+		log.Infof("Task %d failed on system %d (attempt %d), will retry", task.ID, systemID, task.Attempts)
+		task.State = models.TaskStatePending
+	} else {
+		log.Warningf("Task %d failed on system %d after %d attempts", task.ID, systemID, task.Attempts)
+		task.State = models.TaskStateFailed
+		task.CompletionDate = utils.DBTimeNow()
+	}
+
+	// Only record the result if the task hasn't been redeployed or expired since it was read
+	updated, err := updateTaskIfUnchanged(db, &task, state, attempts)
+	if err != nil {
+		log.Errorf("Can't update task: %v", err)
+		return "", http.StatusBadRequest
+	}
+	if !updated {
+		log.Infof("Task %d changed while its result was recorded, ignoring result", task.ID)
+	}
+
+	// Respond with a NOP so the agent can pick up the next task right away
+	return controller.GenerateResponseToAgent(c, systemID, command.Nop())
+}
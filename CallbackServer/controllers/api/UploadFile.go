@@ -13,6 +13,7 @@ import (
 	"bytes"
 	"encoding/hex"
 	"encoding/json"
+	"fmt"
 	"io"
 	"io/ioutil"
 	"mime/multipart"
@@ -24,18 +25,16 @@ import (
 	_ "github.com/lib/pq" // Needed for gorp
 	"github.com/zenazn/goji/web"
 
-	"qdserver/CallbackServer/command"
 	"qdserver/CallbackServer/system"
+	"qdserver/lib/command"
 	"qdserver/lib/models"
+	"qdserver/lib/storage"
 	"qdserver/lib/taskqueue"
 	"qdserver/lib/utils"
 )
 
 // UploadFile receives a file from the client
 func (controller *Controller) UploadFile(c web.C, r *http.Request) (string, int) {
-	db := controller.GetDatabase(c)
-	ch := controller.GetQueueChannel(c)
-
 	type eventFromClient struct {
 		SystemUUID        string
 		CustomerUUID      string
@@ -65,7 +64,7 @@ func (controller *Controller) UploadFile(c web.C, r *http.Request) (string, int)
 				return "", http.StatusBadRequest
 			}
 
-			systemID, err = utils.GetSystemIDFromUUID(db, event.SystemUUID, event.CustomerUUID)
+			systemID, err = controller.getSystemID(c, event.SystemUUID, event.CustomerUUID)
 			if err != nil {
 				log.Errorf("Unable to parse get System ID, %v", err)
 				return "", http.StatusBadRequest
@@ -141,97 +140,12 @@ func (controller *Controller) UploadFile(c web.C, r *http.Request) (string, int)
 				return "", http.StatusBadRequest
 			}
 
-			//
-			// Record in the DB that we have a copy
-			//
-			if event.FileType == "exe" {
-				// Upload to S3
-				err = utils.UploadToS3HashPath(c.Env["Config"].(*system.Configuration).Aws.ExeUpload, sha256HexString, outfile)
-				if err != nil {
-					// I can probably continue on, but for now I'll bail on error
-					log.Errorf("Unable to upload to S3 due to %v", err)
-					return "", http.StatusBadRequest
-				}
-
-				// Find the entry in the DB for this file
-				var executableFile models.ExecutableFile
-				err = db.SelectOne(&executableFile, `SELECT *
-					FROM ExecutableFiles
-					WHERE Sha256=:sha256`,
-					map[string]interface{}{
-						"sha256": sha256ByteArray,
-					})
-				if err != nil {
-					log.Errorf("Unable to find executable (%s) in DB (agent uploaded a file we've never seen), %v", sha256HexString, err)
-					return "", http.StatusBadRequest
-				}
-
-				// Update it to say we have a copy
-				executableFile.UploadDate = utils.DBTimeNow()
-				_, err = db.Update(&executableFile)
-				if err != nil {
-					log.Errorf("Can't update exe: %v", err)
-					return "", http.StatusBadRequest
-				}
-
-				// Sanity check
-				if written != int64(executableFile.Size) {
-					log.Errorf("Uploaded file does not equal expectd size (wrote: %d, expected: %d)", written, int64(executableFile.Size))
-					return "", http.StatusBadRequest
-				}
-
-				err = TaskQueue.CreateTaskToAnalyzeFile(ch, executableFile.ID)
-				if err != nil {
-					log.Errorf("Failed to create task for file %d, %v", executableFile.ID, err)
-					return "", http.StatusBadRequest
-				}
-			} else if event.FileType == "catalog" {
-				// Upload to S3
-				err = utils.UploadToS3HashPath(c.Env["Config"].(*system.Configuration).Aws.CatalogUpload, sha256HexString, outfile)
-				if err != nil {
-					// I can probably continue on, but for now I'll bail on error
-					log.Errorf("Unable to upload to S3 due to %v", err)
-					return "", http.StatusBadRequest
-				}
-
-				// Find the entry in the DB for this file
-				var catalogFile models.CatalogFile
-				err = db.SelectOne(&catalogFile, `SELECT *
-								FROM CatalogFiles
-								WHERE Sha256=:sha256`,
-					map[string]interface{}{
-						"sha256": sha256ByteArray,
-					})
-				if err != nil {
-					log.Errorf("Unable to find catalog (%s) in DB (agent uploaded a file we've never seen), %v", sha256HexString, err)
-					return "", http.StatusBadRequest
-				}
-
-				// Update it to say we have a copy
-				catalogFile.UploadDate = utils.DBTimeNow()
-				_, err = db.Update(&catalogFile)
-				if err != nil {
-					log.Errorf("Can't update exe: %v", err)
-					return "", http.StatusBadRequest
-				}
-
-				// Sanity check
-				if written != int64(catalogFile.Size) {
-					log.Errorf("Uploaded file does not equal expectd size (wrote: %d, expected: %d)", written, int64(catalogFile.Size))
-					return "", http.StatusBadRequest
-				}
-
-				err = TaskQueue.CreateTaskToAnalyzeCatalog(ch, catalogFile.ID)
-				if err != nil {
-					log.Errorf("Failed to create task for file %d, %v", catalogFile.ID, err)
-					return "", http.StatusBadRequest
-				}
-			} else {
-				log.Errorf("Unknown file type %s, %v", event.FileType, err)
+			if err = controller.recordUploadedFile(c, event.FileType, sha256HexString, sha256ByteArray, outfile, written); err != nil {
+				log.Errorf("Unable to record uploaded file, %v", err)
 				return "", http.StatusBadRequest
 			}
 
-			// Everything worked, and the file is on S3, so delete our copy
+			// Everything worked, and the file is stored, so delete our copy
 			os.Remove(outfile.Name())
 			fileUploaded = true
 		}
@@ -242,5 +156,91 @@ func (controller *Controller) UploadFile(c web.C, r *http.Request) (string, int)
 		return "", http.StatusBadRequest
 	}
 
-	return GenerateResponseToAgent(controller.GetDatabase(c), systemID, command.Nop())
+	return controller.GenerateResponseToAgent(c, systemID, command.Nop())
+}
+
+// recordUploadedFile stores a file the agent uploaded, after its hash has been checked, and records
+// in the DB that we have a copy.  A task is queued for the workers to analyze it.
+func (controller *Controller) recordUploadedFile(c web.C, fileType string, sha256HexString string, sha256ByteArray []byte, outfile *os.File, written int64) error {
+	db := controller.GetDatabase(c)
+	ch := controller.GetQueueChannel(c)
+	stores := controller.GetStores(c)
+
+	if fileType == "exe" {
+		// Copy to storage
+		err := storage.PutFile(stores.ExeUpload, storage.HashKey(sha256HexString), outfile)
+		if err != nil {
+			// I can probably continue on, but for now I'll bail on error
+			return fmt.Errorf("Unable to store file due to %v", err)
+		}
+
+		// Find the entry in the DB for this file
+		var executableFile models.ExecutableFile
+		err = db.SelectOne(&executableFile, `SELECT *
+			FROM ExecutableFiles
+			WHERE Sha256=:sha256`,
+			map[string]interface{}{
+				"sha256": sha256ByteArray,
+			})
+		if err != nil {
+			return fmt.Errorf("Unable to find executable (%s) in DB (agent uploaded a file we've never seen), %v", sha256HexString, err)
+		}
+
+		// Update it to say we have a copy
+		executableFile.UploadDate = utils.DBTimeNow()
+		_, err = db.Update(&executableFile)
+		if err != nil {
+			return fmt.Errorf("Can't update exe: %v", err)
+		}
+
+		// Sanity check
+		if written != int64(executableFile.Size) {
+			return fmt.Errorf("Uploaded file does not equal expectd size (wrote: %d, expected: %d)", written, int64(executableFile.Size))
+		}
+
+		err = TaskQueue.CreateTaskToAnalyzeFile(ch, executableFile.ID)
+		if err != nil {
+			return fmt.Errorf("Failed to create task for file %d, %v", executableFile.ID, err)
+		}
+	} else if fileType == "catalog" {
+		// Copy to storage
+		err := storage.PutFile(stores.CatalogUpload, storage.HashKey(sha256HexString), outfile)
+		if err != nil {
+			// I can probably continue on, but for now I'll bail on error
+			return fmt.Errorf("Unable to store file due to %v", err)
+		}
+
+		// Find the entry in the DB for this file
+		var catalogFile models.CatalogFile
+		err = db.SelectOne(&catalogFile, `SELECT *
+			FROM CatalogFiles
+			WHERE Sha256=:sha256`,
+			map[string]interface{}{
+				"sha256": sha256ByteArray,
+			})
+		if err != nil {
+			return fmt.Errorf("Unable to find catalog (%s) in DB (agent uploaded a file we've never seen), %v", sha256HexString, err)
+		}
+
+		// Update it to say we have a copy
+		catalogFile.UploadDate = utils.DBTimeNow()
+		_, err = db.Update(&catalogFile)
+		if err != nil {
+			return fmt.Errorf("Can't update catalog: %v", err)
+		}
+
+		// Sanity check
+		if written != int64(catalogFile.Size) {
+			return fmt.Errorf("Uploaded file does not equal expectd size (wrote: %d, expected: %d)", written, int64(catalogFile.Size))
+		}
+
+		err = TaskQueue.CreateTaskToAnalyzeCatalog(ch, catalogFile.ID)
+		if err != nil {
+			return fmt.Errorf("Failed to create task for file %d, %v", catalogFile.ID, err)
+		}
+	} else {
+		return fmt.Errorf("Unknown file type %s", fileType)
+	}
+
+	return nil
 }
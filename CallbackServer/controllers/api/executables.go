@@ -0,0 +1,100 @@
+////////////////////////////////////////////////////////////////////////////
+//
+// Summit Route End Point Protection
+//
+// This source code is licensed under the BSD-style license found in the
+// LICENSE file in the root directory of this source tree.
+//
+/////////////////////////////////////////////////////////////////////////////
+
+package api
+
+import (
+	"encoding/hex"
+	"fmt"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/coopernurse/gorp"
+	_ "github.com/lib/pq" // Needed for gorp
+
+	"qdserver/lib/command"
+	"qdserver/lib/models"
+)
+
+// executableFromClient is how agents describe a file that was run or loaded
+type executableFromClient struct {
+	Path     string
+	Md5      string
+	Sha1     string
+	Sha256   string // Sha256 of the file
+	Size     int
+	IsSigned bool
+}
+
+// findOrAddExecutable returns the ID of the file, adding it and asking the agent for a copy if we haven't seen it
+// before.  The executionType flag is added to the file's ExecutionType.
+func findOrAddExecutable(db *gorp.DbMap, systemID int64, file executableFromClient, executionType int, timeOfEvent int64) (int64, error) {
+	md5, err := hex.DecodeString(file.Md5)
+	if err != nil {
+		return 0, fmt.Errorf("Unable to decode MD5: %v", err)
+	}
+
+	sha1, err := hex.DecodeString(file.Sha1)
+	if err != nil {
+		return 0, fmt.Errorf("Unable to decode Sha1: %v", err)
+	}
+
+	sha256, err := hex.DecodeString(file.Sha256)
+	if err != nil {
+		return 0, fmt.Errorf("Unable to decode Sha256: %v", err)
+	}
+
+	// Check if we've seen this executable before
+	executableID, err := db.SelectInt(`SELECT ID
+		FROM ExecutableFiles
+		WHERE Sha256=:sha256`,
+		map[string]interface{}{
+			"sha256": sha256,
+		})
+	if err != nil {
+		return 0, fmt.Errorf("Error checking for file: %v", err)
+	}
+
+	if executableID != 0 {
+		// A file that was run may later be loaded as a DLL, or the other way around
+		_, err = db.Exec("UPDATE ExecutableFiles SET ExecutionType = ExecutionType | $1 WHERE ID=$2 and ExecutionType & $1 = 0",
+			executionType, executableID)
+		if err != nil {
+			return 0, fmt.Errorf("Unable to update execution type of file %d: %v", executableID, err)
+		}
+		return executableID, nil
+	}
+
+	log.Infof("New file, adding it to the DB")
+
+	// Assuming executable has not been found, so adding it to the DB
+	executableFileInsert := &models.ExecutableFile{
+		Md5:           md5,
+		Sha1:          sha1,
+		Sha256:        sha256,
+		Size:          file.Size,
+		FirstSeen:     timeOfEvent,
+		IsSigned:      file.IsSigned,
+		ExecutionType: executionType,
+	}
+
+	// Save it
+	if err = db.Insert(executableFileInsert); err != nil {
+		// If you get an error about duplicate values, one fix is to run: select setval('executablefiles_id_seq', (select max(id) + 1 from executablefiles));
+		// I don't know why it forget about that sequence number
+		return 0, fmt.Errorf("Error while creating executable file: %v", err)
+	}
+
+	// Create a task to tell this agent to get that file
+	agentCommand := command.GetFileByHash(file.Sha256)
+	if err = command.AddTask(db, systemID, agentCommand); err != nil {
+		return 0, fmt.Errorf("Unable to add task for agent, %v", err)
+	}
+
+	return executableFileInsert.ID, nil
+}
@@ -11,47 +11,119 @@ package api
 
 import (
 	"encoding/json"
+	"fmt"
 	"net/http"
 
 	log "github.com/Sirupsen/logrus"
 	"github.com/coopernurse/gorp"
+	"github.com/zenazn/goji/web"
 
-	"qdserver/CallbackServer/command"
+	"qdserver/CallbackServer/system"
+	"qdserver/lib/command"
 	"qdserver/lib/models"
 	"qdserver/lib/utils"
 )
 
+// getSystemID returns the ID of the system the request is from, after checking it is the system that signed the request.
+// Every agent request goes through here, so this is also where we note that we've heard from the system.
+func (controller *Controller) getSystemID(c web.C, systemUUID string, customerUUID string) (int64, error) {
+	systemID, err := controller.checkSystemID(c, systemUUID, customerUUID)
+	if err != nil {
+		return 0, err
+	}
+
+	if err = touchSystem(controller.GetDatabase(c), systemID, controller.GetConfiguration(c).CheckIn.LastSeenInterval); err != nil {
+		log.Errorf("Unable to update LastSeen for system %d, %v", systemID, err)
+	}
+
+	return systemID, nil
+}
+
+// touchSystem sets the system's LastSeen to now.  So we aren't writing to the systems table on every request,
+// it is only written once it is more than interval seconds out of date.
+func touchSystem(db *gorp.DbMap, systemID int64, interval int64) error {
+	now := utils.DBTimeNow()
+	_, err := db.Exec("UPDATE systems SET LastSeen=$1 WHERE ID=$2 and LastSeen<$3", now, systemID, now-interval)
+	return err
+}
+
+// checkSystemID looks up the system the request claims to be from, and makes sure it is the system that signed it
+func (controller *Controller) checkSystemID(c web.C, systemUUID string, customerUUID string) (int64, error) {
+	db := controller.GetDatabase(c)
+
+	systemID, err := utils.GetSystemIDFromUUID(db, systemUUID, customerUUID)
+	if err != nil {
+		return 0, err
+	}
+	if systemID == 0 {
+		return 0, fmt.Errorf("Malformed UUIDs")
+	}
+
+	authenticatedSystemID, _ := c.Env["AuthenticatedSystemID"].(int64)
+	if authenticatedSystemID != 0 {
+		if authenticatedSystemID != systemID {
+			return 0, fmt.Errorf("Request signed by system %d claims to be from system %d", authenticatedSystemID, systemID)
+		}
+		return systemID, nil
+	}
+
+	// Unsigned requests are only allowed from systems that were never given a secret
+	count, err := db.SelectInt("select count(*) from systems where ID=:id and length(Secret) > 0",
+		map[string]interface{}{
+			"id": systemID,
+		})
+	if err != nil {
+		return 0, err
+	}
+	if count != 0 {
+		return 0, fmt.Errorf("Unsigned request from system %d, which has a secret", systemID)
+	}
+
+	return systemID, nil
+}
+
 // GenerateResponseToAgent creates a response the agent expects given a command
-// If the command is a NOP, check if we have any tasks
-func GenerateResponseToAgent(db *gorp.DbMap, systemID int64, response command.ResponseToAgent) (string, int) {
-	if response == command.Nop() {
-		var tasks []models.Task
-		_, err := db.Select(&tasks, `SELECT *
-						FROM Tasks t
-						WHERE t.SystemID=:systemID and t.DeployedToAgentDate = 0
-						ORDER BY CreationDate`,
-			map[string]interface{}{
-				"systemID": systemID,
-			})
-		if err != nil {
-			log.Errorf("Problem searching Tasks table... this is bad, %v", err)
-			// TODO Need to do something in case of this error
-		} else if len(tasks) > 0 {
-			task := tasks[0]
+// If the command is a NOP, check if we have any tasks.  Agents that support the Tasks command get
+// every task that is waiting, in order, and other agents get the oldest one.
+func (controller *Controller) GenerateResponseToAgent(c web.C, systemID int64, response command.ResponseToAgent) (string, int) {
+	db := controller.GetDatabase(c)
 
-			task.DeployedToAgentDate = utils.DBTimeNow()
-			// TODO MUST I need to provide a task ID to the agent so when it responds I can mark this as completed.  Else if I send
-			//   the agent a task and it fails, we never resend.
+	capabilities, err := command.GetAgentCapabilities(db, systemID)
+	if err != nil {
+		log.Errorf("Unable to get capabilities of system %d, %v", systemID, err)
+		return "", http.StatusBadRequest
+	}
+
+	if response == command.Nop() {
+		tasksConfig := controller.GetConfiguration(c).Tasks
+		maxTasks := 1
+		if capabilities.Supports("Tasks") {
+			maxTasks = tasksConfig.MaxPerResponse
+		}
 
-			// Update it in the DB
-			_, err := db.Update(&task)
+		var taskResponses []command.ResponseToAgent
+		for len(taskResponses) < maxTasks {
+			task, taskResponse, err := getNextTask(db, tasksConfig, capabilities, systemID)
 			if err != nil {
-				log.Errorf("Can't update task: %v", err)
-				// TODO Need to do something smart with this error
+				log.Errorf("Problem searching Tasks table... this is bad, %v", err)
+				// TODO Need to do something in case of this error
+				break
+			} else if task == nil {
+				break
 			}
+			taskResponses = append(taskResponses, *taskResponse)
+		}
 
-			return task.Command, http.StatusOK
+		if capabilities.Supports("Tasks") && len(taskResponses) != 0 {
+			response = command.Tasks(taskResponses)
+		} else if len(taskResponses) != 0 {
+			response = taskResponses[0]
 		}
+	} else if negotiated, err := capabilities.Negotiate(response); err != nil {
+		log.Errorf("System %d does not support the %s command, sending a NOP", systemID, response.Command)
+		response = command.Nop()
+	} else {
+		response = negotiated
 	}
 
 	// json response
@@ -63,3 +135,121 @@ func GenerateResponseToAgent(db *gorp.DbMap, systemID int64, response command.Re
 
 	return string(responseBytes), http.StatusOK
 }
+
+// hasTasksWaiting returns true if getNextTask would have something for the agent
+func hasTasksWaiting(db *gorp.DbMap, tasksConfig system.ConfigurationTasks, systemID int64) (bool, error) {
+	count, err := db.SelectInt(`SELECT count(*)
+					FROM Tasks t
+					WHERE t.SystemID=:systemID and (t.State=:pending or (t.State=:deployed and t.DeployedToAgentDate<:resendBefore))`,
+		map[string]interface{}{
+			"systemID":     systemID,
+			"pending":      models.TaskStatePending,
+			"deployed":     models.TaskStateDeployed,
+			"resendBefore": utils.DBTimeNow() - tasksConfig.AckTimeout,
+		})
+	return count != 0, err
+}
+
+// updateTaskIfUnchanged writes the task's state, unless its state or attempts have changed from those given since it was
+// read.  Returns false if they had, so another request already handled the task.
+func updateTaskIfUnchanged(db *gorp.DbMap, task *models.Task, state int, attempts int) (bool, error) {
+	result, err := db.Exec(`UPDATE tasks SET State=$1, Attempts=$2, DeployedToAgentDate=$3, CompletionDate=$4, Result=$5
+		WHERE ID=$6 and State=$7 and Attempts=$8`,
+		task.State, task.Attempts, task.DeployedToAgentDate, task.CompletionDate, task.Result, task.ID, state, attempts)
+	if err != nil {
+		return false, err
+	}
+
+	rows, err := result.RowsAffected()
+	return rows != 0, err
+}
+
+// getNextTask finds the oldest task that should be handed to the agent and marks it as deployed.
+// Tasks the agent never reported back on are resent after the ack timeout until they run out of attempts,
+// and tasks the agent doesn't support are failed.  Returns the task and the command, converted for the agent,
+// or nil if there is nothing to send.
+func getNextTask(db *gorp.DbMap, tasksConfig system.ConfigurationTasks, capabilities *command.AgentCapabilities, systemID int64) (*models.Task, *command.ResponseToAgent, error) {
+	var tasks []models.Task
+	_, err := db.Select(&tasks, `SELECT *
+					FROM Tasks t
+					WHERE t.SystemID=:systemID and (t.State=:pending or t.State=:deployed)
+					ORDER BY CreationDate`,
+		map[string]interface{}{
+			"systemID": systemID,
+			"pending":  models.TaskStatePending,
+			"deployed": models.TaskStateDeployed,
+		})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	now := utils.DBTimeNow()
+	for _, task := range tasks {
+		// What the task was when we read it, so we only change it if no other request has since
+		state, attempts := task.State, task.Attempts
+
+		if now-task.CreationDate > tasksConfig.Expiration {
+			log.Infof("Task %d for system %d expired before it was acknowledged", task.ID, systemID)
+			task.State = models.TaskStateExpired
+			if _, err = updateTaskIfUnchanged(db, &task, state, attempts); err != nil {
+				return nil, nil, err
+			}
+			continue
+		}
+
+		if task.State == models.TaskStateDeployed {
+			if now-task.DeployedToAgentDate < tasksConfig.AckTimeout {
+				// Still waiting on the agent to report back
+				continue
+			}
+
+			if task.Attempts >= tasksConfig.MaxAttempts {
+				log.Infof("Task %d for system %d was never acknowledged after %d attempts", task.ID, systemID, task.Attempts)
+				task.State = models.TaskStateExpired
+				if _, err = updateTaskIfUnchanged(db, &task, state, attempts); err != nil {
+					return nil, nil, err
+				}
+				continue
+			}
+
+			log.Infof("Resending task %d to system %d", task.ID, systemID)
+		}
+
+		var taskResponse command.ResponseToAgent
+		if err = json.Unmarshal([]byte(task.Command), &taskResponse); err != nil {
+			return nil, nil, fmt.Errorf("Unable to unmarshal command for task %d, %v", task.ID, err)
+		}
+
+		taskResponse, err = capabilities.Negotiate(taskResponse)
+		if err != nil {
+			log.Warningf("Task %d for system %d is a %s command, which the agent does not support", task.ID, systemID, taskResponse.Command)
+			task.State = models.TaskStateFailed
+			task.CompletionDate = now
+			task.Result = `{"Error":"Command is not supported by the agent"}`
+			if _, err = updateTaskIfUnchanged(db, &task, state, attempts); err != nil {
+				return nil, nil, err
+			}
+			continue
+		}
+
+		// Give the agent the task ID so it can tell us how it went
+		taskResponse.TaskID = task.ID
+
+		task.State = models.TaskStateDeployed
+		task.Attempts++
+		task.DeployedToAgentDate = now
+
+		// Update it in the DB, unless another poll from the agent got to it first
+		updated, err := updateTaskIfUnchanged(db, &task, state, attempts)
+		if err != nil {
+			return nil, nil, err
+		}
+		if !updated {
+			continue
+		}
+
+		return &task, &taskResponse, nil
+	}
+
+	return nil, nil, nil
+}
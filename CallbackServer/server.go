@@ -31,8 +31,15 @@ func main() {
 	var application = &system.Application{}
 	application.Init(configfile)
 	application.ConnectToDatabase()
+	application.ConnectToStorage()
+	if application.Configuration.TLS.Enabled {
+		application.LoadCA()
+	}
 	application.ConnectToQueues()
 
+	go application.PurgeRequestNonces()
+	go application.ListenForWakes()
+
 	//
 	// Apply middleware
 	//
@@ -48,6 +55,9 @@ func main() {
 	logr.Formatter = new(log.JSONFormatter)
 	goji.Use(glogrus.NewGlogrus(logr, "callbackserver"))
 
+	// Check agent signatures
+	goji.Use(application.ApplyAgentAuth)
+
 	controller := &api.Controller{}
 
 	//
@@ -60,15 +70,28 @@ func main() {
 	// get a system UUID
 	goji.Post("/api/v1/Register", application.Route(controller, "RegisterAgent"))
 	goji.Post("/api/v1/ProcessEvent", application.Route(controller, "ProcessEvent"))
+	goji.Post("/api/v1/ProcessExitEvent", application.Route(controller, "ProcessExitEvent"))
+	goji.Post("/api/v1/ModuleLoadEvent", application.Route(controller, "ModuleLoadEvent"))
+	goji.Post("/api/v1/DriverLoadEvent", application.Route(controller, "DriverLoadEvent"))
 	goji.Post("/api/v1/CatalogFileEvent", application.Route(controller, "CatalogFileEvent"))
+	goji.Post("/api/v1/BatchEvents", application.Route(controller, "BatchEvents"))
 	goji.Post("/api/v1/UploadFile", application.Route(controller, "UploadFile"))
+	goji.Post("/api/v1/UploadInitiate", application.Route(controller, "UploadInitiate"))
+	goji.Put("/api/v1/UploadChunk", application.Route(controller, "UploadChunk"))
+	goji.Post("/api/v1/UploadFinalize", application.Route(controller, "UploadFinalize"))
 	goji.Post("/api/v1/Heartbeat", application.Route(controller, "Heartbeat"))
+	goji.Post("/api/v1/Poll", application.Route(controller, "Poll"))
 	goji.Post("/api/v1/GetUpdate", application.Route(controller, "GetUpdate"))
+	goji.Post("/api/v1/TaskResult", application.Route(controller, "TaskResult"))
 
 	graceful.PostHook(func() {
 		application.Close()
 	})
 
 	flag.Set("bind", fmt.Sprintf(":%s", application.Configuration.ListeningPort))
-	goji.Serve()
+	if application.Configuration.TLS.Enabled {
+		goji.ServeTLS(application.TLSConfig())
+	} else {
+		goji.Serve()
+	}
 }
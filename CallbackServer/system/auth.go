@@ -0,0 +1,163 @@
+////////////////////////////////////////////////////////////////////////////
+//
+// Summit Route End Point Protection
+//
+// This source code is licensed under the BSD-style license found in the
+// LICENSE file in the root directory of this source tree.
+//
+/////////////////////////////////////////////////////////////////////////////
+
+package system
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strconv"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+
+	"qdserver/lib/agentca"
+	"qdserver/lib/models"
+	"qdserver/lib/utils"
+)
+
+// Headers agents use to sign their requests.  See utils.SignAgentRequest for what is signed.
+const (
+	HeaderSystemUUID = "X-SREPP-SystemUUID"
+	HeaderTimestamp  = "X-SREPP-Timestamp"
+	HeaderNonce      = "X-SREPP-Nonce"
+	HeaderSignature  = "X-SREPP-Signature"
+	HeaderBodySha256 = "X-SREPP-Body-Sha256"
+)
+
+// nonceRegex limits what we'll store as a nonce
+var nonceRegex = regexp.MustCompile("^[0-9a-f]{16,64}$")
+
+// authenticateAgent checks the signature on a request, returning the ID of the system that signed it.
+// Returns 0 for unsigned requests when signatures aren't required, in which case the handler has to check the
+// system hasn't been given a secret.
+func (application *Application) authenticateAgent(r *http.Request) (int64, error) {
+	config := application.Configuration.Auth
+	db := application.DBSession
+
+	signature := r.Header.Get(HeaderSignature)
+	if signature == "" {
+		if config.RequireSignatures {
+			return 0, fmt.Errorf("Request is not signed")
+		}
+		return 0, nil
+	}
+
+	signatureBytes, err := hex.DecodeString(signature)
+	if err != nil {
+		return 0, fmt.Errorf("Unable to decode signature, %v", err)
+	}
+
+	// Check the request is recent, which limits how long we have to remember nonces
+	timestamp, err := strconv.ParseInt(r.Header.Get(HeaderTimestamp), 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("Unable to parse timestamp, %v", err)
+	}
+	now := utils.DBTimeNow()
+	if timestamp < now-config.MaxClockSkew || timestamp > now+config.MaxClockSkew {
+		return 0, fmt.Errorf("Timestamp %d is too far from now (%d)", timestamp, now)
+	}
+
+	nonce := r.Header.Get(HeaderNonce)
+	if !nonceRegex.MatchString(nonce) {
+		return 0, fmt.Errorf("Bad nonce \"%s\"", nonce)
+	}
+
+	systemUUID, err := utils.UUIDStringToBytes(r.Header.Get(HeaderSystemUUID))
+	if err != nil {
+		return 0, fmt.Errorf("Unable to parse system UUID, %v", err)
+	}
+
+	var system models.System
+	err = db.SelectOne(&system, "select * from systems where SystemUUID=:systemUUID",
+		map[string]interface{}{
+			"systemUUID": systemUUID,
+		})
+	if err != nil {
+		return 0, fmt.Errorf("Unable to find system, %v", err)
+	}
+
+	// The signature covers the body's hash rather than the body, so the body doesn't have to be read to check it.
+	// The body is checked against the hash as the handler reads it.
+	bodySha256, err := hex.DecodeString(r.Header.Get(HeaderBodySha256))
+	if err != nil || len(bodySha256) != sha256.Size {
+		return 0, fmt.Errorf("Bad body sha256 \"%s\"", r.Header.Get(HeaderBodySha256))
+	}
+
+	if len(system.Secret) != 0 && hmac.Equal(signatureBytes, utils.SignAgentRequest(system.Secret, r.Method, r.URL.RequestURI(), timestamp, nonce, bodySha256)) {
+		// Signed with the current secret
+	} else if len(system.PendingSecret) != 0 && hmac.Equal(signatureBytes, utils.SignAgentRequest(system.PendingSecret, r.Method, r.URL.RequestURI(), timestamp, nonce, bodySha256)) {
+		// The agent has switched to the secret we sent with RotateSecret, so stop accepting the old one
+		log.Infof("System %d is now using its new secret", system.ID)
+		system.Secret = system.PendingSecret
+		system.PendingSecret = nil
+		if _, err = db.Update(&system); err != nil {
+			return 0, fmt.Errorf("Unable to update secret, %v", err)
+		}
+	} else {
+		return 0, fmt.Errorf("Bad signature for system %d", system.ID)
+	}
+
+	// The primary key is on (SystemID, Nonce), so the insert fails if we've seen this nonce before
+	requestNonce := &models.RequestNonce{
+		SystemID:  system.ID,
+		Nonce:     nonce,
+		Timestamp: timestamp,
+	}
+	if err = db.Insert(requestNonce); err != nil {
+		return 0, fmt.Errorf("Replayed nonce for system %d, %v", system.ID, err)
+	}
+
+	r.Body = utils.VerifyBody(r.Body, bodySha256)
+	return system.ID, nil
+}
+
+// PurgeRequestNonces deletes nonces that are too old to be replayed, as their timestamps would be rejected.
+// This never returns, so run it in its own goroutine.
+func (application *Application) PurgeRequestNonces() {
+	for {
+		cutoff := utils.DBTimeNow() - application.Configuration.Auth.MaxClockSkew*2
+		if _, err := application.DBSession.Exec("delete from requestnonces where Timestamp < $1", cutoff); err != nil {
+			log.Errorf("Unable to purge old nonces, %v", err)
+		}
+
+		time.Sleep(time.Duration(application.Configuration.Auth.MaxClockSkew) * time.Second)
+	}
+}
+
+// authenticateCertificate maps the client certificate to the system it was issued to.
+// The TLS layer has already checked it was signed by our CA, so this checks it hasn't been revoked.
+// Returns 0 when there is no client certificate and one isn't required.
+func (application *Application) authenticateCertificate(r *http.Request) (int64, error) {
+	if r.TLS == nil || len(r.TLS.PeerCertificates) == 0 {
+		if application.Configuration.TLS.Enabled && application.Configuration.TLS.RequireClientCert {
+			return 0, fmt.Errorf("No client certificate")
+		}
+		return 0, nil
+	}
+
+	var agentCertificate models.AgentCertificate
+	err := application.DBSession.SelectOne(&agentCertificate, "select * from agentcertificates where Fingerprint=:fingerprint",
+		map[string]interface{}{
+			"fingerprint": agentca.Fingerprint(r.TLS.PeerCertificates[0]),
+		})
+	if err != nil {
+		return 0, fmt.Errorf("Unknown client certificate, %v", err)
+	}
+
+	if agentCertificate.RevocationDate != 0 {
+		return 0, fmt.Errorf("Client certificate %d for system %d was revoked", agentCertificate.ID, agentCertificate.SystemID)
+	}
+
+	return agentCertificate.SystemID, nil
+}
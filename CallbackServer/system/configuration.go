@@ -11,8 +11,10 @@ package system
 
 import (
 	"encoding/json"
+	"fmt"
 	"io/ioutil"
 
+	"qdserver/lib/storage"
 	"qdserver/lib/utils"
 )
 
@@ -21,19 +23,90 @@ type ConfigurationDatabase struct {
 	ConnectionString string `json:"connection_string"`
 }
 
-// ConfigurationAWS is a sub-element of Configuration
+// ConfigurationAWS is a sub-element of Configuration, kept so older config files that only list S3 buckets still work
 type ConfigurationAWS struct {
 	ExeUpload     utils.AwsS3 `json:"exe_upload"`
 	CatalogUpload utils.AwsS3 `json:"catalog_upload"`
 }
 
+// ConfigurationStorage is a sub-element of Configuration and says where files are kept
+type ConfigurationStorage struct {
+	ExeUpload     storage.Config `json:"exe_upload"`
+	CatalogUpload storage.Config `json:"catalog_upload"`
+	Updates       storage.Config `json:"updates"` // Agent updates, named update-<from>-<to>.exe
+}
+
+// ConfigurationTasks is a sub-element of Configuration and controls how agent tasks are retried
+type ConfigurationTasks struct {
+	MaxAttempts int   `json:"max_attempts"` // Number of times a task is handed out before we give up on it
+	AckTimeout  int64 `json:"ack_timeout"`  // Seconds to wait on the agent to report back before resending
+	Expiration  int64 `json:"expiration"`   // Seconds after creation that a task is no longer worth sending
+
+	MaxPerResponse int `json:"max_per_response"` // Most tasks handed out at once, to agents that support the Tasks command
+}
+
+// ConfigurationPoll is a sub-element of Configuration and controls how long agent polls are held open
+type ConfigurationPoll struct {
+	MaxWait int64 `json:"max_wait"` // Seconds to hold a poll open, which must be less than any proxy's timeout
+}
+
+// ConfigurationUploads is a sub-element of Configuration and limits chunked uploads
+type ConfigurationUploads struct {
+	MaxFileSize  int64 `json:"max_file_size"`  // Largest file we'll accept, in bytes
+	MaxChunkSize int64 `json:"max_chunk_size"` // Largest chunk an agent may send in one request, in bytes
+	Expiration   int64 `json:"expiration"`     // Seconds without progress before an upload is started over
+}
+
+// ConfigurationAuth is a sub-element of Configuration and controls how agent requests are authenticated
+type ConfigurationAuth struct {
+	RequireSignatures bool  `json:"require_signatures"` // Reject unsigned requests, even from agents registered before secrets were given out
+	MaxClockSkew      int64 `json:"max_clock_skew"`     // Seconds a signed request's timestamp may be off from ours
+}
+
+// ConfigurationTLS is a sub-element of Configuration, for when we terminate TLS ourselves instead of nginx.
+// Agents get client certificates from our CA when they register, which identify them on later requests.
+type ConfigurationTLS struct {
+	Enabled            bool   `json:"enabled"`
+	CertFile           string `json:"cert_file"`            // Server certificate
+	KeyFile            string `json:"key_file"`             // Server key
+	CACertFile         string `json:"ca_cert_file"`         // CA that signs agent certificates, created if it and the key don't exist
+	CAKeyFile          string `json:"ca_key_file"`          // CA key
+	ClientCertValidity int64  `json:"client_cert_validity"` // Seconds an agent certificate is valid for
+	RequireClientCert  bool   `json:"require_client_cert"`  // Reject requests without a client certificate, other than registration
+}
+
+// ConfigurationCheckIn is a sub-element of Configuration and controls what is recorded when agents call in
+type ConfigurationCheckIn struct {
+	LastSeenInterval int64 `json:"last_seen_interval"` // Seconds LastSeen may be out of date before it is written again
+}
+
+// What RegisterAgent does when an agent registers from a machine we already have a system for
+const (
+	DuplicateActionReuse     = "reuse"     // Give the existing system a new UUID and secret, and hand it to the agent, if it can prove it was using it
+	DuplicateActionSuccessor = "successor" // Create a new system that retires the existing one as its predecessor, if the agent can prove it was using it
+	DuplicateActionNew       = "new"       // Create a new system, unrelated to the existing one
+)
+
+// ConfigurationRegistration is a sub-element of Configuration and controls how agents are registered
+type ConfigurationRegistration struct {
+	DuplicateAction string `json:"duplicate_action"` // One of the DuplicateAction constants
+}
+
 // Configuration is the main structure of our config.json file
 type Configuration struct {
-	ListeningPort string                `json:"listening_port"`
-	UploadPath    string                `json:"upload_path"`
-	AMQPServer    string                `json:"amqp_server"`
-	Database      ConfigurationDatabase `json:"database"`
-	Aws           ConfigurationAWS      `json:"aws"`
+	ListeningPort string                    `json:"listening_port"`
+	UploadPath    string                    `json:"upload_path"`
+	AMQPServer    string                    `json:"amqp_server"`
+	Database      ConfigurationDatabase     `json:"database"`
+	Aws           ConfigurationAWS          `json:"aws"`
+	Storage       ConfigurationStorage      `json:"storage"`
+	Auth          ConfigurationAuth         `json:"auth"`
+	TLS           ConfigurationTLS          `json:"tls"`
+	Tasks         ConfigurationTasks        `json:"tasks"`
+	Uploads       ConfigurationUploads      `json:"uploads"`
+	Registration  ConfigurationRegistration `json:"registration"`
+	CheckIn       ConfigurationCheckIn      `json:"check_in"`
+	Poll          ConfigurationPoll         `json:"poll"`
 }
 
 // Load parses our configuration file
@@ -51,6 +124,62 @@ func (configuration *Configuration) Load(filename string) (err error) {
 // Parse our configuration file
 func (configuration *Configuration) Parse(data []byte) (err error) {
 	err = json.Unmarshal(data, &configuration)
+	if err != nil {
+		return
+	}
+
+	// Defaults for older config files
+	if configuration.Tasks.MaxAttempts == 0 {
+		configuration.Tasks.MaxAttempts = 3
+	}
+	if configuration.Tasks.AckTimeout == 0 {
+		configuration.Tasks.AckTimeout = 60 * 30
+	}
+	if configuration.Tasks.Expiration == 0 {
+		configuration.Tasks.Expiration = 60 * 60 * 24 * 7
+	}
+	if configuration.Tasks.MaxPerResponse == 0 {
+		configuration.Tasks.MaxPerResponse = 20
+	}
+	if configuration.Poll.MaxWait == 0 {
+		configuration.Poll.MaxWait = 50
+	}
+	if configuration.Uploads.MaxFileSize == 0 {
+		configuration.Uploads.MaxFileSize = 1024 * 1024 * 100
+	}
+	if configuration.Uploads.MaxChunkSize == 0 {
+		configuration.Uploads.MaxChunkSize = 1024 * 1024 * 4
+	}
+	if configuration.Uploads.Expiration == 0 {
+		configuration.Uploads.Expiration = 60 * 60 * 24
+	}
+	if configuration.Storage.ExeUpload.Type == "" {
+		configuration.Storage.ExeUpload = storage.Config{Type: "s3", S3: configuration.Aws.ExeUpload}
+	}
+	if configuration.Storage.CatalogUpload.Type == "" {
+		configuration.Storage.CatalogUpload = storage.Config{Type: "s3", S3: configuration.Aws.CatalogUpload}
+	}
+	if configuration.Auth.MaxClockSkew == 0 {
+		configuration.Auth.MaxClockSkew = 60 * 5
+	}
+	if configuration.TLS.ClientCertValidity == 0 {
+		configuration.TLS.ClientCertValidity = 60 * 60 * 24 * 365
+	}
+	if configuration.Storage.Updates.Type == "" {
+		configuration.Storage.Updates = storage.Config{Type: "local", Path: "updates"}
+	}
+	if configuration.CheckIn.LastSeenInterval == 0 {
+		configuration.CheckIn.LastSeenInterval = 60
+	}
+	if configuration.Registration.DuplicateAction == "" {
+		configuration.Registration.DuplicateAction = DuplicateActionSuccessor
+	}
+
+	switch configuration.Registration.DuplicateAction {
+	case DuplicateActionReuse, DuplicateActionSuccessor, DuplicateActionNew:
+	default:
+		return fmt.Errorf("Unknown duplicate_action \"%s\"", configuration.Registration.DuplicateAction)
+	}
 
 	return
 }
@@ -13,6 +13,8 @@ import (
 	"github.com/coopernurse/gorp"
 	"github.com/streadway/amqp"
 	"github.com/zenazn/goji/web"
+
+	"qdserver/lib/agentca"
 )
 
 // Controller struct
@@ -28,6 +30,15 @@ func (controller *Controller) GetDatabase(c web.C) *gorp.DbMap {
 	return nil
 }
 
+// GetConfiguration helper
+func (controller *Controller) GetConfiguration(c web.C) *Configuration {
+	if config, ok := c.Env["Config"].(*Configuration); ok {
+		return config
+	}
+
+	return nil
+}
+
 // GetQueueChannel helper
 func (controller *Controller) GetQueueChannel(c web.C) *amqp.Channel {
 	if ch, ok := c.Env["QueueChannel"].(*amqp.Channel); ok {
@@ -36,3 +47,30 @@ func (controller *Controller) GetQueueChannel(c web.C) *amqp.Channel {
 
 	return nil
 }
+
+// GetStores helper
+func (controller *Controller) GetStores(c web.C) *Stores {
+	if stores, ok := c.Env["Stores"].(*Stores); ok {
+		return stores
+	}
+
+	return nil
+}
+
+// GetWaiters helper
+func (controller *Controller) GetWaiters(c web.C) *Waiters {
+	if waiters, ok := c.Env["Waiters"].(*Waiters); ok {
+		return waiters
+	}
+
+	return nil
+}
+
+// GetCA helper, returns nil when we don't have a CA
+func (controller *Controller) GetCA(c web.C) *agentca.CA {
+	if ca, ok := c.Env["CA"].(*agentca.CA); ok {
+		return ca
+	}
+
+	return nil
+}
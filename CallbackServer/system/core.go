@@ -10,6 +10,7 @@
 package system
 
 import (
+	"crypto/tls"
 	"io"
 	"net/http"
 	"reflect"
@@ -20,7 +21,10 @@ import (
 	"github.com/streadway/amqp"
 	"github.com/zenazn/goji/web"
 
+	"qdserver/lib/agentca"
+	"qdserver/lib/migrations"
 	"qdserver/lib/models"
+	"qdserver/lib/storage"
 	"qdserver/lib/taskqueue"
 )
 
@@ -30,6 +34,16 @@ type Application struct {
 	DBSession       *gorp.DbMap
 	QueueConnection *amqp.Connection
 	QueueChannel    *amqp.Channel
+	Stores          *Stores
+	CA              *agentca.CA // Only set when TLS is enabled
+	Waiters         *Waiters    // Agent polls being held open
+}
+
+// Stores are where the files we keep live
+type Stores struct {
+	ExeUpload     storage.Store
+	CatalogUpload storage.Store
+	Updates       storage.Store
 }
 
 // Init initializes our globals
@@ -42,6 +56,8 @@ func (application *Application) Init(filename *string) {
 		log.Fatalf("Can't read configuration file: %s", err)
 		panic(err)
 	}
+
+	application.Waiters = NewWaiters()
 }
 
 // ConnectToDatabase initializes our database connection
@@ -53,10 +69,70 @@ func (application *Application) ConnectToDatabase() {
 		panic(err)
 	}
 
+	// Don't run against a schema we don't understand
+	if err = migrations.CheckCurrent(dbmap); err != nil {
+		log.Fatalf("%v", err)
+		panic(err)
+	}
+
 	// Store our session
 	application.DBSession = dbmap
 }
 
+// ConnectToStorage sets up the stores for uploaded files and updates
+func (application *Application) ConnectToStorage() {
+	var err error
+	stores := &Stores{}
+	config := application.Configuration.Storage
+
+	if stores.ExeUpload, err = storage.New(config.ExeUpload); err != nil {
+		log.Fatalf("Unable to set up storage for executables: %v", err)
+		panic(err)
+	}
+	if stores.CatalogUpload, err = storage.New(config.CatalogUpload); err != nil {
+		log.Fatalf("Unable to set up storage for catalogs: %v", err)
+		panic(err)
+	}
+	if stores.Updates, err = storage.New(config.Updates); err != nil {
+		log.Fatalf("Unable to set up storage for updates: %v", err)
+		panic(err)
+	}
+
+	application.Stores = stores
+}
+
+// LoadCA loads our CA for signing agent certificates, creating it the first time
+func (application *Application) LoadCA() {
+	config := application.Configuration.TLS
+
+	ca, err := agentca.Load(config.CACertFile, config.CAKeyFile)
+	if err != nil {
+		log.Fatalf("Unable to load CA: %v", err)
+		panic(err)
+	}
+
+	application.CA = ca
+}
+
+// TLSConfig returns the settings for serving TLS.  Client certificates are optional at this level, as agents
+// don't have one until they register, so ApplyAgentAuth decides what to do about requests without one.
+func (application *Application) TLSConfig() *tls.Config {
+	config := application.Configuration.TLS
+
+	cert, err := tls.LoadX509KeyPair(config.CertFile, config.KeyFile)
+	if err != nil {
+		log.Fatalf("Unable to load server certificate: %v", err)
+		panic(err)
+	}
+
+	return &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		ClientAuth:   tls.VerifyClientCertIfGiven,
+		ClientCAs:    application.CA.CertPool(),
+		MinVersion:   tls.VersionTLS12,
+	}
+}
+
 // ConnectToQueues initializes our AMQP connection
 func (application *Application) ConnectToQueues() {
 	conn, err := amqp.Dial(application.Configuration.AMQPServer)
@@ -12,6 +12,7 @@ package system
 import (
 	"net/http"
 
+	log "github.com/Sirupsen/logrus"
 	"github.com/zenazn/goji/web"
 )
 
@@ -21,6 +22,51 @@ func (application *Application) ApplyConfig(c *web.C, h http.Handler) http.Handl
 		c.Env["DBSession"] = application.DBSession
 		c.Env["Config"] = application.Configuration
 		c.Env["QueueChannel"] = application.QueueChannel
+		c.Env["Stores"] = application.Stores
+		c.Env["CA"] = application.CA
+		c.Env["Waiters"] = application.Waiters
+
+		h.ServeHTTP(w, r)
+	}
+	return http.HandlerFunc(fn)
+}
+
+// ApplyAgentAuth checks the client certificates and signatures on agent requests.  Registration is the only route
+// an agent can call before it has a certificate or secret.
+func (application *Application) ApplyAgentAuth(c *web.C, h http.Handler) http.Handler {
+	fn := func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/" || r.URL.Path == "/api/v1/Register" {
+			// A reinstalled agent may still have the certificate of the system it was using
+			if systemID, err := application.authenticateCertificate(r); err == nil && systemID != 0 {
+				c.Env["AuthenticatedSystemID"] = systemID
+			}
+			h.ServeHTTP(w, r)
+			return
+		}
+
+		certSystemID, err := application.authenticateCertificate(r)
+		if err != nil {
+			log.Warningf("Rejecting request to %s from %s, %v", r.URL.Path, r.RemoteAddr, err)
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+
+		systemID, err := application.authenticateAgent(r)
+		if err != nil {
+			log.Warningf("Rejecting request to %s from %s, %v", r.URL.Path, r.RemoteAddr, err)
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+
+		if certSystemID != 0 {
+			if systemID != 0 && systemID != certSystemID {
+				log.Warningf("Rejecting request to %s from %s, certificate is for system %d but signed by system %d", r.URL.Path, r.RemoteAddr, certSystemID, systemID)
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			systemID = certSystemID
+		}
+		c.Env["AuthenticatedSystemID"] = systemID
 
 		h.ServeHTTP(w, r)
 	}
@@ -0,0 +1,137 @@
+////////////////////////////////////////////////////////////////////////////
+//
+// Summit Route End Point Protection
+//
+// This source code is licensed under the BSD-style license found in the
+// LICENSE file in the root directory of this source tree.
+//
+/////////////////////////////////////////////////////////////////////////////
+
+package system
+
+import (
+	"sync"
+
+	log "github.com/Sirupsen/logrus"
+
+	"qdserver/lib/taskqueue"
+)
+
+// Waiters tracks the agent polls being held open on this server, so they can be answered as soon as there is a task
+type Waiters struct {
+	mutex   sync.Mutex
+	waiting map[int64][]chan bool
+}
+
+// NewWaiters creates an empty Waiters
+func NewWaiters() *Waiters {
+	return &Waiters{waiting: make(map[int64][]chan bool)}
+}
+
+// Add registers a poll from the system.  The returned channel receives a value when the system is woken.
+// Call Remove when done with it.
+func (waiters *Waiters) Add(systemID int64) chan bool {
+	wake := make(chan bool, 1)
+
+	waiters.mutex.Lock()
+	defer waiters.mutex.Unlock()
+	waiters.waiting[systemID] = append(waiters.waiting[systemID], wake)
+
+	return wake
+}
+
+// Remove unregisters a poll added with Add
+func (waiters *Waiters) Remove(systemID int64, wake chan bool) {
+	waiters.mutex.Lock()
+	defer waiters.mutex.Unlock()
+
+	channels := waiters.waiting[systemID]
+	for i, channel := range channels {
+		if channel == wake {
+			channels = append(channels[:i], channels[i+1:]...)
+			break
+		}
+	}
+
+	if len(channels) == 0 {
+		delete(waiters.waiting, systemID)
+	} else {
+		waiters.waiting[systemID] = channels
+	}
+}
+
+// Wake answers every poll the system has open on this server
+func (waiters *Waiters) Wake(systemID int64) {
+	waiters.mutex.Lock()
+	defer waiters.mutex.Unlock()
+
+	for _, wake := range waiters.waiting[systemID] {
+		select {
+		case wake <- true:
+		default:
+			// Already woken
+		}
+	}
+}
+
+// ListenForWakes receives wake messages from the queue, sent by the WebServer or commander when they
+// give a system a task, and wakes any poll the system has open on this server.
+// This never returns unless the queue connection is lost, so run it in its own goroutine.
+func (application *Application) ListenForWakes() {
+	ch, err := application.QueueConnection.Channel()
+	if err != nil {
+		log.Errorf("Failed to open a channel for wake messages: %v", err)
+		return
+	}
+	defer ch.Close()
+
+	if err = TaskQueue.DeclareWakeExchange(ch); err != nil {
+		log.Errorf("Failed to declare wake exchange: %v", err)
+		return
+	}
+
+	// Each server gets its own queue, which goes away with it
+	queue, err := ch.QueueDeclare(
+		"",    // name, so the server picks one
+		false, // durable
+		true,  // delete when unused
+		true,  // exclusive
+		false, // no-wait
+		nil,   // arguments
+	)
+	if err != nil {
+		log.Errorf("Failed to declare wake queue: %v", err)
+		return
+	}
+
+	if err = ch.QueueBind(queue.Name, "", TaskQueue.WakeExchange, false, nil); err != nil {
+		log.Errorf("Failed to bind wake queue: %v", err)
+		return
+	}
+
+	deliveries, err := ch.Consume(
+		queue.Name, // queue
+		"",         // consumer
+		true,       // auto-ack
+		true,       // exclusive
+		false,      // no-local
+		false,      // no-wait
+		nil,        // arguments
+	)
+	if err != nil {
+		log.Errorf("Failed to consume wake messages: %v", err)
+		return
+	}
+
+	for delivery := range deliveries {
+		systemID, err := TaskQueue.ParseWakeMessage(delivery.Body)
+		if err != nil {
+			log.Errorf("Unable to parse wake message, %v", err)
+			continue
+		}
+
+		application.Waiters.Wake(systemID)
+	}
+
+	log.Errorf("Stopped receiving wake messages, polls will only be answered when they time out")
+}
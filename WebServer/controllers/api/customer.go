@@ -0,0 +1,115 @@
+////////////////////////////////////////////////////////////////////////////
+//
+// Summit Route End Point Protection
+//
+// This source code is licensed under the BSD-style license found in the
+// LICENSE file in the root directory of this source tree.
+//
+/////////////////////////////////////////////////////////////////////////////
+
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/zenazn/goji/web"
+
+	"qdserver/WebServer/system"
+	"qdserver/WebServer/tenant"
+	"qdserver/lib/models"
+)
+
+// maxProcessEventRetention is the most days a customer can choose to keep process events for, other than forever
+const maxProcessEventRetention = 10 * 365
+
+// findCustomer returns the user's customer
+func findCustomer(db *tenant.DB) (*models.Customer, error) {
+	var customer models.Customer
+	err := db.SelectOne(&customer, "SELECT * FROM {customers}", nil)
+	if err != nil {
+		return nil, err
+	}
+	return &customer, nil
+}
+
+// CustomerSettingsJSON route returns how long the customer keeps process events, and whether they are archived.
+// DefaultRetention is what a ProcessEventRetention of 0 means, where 0 is forever.
+func (controller *Controller) CustomerSettingsJSON(c web.C, r *http.Request) (string, int) {
+	db := controller.GetTenantDatabase(c)
+	if db == nil {
+		// This should not happen
+		log.Errorf("User was not of the expected form")
+		return "", http.StatusBadRequest
+	}
+
+	customer, err := findCustomer(db)
+	if err != nil {
+		log.Errorf("Unable to find customer, %v", err)
+		return "", http.StatusBadRequest
+	}
+
+	config := c.Env["Config"].(*system.Configuration)
+
+	type CustomerSettingsJSON struct {
+		ProcessEventRetention int64
+		ArchiveProcessEvents  bool
+		DefaultRetention      int64
+		ArchiveAvailable      bool // False if the server has no archive store, so events can't be archived
+	}
+
+	contents, err := json.Marshal(CustomerSettingsJSON{
+		ProcessEventRetention: customer.ProcessEventRetention,
+		ArchiveProcessEvents:  customer.ArchiveProcessEvents,
+		DefaultRetention:      config.Retention.DefaultDays,
+		ArchiveAvailable:      config.Storage.Archive.Type != "",
+	})
+	if err != nil {
+		log.Errorf("Unable to marshal json")
+		return "", http.StatusBadRequest
+	}
+
+	return string(contents), http.StatusOK
+}
+
+// PostCustomerSettingsJSON route sets ProcessEventRetention (days, 0 for the server's default) and
+// ArchiveProcessEvents ("true" or "false")
+func (controller *Controller) PostCustomerSettingsJSON(c web.C, r *http.Request) (string, int) {
+	db := controller.GetTenantDatabase(c)
+	if db == nil {
+		// This should not happen
+		log.Errorf("User was not of the expected form")
+		return "", http.StatusBadRequest
+	}
+
+	customer, err := findCustomer(db)
+	if err != nil {
+		log.Errorf("Unable to find customer, %v", err)
+		return "", http.StatusBadRequest
+	}
+
+	if retentionStr := r.FormValue("ProcessEventRetention"); retentionStr != "" {
+		retention, err := strconv.ParseInt(retentionStr, 10, 64)
+		if err != nil || retention < 0 || retention > maxProcessEventRetention {
+			return "bad retention", http.StatusBadRequest
+		}
+		customer.ProcessEventRetention = retention
+	}
+
+	if archiveStr := r.FormValue("ArchiveProcessEvents"); archiveStr != "" {
+		archive := archiveStr == "true"
+		if archive && c.Env["Config"].(*system.Configuration).Storage.Archive.Type == "" {
+			return "archive not available", http.StatusBadRequest
+		}
+		customer.ArchiveProcessEvents = archive
+	}
+
+	if _, err = db.Update(customer); err != nil {
+		log.Errorf("Can't update customer: %v", err)
+		return "", http.StatusBadRequest
+	}
+
+	return "", http.StatusOK
+}
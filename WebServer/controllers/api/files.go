@@ -17,10 +17,10 @@ import (
 	"net/http"
 
 	log "github.com/Sirupsen/logrus"
-	"github.com/coopernurse/gorp"
 	"github.com/zenazn/goji/web"
 
 	"qdserver/WebServer/helpers"
+	"qdserver/WebServer/tenant"
 	"qdserver/lib/models"
 	"qdserver/lib/utils"
 )
@@ -78,7 +78,7 @@ func (ff *FilteredFile) GetSignerSubjectShortName() string {
 // FilterFiles is a class used to return data about a customer's files, given various filters
 //
 type FilterFiles struct {
-	db                   *gorp.DbMap
+	db                   *tenant.DB
 	restrictedView       string
 	restrictions         []string
 	filterVars           map[string]interface{}
@@ -143,8 +143,9 @@ func (ff *FilterFiles) InitRestrictedView() {
 
 	// Set up a view that we'll use that only returns the file IDs
 	ff.restrictedView = fmt.Sprintf(`(SELECT FileId
-		FROM systemSets ss, systems s, filetosystemmap fsm, ExecutableFiles f
-		WHERE ss.CustomerID=:customerID AND ss.ID =s.SystemSetID AND s.ID=fsm.SystemID AND fsm.FileID=f.ID
+		FROM {systems} s, {executablefiles} f, {filetosystemmap} fsm
+		LEFT JOIN filepaths fp ON fsm.FilePathID=fp.ID
+		WHERE s.ID=fsm.SystemID AND fsm.FileID=f.ID
 		%s GROUP BY FileId) restrictors`, restrictionsStr)
 }
 
@@ -214,17 +215,16 @@ func (ff *FilterFiles) GetSQL(whatToSelect string, ordering string) (sqlstring s
 		FROM (
 			SELECT
 				restrictors.FileId,
-				FIRST(fsm.FilePath) as FilePath,
+				FIRST(coalesce(fp.Path, '')) as FilePath,
 				MIN(fsm.FirstSeen) AS FirstSeen,
 				MAX(fsm.LastSeen) AS LastSeen,
 				COUNT(*) as NumSystems
-			FROM %s, systemSets ss, systems s, filetosystemmap fsm
-			WHERE ss.CustomerID=:customerID
-				AND ss.ID =s.SystemSetID
-				AND s.ID=fsm.SystemID
+			FROM %s, {systems} s, {filetosystemmap} fsm
+			LEFT JOIN filepaths fp ON fsm.FilePathID=fp.ID
+			WHERE s.ID=fsm.SystemID
 				AND restrictors.FileId=fsm.FileId
 			GROUP BY restrictors.FileId
-			) v, ExecutableFiles f
+			) v, {executablefiles} f
 			LEFT OUTER JOIN
 			(SELECT * FROM FileToSignerMap ftsm, Signers s WHERE ftsm.SignerID = s.ID) fts
 			ON f.id = fts.FileID
@@ -244,13 +244,12 @@ func (ff *FilterFiles) SetFilterVar(name string, value interface{}) {
 //
 // NewFilterFiles contructs a FilterFiles object
 //
-func NewFilterFiles(db *gorp.DbMap, customerID int64) *FilterFiles {
+func NewFilterFiles(db *tenant.DB) *FilterFiles {
 	restrictionsMaxSize := 0 // Arbitrary
 	ff := &FilterFiles{db: db, restrictedView: "", restrictions: make([]string, restrictionsMaxSize), outerRestrictions: make([]string, restrictionsMaxSize)}
 	ff.filterVars = make(map[string]interface{})
 	ff.outerFilterVars = make(map[string]interface{})
 
-	ff.filterVars["customerID"] = customerID
 	ff.filterVars["limit"] = "10"
 	ff.filterVars["offset"] = "0"
 	ff.filterVars["sortColumn"] = "LastSeen"
@@ -263,12 +262,8 @@ func NewFilterFiles(db *gorp.DbMap, customerID int64) *FilterFiles {
 // FilesJSON route
 //
 func (controller *Controller) FilesJSON(c web.C, r *http.Request) (string, int) {
-	db := controller.GetDatabase(c)
-
-	// Get our user object
-	var user models.User
-	user, ok := c.Env["User"].(models.User)
-	if !ok {
+	db := controller.GetTenantDatabase(c)
+	if db == nil {
 		// This should not happen
 		log.Errorf("User was not of the expected form")
 		return "", http.StatusBadRequest
@@ -279,7 +274,7 @@ func (controller *Controller) FilesJSON(c web.C, r *http.Request) (string, int)
 	dataTableParams.SortColumn = getExeSortColumn(dataTableParams.SortColumn)
 	// TODO This filter fallback should be cleaner.  My goal is if the user types in unsupported characters, that I just show nothing.
 
-	var ff = *NewFilterFiles(db, user.CustomerID)
+	var ff = *NewFilterFiles(db)
 
 	var filterString string
 	filterString = ""
@@ -312,11 +307,11 @@ func (controller *Controller) FilesJSON(c web.C, r *http.Request) (string, int)
 				} else if element.Category == "Signer" {
 					ff.AddOuterRestriction(fmt.Sprintf("fts.SubjectShortName %s :%s", utils.GetStringMatchOperator(element.Operator), restrictionVar), restrictionVar, element.Value)
 				} else if element.Category == "Path" {
-					value := element.Value
+					value := utils.PathFilterValue(element.Operator, element.Value)
 					if element.Operator == "contains" || element.Operator == "!contains" {
 						value = fmt.Sprintf("%%%s%%", value)
 					}
-					ff.AddRestriction(fmt.Sprintf("FilePath %s :%s", utils.GetStringSubstrMatchOperator(element.Operator), restrictionVar), restrictionVar, value)
+					ff.AddRestriction(fmt.Sprintf("coalesce(fp.Path, '') %s :%s", utils.GetStringSubstrMatchOperator(element.Operator), restrictionVar), restrictionVar, value)
 				} else if element.Category == "Count" {
 					ff.AddOuterRestriction(fmt.Sprintf("NumSystems %s :%s", utils.GetIntMatchOperator(element.Operator), restrictionVar), restrictionVar, element.Value)
 				} else if element.Category == "FirstSeen" {
@@ -412,16 +407,49 @@ func (controller *Controller) FilesJSON(c web.C, r *http.Request) (string, int)
 	return string(contents), http.StatusOK
 }
 
+// getExecutionTypeStrings converts the ExecutionType flags of a file for display
+func getExecutionTypeStrings(executionType int) []string {
+	types := []string{}
+	if executionType&models.ExecutionTypeExe != 0 {
+		types = append(types, "exe")
+	}
+	if executionType&models.ExecutionTypeDll != 0 {
+		types = append(types, "dll")
+	}
+	if executionType&models.ExecutionTypeSys != 0 {
+		types = append(types, "sys")
+	}
+	return types
+}
+
+// getSignatureStatusString converts the SignatureStatus of a file for display
+func getSignatureStatusString(status int) string {
+	switch status {
+	case models.SignatureStatusUnsigned:
+		return "unsigned"
+	case models.SignatureStatusValid:
+		return "valid"
+	case models.SignatureStatusInvalid:
+		return "invalid"
+	case models.SignatureStatusExpired:
+		return "expired"
+	case models.SignatureStatusCatalog:
+		return "catalog"
+	case models.SignatureStatusUntrusted:
+		return "untrusted"
+	}
+	return "unknown"
+}
+
+// maxFileLoads is how many of the most recent module and driver loads of a file are sent with its info
+const maxFileLoads = 25
+
 //
 // FileInfoJSON route
 //
 func (controller *Controller) FileInfoJSON(c web.C, r *http.Request) (string, int) {
-	db := controller.GetDatabase(c)
-
-	// Get our user object
-	var user models.User
-	user, ok := c.Env["User"].(models.User)
-	if !ok {
+	db := controller.GetTenantDatabase(c)
+	if db == nil {
 		// This should not happen
 		log.Errorf("User was not of the expected form")
 		return "", http.StatusBadRequest
@@ -434,7 +462,7 @@ func (controller *Controller) FileInfoJSON(c web.C, r *http.Request) (string, in
 		return "", http.StatusBadRequest
 	}
 
-	var ff = *NewFilterFiles(db, user.CustomerID)
+	var ff = *NewFilterFiles(db)
 
 	// Apply filters
 	if sha256HexString != "" {
@@ -471,6 +499,9 @@ func (controller *Controller) FileInfoJSON(c web.C, r *http.Request) (string, in
 		InternalName     string
 		FileVersion      string
 		OriginalFilename string
+		SignatureStatus  int
+		UploadDate       int64
+		ExecutionType    int
 
 		Subject                   sql.NullString
 		SerialNumber              []byte
@@ -491,11 +522,14 @@ func (controller *Controller) FileInfoJSON(c web.C, r *http.Request) (string, in
 			InternalName,
 			FileVersion,
 			OriginalFilename,
+			SignatureStatus,
+			UploadDate,
+			ExecutionType,
 			Subject,
 			SerialNumber,
 			DigestAlgorithm,
 			DigestEncryptionAlgorithm
-		FROM ExecutableFiles e
+		FROM {executablefiles} e
 		LEFT JOIN (
 				SELECT *
 				FROM FileToSignerMap ftsmap, Signers s
@@ -510,17 +544,68 @@ func (controller *Controller) FileInfoJSON(c web.C, r *http.Request) (string, in
 		return "", http.StatusBadRequest
 	}
 
+	// Most recent times the file was loaded as a DLL or driver on the customer's systems
+	type LoadData struct {
+		Type        string // "dll" or "sys"
+		SystemUUID  []byte
+		MachineName string
+		Comment     string
+		FilePath    string
+		EventTime   int64
+		ProcessPath string // Process the DLL was loaded into, empty for drivers or if we don't know
+	}
+
+	var loads []LoadData
+	_, err = ff.db.Select(&loads, `SELECT
+			'dll' as Type, s.SystemUUID, s.MachineName, s.Comment, coalesce(mfp.Path, '') as FilePath, m.EventTime,
+			coalesce(pfp.Path, '') as ProcessPath
+			FROM {systems} s, {moduleloadevents} m
+			LEFT JOIN FilePaths mfp ON m.FilePathID=mfp.ID
+			LEFT JOIN {processevents} p ON m.ProcessEventID=p.ID
+			LEFT JOIN FilePaths pfp ON p.FilePathID=pfp.ID
+			WHERE s.ID=m.SystemID and m.ExecutableFileID=:fileID
+		UNION ALL
+		SELECT
+			'sys' as Type, s.SystemUUID, s.MachineName, s.Comment, coalesce(dfp.Path, '') as FilePath, d.EventTime,
+			'' as ProcessPath
+			FROM {systems} s, {driverloadevents} d
+			LEFT JOIN FilePaths dfp ON d.FilePathID=dfp.ID
+			WHERE s.ID=d.SystemID and d.ExecutableFileID=:fileID
+		ORDER BY EventTime DESC
+		LIMIT :limit`,
+		map[string]interface{}{
+			"fileID": filteredfile.FileID,
+			"limit":  maxFileLoads,
+		})
+	if err != nil {
+		log.Errorf("Unable to find loads of file %d, %v", filteredfile.FileID, err)
+		return "", http.StatusBadRequest
+	}
+
+	type LoadJSON struct {
+		Type        string
+		SystemUUID  string
+		SystemName  string
+		FilePath    string
+		EventTime   string
+		ProcessPath string
+	}
+
 	type FileDataJSON struct {
 		Sha256 string
 		Sha1   string
 		Md5    string
 
+		LoadedAs []string // How the file has been seen loaded: "exe", "dll", or "sys"
+		Loads    []LoadJSON
+
 		FilePath   string
 		FirstSeen  string
 		LastSeen   string
 		NumSystems int
 
 		Size             int
+		Uploaded         bool // We have a copy that can be downloaded
 		CompanyName      string
 		ProductVersion   string
 		ProductName      string
@@ -529,6 +614,7 @@ func (controller *Controller) FileInfoJSON(c web.C, r *http.Request) (string, in
 		FileVersion      string
 		OriginalFilename string
 
+		SignatureStatus           string
 		SubjectShortName          string
 		Subject                   string
 		SerialNumber              string
@@ -541,12 +627,37 @@ func (controller *Controller) FileInfoJSON(c web.C, r *http.Request) (string, in
 	fileDataJSON.Sha1 = hex.EncodeToString(detailedFileData.Sha1)
 	fileDataJSON.Md5 = hex.EncodeToString(detailedFileData.Md5)
 
+	fileDataJSON.LoadedAs = getExecutionTypeStrings(detailedFileData.ExecutionType)
+	fileDataJSON.Loads = make([]LoadJSON, len(loads), len(loads))
+	for index, load := range loads {
+		systemUUID, err := utils.ByteArrayToUUIDString(load.SystemUUID)
+		if err != nil {
+			log.Errorf("Unable to parse SystemUUID, %v", err)
+			return "", http.StatusBadRequest
+		}
+
+		systemName := load.Comment
+		if systemName == "" {
+			systemName = load.MachineName
+		}
+
+		fileDataJSON.Loads[index] = LoadJSON{
+			Type:        load.Type,
+			SystemUUID:  systemUUID,
+			SystemName:  systemName,
+			FilePath:    load.FilePath,
+			EventTime:   utils.Int64ToUnixTimeString(load.EventTime, false),
+			ProcessPath: load.ProcessPath,
+		}
+	}
+
 	fileDataJSON.FilePath = filteredfile.FilePath
 	fileDataJSON.FirstSeen = utils.Int64ToUnixTimeString(filteredfile.FirstSeen, false)
 	fileDataJSON.LastSeen = utils.Int64ToUnixTimeString(filteredfile.LastSeen, false)
 	fileDataJSON.NumSystems = filteredfile.NumSystems
 
 	fileDataJSON.Size = detailedFileData.Size
+	fileDataJSON.Uploaded = detailedFileData.UploadDate != 0
 	fileDataJSON.CompanyName = detailedFileData.CompanyName
 	fileDataJSON.ProductVersion = detailedFileData.ProductVersion
 	fileDataJSON.ProductName = detailedFileData.ProductName
@@ -555,6 +666,7 @@ func (controller *Controller) FileInfoJSON(c web.C, r *http.Request) (string, in
 	fileDataJSON.FileVersion = detailedFileData.FileVersion
 	fileDataJSON.OriginalFilename = detailedFileData.OriginalFilename
 
+	fileDataJSON.SignatureStatus = getSignatureStatusString(detailedFileData.SignatureStatus)
 	fileDataJSON.SubjectShortName = filteredfile.GetSignerSubjectShortName()
 	fileDataJSON.Subject = utils.GetNullString(detailedFileData.Subject, "")
 	fileDataJSON.SerialNumber = hex.EncodeToString(detailedFileData.SerialNumber)
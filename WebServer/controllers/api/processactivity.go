@@ -0,0 +1,164 @@
+////////////////////////////////////////////////////////////////////////////
+//
+// Summit Route End Point Protection
+//
+// This source code is licensed under the BSD-style license found in the
+// LICENSE file in the root directory of this source tree.
+//
+/////////////////////////////////////////////////////////////////////////////
+
+package api
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/zenazn/goji/web"
+
+	"qdserver/WebServer/helpers"
+	"qdserver/lib/retention"
+	"qdserver/lib/utils"
+)
+
+const (
+	maxProcessActivityRows       = 1000
+	defaultProcessActivityWindow = 30 * retention.SecondsPerDay // Seconds looked back over when no window is given
+)
+
+// ProcessActivityJSON route returns how many times each file ran on each system each day, from the process events and
+// the daily roll-ups of those that have expired, so it covers as far back as we have.  It needs "system" (a system
+// UUID), "sha256" (of a file), or both, and takes "from" and "to" (unix times), which default to the last 30 days.
+func (controller *Controller) ProcessActivityJSON(c web.C, r *http.Request) (string, int) {
+	db := controller.GetTenantDatabase(c)
+	if db == nil {
+		// This should not happen
+		log.Errorf("User was not of the expected form")
+		return "", http.StatusBadRequest
+	}
+
+	systemUUIDStr := helpers.GetParam(r.URL.Query(), "system", "^[a-f0-9]{8}-[a-f0-9]{4}-[a-f0-9]{4}-[a-f0-9]{4}-[a-f0-9]{12}$", "")
+	sha256HexString := helpers.GetParam(r.URL.Query(), "sha256", "^[a-f0-9]{64}$", "")
+	if systemUUIDStr == "" && sha256HexString == "" {
+		log.Errorf("No system or file given")
+		return "", http.StatusBadRequest
+	}
+
+	to, err := strconv.ParseInt(helpers.GetParam(r.URL.Query(), "to", "^[0-9]+$", strconv.FormatInt(utils.DBTimeNow(), 10)), 10, 64)
+	if err != nil {
+		log.Errorf("Badly formatted to time")
+		return "", http.StatusBadRequest
+	}
+	from, err := strconv.ParseInt(helpers.GetParam(r.URL.Query(), "from", "^[0-9]+$", strconv.FormatInt(to-defaultProcessActivityWindow, 10)), 10, 64)
+	if err != nil {
+		log.Errorf("Badly formatted from time")
+		return "", http.StatusBadRequest
+	}
+
+	// Roll-ups are by whole day, so include all of the first and last days
+	params := map[string]interface{}{
+		"from": from - from%retention.SecondsPerDay,
+		"to":   to - to%retention.SecondsPerDay + retention.SecondsPerDay,
+	}
+	where := ""
+
+	if systemUUIDStr != "" {
+		system, err := findCustomerSystem(db, systemUUIDStr)
+		if err != nil {
+			log.Errorf("Unable to find system, %v", err)
+			return "", http.StatusBadRequest
+		}
+		params["systemID"] = system.ID
+		where += " and a.SystemID = :systemID"
+	}
+
+	if sha256HexString != "" {
+		sha256, err := hex.DecodeString(sha256HexString)
+		if err != nil {
+			log.Errorf("Unable to decode Sha256: %v", err)
+			return "", http.StatusBadRequest
+		}
+		fileID, err := db.SelectInt("SELECT coalesce(min(f.ID), 0) FROM {executablefiles} f WHERE f.Sha256=:sha256",
+			map[string]interface{}{
+				"sha256": sha256,
+			})
+		if err != nil {
+			log.Errorf("Unable to find file, %v", err)
+			return "", http.StatusBadRequest
+		}
+		params["fileID"] = fileID
+		where += " and a.ExecutableFileID = :fileID"
+	}
+
+	type activityRow struct {
+		Day         int64
+		SystemUUID  []byte
+		MachineName string
+		Sha256      []byte
+		Events      int64
+		FirstSeen   int64
+		LastSeen    int64
+	}
+
+	var rows []activityRow
+	_, err = db.Select(&rows, `SELECT act.Day, s.SystemUUID, s.MachineName, e.Sha256, act.Events, act.FirstSeen, act.LastSeen
+		FROM (`+retention.DailyActivitySelect("{processeventrollups}", "{processevents}", where)+`) act
+		JOIN {systems} s ON s.ID = act.SystemID
+		JOIN {executablefiles} e ON e.ID = act.ExecutableFileID
+		ORDER BY act.Day DESC, act.Events DESC
+		LIMIT `+strconv.Itoa(maxProcessActivityRows+1), params)
+	if err != nil {
+		log.Errorf("Unable to find process activity, %v", err)
+		return "", http.StatusBadRequest
+	}
+
+	type ActivityJSON struct {
+		Day        string
+		SystemUUID string
+		SystemName string
+		Sha256     string
+		Events     int64
+		FirstSeen  string
+		LastSeen   string
+	}
+
+	type ActivityResponse struct {
+		Activity  []ActivityJSON
+		Truncated bool // True if there were too many rows to include them all
+	}
+
+	response := ActivityResponse{Activity: []ActivityJSON{}}
+	if len(rows) > maxProcessActivityRows {
+		rows = rows[:maxProcessActivityRows]
+		response.Truncated = true
+	}
+
+	for _, row := range rows {
+		systemUUID, err := utils.ByteArrayToUUIDString(row.SystemUUID)
+		if err != nil {
+			log.Errorf("Unable to convert system UUID, %v", err)
+			return "", http.StatusBadRequest
+		}
+
+		response.Activity = append(response.Activity, ActivityJSON{
+			Day:        time.Unix(row.Day, 0).UTC().Format("2006-01-02"), // Days are in UTC
+			SystemUUID: systemUUID,
+			SystemName: row.MachineName,
+			Sha256:     hex.EncodeToString(row.Sha256),
+			Events:     row.Events,
+			FirstSeen:  utils.Int64ToUnixTimeString(row.FirstSeen, false),
+			LastSeen:   utils.Int64ToUnixTimeString(row.LastSeen, false),
+		})
+	}
+
+	contents, err := json.Marshal(response)
+	if err != nil {
+		log.Errorf("Unable to marshal json")
+		return "", http.StatusBadRequest
+	}
+
+	return string(contents), http.StatusOK
+}
@@ -23,9 +23,22 @@ import (
 	"qdserver/lib/utils"
 )
 
-// ProcessesJSON route
+// processStateNames are how ProcessState values are shown to the user
+var processStateNames = map[int]string{
+	models.ProcessStateUnknown: "unknown",
+	models.ProcessStateRunning: "running",
+	models.ProcessStateExited:  "exited",
+}
+
+// ProcessesJSON route.  The optional "system" parameter limits the processes to one system, "state" to those
+// "running" or "exited", and "at" (unix time) to those that were running at that time.
 func (controller *Controller) ProcessesJSON(c web.C, r *http.Request) (string, int) {
-	db := controller.GetDatabase(c)
+	db := controller.GetTenantDatabase(c)
+	if db == nil {
+		// This should not happen
+		log.Errorf("User was not of the expected form")
+		return "", http.StatusBadRequest
+	}
 
 	// Read parameters
 	start := helpers.GetParam(r.URL.Query(), "start", "^[0-9]*$", "0")
@@ -35,56 +48,77 @@ func (controller *Controller) ProcessesJSON(c web.C, r *http.Request) (string, i
 		length = "100"
 	}
 	filter := helpers.GetParam(r.URL.Query(), "filter", "^[a-z]*$", "")
-
-	// Get our user object
-	var user models.User
-	user, ok := c.Env["User"].(models.User)
-	if !ok {
-		// This should not happen
-		log.Errorf("User was not of the expected form")
-		return "", http.StatusBadRequest
-	}
+	systemUUIDStr := helpers.GetParam(r.URL.Query(), "system", "^[a-f0-9]{8}-[a-f0-9]{4}-[a-f0-9]{4}-[a-f0-9]{4}-[a-f0-9]{12}$", "")
+	state := helpers.GetParam(r.URL.Query(), "state", "^(running|exited)$", "")
+	at := helpers.GetParam(r.URL.Query(), "at", "^[0-9]+$", "")
 
 	type ProcessData struct {
+		ID          int64
 		Sha256      []byte
 		FilePath    string
 		CommandLine string
 		EventTime   int64
+		State       int
+		EndTime     int64
+		ExitCode    int64
 	}
 
 	var processes []ProcessData
 
-	// TODO Need to check count in a smarter way so I'm not duplicating all this code
+	// Build up the conditions shared by the count and the query
+	where := `p.ExecutableFileID=f.ID and coalesce(fp.Path, '') LIKE :filter`
+	params := map[string]interface{}{
+		"filter": "%" + utils.PathFilterValue("contains", filter) + "%",
+	}
+
+	if systemUUIDStr != "" {
+		system, err := findCustomerSystem(db, systemUUIDStr)
+		if err != nil {
+			log.Errorf("Unable to find system %s, %v", systemUUIDStr, err)
+			return "", http.StatusBadRequest
+		}
+		where += " and p.SystemID=:systemID"
+		params["systemID"] = system.ID
+	}
+
+	switch state {
+	case "running":
+		where += " and p.State=:running"
+		params["running"] = models.ProcessStateRunning
+	case "exited":
+		where += " and p.State=:exited"
+		params["exited"] = models.ProcessStateExited
+	}
+
+	if at != "" {
+		// Started by then, and either still running or exited after.  Processes we never learn the exit of are
+		// assumed to still be running.
+		where += " and p.EventTime<=:at and (p.EndTime=0 or p.EndTime>=:at)"
+		params["at"] = at
+	}
 
 	// Get count
-	filter = "%" + filter + "%"
 	count, err := db.SelectInt(`SELECT count(*)
-			FROM systemSets ss, systems s, ProcessEvents p, ExecutableFiles f
-			WHERE ss.CustomerID=:CustomerID and ss.ID =s.SystemSetID and s.ID=p.SystemID and p.ExecutableFileID=f.ID
-				and p.FilePath ILIKE :filter`,
-		map[string]interface{}{
-			"CustomerID": user.CustomerID,
-			"filter":     filter,
-		})
+			FROM {executablefiles} f, {processevents} p
+			LEFT JOIN FilePaths fp ON p.FilePathID=fp.ID
+			WHERE `+where, params)
 	if err != nil {
 		// TODO MUST This probably can happen if no processes are in the DB
 		log.Errorf("Unable to find processes in DB, %v", err)
 		return "", http.StatusBadRequest
 	}
 
+	params["limit"] = length
+	params["offset"] = start
 	_, err = db.Select(&processes, `SELECT
-			f.Sha256, p.FilePath, p.CommandLine, p.EventTime
-			FROM systemSets ss, systems s, ProcessEvents p, ExecutableFiles f
-			WHERE ss.CustomerID=:CustomerID and ss.ID =s.SystemSetID and s.ID=p.SystemID and p.ExecutableFileID=f.ID
-				and p.FilePath ILIKE :filter
+			p.ID, f.Sha256, coalesce(fp.Path, '') as FilePath, coalesce(cl.CommandLine, '') as CommandLine,
+			p.EventTime, p.State, p.EndTime, p.ExitCode
+			FROM {executablefiles} f, {processevents} p
+			LEFT JOIN FilePaths fp ON p.FilePathID=fp.ID
+			LEFT JOIN CommandLines cl ON p.CommandLineID=cl.ID
+			WHERE `+where+`
 			ORDER BY p.EventTime DESC
-			LIMIT :limit OFFSET :offset`,
-		map[string]interface{}{
-			"CustomerID": user.CustomerID,
-			"filter":     filter,
-			"limit":      length,
-			"offset":     start,
-		})
+			LIMIT :limit OFFSET :offset`, params)
 	if err != nil {
 		// TODO MUST This probably can happen if no processes are in the DB
 		log.Errorf("Unable to find processes in DB, %v", err)
@@ -92,10 +126,15 @@ func (controller *Controller) ProcessesJSON(c web.C, r *http.Request) (string, i
 	}
 
 	type ProcessDataJSON struct {
+		ID          int64
 		Sha256      string
 		FilePath    string
 		CommandLine string
 		EventTime   string
+		State       string
+		EndTime     string // Empty unless the process exited
+		ExitCode    int64
+		Duration    int64 // Seconds the process ran for, or has been running for if it hasn't exited
 	}
 
 	type DataTablesJSON struct {
@@ -112,11 +151,22 @@ func (controller *Controller) ProcessesJSON(c web.C, r *http.Request) (string, i
 
 	for index, process := range processes {
 		var processDataJSON ProcessDataJSON
+		processDataJSON.ID = process.ID
 		processDataJSON.Sha256 = hex.EncodeToString(process.Sha256)
 		processDataJSON.FilePath = process.FilePath
 		processDataJSON.CommandLine = process.CommandLine
 
-		processDataJSON.EventTime = utils.Int64ToUnixTimeString(process.EventTime, true)
+		processDataJSON.EventTime = utils.Int64ToUnixTimeString(process.EventTime, false)
+		processDataJSON.State = processStateNames[process.State]
+
+		switch process.State {
+		case models.ProcessStateExited:
+			processDataJSON.EndTime = utils.Int64ToUnixTimeString(process.EndTime, false)
+			processDataJSON.ExitCode = process.ExitCode
+			processDataJSON.Duration = process.EndTime - process.EventTime
+		case models.ProcessStateRunning:
+			processDataJSON.Duration = utils.DBTimeNow() - process.EventTime
+		}
 
 		dataTablesJSON.AaData[index] = processDataJSON
 	}
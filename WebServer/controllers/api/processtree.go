@@ -0,0 +1,332 @@
+////////////////////////////////////////////////////////////////////////////
+//
+// Summit Route End Point Protection
+//
+// This source code is licensed under the BSD-style license found in the
+// LICENSE file in the root directory of this source tree.
+//
+/////////////////////////////////////////////////////////////////////////////
+
+package api
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"sort"
+	"strconv"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/zenazn/goji/web"
+
+	"qdserver/WebServer/helpers"
+	"qdserver/WebServer/tenant"
+	"qdserver/lib/models"
+	"qdserver/lib/utils"
+)
+
+const (
+	maxProcessTreeNodes      = 10000        // Most process events put in the trees for one request
+	maxProcessTreeDepth      = 64           // Most ancestors walked up through, in case the PPIDs loop
+	defaultProcessTreeWindow = 60 * 60 * 24 // Seconds looked back over when no window is given
+)
+
+// processTreeSelect selects the processTreeRows of a system, and needs the "systemID" param
+const processTreeSelect = `SELECT
+		p.ID, p.PID, p.PPID, coalesce(fp.Path, '') as FilePath, coalesce(cl.CommandLine, '') as CommandLine,
+		p.EventTime, p.State, p.EndTime, p.ExitCode,
+		f.Sha256, f.CompanyName, f.ProductName, f.FileDescription, f.SignatureStatus
+		FROM {executablefiles} f, {processevents} p
+		LEFT JOIN FilePaths fp ON p.FilePathID=fp.ID
+		LEFT JOIN CommandLines cl ON p.CommandLineID=cl.ID
+		WHERE p.ExecutableFileID=f.ID and p.SystemID=:systemID`
+
+// processTreeRow is a process event along with what we know about its executable
+type processTreeRow struct {
+	ID          int64
+	PID         int64
+	PPID        int64
+	FilePath    string
+	CommandLine string
+	EventTime   int64
+	State       int
+	EndTime     int64
+	ExitCode    int64
+
+	Sha256          []byte
+	CompanyName     string
+	ProductName     string
+	FileDescription string
+	SignatureStatus int
+}
+
+// processTreeNode is a process in the tree sent to the user
+type processTreeNode struct {
+	ID          int64
+	PID         int64
+	PPID        int64
+	FilePath    string
+	CommandLine string
+	StartTime   string
+	EndTime     string // Empty unless the process exited
+	State       string
+	ExitCode    int64
+
+	Sha256          string
+	CompanyName     string
+	ProductName     string
+	FileDescription string
+	SignatureStatus string
+
+	Children []*processTreeNode `json:",omitempty"`
+}
+
+// newProcessTreeNode converts the row for display
+func newProcessTreeNode(row processTreeRow) *processTreeNode {
+	node := &processTreeNode{
+		ID:              row.ID,
+		PID:             row.PID,
+		PPID:            row.PPID,
+		FilePath:        row.FilePath,
+		CommandLine:     row.CommandLine,
+		StartTime:       utils.Int64ToUnixTimeString(row.EventTime, false),
+		State:           processStateNames[row.State],
+		Sha256:          hex.EncodeToString(row.Sha256),
+		CompanyName:     row.CompanyName,
+		ProductName:     row.ProductName,
+		FileDescription: row.FileDescription,
+		SignatureStatus: getSignatureStatusString(row.SignatureStatus),
+	}
+	if row.State == models.ProcessStateExited {
+		node.EndTime = utils.Int64ToUnixTimeString(row.EndTime, false)
+		node.ExitCode = row.ExitCode
+	}
+	return node
+}
+
+// isParentProcess returns true if parent could have started child.  As PIDs are reused, the parent must have been
+// running when the child started, not just have the child's PPID.
+func isParentProcess(parent *processTreeRow, child *processTreeRow) bool {
+	return parent.ID != child.ID && parent.PID == child.PPID && parent.EventTime <= child.EventTime &&
+		(parent.State != models.ProcessStateExited || parent.EndTime >= child.EventTime)
+}
+
+// findProcessParents returns the ID of the parent of each row that has one, keyed by the ID of the child.  The rows
+// are sorted by when they started, and only a process sorted before the child can be its parent, so the PPIDs can't
+// loop.  When more than one process with the child's PPID could be its parent, the one that started last is used.
+func findProcessParents(rows []processTreeRow) map[int64]int64 {
+	sort.Sort(processTreeRowsByStart(rows))
+
+	parents := make(map[int64]int64)
+	byPID := make(map[int64][]*processTreeRow) // Rows before the current one, in the order they started
+	for i := range rows {
+		row := &rows[i]
+		candidates := byPID[row.PPID]
+		for j := len(candidates) - 1; j >= 0; j-- {
+			if isParentProcess(candidates[j], row) {
+				parents[row.ID] = candidates[j].ID
+				break
+			}
+		}
+		byPID[row.PID] = append(byPID[row.PID], row)
+	}
+
+	return parents
+}
+
+// buildProcessForest links the rows into trees, returning the roots in the order they started and every node by ID
+func buildProcessForest(rows []processTreeRow) ([]*processTreeNode, map[int64]*processTreeNode) {
+	parents := findProcessParents(rows)
+
+	nodes := make(map[int64]*processTreeNode)
+	for _, row := range rows {
+		nodes[row.ID] = newProcessTreeNode(row)
+	}
+
+	var roots []*processTreeNode
+	for _, row := range rows {
+		node := nodes[row.ID]
+		if parentID, ok := parents[row.ID]; ok {
+			nodes[parentID].Children = append(nodes[parentID].Children, node)
+		} else {
+			roots = append(roots, node)
+		}
+	}
+
+	return roots, nodes
+}
+
+// processTreeRowsByStart sorts rows by when the process started
+type processTreeRowsByStart []processTreeRow
+
+func (rows processTreeRowsByStart) Len() int      { return len(rows) }
+func (rows processTreeRowsByStart) Swap(i, j int) { rows[i], rows[j] = rows[j], rows[i] }
+func (rows processTreeRowsByStart) Less(i, j int) bool {
+	if rows[i].EventTime != rows[j].EventTime {
+		return rows[i].EventTime < rows[j].EventTime
+	}
+	return rows[i].ID < rows[j].ID
+}
+
+// findProcessAncestors walks up from the process to the oldest parent we have, returning them oldest first
+func findProcessAncestors(db *tenant.DB, systemID int64, row processTreeRow) ([]*processTreeNode, error) {
+	var ancestors []*processTreeNode
+	seen := map[int64]bool{row.ID: true}
+
+	for len(ancestors) < maxProcessTreeDepth {
+		var parents []processTreeRow
+		_, err := db.Select(&parents, processTreeSelect+`
+			and p.PID=:ppid and p.EventTime<=:startTime and p.ID!=:id
+			and (p.State!=:exited or p.EndTime>=:startTime)
+			ORDER BY p.EventTime DESC, p.ID DESC
+			LIMIT 1`,
+			map[string]interface{}{
+				"systemID":  systemID,
+				"ppid":      row.PPID,
+				"startTime": row.EventTime,
+				"id":        row.ID,
+				"exited":    models.ProcessStateExited,
+			})
+		if err != nil {
+			return nil, err
+		}
+		if len(parents) == 0 || seen[parents[0].ID] {
+			break
+		}
+
+		row = parents[0]
+		seen[row.ID] = true
+		ancestors = append([]*processTreeNode{newProcessTreeNode(row)}, ancestors...)
+	}
+
+	return ancestors, nil
+}
+
+// ProcessTreeJSON route returns the processes of a system as trees of parents and their children.
+// With "event" (a process event ID), it returns the ancestors of that process and the tree of its descendants.
+// Otherwise it returns the trees of the processes of "system" (a system UUID) that started between "from" and "to"
+// (unix times), which default to the last day.
+func (controller *Controller) ProcessTreeJSON(c web.C, r *http.Request) (string, int) {
+	db := controller.GetTenantDatabase(c)
+	if db == nil {
+		// This should not happen
+		log.Errorf("User was not of the expected form")
+		return "", http.StatusBadRequest
+	}
+
+	eventIDStr := helpers.GetParam(r.URL.Query(), "event", "^[0-9]+$", "")
+	systemUUIDStr := helpers.GetParam(r.URL.Query(), "system", "^[a-f0-9]{8}-[a-f0-9]{4}-[a-f0-9]{4}-[a-f0-9]{4}-[a-f0-9]{12}$", "")
+
+	type TreeJSON struct {
+		Ancestors []*processTreeNode // Oldest first, only when looking at one process
+		Processes []*processTreeNode // Roots of the trees
+		Truncated bool               // True if there were too many processes to include them all
+	}
+	var treeJSON TreeJSON
+
+	var rows []processTreeRow
+	params := map[string]interface{}{}
+
+	if eventIDStr != "" {
+		eventID, err := strconv.ParseInt(eventIDStr, 10, 64)
+		if err != nil {
+			log.Errorf("Badly formatted event ID")
+			return "", http.StatusBadRequest
+		}
+
+		// Make sure the event is one of the user's
+		systemID, err := db.SelectInt("SELECT coalesce(min(p.SystemID), 0) FROM {processevents} p WHERE p.ID=:eventID",
+			map[string]interface{}{
+				"eventID": eventID,
+			})
+		if err != nil || systemID == 0 {
+			log.Errorf("Unable to find process event %d, %v", eventID, err)
+			return "", http.StatusBadRequest
+		}
+
+		var event processTreeRow
+		err = db.SelectOne(&event, processTreeSelect+" and p.ID=:eventID",
+			map[string]interface{}{
+				"systemID": systemID,
+				"eventID":  eventID,
+			})
+		if err != nil {
+			log.Errorf("Unable to find process event %d, %v", eventID, err)
+			return "", http.StatusBadRequest
+		}
+
+		treeJSON.Ancestors, err = findProcessAncestors(db, systemID, event)
+		if err != nil {
+			log.Errorf("Unable to find ancestors of process event %d, %v", eventID, err)
+			return "", http.StatusBadRequest
+		}
+
+		// Descendants all started while the process was running
+		end := utils.DBTimeNow()
+		if event.State == models.ProcessStateExited {
+			end = event.EndTime
+		}
+		params["systemID"] = systemID
+		params["from"] = event.EventTime
+		params["to"] = end
+	} else {
+		if systemUUIDStr == "" {
+			log.Errorf("Badly formatted uuid string")
+			return "", http.StatusBadRequest
+		}
+
+		system, err := findCustomerSystem(db, systemUUIDStr)
+		if err != nil {
+			log.Errorf("Unable to find system, %v", err)
+			return "", http.StatusBadRequest
+		}
+
+		to, err := strconv.ParseInt(helpers.GetParam(r.URL.Query(), "to", "^[0-9]+$", strconv.FormatInt(utils.DBTimeNow(), 10)), 10, 64)
+		if err != nil {
+			log.Errorf("Badly formatted to time")
+			return "", http.StatusBadRequest
+		}
+		from, err := strconv.ParseInt(helpers.GetParam(r.URL.Query(), "from", "^[0-9]+$", strconv.FormatInt(to-defaultProcessTreeWindow, 10)), 10, 64)
+		if err != nil {
+			log.Errorf("Badly formatted from time")
+			return "", http.StatusBadRequest
+		}
+
+		params["systemID"] = system.ID
+		params["from"] = from
+		params["to"] = to
+	}
+
+	params["limit"] = maxProcessTreeNodes + 1
+	_, err := db.Select(&rows, processTreeSelect+`
+		and p.EventTime>=:from and p.EventTime<=:to
+		ORDER BY p.EventTime, p.ID
+		LIMIT :limit`, params)
+	if err != nil {
+		log.Errorf("Unable to find processes for system %d, %v", params["systemID"], err)
+		return "", http.StatusBadRequest
+	}
+	if len(rows) > maxProcessTreeNodes {
+		rows = rows[:maxProcessTreeNodes]
+		treeJSON.Truncated = true
+	}
+
+	roots, nodes := buildProcessForest(rows)
+	if eventIDStr != "" {
+		// Only the tree under the process we were asked about
+		eventID, _ := strconv.ParseInt(eventIDStr, 10, 64)
+		if node, ok := nodes[eventID]; ok {
+			treeJSON.Processes = []*processTreeNode{node}
+		}
+	} else {
+		treeJSON.Processes = roots
+	}
+
+	contents, err := json.Marshal(treeJSON)
+	if err != nil {
+		log.Errorf("Unable to marshal json")
+		return "", http.StatusBadRequest
+	}
+
+	return string(contents), http.StatusOK
+}
@@ -0,0 +1,98 @@
+////////////////////////////////////////////////////////////////////////////
+//
+// Summit Route End Point Protection
+//
+// This source code is licensed under the BSD-style license found in the
+// LICENSE file in the root directory of this source tree.
+//
+/////////////////////////////////////////////////////////////////////////////
+
+package api
+
+import (
+	"reflect"
+	"testing"
+
+	"qdserver/lib/models"
+)
+
+// running returns a row for a process that is still running
+func running(id, pid, ppid, start int64) processTreeRow {
+	return processTreeRow{ID: id, PID: pid, PPID: ppid, EventTime: start, State: models.ProcessStateRunning}
+}
+
+// exited returns a row for a process that has exited
+func exited(id, pid, ppid, start, end int64) processTreeRow {
+	return processTreeRow{ID: id, PID: pid, PPID: ppid, EventTime: start, EndTime: end, State: models.ProcessStateExited}
+}
+
+func TestFindProcessParents(t *testing.T) {
+	tests := []struct {
+		name    string
+		rows    []processTreeRow
+		parents map[int64]int64
+	}{
+		{"parent and child",
+			[]processTreeRow{running(1, 100, 4, 10), running(2, 200, 100, 20)},
+			map[int64]int64{2: 1}},
+		{"missing parent",
+			[]processTreeRow{running(1, 100, 4, 10), running(2, 200, 300, 20)},
+			map[int64]int64{}},
+		{"out of order",
+			[]processTreeRow{running(3, 300, 200, 30), running(2, 200, 100, 20), running(1, 100, 4, 10)},
+			map[int64]int64{3: 2, 2: 1}},
+		{"parent started after the child",
+			[]processTreeRow{running(1, 100, 4, 30), running(2, 200, 100, 20)},
+			map[int64]int64{}},
+		{"parent exited before the child started",
+			[]processTreeRow{exited(1, 100, 4, 10, 15), running(2, 200, 100, 20)},
+			map[int64]int64{}},
+		{"PID reused",
+			// The first process with PID 100 exits, and a second one gets its PID and starts the child
+			[]processTreeRow{exited(1, 100, 4, 10, 15), running(2, 100, 4, 16), running(3, 200, 100, 20)},
+			map[int64]int64{3: 2}},
+		{"PID reused while the child runs",
+			// Each child belongs to whichever process had PID 100 when it started
+			[]processTreeRow{exited(1, 100, 4, 10, 15), running(2, 200, 100, 12), running(3, 100, 4, 16), running(4, 300, 100, 20)},
+			map[int64]int64{2: 1, 4: 3}},
+		{"own PPID",
+			[]processTreeRow{running(1, 100, 100, 10)},
+			map[int64]int64{}},
+		{"PPIDs loop",
+			[]processTreeRow{running(1, 100, 200, 10), running(2, 200, 100, 10)},
+			map[int64]int64{2: 1}},
+	}
+
+	for _, test := range tests {
+		parents := findProcessParents(test.rows)
+		if !reflect.DeepEqual(parents, test.parents) {
+			t.Errorf("%s: findProcessParents = %v, want %v", test.name, parents, test.parents)
+		}
+	}
+}
+
+func TestBuildProcessForest(t *testing.T) {
+	rows := []processTreeRow{
+		running(4, 400, 200, 40),
+		running(2, 200, 100, 20),
+		running(1, 100, 4, 10),
+		running(3, 300, 100, 30),
+		running(5, 500, 999, 5),
+	}
+
+	roots, nodes := buildProcessForest(rows)
+	if len(nodes) != len(rows) {
+		t.Errorf("buildProcessForest returned %d nodes, want %d", len(nodes), len(rows))
+	}
+
+	// Roots, and children, are in the order they started
+	if len(roots) != 2 || roots[0].ID != 5 || roots[1].ID != 1 {
+		t.Fatalf("roots = %v, want 5 and 1", roots)
+	}
+	if children := roots[1].Children; len(children) != 2 || children[0].ID != 2 || children[1].ID != 3 {
+		t.Errorf("children of 1 = %v, want 2 and 3", children)
+	}
+	if children := nodes[2].Children; len(children) != 1 || children[0].ID != 4 {
+		t.Errorf("children of 2 = %v, want 4", children)
+	}
+}
@@ -58,7 +58,7 @@ func (controller *Controller) ProfileJSON(c web.C, r *http.Request) (string, int
 
 // PostProfileJSON route
 func (controller *Controller) PostProfileJSON(c web.C, r *http.Request) (string, int) {
-	db := controller.GetDatabase(c)
+	db := controller.GetTenantDatabase(c)
 
 	// Get our user object
 	var user models.User
@@ -79,8 +79,8 @@ func (controller *Controller) PostProfileJSON(c web.C, r *http.Request) (string,
 		return "Email too short", http.StatusBadRequest
 	}
 
-	// Ensure email address is not already in the DB
-	count, err := db.SelectInt(`SELECT count(*)
+	// Ensure email address is not already in the DB.  This is across all customers, as users sign in by email.
+	count, err := db.DbMap().SelectInt(`SELECT count(*)
 			FROM Users
 			WHERE Email=:email and ID!=:id`,
 		map[string]interface{}{
@@ -114,7 +114,7 @@ func (controller *Controller) PostProfileJSON(c web.C, r *http.Request) (string,
 
 // PostChangePasswordJSON route
 func (controller *Controller) PostChangePasswordJSON(c web.C, r *http.Request) (string, int) {
-	db := controller.GetDatabase(c)
+	db := controller.GetTenantDatabase(c)
 
 	// Get our user object
 	var user models.User
@@ -154,7 +154,7 @@ func (controller *Controller) PostChangePasswordJSON(c web.C, r *http.Request) (
 
 // PostResetPasswordJSON route
 func (controller *Controller) PostResetPasswordJSON(c web.C, r *http.Request) (string, int) {
-	db := controller.GetDatabase(c)
+	db := controller.GetTenantDatabase(c)
 
 	log.Infof("Reset password") // TODO REMOVE
 
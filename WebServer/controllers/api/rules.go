@@ -0,0 +1,235 @@
+////////////////////////////////////////////////////////////////////////////
+//
+// Summit Route End Point Protection
+//
+// This source code is licensed under the BSD-style license found in the
+// LICENSE file in the root directory of this source tree.
+//
+/////////////////////////////////////////////////////////////////////////////
+
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/zenazn/goji/web"
+
+	"qdserver/WebServer/helpers"
+	"qdserver/WebServer/tenant"
+	"qdserver/lib/command"
+	"qdserver/lib/models"
+	"qdserver/lib/rules"
+)
+
+// getRuleSetForSystemSet returns the rule set of the system set, creating it if the set doesn't have one yet
+func getRuleSetForSystemSet(db *tenant.DB, systemSet *models.SystemSet) (*models.RuleSet, error) {
+	if systemSet.RuleSetID != 0 {
+		ruleSet, _, err := rules.LoadRuleSet(db.DbMap(), systemSet.RuleSetID)
+		return ruleSet, err
+	}
+
+	ruleSet := &models.RuleSet{DefaultAllow: true}
+	if err := db.Insert(ruleSet); err != nil {
+		return nil, err
+	}
+
+	systemSet.RuleSetID = ruleSet.ID
+	if _, err := db.Update(systemSet); err != nil {
+		return nil, err
+	}
+
+	return ruleSet, nil
+}
+
+// RulesJSON route
+func (controller *Controller) RulesJSON(c web.C, r *http.Request) (string, int) {
+	db := controller.GetTenantDatabase(c)
+	if db == nil {
+		// This should not happen
+		log.Errorf("User was not of the expected form")
+		return "", http.StatusBadRequest
+	}
+
+	systemSetIDStr := helpers.GetParam(r.URL.Query(), "systemset", "^[0-9]+$", "")
+	systemSet, err := getSystemSet(db, systemSetIDStr)
+	if err != nil {
+		log.Errorf("Unable to find system set %s, %v", systemSetIDStr, err)
+		return "", http.StatusBadRequest
+	}
+
+	type RuleJSON struct {
+		ID             int64
+		Description    string
+		AttributeType  string
+		AttributeValue string
+		Allow          bool
+	}
+
+	type RuleSetJSON struct {
+		SystemSetID  int64
+		Mode         int
+		DefaultAllow bool
+		Rules        []RuleJSON
+	}
+
+	ruleSetJSON := RuleSetJSON{
+		SystemSetID:  systemSet.ID,
+		Mode:         systemSet.Mode,
+		DefaultAllow: true,
+		Rules:        []RuleJSON{},
+	}
+
+	if systemSet.RuleSetID != 0 {
+		ruleSet, ruleList, err := rules.LoadRuleSet(db.DbMap(), systemSet.RuleSetID)
+		if err != nil {
+			log.Errorf("Unable to load rule set %d, %v", systemSet.RuleSetID, err)
+			return "", http.StatusBadRequest
+		}
+
+		ruleSetJSON.DefaultAllow = ruleSet.DefaultAllow
+		for _, rule := range ruleList {
+			ruleSetJSON.Rules = append(ruleSetJSON.Rules, RuleJSON{
+				ID:             rule.ID,
+				Description:    rule.Description,
+				AttributeType:  rule.AttributeType,
+				AttributeValue: rule.AttributeValue,
+				Allow:          rule.AllowDeny,
+			})
+		}
+	}
+
+	contents, err := json.Marshal(ruleSetJSON)
+	if err != nil {
+		log.Errorf("Unable to marshal json")
+		return "", http.StatusBadRequest
+	}
+
+	return string(contents), http.StatusOK
+}
+
+// PostRuleJSON route adds a rule to the end of a system set's rules
+func (controller *Controller) PostRuleJSON(c web.C, r *http.Request) (string, int) {
+	db := controller.GetTenantDatabase(c)
+	if db == nil {
+		// This should not happen
+		log.Errorf("User was not of the expected form")
+		return "", http.StatusBadRequest
+	}
+
+	systemSet, err := getSystemSet(db, r.FormValue("SystemSetID"))
+	if err != nil {
+		log.Errorf("Unable to find system set, %v", err)
+		return "", http.StatusBadRequest
+	}
+
+	attributeType := r.FormValue("AttributeType")
+	if !rules.ValidAttributeType(attributeType) {
+		return "unknown attribute type", http.StatusBadRequest
+	}
+
+	attributeValue := r.FormValue("AttributeValue")
+	if attributeValue == "" {
+		return "attribute value required", http.StatusBadRequest
+	}
+
+	ruleSet, err := getRuleSetForSystemSet(db, systemSet)
+	if err != nil {
+		log.Errorf("Unable to get rule set for system set %d, %v", systemSet.ID, err)
+		return "", http.StatusBadRequest
+	}
+
+	rule := &models.Rule{
+		Description:    r.FormValue("Description"),
+		AttributeType:  attributeType,
+		AttributeValue: attributeValue,
+		AllowDeny:      r.FormValue("Allow") == "true",
+	}
+	if err = rules.AppendRule(db.DbMap(), ruleSet, rule); err != nil {
+		log.Errorf("Unable to add rule to rule set %d, %v", ruleSet.ID, err)
+		return "", http.StatusBadRequest
+	}
+
+	if err = command.QueuePolicyForRuleSet(db.DbMap(), ruleSet.ID); err != nil {
+		log.Errorf("Unable to queue policy for rule set %d, %v", ruleSet.ID, err)
+		return "", http.StatusBadRequest
+	}
+
+	return "", http.StatusOK
+}
+
+// PostDeleteRuleJSON route removes a rule from a system set's rules
+func (controller *Controller) PostDeleteRuleJSON(c web.C, r *http.Request) (string, int) {
+	db := controller.GetTenantDatabase(c)
+	if db == nil {
+		// This should not happen
+		log.Errorf("User was not of the expected form")
+		return "", http.StatusBadRequest
+	}
+
+	systemSet, err := getSystemSet(db, r.FormValue("SystemSetID"))
+	if err != nil || systemSet.RuleSetID == 0 {
+		log.Errorf("Unable to find rules for system set, %v", err)
+		return "", http.StatusBadRequest
+	}
+
+	ruleID, err := strconv.ParseInt(r.FormValue("RuleID"), 10, 64)
+	if err != nil {
+		return "bad rule id", http.StatusBadRequest
+	}
+
+	ruleSet, _, err := rules.LoadRuleSet(db.DbMap(), systemSet.RuleSetID)
+	if err != nil {
+		log.Errorf("Unable to load rule set %d, %v", systemSet.RuleSetID, err)
+		return "", http.StatusBadRequest
+	}
+
+	if err = rules.RemoveRule(db.DbMap(), ruleSet, ruleID); err != nil {
+		log.Errorf("Unable to remove rule %d, %v", ruleID, err)
+		return "", http.StatusBadRequest
+	}
+
+	if err = command.QueuePolicyForRuleSet(db.DbMap(), ruleSet.ID); err != nil {
+		log.Errorf("Unable to queue policy for rule set %d, %v", ruleSet.ID, err)
+		return "", http.StatusBadRequest
+	}
+
+	return "", http.StatusOK
+}
+
+// PostRuleSetJSON route sets what happens when none of a system set's rules match
+func (controller *Controller) PostRuleSetJSON(c web.C, r *http.Request) (string, int) {
+	db := controller.GetTenantDatabase(c)
+	if db == nil {
+		// This should not happen
+		log.Errorf("User was not of the expected form")
+		return "", http.StatusBadRequest
+	}
+
+	systemSet, err := getSystemSet(db, r.FormValue("SystemSetID"))
+	if err != nil {
+		log.Errorf("Unable to find system set, %v", err)
+		return "", http.StatusBadRequest
+	}
+
+	ruleSet, err := getRuleSetForSystemSet(db, systemSet)
+	if err != nil {
+		log.Errorf("Unable to get rule set for system set %d, %v", systemSet.ID, err)
+		return "", http.StatusBadRequest
+	}
+
+	ruleSet.DefaultAllow = r.FormValue("DefaultAllow") == "true"
+	if _, err = db.Update(ruleSet); err != nil {
+		log.Errorf("Can't update rule set: %v", err)
+		return "", http.StatusBadRequest
+	}
+
+	if err = command.QueuePolicyForRuleSet(db.DbMap(), ruleSet.ID); err != nil {
+		log.Errorf("Unable to queue policy for rule set %d, %v", ruleSet.ID, err)
+		return "", http.StatusBadRequest
+	}
+
+	return "", http.StatusOK
+}
@@ -10,6 +10,7 @@
 package api
 
 import (
+	"database/sql"
 	"encoding/json"
 	"fmt"
 	"net/http"
@@ -19,7 +20,9 @@ import (
 	"github.com/zenazn/goji/web"
 
 	"qdserver/WebServer/helpers"
+	"qdserver/WebServer/tenant"
 	"qdserver/lib/models"
+	"qdserver/lib/retention"
 	"qdserver/lib/utils"
 )
 
@@ -57,8 +60,14 @@ type SystemData struct {
 	Model        string
 	Arch         string
 	MachineName  string
+	IPAddresses  string
+	LoggedOnUser string
+	LastBootTime int64
 	FirstSeen    int64
 	LastSeen     int64
+	RetiredDate  int64
+	LateAfter    int64 // From the system set
+	OfflineAfter int64 // From the system set
 }
 
 // SystemDataJSON is sent in json responses
@@ -75,16 +84,42 @@ type SystemDataJSON struct {
 	MachineName  string
 	FirstSeen    string
 	LastSeen     string
+	Status       string // online, late, offline, or retired
+	Certificate  string `json:",omitempty"` // Status of the agent's client certificate, only in SystemInfoJSON
+	IPAddresses  string `json:",omitempty"` // Only in SystemInfoJSON
+	LoggedOnUser string `json:",omitempty"` // Only in SystemInfoJSON
+	LastBootTime string `json:",omitempty"` // Only in SystemInfoJSON
+}
+
+// getCertificateStatus describes the newest client certificate issued to the system
+func getCertificateStatus(db *tenant.DB, systemUUID []byte) (string, error) {
+	var agentCertificate models.AgentCertificate
+	err := db.SelectOne(&agentCertificate, `SELECT ac.*
+		FROM {agentcertificates} ac, {systems} s
+		WHERE s.SystemUUID=:systemUUID and ac.SystemID=s.ID
+		ORDER BY ac.CreationDate DESC LIMIT 1`,
+		map[string]interface{}{
+			"systemUUID": systemUUID,
+		})
+	if err == sql.ErrNoRows {
+		return "None", nil
+	} else if err != nil {
+		return "", err
+	}
+
+	if agentCertificate.RevocationDate != 0 {
+		return fmt.Sprintf("Revoked %s", utils.Int64ToUnixTimeString(agentCertificate.RevocationDate, false)), nil
+	}
+	if agentCertificate.NotAfter < utils.DBTimeNow() {
+		return fmt.Sprintf("Expired %s", utils.Int64ToUnixTimeString(agentCertificate.NotAfter, false)), nil
+	}
+	return fmt.Sprintf("Valid until %s", utils.Int64ToUnixTimeString(agentCertificate.NotAfter, false)), nil
 }
 
 // SystemInfoJSON route
 func (controller *Controller) SystemInfoJSON(c web.C, r *http.Request) (string, int) {
-	db := controller.GetDatabase(c)
-
-	// Get our user object
-	var user models.User
-	user, ok := c.Env["User"].(models.User)
-	if !ok {
+	db := controller.GetTenantDatabase(c)
+	if db == nil {
 		// This should not happen
 		log.Errorf("User was not of the expected form")
 		return "", http.StatusBadRequest
@@ -107,15 +142,15 @@ func (controller *Controller) SystemInfoJSON(c web.C, r *http.Request) (string,
 	log.Infof("Looking for %s", systemUUIDStr)
 
 	filterVars := map[string]interface{}{
-		"customerID": user.CustomerID,
 		"systemUUID": systemUUID,
 	}
 
 	var system SystemData
 	err = db.SelectOne(&system, `SELECT
-		s.SystemUUID, s.MachineGUID, s.AgentVersion, s.Comment, s.OSHumanName, s.OSVersion, s.Manufacturer, s.Model, s.Arch, s.MachineName, s.FirstSeen, s.LastSeen
-		FROM systemSets ss, systems s
-		WHERE CustomerID=:customerID and ss.ID =s.SystemSetID and s.SystemUUID=:systemUUID`,
+		s.SystemUUID, s.MachineGUID, s.AgentVersion, s.Comment, s.OSHumanName, s.OSVersion, s.Manufacturer, s.Model, s.Arch, s.MachineName,
+		s.IPAddresses, s.LoggedOnUser, s.LastBootTime, s.FirstSeen, s.LastSeen, s.RetiredDate, ss.LateAfter, ss.OfflineAfter
+		FROM {systemsets} ss, {systems} s
+		WHERE ss.ID =s.SystemSetID and s.SystemUUID=:systemUUID`,
 		filterVars)
 	if err != nil {
 		// TODO MUST This probably can happen if no agents have called in yet
@@ -140,9 +175,21 @@ func (controller *Controller) SystemInfoJSON(c web.C, r *http.Request) (string,
 	systemDataJSON.Model = system.Model
 	systemDataJSON.Arch = system.Arch
 	systemDataJSON.MachineName = system.MachineName
+	systemDataJSON.IPAddresses = system.IPAddresses
+	systemDataJSON.LoggedOnUser = system.LoggedOnUser
+	if system.LastBootTime != 0 {
+		systemDataJSON.LastBootTime = utils.Int64ToUnixTimeString(system.LastBootTime, false)
+	}
 
 	systemDataJSON.LastSeen = utils.Int64ToUnixTimeString(system.LastSeen, false)
 	systemDataJSON.FirstSeen = utils.Int64ToUnixTimeString(system.FirstSeen, false)
+	systemDataJSON.Status = utils.GetSystemStatus(system.LastSeen, system.RetiredDate, system.LateAfter, system.OfflineAfter, utils.DBTimeNow())
+
+	systemDataJSON.Certificate, err = getCertificateStatus(db, system.SystemUUID)
+	if err != nil {
+		log.Errorf("Unable to find certificate for system, %v", err)
+		return "", http.StatusBadRequest
+	}
 
 	contents, err := json.Marshal(systemDataJSON)
 	if err != nil {
@@ -154,14 +201,67 @@ func (controller *Controller) SystemInfoJSON(c web.C, r *http.Request) (string,
 
 }
 
+// SystemHistoryJSON route lists the changes to a system's inventory, newest first
+func (controller *Controller) SystemHistoryJSON(c web.C, r *http.Request) (string, int) {
+	db := controller.GetTenantDatabase(c)
+	if db == nil {
+		// This should not happen
+		log.Errorf("User was not of the expected form")
+		return "", http.StatusBadRequest
+	}
+
+	systemUUIDStr := helpers.GetParam(r.URL.Query(), "uuid", "^[a-f0-9]{8}-[a-f0-9]{4}-[a-f0-9]{4}-[a-f0-9]{4}-[a-f0-9]{12}$", "")
+	if systemUUIDStr == "" {
+		log.Errorf("Badly formatted uuid string")
+		return "", http.StatusBadRequest
+	}
+
+	system, err := findCustomerSystem(db, systemUUIDStr)
+	if err != nil {
+		log.Errorf("Unable to find system, %v", err)
+		return "", http.StatusBadRequest
+	}
+
+	var history []models.SystemHistory
+	_, err = db.Select(&history, "select * from {systemhistory} where SystemID=:systemID ORDER BY ChangeTime DESC, ID DESC",
+		map[string]interface{}{
+			"systemID": system.ID,
+		})
+	if err != nil {
+		log.Errorf("Unable to find history for system %d, %v", system.ID, err)
+		return "", http.StatusBadRequest
+	}
+
+	type SystemHistoryJSON struct {
+		ChangeTime string
+		Field      string
+		OldValue   string
+		NewValue   string
+	}
+
+	historyJSON := make([]SystemHistoryJSON, len(history), len(history))
+	for index, change := range history {
+		historyJSON[index] = SystemHistoryJSON{
+			ChangeTime: utils.Int64ToUnixTimeString(change.ChangeTime, false),
+			Field:      change.Field,
+			OldValue:   change.OldValue,
+			NewValue:   change.NewValue,
+		}
+	}
+
+	contents, err := json.Marshal(historyJSON)
+	if err != nil {
+		log.Errorf("Unable to marshal json")
+		return "", http.StatusBadRequest
+	}
+
+	return string(contents), http.StatusOK
+}
+
 // SystemsJSON route
 func (controller *Controller) SystemsJSON(c web.C, r *http.Request) (string, int) {
-	db := controller.GetDatabase(c)
-
-	// Get our user object
-	var user models.User
-	user, ok := c.Env["User"].(models.User)
-	if !ok {
+	db := controller.GetTenantDatabase(c)
+	if db == nil {
 		// This should not happen
 		log.Errorf("User was not of the expected form")
 		return "", http.StatusBadRequest
@@ -174,13 +274,12 @@ func (controller *Controller) SystemsJSON(c web.C, r *http.Request) (string, int
 	dataTableParams.SortColumn = getSortSystemColumn(dataTableParams.SortColumn)
 
 	filterVars := map[string]interface{}{
-		"customerID": user.CustomerID,
-		"limit":      dataTableParams.Length,
-		"offset":     dataTableParams.Start,
+		"limit":  dataTableParams.Length,
+		"offset": dataTableParams.Start,
 	}
 
-	sqlString := `systemSets ss, systems s
-	WHERE CustomerID=:customerID and ss.ID =s.SystemSetID`
+	sqlString := `{systemsets} ss, {systems} s
+	WHERE ss.ID =s.SystemSetID`
 
 	//
 	// Get count
@@ -195,7 +294,8 @@ func (controller *Controller) SystemsJSON(c web.C, r *http.Request) (string, int
 
 	var systems []SystemData
 	sqlStatement := fmt.Sprintf(`SELECT
-		s.SystemUUID, s.AgentVersion, s.Comment, s.OSHumanName, s.OSVersion, s.Manufacturer, s.Model, s.Arch, s.MachineName, s.FirstSeen, s.LastSeen
+		s.SystemUUID, s.AgentVersion, s.Comment, s.OSHumanName, s.OSVersion, s.Manufacturer, s.Model, s.Arch, s.MachineName, s.FirstSeen, s.LastSeen,
+		s.RetiredDate, ss.LateAfter, ss.OfflineAfter
 		FROM %s
 		ORDER BY %s %s
 		LIMIT :limit OFFSET :offset`, sqlString, dataTableParams.SortColumn, dataTableParams.SortOrder)
@@ -214,6 +314,8 @@ func (controller *Controller) SystemsJSON(c web.C, r *http.Request) (string, int
 		AaData               []SystemDataJSON `json:"aaData"`
 	}
 
+	now := utils.DBTimeNow()
+
 	var dataTablesJSON DataTablesJSON
 	dataTablesJSON.ITotalRecords = int(count)
 	dataTablesJSON.ITotalDisplayRecords = len(systems)
@@ -240,6 +342,7 @@ func (controller *Controller) SystemsJSON(c web.C, r *http.Request) (string, int
 
 		systemDataJSON.LastSeen = utils.Int64ToUnixTimeString(system.LastSeen, true)
 		systemDataJSON.FirstSeen = utils.Int64ToUnixTimeString(system.FirstSeen, true)
+		systemDataJSON.Status = utils.GetSystemStatus(system.LastSeen, system.RetiredDate, system.LateAfter, system.OfflineAfter, now)
 
 		dataTablesJSON.AaData[index] = systemDataJSON
 
@@ -253,3 +356,289 @@ func (controller *Controller) SystemsJSON(c web.C, r *http.Request) (string, int
 
 	return string(contents), http.StatusOK
 }
+
+// PostRevokeSystemCertificateJSON route cuts off a compromised agent.  Its client certificates are revoked, and its
+// secret is replaced with one nobody knows, so it can't keep calling in with signed requests either.
+func (controller *Controller) PostRevokeSystemCertificateJSON(c web.C, r *http.Request) (string, int) {
+	db := controller.GetTenantDatabase(c)
+	if db == nil {
+		// This should not happen
+		log.Errorf("User was not of the expected form")
+		return "", http.StatusBadRequest
+	}
+
+	system, err := findCustomerSystem(db, r.FormValue("SystemUUID"))
+	if err != nil {
+		log.Errorf("Unable to find system, %v", err)
+		return "", http.StatusBadRequest
+	}
+
+	var agentCertificates []models.AgentCertificate
+	_, err = db.Select(&agentCertificates, "select * from {agentcertificates} where SystemID=:systemID and RevocationDate=0",
+		map[string]interface{}{
+			"systemID": system.ID,
+		})
+	if err != nil {
+		log.Errorf("Unable to find certificates for system %d, %v", system.ID, err)
+		return "", http.StatusBadRequest
+	}
+
+	for _, agentCertificate := range agentCertificates {
+		agentCertificate.RevocationDate = utils.DBTimeNow()
+		if _, err = db.Update(&agentCertificate); err != nil {
+			log.Errorf("Can't revoke certificate %d: %v", agentCertificate.ID, err)
+			return "", http.StatusBadRequest
+		}
+	}
+
+	system.Secret, err = utils.GenerateSecret()
+	if err != nil {
+		log.Errorf("Unable to generate secret: %v", err)
+		return "", http.StatusBadRequest
+	}
+	system.PendingSecret = nil
+	if _, err = db.Update(system); err != nil {
+		log.Errorf("Can't update system: %v", err)
+		return "", http.StatusBadRequest
+	}
+
+	log.Infof("Revoked %d certificates for system %d", len(agentCertificates), system.ID)
+
+	return "", http.StatusOK
+}
+
+// PostRetireSystemJSON route marks a system as retired, so it is no longer expected to check in, or puts it back in use.
+// Takes the SystemUUID, and Retired as "true" or "false".
+func (controller *Controller) PostRetireSystemJSON(c web.C, r *http.Request) (string, int) {
+	db := controller.GetTenantDatabase(c)
+	if db == nil {
+		// This should not happen
+		log.Errorf("User was not of the expected form")
+		return "", http.StatusBadRequest
+	}
+
+	system, err := findCustomerSystem(db, r.FormValue("SystemUUID"))
+	if err != nil {
+		log.Errorf("Unable to find system, %v", err)
+		return "", http.StatusBadRequest
+	}
+
+	if r.FormValue("Retired") == "true" {
+		if system.RetiredDate == 0 {
+			system.RetiredDate = utils.DBTimeNow()
+		}
+	} else {
+		system.RetiredDate = 0
+	}
+
+	if _, err = db.Update(system); err != nil {
+		log.Errorf("Can't update system: %v", err)
+		return "", http.StatusBadRequest
+	}
+
+	return "", http.StatusOK
+}
+
+// PostWakeSystemJSON route tells the system's agent to pick up its tasks now, if it is polling, instead of on its next heartbeat
+func (controller *Controller) PostWakeSystemJSON(c web.C, r *http.Request) (string, int) {
+	db := controller.GetTenantDatabase(c)
+	if db == nil {
+		// This should not happen
+		log.Errorf("User was not of the expected form")
+		return "", http.StatusBadRequest
+	}
+
+	system, err := findCustomerSystem(db, r.FormValue("SystemUUID"))
+	if err != nil {
+		log.Errorf("Unable to find system, %v", err)
+		return "", http.StatusBadRequest
+	}
+
+	if err = controller.WakeSystem(c, system.ID); err != nil {
+		log.Errorf("Unable to wake system %d, %v", system.ID, err)
+		return "", http.StatusBadRequest
+	}
+
+	return "", http.StatusOK
+}
+
+// findCustomerSystem looks up one of the customer's systems by UUID
+func findCustomerSystem(db *tenant.DB, systemUUIDStr string) (*models.System, error) {
+	systemUUID, err := utils.UUIDStringToBytes(systemUUIDStr)
+	if err != nil {
+		return nil, err
+	}
+
+	var system models.System
+	err = db.SelectOne(&system, "SELECT s.* FROM {systems} s WHERE s.SystemUUID=:systemUUID",
+		map[string]interface{}{
+			"systemUUID": systemUUID,
+		})
+	if err != nil {
+		return nil, err
+	}
+
+	return &system, nil
+}
+
+// mergeSystems moves everything recorded for the from system onto the into system, and deletes the from system.
+// The from agent's certificates are revoked and its outstanding tasks expired, as it is not expected to call in again.
+func mergeSystems(tx *tenant.Tx, from *models.System, into *models.System) error {
+	params := map[string]interface{}{
+		"from": from.ID,
+		"into": into.ID,
+	}
+
+	// Process, module, and driver events can simply be moved
+	if _, err := tx.Exec("UPDATE processevents SET SystemID=:into WHERE SystemID=:from", params); err != nil {
+		return fmt.Errorf("Unable to move process events: %v", err)
+	}
+	if err := retention.MoveRollups(tx.Unscoped(), from.ID, into.ID); err != nil {
+		return fmt.Errorf("Unable to move process event roll-ups: %v", err)
+	}
+	if _, err := tx.Exec("UPDATE moduleloadevents SET SystemID=:into WHERE SystemID=:from", params); err != nil {
+		return fmt.Errorf("Unable to move module load events: %v", err)
+	}
+	if _, err := tx.Exec("UPDATE driverloadevents SET SystemID=:into WHERE SystemID=:from", params); err != nil {
+		return fmt.Errorf("Unable to move driver load events: %v", err)
+	}
+
+	// Files seen on both systems need their times combined
+	var fileMaps []models.FileToSystemMap
+	_, err := tx.Select(&fileMaps, "select * from {filetosystemmap} where SystemID=:systemID",
+		map[string]interface{}{
+			"systemID": from.ID,
+		})
+	if err != nil {
+		return fmt.Errorf("Unable to find files: %v", err)
+	}
+
+	sightings := make(map[int64]*utils.FileSighting)
+	for _, fileMap := range fileMaps {
+		sightings[fileMap.FileID] = &utils.FileSighting{
+			FirstSeen:  fileMap.FirstSeen,
+			LastSeen:   fileMap.LastSeen,
+			FilePathID: fileMap.FilePathID,
+		}
+	}
+	if err = utils.RecordFilesSeenOnSystem(tx.Unscoped(), into.ID, sightings); err != nil {
+		return fmt.Errorf("Unable to move files: %v", err)
+	}
+	if _, err = tx.Exec("DELETE FROM filetosystemmap WHERE SystemID=:from", params); err != nil {
+		return fmt.Errorf("Unable to remove files: %v", err)
+	}
+
+	// Keep the history of tasks and certificates, but nothing outstanding
+	_, err = tx.Exec("UPDATE tasks SET State=:expired WHERE SystemID=:from and (State=:pending or State=:deployed)",
+		map[string]interface{}{
+			"from":     from.ID,
+			"expired":  models.TaskStateExpired,
+			"pending":  models.TaskStatePending,
+			"deployed": models.TaskStateDeployed,
+		})
+	if err != nil {
+		return fmt.Errorf("Unable to expire tasks: %v", err)
+	}
+	if _, err = tx.Exec("UPDATE tasks SET SystemID=:into WHERE SystemID=:from", params); err != nil {
+		return fmt.Errorf("Unable to move tasks: %v", err)
+	}
+	_, err = tx.Exec("UPDATE agentcertificates SET RevocationDate=:now WHERE SystemID=:from and RevocationDate=0",
+		map[string]interface{}{
+			"from": from.ID,
+			"now":  utils.DBTimeNow(),
+		})
+	if err != nil {
+		return fmt.Errorf("Unable to revoke certificates: %v", err)
+	}
+	if _, err = tx.Exec("UPDATE agentcertificates SET SystemID=:into WHERE SystemID=:from", params); err != nil {
+		return fmt.Errorf("Unable to move certificates: %v", err)
+	}
+	if _, err = tx.Exec("UPDATE systemhistory SET SystemID=:into WHERE SystemID=:from", params); err != nil {
+		return fmt.Errorf("Unable to move history: %v", err)
+	}
+
+	// Nothing worth keeping from the from agent's requests
+	if _, err = tx.Exec("DELETE FROM fileuploads WHERE SystemID=:from", params); err != nil {
+		return fmt.Errorf("Unable to remove uploads: %v", err)
+	}
+	if _, err = tx.Exec("DELETE FROM requestnonces WHERE SystemID=:from", params); err != nil {
+		return fmt.Errorf("Unable to remove nonces: %v", err)
+	}
+
+	// Systems that replaced the from system now follow the into system
+	if into.PredecessorID == from.ID {
+		into.PredecessorID = from.PredecessorID
+	}
+	_, err = tx.Exec("UPDATE systems SET PredecessorID=:into WHERE PredecessorID=:from and ID<>:into", params)
+	if err != nil {
+		return fmt.Errorf("Unable to update successors: %v", err)
+	}
+
+	if from.FirstSeen < into.FirstSeen {
+		into.FirstSeen = from.FirstSeen
+	}
+	if from.LastSeen > into.LastSeen {
+		into.LastSeen = from.LastSeen
+	}
+	if into.Comment == "" {
+		into.Comment = from.Comment
+	}
+	if _, err = tx.Update(into); err != nil {
+		return fmt.Errorf("Unable to update system: %v", err)
+	}
+
+	if _, err = tx.Delete(from); err != nil {
+		return fmt.Errorf("Unable to delete system: %v", err)
+	}
+
+	return nil
+}
+
+// PostMergeSystemsJSON route combines two systems that are the same machine, such as when the agent was reinstalled.
+// Everything recorded for FromSystemUUID is moved to IntoSystemUUID, and FromSystemUUID is deleted.
+func (controller *Controller) PostMergeSystemsJSON(c web.C, r *http.Request) (string, int) {
+	db := controller.GetTenantDatabase(c)
+	if db == nil {
+		// This should not happen
+		log.Errorf("User was not of the expected form")
+		return "", http.StatusBadRequest
+	}
+
+	from, err := findCustomerSystem(db, r.FormValue("FromSystemUUID"))
+	if err != nil {
+		log.Errorf("Unable to find system to merge from, %v", err)
+		return "", http.StatusBadRequest
+	}
+
+	into, err := findCustomerSystem(db, r.FormValue("IntoSystemUUID"))
+	if err != nil {
+		log.Errorf("Unable to find system to merge into, %v", err)
+		return "", http.StatusBadRequest
+	}
+
+	if from.ID == into.ID {
+		log.Errorf("Can't merge system %d into itself", from.ID)
+		return "", http.StatusBadRequest
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		log.Errorf("Unable to start transaction, %v", err)
+		return "", http.StatusBadRequest
+	}
+
+	if err = mergeSystems(tx, from, into); err != nil {
+		log.Errorf("Unable to merge system %d into %d, %v", from.ID, into.ID, err)
+		tx.Rollback()
+		return "", http.StatusBadRequest
+	}
+
+	if err = tx.Commit(); err != nil {
+		log.Errorf("Unable to commit merge of system %d into %d, %v", from.ID, into.ID, err)
+		return "", http.StatusBadRequest
+	}
+
+	log.Infof("Merged system %d into %d", from.ID, into.ID)
+
+	return "", http.StatusOK
+}
@@ -0,0 +1,540 @@
+////////////////////////////////////////////////////////////////////////////
+//
+// Summit Route End Point Protection
+//
+// This source code is licensed under the BSD-style license found in the
+// LICENSE file in the root directory of this source tree.
+//
+/////////////////////////////////////////////////////////////////////////////
+
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/zenazn/goji/web"
+
+	"qdserver/WebServer/tenant"
+	"qdserver/lib/command"
+	"qdserver/lib/models"
+	"qdserver/lib/rules"
+	"qdserver/lib/utils"
+)
+
+// getSystemSet returns the customer's system set with the given ID
+func getSystemSet(db *tenant.DB, systemSetIDStr string) (*models.SystemSet, error) {
+	systemSetID, err := strconv.ParseInt(systemSetIDStr, 10, 64)
+	if err != nil {
+		return nil, err
+	}
+
+	var systemSet models.SystemSet
+	err = db.SelectOne(&systemSet, "select * from {systemsets} where ID=:id",
+		map[string]interface{}{
+			"id": systemSetID,
+		})
+	if err != nil {
+		return nil, err
+	}
+
+	return &systemSet, nil
+}
+
+// getParentSystemSetID reads the ParentID form value, which may be empty or 0 for a top level set.
+// The parent must belong to the customer.
+func getParentSystemSetID(db *tenant.DB, parentIDStr string) (int64, error) {
+	if parentIDStr == "" || parentIDStr == "0" {
+		return 0, nil
+	}
+
+	parent, err := getSystemSet(db, parentIDStr)
+	if err != nil {
+		return 0, err
+	}
+
+	return parent.ID, nil
+}
+
+// defaultSystemSetName is the set that agents are registered into, which is found by its name
+const defaultSystemSetName = "Default"
+
+// checkSystemSetName returns why the name can't be used for the system set with the given ID, 0 for a new set, or ""
+// if it can.  Names are unique for each customer, ignoring case, and the Default set's name can't be taken.
+func checkSystemSetName(db *tenant.DB, systemSetID int64, name string) (string, error) {
+	if name == "" {
+		return "name required", nil
+	}
+	if strings.EqualFold(name, defaultSystemSetName) {
+		return "name is reserved", nil
+	}
+
+	count, err := db.SelectInt("select count(*) from {systemsets} where lower(Name)=lower(:name) and ID<>:id",
+		map[string]interface{}{
+			"name": name,
+			"id":   systemSetID,
+		})
+	if err != nil {
+		return "", err
+	}
+	if count != 0 {
+		return "name not unique", nil
+	}
+
+	return "", nil
+}
+
+// lockSystemSets locks the customer's system sets until the transaction ends, so the tree isn't changed under us
+func lockSystemSets(tx *tenant.Tx) error {
+	var systemSets []models.SystemSet
+	_, err := tx.Select(&systemSets, "select * from {systemsets} ss for update", nil)
+	return err
+}
+
+// readSystemSetSettings sets the Mode and inheritance options from the form values
+func readSystemSetSettings(r *http.Request, systemSet *models.SystemSet) bool {
+	if modeStr := r.FormValue("Mode"); modeStr != "" {
+		mode, err := strconv.Atoi(modeStr)
+		if err != nil || mode < 0 || mode > 1 {
+			return false
+		}
+		systemSet.Mode = mode
+	}
+
+	if inheritModeStr := r.FormValue("InheritMode"); inheritModeStr != "" {
+		systemSet.InheritMode = inheritModeStr == "true"
+	}
+
+	if ruleInheritanceStr := r.FormValue("RuleInheritance"); ruleInheritanceStr != "" {
+		ruleInheritance, err := strconv.Atoi(ruleInheritanceStr)
+		if err != nil || ruleInheritance < models.RuleInheritancePrepend || ruleInheritance > models.RuleInheritanceInherit {
+			return false
+		}
+		systemSet.RuleInheritance = ruleInheritance
+	}
+
+	// Times without a check-in are in seconds, with 0 for the default
+	if lateAfterStr := r.FormValue("LateAfter"); lateAfterStr != "" {
+		lateAfter, err := strconv.ParseInt(lateAfterStr, 10, 64)
+		if err != nil || lateAfter < 0 {
+			return false
+		}
+		systemSet.LateAfter = lateAfter
+	}
+
+	if offlineAfterStr := r.FormValue("OfflineAfter"); offlineAfterStr != "" {
+		offlineAfter, err := strconv.ParseInt(offlineAfterStr, 10, 64)
+		if err != nil || offlineAfter < 0 {
+			return false
+		}
+		systemSet.OfflineAfter = offlineAfter
+	}
+
+	return true
+}
+
+// SystemSetsJSON route
+func (controller *Controller) SystemSetsJSON(c web.C, r *http.Request) (string, int) {
+	db := controller.GetTenantDatabase(c)
+	if db == nil {
+		// This should not happen
+		log.Errorf("User was not of the expected form")
+		return "", http.StatusBadRequest
+	}
+
+	var systemSets []models.SystemSet
+	_, err := db.Select(&systemSets, "select * from {systemsets} order by Name", nil)
+	if err != nil {
+		log.Errorf("Unable to find system sets in DB, %v", err)
+		return "", http.StatusBadRequest
+	}
+
+	type SystemSetJSON struct {
+		ID              int64
+		Name            string
+		ParentID        int64
+		Mode            int
+		InheritMode     bool
+		RuleInheritance int
+		EffectiveMode   int
+		LateAfter       int64
+		OfflineAfter    int64
+		NumSystems      int64
+		CreationDate    string
+	}
+
+	systemSetsJSON := make([]SystemSetJSON, len(systemSets), len(systemSets))
+	for index, systemSet := range systemSets {
+		effective, err := rules.ResolveSystemSet(db.DbMap(), systemSet.ID)
+		if err != nil {
+			log.Errorf("Unable to resolve system set %d, %v", systemSet.ID, err)
+			return "", http.StatusBadRequest
+		}
+
+		numSystems, err := db.SelectInt("select count(*) from {systems} where SystemSetID=:id",
+			map[string]interface{}{
+				"id": systemSet.ID,
+			})
+		if err != nil {
+			log.Errorf("Unable to count systems in system set %d, %v", systemSet.ID, err)
+			return "", http.StatusBadRequest
+		}
+
+		systemSetsJSON[index] = SystemSetJSON{
+			ID:              systemSet.ID,
+			Name:            systemSet.Name,
+			ParentID:        systemSet.SystemSetID,
+			Mode:            systemSet.Mode,
+			InheritMode:     systemSet.InheritMode,
+			RuleInheritance: systemSet.RuleInheritance,
+			EffectiveMode:   effective.Mode,
+			LateAfter:       systemSet.LateAfter,
+			OfflineAfter:    systemSet.OfflineAfter,
+			NumSystems:      numSystems,
+			CreationDate:    utils.Int64ToUnixTimeString(systemSet.CreationDate, true),
+		}
+	}
+
+	contents, err := json.Marshal(systemSetsJSON)
+	if err != nil {
+		log.Errorf("Unable to marshal json")
+		return "", http.StatusBadRequest
+	}
+
+	return string(contents), http.StatusOK
+}
+
+// PostSystemSetJSON route creates a system set
+func (controller *Controller) PostSystemSetJSON(c web.C, r *http.Request) (string, int) {
+	db := controller.GetTenantDatabase(c)
+	if db == nil {
+		// This should not happen
+		log.Errorf("User was not of the expected form")
+		return "", http.StatusBadRequest
+	}
+
+	name := strings.TrimSpace(r.FormValue("Name"))
+	problem, err := checkSystemSetName(db, 0, name)
+	if err != nil {
+		log.Errorf("Unable to check system set name, %v", err)
+		return "", http.StatusBadRequest
+	}
+	if problem != "" {
+		return problem, http.StatusBadRequest
+	}
+
+	parentID, err := getParentSystemSetID(db, r.FormValue("ParentID"))
+	if err != nil {
+		log.Errorf("Unable to find parent system set, %v", err)
+		return "", http.StatusBadRequest
+	}
+
+	systemSet := &models.SystemSet{
+		CustomerID:   db.CustomerID,
+		Name:         name,
+		SystemSetID:  parentID,
+		InheritMode:  parentID != 0,
+		CreationDate: utils.DBTimeNow(),
+	}
+	if !readSystemSetSettings(r, systemSet) {
+		return "bad settings", http.StatusBadRequest
+	}
+
+	if err = db.Insert(systemSet); err != nil {
+		log.Errorf("Error while creating systemset: %v", err)
+		return "", http.StatusBadRequest
+	}
+
+	contents, err := json.Marshal(struct{ ID int64 }{systemSet.ID})
+	if err != nil {
+		log.Errorf("Unable to marshal json")
+		return "", http.StatusBadRequest
+	}
+
+	return string(contents), http.StatusOK
+}
+
+// PostRenameSystemSetJSON route
+func (controller *Controller) PostRenameSystemSetJSON(c web.C, r *http.Request) (string, int) {
+	db := controller.GetTenantDatabase(c)
+	if db == nil {
+		// This should not happen
+		log.Errorf("User was not of the expected form")
+		return "", http.StatusBadRequest
+	}
+
+	systemSet, err := getSystemSet(db, r.FormValue("SystemSetID"))
+	if err != nil {
+		log.Errorf("Unable to find system set, %v", err)
+		return "", http.StatusBadRequest
+	}
+
+	// Agents are registered into the Default set by its name
+	if strings.EqualFold(systemSet.Name, defaultSystemSetName) {
+		return "the Default system set can not be renamed", http.StatusBadRequest
+	}
+
+	name := strings.TrimSpace(r.FormValue("Name"))
+	problem, err := checkSystemSetName(db, systemSet.ID, name)
+	if err != nil {
+		log.Errorf("Unable to check system set name, %v", err)
+		return "", http.StatusBadRequest
+	}
+	if problem != "" {
+		return problem, http.StatusBadRequest
+	}
+
+	systemSet.Name = name
+	if _, err = db.Update(systemSet); err != nil {
+		log.Errorf("Can't update system set: %v", err)
+		return "", http.StatusBadRequest
+	}
+
+	return "", http.StatusOK
+}
+
+// PostSystemSetSettingsJSON route sets the Mode and inheritance options of a system set
+func (controller *Controller) PostSystemSetSettingsJSON(c web.C, r *http.Request) (string, int) {
+	db := controller.GetTenantDatabase(c)
+	if db == nil {
+		// This should not happen
+		log.Errorf("User was not of the expected form")
+		return "", http.StatusBadRequest
+	}
+
+	systemSet, err := getSystemSet(db, r.FormValue("SystemSetID"))
+	if err != nil {
+		log.Errorf("Unable to find system set, %v", err)
+		return "", http.StatusBadRequest
+	}
+
+	if !readSystemSetSettings(r, systemSet) {
+		return "bad settings", http.StatusBadRequest
+	}
+
+	if _, err = db.Update(systemSet); err != nil {
+		log.Errorf("Can't update system set: %v", err)
+		return "", http.StatusBadRequest
+	}
+
+	if err = command.QueuePolicyForSystemSet(db.DbMap(), systemSet.ID); err != nil {
+		log.Errorf("Unable to queue policy for system set %d, %v", systemSet.ID, err)
+		return "", http.StatusBadRequest
+	}
+
+	return "", http.StatusOK
+}
+
+// moveSystemSet gives the system set a new parent, unless that would make the set its own ancestor.  Returns a message
+// for the user if the move isn't allowed.
+func moveSystemSet(tx *tenant.Tx, systemSetIDStr string, parentIDStr string) (*models.SystemSet, string, error) {
+	if err := lockSystemSets(tx); err != nil {
+		return nil, "", err
+	}
+
+	systemSet, err := getSystemSet(tx.DB, systemSetIDStr)
+	if err != nil {
+		return nil, "", err
+	}
+
+	parentID, err := getParentSystemSetID(tx.DB, parentIDStr)
+	if err != nil {
+		return nil, "", err
+	}
+
+	// Ensure we aren't making a set its own ancestor
+	descendants, err := rules.GetDescendantSystemSets(tx.Unscoped(), systemSet.ID)
+	if err != nil {
+		return nil, "", err
+	}
+	for _, descendant := range descendants {
+		if descendant == parentID {
+			return nil, "a system set can not be moved below itself", nil
+		}
+	}
+
+	systemSet.SystemSetID = parentID
+	_, err = tx.Update(systemSet)
+	return systemSet, "", err
+}
+
+// PostMoveSystemSetJSON route gives a system set a new parent
+func (controller *Controller) PostMoveSystemSetJSON(c web.C, r *http.Request) (string, int) {
+	db := controller.GetTenantDatabase(c)
+	if db == nil {
+		// This should not happen
+		log.Errorf("User was not of the expected form")
+		return "", http.StatusBadRequest
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		log.Errorf("Unable to start transaction, %v", err)
+		return "", http.StatusBadRequest
+	}
+
+	systemSet, problem, err := moveSystemSet(tx, r.FormValue("SystemSetID"), r.FormValue("ParentID"))
+	if err != nil || problem != "" {
+		tx.Rollback()
+		if err != nil {
+			log.Errorf("Unable to move system set, %v", err)
+		}
+		return problem, http.StatusBadRequest
+	}
+
+	if err = tx.Commit(); err != nil {
+		log.Errorf("Unable to commit move of system set %d, %v", systemSet.ID, err)
+		return "", http.StatusBadRequest
+	}
+
+	if err = command.QueuePolicyForSystemSet(db.DbMap(), systemSet.ID); err != nil {
+		log.Errorf("Unable to queue policy for system set %d, %v", systemSet.ID, err)
+		return "", http.StatusBadRequest
+	}
+
+	return "", http.StatusOK
+}
+
+// deleteSystemSet deletes the system set and its rule set, moving its systems and child sets up to its parent.  Returns
+// a message for the user if the set can't be deleted.
+func deleteSystemSet(tx *tenant.Tx, systemSetIDStr string) (*models.SystemSet, string, error) {
+	if err := lockSystemSets(tx); err != nil {
+		return nil, "", err
+	}
+
+	systemSet, err := getSystemSet(tx.DB, systemSetIDStr)
+	if err != nil {
+		return nil, "", err
+	}
+
+	var children []models.SystemSet
+	_, err = tx.Select(&children, "select * from {systemsets} where SystemSetID=:id",
+		map[string]interface{}{
+			"id": systemSet.ID,
+		})
+	if err != nil {
+		return nil, "", err
+	}
+
+	var systems []models.System
+	_, err = tx.Select(&systems, "select * from {systems} where SystemSetID=:id for update",
+		map[string]interface{}{
+			"id": systemSet.ID,
+		})
+	if err != nil {
+		return nil, "", err
+	}
+
+	if systemSet.SystemSetID == 0 && (len(children) != 0 || len(systems) != 0) {
+		return nil, "a top level system set must be empty to be deleted", nil
+	}
+
+	for _, child := range children {
+		child.SystemSetID = systemSet.SystemSetID
+		if _, err = tx.Update(&child); err != nil {
+			return nil, "", err
+		}
+	}
+
+	for _, system := range systems {
+		system.SystemSetID = systemSet.SystemSetID
+		if _, err = tx.Update(&system); err != nil {
+			return nil, "", err
+		}
+	}
+
+	if _, err = tx.Delete(systemSet); err != nil {
+		return nil, "", err
+	}
+
+	// The rule set was only the deleted set's
+	if systemSet.RuleSetID != 0 {
+		if err = rules.DeleteRuleSet(tx.Unscoped(), systemSet.RuleSetID); err != nil {
+			return nil, "", err
+		}
+	}
+
+	return systemSet, "", nil
+}
+
+// PostDeleteSystemSetJSON route deletes a system set.  Its systems and child sets are moved up to its parent.
+func (controller *Controller) PostDeleteSystemSetJSON(c web.C, r *http.Request) (string, int) {
+	db := controller.GetTenantDatabase(c)
+	if db == nil {
+		// This should not happen
+		log.Errorf("User was not of the expected form")
+		return "", http.StatusBadRequest
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		log.Errorf("Unable to start transaction, %v", err)
+		return "", http.StatusBadRequest
+	}
+
+	systemSet, problem, err := deleteSystemSet(tx, r.FormValue("SystemSetID"))
+	if err != nil || problem != "" {
+		tx.Rollback()
+		if err != nil {
+			log.Errorf("Unable to delete system set, %v", err)
+		}
+		return problem, http.StatusBadRequest
+	}
+
+	if err = tx.Commit(); err != nil {
+		log.Errorf("Unable to commit delete of system set %d, %v", systemSet.ID, err)
+		return "", http.StatusBadRequest
+	}
+
+	if systemSet.SystemSetID != 0 {
+		if err = command.QueuePolicyForSystemSet(db.DbMap(), systemSet.SystemSetID); err != nil {
+			log.Errorf("Unable to queue policy for system set %d, %v", systemSet.SystemSetID, err)
+			return "", http.StatusBadRequest
+		}
+	}
+
+	return "", http.StatusOK
+}
+
+// PostMoveSystemJSON route moves a system to a different system set
+func (controller *Controller) PostMoveSystemJSON(c web.C, r *http.Request) (string, int) {
+	db := controller.GetTenantDatabase(c)
+	if db == nil {
+		// This should not happen
+		log.Errorf("User was not of the expected form")
+		return "", http.StatusBadRequest
+	}
+
+	systemSet, err := getSystemSet(db, r.FormValue("SystemSetID"))
+	if err != nil {
+		log.Errorf("Unable to find system set, %v", err)
+		return "", http.StatusBadRequest
+	}
+
+	system, err := findCustomerSystem(db, r.FormValue("SystemUUID"))
+	if err != nil {
+		log.Errorf("Unable to find system, %v", err)
+		return "", http.StatusBadRequest
+	}
+
+	system.SystemSetID = systemSet.ID
+	if _, err = db.Update(system); err != nil {
+		log.Errorf("Can't update system: %v", err)
+		return "", http.StatusBadRequest
+	}
+
+	if err = command.QueuePolicyForSystem(db.DbMap(), system.ID); err != nil {
+		log.Errorf("Unable to queue policy for system %d, %v", system.ID, err)
+		return "", http.StatusBadRequest
+	}
+
+	// Get the new policy to the agent right away
+	if err = controller.WakeSystem(c, system.ID); err != nil {
+		log.Errorf("Unable to wake system %d, %v", system.ID, err)
+	}
+
+	return "", http.StatusOK
+}
@@ -0,0 +1,76 @@
+////////////////////////////////////////////////////////////////////////////
+//
+// Summit Route End Point Protection
+//
+// This source code is licensed under the BSD-style license found in the
+// LICENSE file in the root directory of this source tree.
+//
+/////////////////////////////////////////////////////////////////////////////
+
+package web
+
+import (
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"regexp"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/zenazn/goji/web"
+
+	"qdserver/lib/storage"
+)
+
+// DownloadFile route returns our copy of an executable that was seen on one of the customer's systems
+func (controller *Controller) DownloadFile(c web.C, r *http.Request) (string, int) {
+	db := controller.GetTenantDatabase(c)
+	store := controller.GetExeStore(c)
+
+	if db == nil {
+		// This should not happen
+		log.Errorf("User was not of the expected form")
+		return "/signin", http.StatusSeeOther
+	}
+
+	if store == nil {
+		log.Errorf("Sample download requested, but no storage is configured")
+		return "", http.StatusNotFound
+	}
+
+	sha256HexString := c.URLParams["sha256"]
+	if match, _ := regexp.MatchString("^[a-f0-9]{64}$", sha256HexString); !match {
+		log.Errorf("Incorrectly formatted sha256, %v", sha256HexString)
+		return "", http.StatusBadRequest
+	}
+	sha256, err := hex.DecodeString(sha256HexString)
+	if err != nil {
+		log.Errorf("Unable to decode Sha256: %v", err)
+		return "", http.StatusBadRequest
+	}
+
+	// Only allow downloading files the customer has seen, and that we have a copy of
+	count, err := db.SelectInt("SELECT count(*) FROM {executablefiles} f WHERE f.Sha256=:sha256 AND f.UploadDate!=0",
+		map[string]interface{}{
+			"sha256": sha256,
+		})
+	if err != nil {
+		log.Errorf("Unable to check for file, %v", err)
+		return "", http.StatusBadRequest
+	}
+	if count == 0 {
+		log.Infof("Request made for a file that isn't available, %s", sha256HexString)
+		return "", http.StatusNotFound
+	}
+
+	contents, err := storage.ReadAll(store, storage.HashKey(sha256HexString))
+	if err != nil {
+		log.Errorf("Unable to read file %s from storage, %v", sha256HexString, err)
+		return "", http.StatusNotFound
+	}
+
+	c.Env["Content-Type"] = "application/octet-stream"
+	c.Env["Content-Length"] = fmt.Sprintf("%d", len(contents))
+	c.Env["Content-Disposition"] = fmt.Sprintf("attachment; filename=\"%s.bin\"", sha256HexString)
+
+	return string(contents), http.StatusOK
+}
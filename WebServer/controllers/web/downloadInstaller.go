@@ -26,12 +26,8 @@ import (
 
 // DownloadInstaller route
 func (controller *Controller) DownloadInstaller(c web.C, r *http.Request) (string, int) {
-	db := controller.GetDatabase(c)
-
-	// Get our user object
-	var user models.User
-	user, ok := c.Env["User"].(models.User)
-	if !ok {
+	db := controller.GetTenantDatabase(c)
+	if db == nil {
 		// This should not happen
 		log.Errorf("User was not of the expected form")
 		return "/signin", http.StatusSeeOther
@@ -39,10 +35,7 @@ func (controller *Controller) DownloadInstaller(c web.C, r *http.Request) (strin
 
 	// Get the Customer UUID
 	var customer models.Customer
-	err := db.SelectOne(&customer, "select * from customers where ID=:id",
-		map[string]interface{}{
-			"id": user.CustomerID,
-		})
+	err := db.SelectOne(&customer, "select * from {customers}", nil)
 	if err != nil {
 		log.Errorf("Unable to find customer in DB")
 		return "/signin", http.StatusSeeOther
@@ -38,6 +38,11 @@ func main() {
 	application.Init(configfile)
 	application.LoadTemplates()
 	application.ConnectToDatabase()
+	application.ConnectToStorage()
+	application.ConnectToQueues()
+
+	go application.WatchForStaleSystems()
+	go application.ExpireProcessEvents()
 
 	// Setup static files
 	static := gojiweb.New()
@@ -88,6 +93,21 @@ func main() {
 	goji.Use(application.ApplyAuth)
 	goji.Use(application.ApplyProtectionFromCSRF)
 
+	addRoutes(goji.DefaultMux, application)
+
+	//
+	// Graceful shutodown
+	//
+	graceful.PostHook(func() {
+		application.Close()
+	})
+
+	flag.Set("bind", fmt.Sprintf(":%s", application.Configuration.ListeningPort))
+	goji.Serve()
+}
+
+// addRoutes adds the pages and API to the mux
+func addRoutes(mux *gojiweb.Mux, application *system.Application) {
 	controller := &web.Controller{}
 	apiController := &api.Controller{}
 
@@ -97,63 +117,76 @@ func main() {
 
 	// Set some static file
 	// TODO: Should use nginx to serve these
-	goji.Get("/robots.txt", http.FileServer(http.Dir(application.Configuration.PublicPath)))
-	goji.Get("/favicon.ico", http.FileServer(http.Dir(application.Configuration.PublicPath+"/images")))
+	mux.Get("/robots.txt", http.FileServer(http.Dir(application.Configuration.PublicPath)))
+	mux.Get("/favicon.ico", http.FileServer(http.Dir(application.Configuration.PublicPath+"/images")))
 
 	// Home page
-	goji.Get("/", application.Route(controller, "Index", system.RouteProtected))
+	mux.Get("/", application.Route(controller, "Index", system.RouteProtected))
 
 	// Sign In routes
-	goji.Get("/signin", application.Route(controller, "SignIn", system.RoutePublic))
-	goji.Post("/signin", application.Route(controller, "SignInPost", system.RoutePublic))
-	goji.Get("/forgot_password", application.Route(controller, "ForgotPassword", system.RoutePublic))
-	goji.Post("/forgot_password", application.Route(controller, "ForgotPasswordPost", system.RoutePublic))
-	goji.Get("/password_reset/:data", application.Route(controller, "PasswordReset", system.RoutePublic))
+	mux.Get("/signin", application.Route(controller, "SignIn", system.RoutePublic))
+	mux.Post("/signin", application.Route(controller, "SignInPost", system.RoutePublic))
+	mux.Get("/forgot_password", application.Route(controller, "ForgotPassword", system.RoutePublic))
+	mux.Post("/forgot_password", application.Route(controller, "ForgotPasswordPost", system.RoutePublic))
+	mux.Get("/password_reset/:data", application.Route(controller, "PasswordReset", system.RoutePublic))
 
 	// Register routes
-	goji.Get("/register", application.Route(controller, "Register", system.RoutePublic))
-	goji.Post("/register", application.Route(controller, "RegisterPost", system.RoutePublic))
+	mux.Get("/register", application.Route(controller, "Register", system.RoutePublic))
+	mux.Post("/register", application.Route(controller, "RegisterPost", system.RoutePublic))
 
 	// Static
-	goji.Get("/terms_and_conditions", application.Route(controller, "TermsAndConditions", system.RoutePublic))
-	goji.Get("/privacy_policy", application.Route(controller, "Privacy", system.RoutePublic))
-	goji.Get("/help", application.Route(controller, "Help", system.RoutePublic))
+	mux.Get("/terms_and_conditions", application.Route(controller, "TermsAndConditions", system.RoutePublic))
+	mux.Get("/privacy_policy", application.Route(controller, "Privacy", system.RoutePublic))
+	mux.Get("/help", application.Route(controller, "Help", system.RoutePublic))
 
 	// Logout
-	goji.Get("/logout", application.Route(controller, "Logout", system.RouteProtected))
+	mux.Get("/logout", application.Route(controller, "Logout", system.RouteProtected))
 
 	// Download
-	goji.Get("/download/SREPP.exe", application.Route(controller, "DownloadInstaller", system.RouteProtected))
+	mux.Get("/download/SREPP.exe", application.Route(controller, "DownloadInstaller", system.RouteProtected))
+	mux.Get("/download/file/:sha256", application.Route(controller, "DownloadFile", system.RouteProtected))
 
 	//
 	// API
 	//
-	goji.Get("/api/systems.json", application.Route(apiController, "SystemsJSON", system.RouteProtected))
-	goji.Get("/api/systeminfo.json", application.Route(apiController, "SystemInfoJSON", system.RouteProtected))
-	goji.Get("/api/processes.json", application.Route(apiController, "ProcessesJSON", system.RouteProtected))
-	goji.Get("/api/files.json", application.Route(apiController, "FilesJSON", system.RouteProtected))
-	goji.Get("/api/fileinfo.json", application.Route(apiController, "FileInfoJSON", system.RouteProtected))
-
-	goji.Get("/api/privacy_policy", application.Route(apiController, "PrivacyAPI", system.RouteProtected))
-	goji.Get("/api/terms_and_conditions", application.Route(apiController, "TermsAPI", system.RouteProtected))
-	goji.Get("/api/help", application.Route(apiController, "HelpAPI", system.RouteProtected))
-
-	goji.Get("/api/profile.json", application.Route(apiController, "ProfileJSON", system.RouteProtected))
-	goji.Post("/api/profile.json", application.Route(apiController, "PostProfileJSON", system.RouteProtected))
-	goji.Post("/api/change_password.json", application.Route(apiController, "PostChangePasswordJSON", system.RouteProtected))
-	goji.Post("/api/reset_password.json", application.Route(apiController, "PostResetPasswordJSON", system.RouteProtected))
+	mux.Get("/api/systems.json", application.Route(apiController, "SystemsJSON", system.RouteProtected))
+	mux.Get("/api/systeminfo.json", application.Route(apiController, "SystemInfoJSON", system.RouteProtected))
+	mux.Get("/api/systemhistory.json", application.Route(apiController, "SystemHistoryJSON", system.RouteProtected))
+	mux.Post("/api/revoke_system_certificate.json", application.Route(apiController, "PostRevokeSystemCertificateJSON", system.RouteProtected))
+	mux.Post("/api/merge_systems.json", application.Route(apiController, "PostMergeSystemsJSON", system.RouteProtected))
+	mux.Post("/api/retire_system.json", application.Route(apiController, "PostRetireSystemJSON", system.RouteProtected))
+	mux.Post("/api/wake_system.json", application.Route(apiController, "PostWakeSystemJSON", system.RouteProtected))
+	mux.Get("/api/processes.json", application.Route(apiController, "ProcessesJSON", system.RouteProtected))
+	mux.Get("/api/processtree.json", application.Route(apiController, "ProcessTreeJSON", system.RouteProtected))
+	mux.Get("/api/processactivity.json", application.Route(apiController, "ProcessActivityJSON", system.RouteProtected))
+	mux.Get("/api/files.json", application.Route(apiController, "FilesJSON", system.RouteProtected))
+	mux.Get("/api/fileinfo.json", application.Route(apiController, "FileInfoJSON", system.RouteProtected))
+
+	mux.Get("/api/systemsets.json", application.Route(apiController, "SystemSetsJSON", system.RouteProtected))
+	mux.Post("/api/systemsets.json", application.Route(apiController, "PostSystemSetJSON", system.RouteProtected))
+	mux.Post("/api/rename_systemset.json", application.Route(apiController, "PostRenameSystemSetJSON", system.RouteProtected))
+	mux.Post("/api/systemset_settings.json", application.Route(apiController, "PostSystemSetSettingsJSON", system.RouteProtected))
+	mux.Post("/api/move_systemset.json", application.Route(apiController, "PostMoveSystemSetJSON", system.RouteProtected))
+	mux.Post("/api/delete_systemset.json", application.Route(apiController, "PostDeleteSystemSetJSON", system.RouteProtected))
+	mux.Post("/api/move_system.json", application.Route(apiController, "PostMoveSystemJSON", system.RouteProtected))
+
+	mux.Get("/api/rules.json", application.Route(apiController, "RulesJSON", system.RouteProtected))
+	mux.Post("/api/rules.json", application.Route(apiController, "PostRuleJSON", system.RouteProtected))
+	mux.Post("/api/delete_rule.json", application.Route(apiController, "PostDeleteRuleJSON", system.RouteProtected))
+	mux.Post("/api/ruleset.json", application.Route(apiController, "PostRuleSetJSON", system.RouteProtected))
+
+	mux.Get("/api/privacy_policy", application.Route(apiController, "PrivacyAPI", system.RouteProtected))
+	mux.Get("/api/terms_and_conditions", application.Route(apiController, "TermsAPI", system.RouteProtected))
+	mux.Get("/api/help", application.Route(apiController, "HelpAPI", system.RouteProtected))
+
+	mux.Get("/api/profile.json", application.Route(apiController, "ProfileJSON", system.RouteProtected))
+	mux.Post("/api/profile.json", application.Route(apiController, "PostProfileJSON", system.RouteProtected))
+	mux.Post("/api/change_password.json", application.Route(apiController, "PostChangePasswordJSON", system.RouteProtected))
+	mux.Post("/api/reset_password.json", application.Route(apiController, "PostResetPasswordJSON", system.RouteProtected))
+	mux.Get("/api/customer_settings.json", application.Route(apiController, "CustomerSettingsJSON", system.RouteProtected))
+	mux.Post("/api/customer_settings.json", application.Route(apiController, "PostCustomerSettingsJSON", system.RouteProtected))
 	// Reset password is the same as change password, except it doesn't require you to type in your old password
 
 	// Don't show 404's
-	goji.NotFound(application.Route(controller, "Index", system.RouteProtected))
-
-	//
-	// Graceful shutodown
-	//
-	graceful.PostHook(func() {
-		application.Close()
-	})
-
-	flag.Set("bind", fmt.Sprintf(":%s", application.Configuration.ListeningPort))
-	goji.Serve()
+	mux.NotFound(application.Route(controller, "Index", system.RouteProtected))
 }
@@ -0,0 +1,530 @@
+////////////////////////////////////////////////////////////////////////////
+//
+// Summit Route End Point Protection
+//
+// This source code is licensed under the BSD-style license found in the
+// LICENSE file in the root directory of this source tree.
+//
+/////////////////////////////////////////////////////////////////////////////
+
+package main
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"database/sql/driver"
+	"encoding/hex"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/coopernurse/gorp"
+	uuid "github.com/nu7hatch/gouuid"
+	gojiweb "github.com/zenazn/goji/web"
+
+	"qdserver/WebServer/system"
+	"qdserver/WebServer/tenant"
+	"qdserver/lib/migrations"
+	"qdserver/lib/models"
+	"qdserver/lib/storage"
+	"qdserver/lib/utils"
+)
+
+// testDBEnv names the environment variable with the connection string of a database TestCrossCustomerRoutes may
+// write to.  TestRoutesQueryOneCustomer doesn't need one.
+const testDBEnv = "SREPP_TEST_DB"
+
+// targets are a customer's rows that requests name
+type targets struct {
+	customerID  int64
+	systemUUID  string
+	systemSetID int64
+	ruleID      int64
+	eventID     int64
+	sha256      string
+}
+
+// testRequest is a request to one of the routes
+type testRequest struct {
+	method string
+	path   string
+	form   url.Values
+}
+
+// crossCustomerRequests returns requests to every route that reads or writes customers' data, which try to reach the
+// other customer's rows.  Requests that move something between two rows use one of the signed in customer's own.
+func crossCustomerRequests(own, other targets) []testRequest {
+	get := func(path string, query url.Values) testRequest {
+		if query != nil {
+			path += "?" + query.Encode()
+		}
+		return testRequest{method: "GET", path: path}
+	}
+	post := func(path string, form url.Values) testRequest {
+		return testRequest{method: "POST", path: path, form: form}
+	}
+	systemSet := strconv.FormatInt(other.systemSetID, 10)
+	ownSystemSet := strconv.FormatInt(own.systemSetID, 10)
+
+	return []testRequest{
+		get("/download/SREPP.exe", nil),
+		get("/download/file/"+other.sha256, nil),
+
+		get("/api/systems.json", nil),
+		get("/api/systeminfo.json", url.Values{"uuid": {other.systemUUID}}),
+		get("/api/systemhistory.json", url.Values{"uuid": {other.systemUUID}}),
+		post("/api/revoke_system_certificate.json", url.Values{"SystemUUID": {other.systemUUID}}),
+		post("/api/merge_systems.json", url.Values{"FromSystemUUID": {own.systemUUID}, "IntoSystemUUID": {other.systemUUID}}),
+		post("/api/merge_systems.json", url.Values{"FromSystemUUID": {other.systemUUID}, "IntoSystemUUID": {own.systemUUID}}),
+		post("/api/retire_system.json", url.Values{"SystemUUID": {other.systemUUID}, "Retired": {"true"}}),
+		post("/api/wake_system.json", url.Values{"SystemUUID": {other.systemUUID}}),
+
+		get("/api/processes.json", nil),
+		get("/api/processes.json", url.Values{"system": {other.systemUUID}}),
+		get("/api/processtree.json", url.Values{"system": {other.systemUUID}}),
+		get("/api/processtree.json", url.Values{"event": {strconv.FormatInt(other.eventID, 10)}}),
+		get("/api/processactivity.json", url.Values{"system": {other.systemUUID}, "sha256": {other.sha256}}),
+		get("/api/files.json", nil),
+		get("/api/files.json", url.Values{"sha256": {other.sha256}}),
+		get("/api/fileinfo.json", url.Values{"sha256": {other.sha256}}),
+
+		get("/api/systemsets.json", nil),
+		post("/api/systemsets.json", url.Values{"Name": {"Stolen"}, "ParentID": {systemSet}}),
+		post("/api/rename_systemset.json", url.Values{"SystemSetID": {systemSet}, "Name": {"Stolen"}}),
+		post("/api/systemset_settings.json", url.Values{"SystemSetID": {systemSet}, "Mode": {"1"}}),
+		post("/api/move_systemset.json", url.Values{"SystemSetID": {systemSet}, "ParentID": {ownSystemSet}}),
+		post("/api/move_systemset.json", url.Values{"SystemSetID": {ownSystemSet}, "ParentID": {systemSet}}),
+		post("/api/delete_systemset.json", url.Values{"SystemSetID": {systemSet}}),
+		post("/api/move_system.json", url.Values{"SystemSetID": {systemSet}, "SystemUUID": {own.systemUUID}}),
+		post("/api/move_system.json", url.Values{"SystemSetID": {ownSystemSet}, "SystemUUID": {other.systemUUID}}),
+
+		get("/api/rules.json", url.Values{"systemset": {systemSet}}),
+		post("/api/rules.json", url.Values{"SystemSetID": {systemSet}, "AttributeType": {models.RuleAttributeCompanyName},
+			"AttributeValue": {"Stolen"}, "Description": {"Stolen"}, "Allow": {"true"}}),
+		post("/api/delete_rule.json", url.Values{"SystemSetID": {systemSet}, "RuleID": {strconv.FormatInt(other.ruleID, 10)}}),
+		post("/api/delete_rule.json", url.Values{"SystemSetID": {ownSystemSet}, "RuleID": {strconv.FormatInt(other.ruleID, 10)}}),
+		post("/api/ruleset.json", url.Values{"SystemSetID": {systemSet}, "DefaultAllow": {"false"}}),
+
+		post("/api/profile.json", url.Values{"FirstName": {"Stolen"}, "Email": {"stolen@example.com"}}),
+		post("/api/reset_password.json", url.Values{"NewPassword": {"stolen password"}}),
+		get("/api/customer_settings.json", nil),
+		post("/api/customer_settings.json", url.Values{"ProcessEventRetention": {"1"}, "ArchiveProcessEvents": {"true"}}),
+	}
+}
+
+// customerFreeRoutes are the routes that don't read or write customers' data, so crossCustomerRequests leaves out
+var customerFreeRoutes = map[string]bool{
+	"GET /robots.txt": true, "GET /favicon.ico": true, "GET /": true, "GET /logout": true,
+	"GET /signin": true, "POST /signin": true, "GET /forgot_password": true, "POST /forgot_password": true,
+	"GET /password_reset/:data": true, "GET /register": true, "POST /register": true,
+	"GET /terms_and_conditions": true, "GET /privacy_policy": true, "GET /help": true,
+	"GET /api/privacy_policy": true, "GET /api/terms_and_conditions": true, "GET /api/help": true,
+
+	// The profile is the signed in user, who is already loaded
+	"GET /api/profile.json": true,
+
+	// Changing the password needs the current one, so it is covered by reset_password
+	"POST /api/change_password.json": true,
+}
+
+var routeRegexp = regexp.MustCompile(`mux\.(Get|Post)\("([^"]+)"`)
+
+// Every route added by addRoutes has a request in crossCustomerRequests, or doesn't touch customers' data
+func TestCrossCustomerRequestsCoverRoutes(t *testing.T) {
+	source, err := ioutil.ReadFile("server.go")
+	if err != nil {
+		t.Fatalf("Unable to read server.go, %v", err)
+	}
+
+	requested := make(map[string]bool)
+	for _, request := range crossCustomerRequests(targets{sha256: strings.Repeat("a", 64)}, targets{sha256: strings.Repeat("b", 64)}) {
+		path := strings.SplitN(request.path, "?", 2)[0]
+		if strings.HasPrefix(path, "/download/file/") {
+			path = "/download/file/:sha256"
+		}
+		requested[request.method+" "+path] = true
+	}
+
+	matches := routeRegexp.FindAllStringSubmatch(string(source), -1)
+	if len(matches) == 0 {
+		t.Fatalf("Found no routes in server.go")
+	}
+	for _, match := range matches {
+		route := strings.ToUpper(match[1]) + " " + match[2]
+		if !requested[route] && !customerFreeRoutes[route] {
+			t.Errorf("No cross-customer request for %s", route)
+		}
+	}
+}
+
+// newTestServer returns the routes, served to the user
+func newTestServer(dbmap *gorp.DbMap, store storage.Store, user models.User) http.Handler {
+	application := &system.Application{Configuration: &system.Configuration{}, DBSession: dbmap, ExeStore: store}
+
+	mux := gojiweb.New()
+	mux.Use(func(c *gojiweb.C, h http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			c.Env = map[interface{}]interface{}{"User": user}
+			h.ServeHTTP(w, r)
+		})
+	})
+	mux.Use(application.ApplyDatabase)
+	addRoutes(mux, application)
+	return mux
+}
+
+// serve sends the request to the server and returns the response
+func serve(server http.Handler, request testRequest) *httptest.ResponseRecorder {
+	var body io.Reader
+	if request.form != nil {
+		body = strings.NewReader(request.form.Encode())
+	}
+	r, _ := http.NewRequest(request.method, request.path, body)
+	if request.form != nil {
+		r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	}
+
+	w := httptest.NewRecorder()
+	server.ServeHTTP(w, r)
+	return w
+}
+
+// newTestStore returns a local store in a temporary directory, and a function that removes it
+func newTestStore(t *testing.T) (storage.Store, func()) {
+	dir, err := ioutil.TempDir("", "webserver-test")
+	if err != nil {
+		t.Fatalf("Unable to make a temporary directory, %v", err)
+	}
+	store, err := storage.NewLocalStore(dir)
+	if err != nil {
+		os.RemoveAll(dir)
+		t.Fatalf("Unable to make a store, %v", err)
+	}
+	return store, func() { os.RemoveAll(dir) }
+}
+
+// recordedStatement is a statement run through a recordingDriver
+type recordedStatement struct {
+	query string
+	args  []driver.Value
+}
+
+// recordingDriver is a database/sql driver that records the statements run through it, and finds no rows
+type recordingDriver struct {
+	sync.Mutex
+	statements []recordedStatement
+}
+
+// take returns the statements recorded since the last take
+func (d *recordingDriver) take() []recordedStatement {
+	d.Lock()
+	defer d.Unlock()
+	statements := d.statements
+	d.statements = nil
+	return statements
+}
+
+func (d *recordingDriver) Open(name string) (driver.Conn, error) {
+	return recordingConn{d}, nil
+}
+
+type recordingConn struct {
+	driver *recordingDriver
+}
+
+func (conn recordingConn) Prepare(query string) (driver.Stmt, error) {
+	return recordingStmt{conn.driver, query}, nil
+}
+func (conn recordingConn) Close() error              { return nil }
+func (conn recordingConn) Begin() (driver.Tx, error) { return conn, nil }
+func (conn recordingConn) Commit() error             { return nil }
+func (conn recordingConn) Rollback() error           { return nil }
+
+type recordingStmt struct {
+	driver *recordingDriver
+	query  string
+}
+
+func (stmt recordingStmt) record(args []driver.Value) {
+	stmt.driver.Lock()
+	defer stmt.driver.Unlock()
+	stmt.driver.statements = append(stmt.driver.statements, recordedStatement{stmt.query, args})
+}
+
+func (stmt recordingStmt) Close() error  { return nil }
+func (stmt recordingStmt) NumInput() int { return -1 }
+func (stmt recordingStmt) Exec(args []driver.Value) (driver.Result, error) {
+	stmt.record(args)
+	return driver.RowsAffected(0), nil
+}
+func (stmt recordingStmt) Query(args []driver.Value) (driver.Rows, error) {
+	stmt.record(args)
+	return noRows{}, nil
+}
+
+type noRows struct{}
+
+func (noRows) Columns() []string              { return nil }
+func (noRows) Close() error                   { return nil }
+func (noRows) Next(dest []driver.Value) error { return io.EOF }
+
+var recorder = &recordingDriver{}
+
+func init() {
+	sql.Register("recording", recorder)
+}
+
+// unscopedStatements are statements that name customers' tables without being limited to one customer
+var unscopedStatements = []*regexp.Regexp{
+	// Users sign in by email, so it has to be unique across customers.  Only a count is returned.
+	regexp.MustCompile(`(?i)FROM Users\s+WHERE Email=`),
+}
+
+// Every statement run for a request names customers' tables only through the signed in user's customer, and never
+// names the other customer
+func TestRoutesQueryOneCustomer(t *testing.T) {
+	db, err := sql.Open("recording", "")
+	if err != nil {
+		t.Fatalf("Unable to open the recording driver, %v", err)
+	}
+	store, removeStore := newTestStore(t)
+	defer removeStore()
+
+	own := targets{customerID: 1001, systemUUID: "11111111-1111-4111-8111-111111111111", systemSetID: 1201,
+		ruleID: 1301, eventID: 1401, sha256: strings.Repeat("a", 64)}
+	other := targets{customerID: 2001, systemUUID: "22222222-2222-4222-8222-222222222222", systemSetID: 2201,
+		ruleID: 2301, eventID: 2401, sha256: strings.Repeat("b", 64)}
+	server := newTestServer(models.NewDbMap(db), store, models.User{ID: 1101, CustomerID: own.customerID})
+
+	tables := make(map[string]*regexp.Regexp)
+	for _, table := range tenant.ScopedTables() {
+		tables[table] = regexp.MustCompile(`(?i)\b` + table + `\b`)
+	}
+
+	for _, request := range crossCustomerRequests(own, other) {
+		serve(server, request)
+		statements := recorder.take()
+		if len(statements) == 0 {
+			t.Errorf("%s %s: ran no statements", request.method, request.path)
+		}
+
+	statements:
+		for _, statement := range statements {
+			bound := false
+			for _, arg := range statement.args {
+				if arg == other.customerID {
+					t.Errorf("%s %s: %q was given the other customer", request.method, request.path, statement.query)
+				}
+				bound = bound || arg == own.customerID
+			}
+			if bound {
+				continue
+			}
+
+			for _, unscoped := range unscopedStatements {
+				if unscoped.MatchString(statement.query) {
+					continue statements
+				}
+			}
+			for table, tableRegexp := range tables {
+				if tableRegexp.MatchString(statement.query) {
+					t.Errorf("%s %s: %q names %s without the customer", request.method, request.path, statement.query, table)
+				}
+			}
+		}
+	}
+}
+
+// testCustomer is a customer with a row in every table that belongs to customers.  Everything it shows to the user
+// includes its tag.
+type testCustomer struct {
+	tag        string
+	db         *tenant.DB
+	customer   *models.Customer
+	user       *models.User
+	rule       *models.Rule
+	ruleSet    *models.RuleSet
+	systemSet  *models.SystemSet
+	system     *models.System
+	file       *models.ExecutableFile
+	filePath   *models.FilePath
+	event      *models.ProcessEvent
+	systemUUID string
+}
+
+// randomBytes returns n random bytes
+func randomBytes(t *testing.T, n int) []byte {
+	b := make([]byte, n)
+	if _, err := io.ReadFull(rand.Reader, b); err != nil {
+		t.Fatalf("Unable to read random data, %v", err)
+	}
+	return b
+}
+
+// newTestCustomer adds a customer with a row in every table that belongs to customers
+func newTestCustomer(t *testing.T, dbmap *gorp.DbMap) *testCustomer {
+	now := utils.DBTimeNow()
+	c := &testCustomer{tag: "customer" + hex.EncodeToString(randomBytes(t, 8))}
+
+	insert := func(list ...interface{}) {
+		if err := dbmap.Insert(list...); err != nil {
+			t.Fatalf("Unable to insert %T, %v", list[0], err)
+		}
+	}
+
+	c.customer = &models.Customer{UUID: randomBytes(t, 16), Active: true, CreationDate: now}
+	insert(c.customer)
+	c.user = &models.User{CustomerID: c.customer.ID, FirstName: c.tag, Email: c.tag + "@example.com", Active: true, CreationDate: now}
+	c.rule = &models.Rule{Description: c.tag, AttributeType: models.RuleAttributeCompanyName, AttributeValue: c.tag, AllowDeny: true}
+	insert(c.user, c.rule)
+
+	c.ruleSet = &models.RuleSet{FirstRule: c.rule.ID, DefaultAllow: true}
+	insert(c.ruleSet)
+	c.systemSet = &models.SystemSet{CustomerID: c.customer.ID, Name: c.tag, RuleSetID: c.ruleSet.ID, CreationDate: now}
+	insert(c.systemSet)
+
+	systemUUID, err := uuid.NewV4()
+	if err != nil {
+		t.Fatalf("Unable to make a UUID, %v", err)
+	}
+	c.systemUUID = systemUUID.String()
+	c.system = &models.System{SystemSetID: c.systemSet.ID, SystemUUID: systemUUID[:], Comment: c.tag, MachineName: c.tag,
+		FirstSeen: now, LastSeen: now}
+	insert(c.system)
+
+	path := `c:\` + c.tag + `\` + c.tag + ".exe"
+	pathHash := sha256.Sum256([]byte(path))
+	c.filePath = &models.FilePath{Hash: pathHash[:], Path: path}
+	c.file = &models.ExecutableFile{Md5: randomBytes(t, 16), Sha1: randomBytes(t, 20), Sha256: randomBytes(t, 32),
+		Size: 1, FirstSeen: now, UploadDate: now, CompanyName: c.tag, ProductName: c.tag}
+	insert(c.filePath, c.file)
+
+	c.event = &models.ProcessEvent{SystemID: c.system.ID, ExecutableFileID: c.file.ID, PID: 100, PPID: 4,
+		FilePathID: c.filePath.ID, EventTime: now, State: models.ProcessStateRunning}
+	insert(c.event,
+		&models.FileToSystemMap{FileID: c.file.ID, SystemID: c.system.ID, FilePathID: c.filePath.ID, FirstSeen: now, LastSeen: now},
+		&models.ProcessEventRollup{Day: now - now%86400, SystemID: c.system.ID, ExecutableFileID: c.file.ID, Events: 1,
+			FirstSeen: now, LastSeen: now},
+		&models.ModuleLoadEvent{SystemID: c.system.ID, ExecutableFileID: c.file.ID, ProcessEventID: c.event.ID, PID: 100,
+			FilePathID: c.filePath.ID, EventTime: now},
+		&models.DriverLoadEvent{SystemID: c.system.ID, ExecutableFileID: c.file.ID, FilePathID: c.filePath.ID, EventTime: now},
+		&models.Task{SystemID: c.system.ID, CreationDate: now, Command: `{"Command":"` + c.tag + `"}`, State: models.TaskStatePending},
+		&models.SystemHistory{SystemID: c.system.ID, ChangeTime: now, Field: "Comment", NewValue: c.tag},
+		&models.AgentCertificate{SystemID: c.system.ID, SerialNumber: randomBytes(t, 16), Fingerprint: randomBytes(t, 32),
+			NotBefore: now, NotAfter: now + 86400, CreationDate: now},
+		&models.FileUpload{SystemID: c.system.ID, Sha256: randomBytes(t, 32), Size: 1, FileType: "exe", CreationDate: now, LastUpdate: now},
+		&models.RequestNonce{SystemID: c.system.ID, Nonce: c.tag, Timestamp: now})
+
+	c.db = tenant.New(dbmap, c.customer.ID)
+	return c
+}
+
+// targets returns the customer's rows that requests name
+func (c *testCustomer) targets() targets {
+	return targets{customerID: c.customer.ID, systemUUID: c.systemUUID, systemSetID: c.systemSet.ID, ruleID: c.rule.ID,
+		eventID: c.event.ID, sha256: hex.EncodeToString(c.file.Sha256)}
+}
+
+// remove deletes what newTestCustomer added, along with anything the requests added
+func (c *testCustomer) remove(dbmap *gorp.DbMap) {
+	for _, table := range []string{"processevents", "processeventrollups", "moduleloadevents", "driverloadevents",
+		"filetosystemmap", "tasks", "systemhistory", "agentcertificates", "fileuploads", "requestnonces"} {
+		dbmap.Exec("DELETE FROM "+table+" WHERE SystemID IN (SELECT s.ID FROM systems s, systemsets ss WHERE s.SystemSetID=ss.ID and ss.CustomerID=$1)",
+			c.customer.ID)
+	}
+	dbmap.Exec("DELETE FROM systems WHERE SystemSetID IN (SELECT ID FROM systemsets WHERE CustomerID=$1)", c.customer.ID)
+	dbmap.Exec("DELETE FROM systemsets WHERE CustomerID=$1", c.customer.ID)
+	dbmap.Exec("DELETE FROM users WHERE CustomerID=$1", c.customer.ID)
+	dbmap.Delete(c.ruleSet, c.rule, c.file, c.filePath, c.customer)
+}
+
+// rows returns the text of each of the customer's rows in every table that belongs to customers
+func (c *testCustomer) rows(t *testing.T) map[string][]string {
+	rows := make(map[string][]string)
+	for _, table := range tenant.ScopedTables() {
+		var tableRows []string
+		if _, err := c.db.Select(&tableRows, "SELECT t::text FROM {"+table+"} t ORDER BY 1", nil); err != nil {
+			t.Fatalf("Unable to read %s, %v", table, err)
+		}
+		rows[table] = tableRows
+	}
+	return rows
+}
+
+// Each route, asked for the other customer's rows by customer A, shows A nothing of B's and changes nothing of B's
+func TestCrossCustomerRoutes(t *testing.T) {
+	connectionString := os.Getenv(testDBEnv)
+	if connectionString == "" {
+		t.Skipf("Set %s to a database the tests may write to", testDBEnv)
+	}
+	dbmap, err := models.InitDB(connectionString)
+	if err != nil {
+		t.Fatalf("Unable to connect to the test database, %v", err)
+	}
+	if _, err = migrations.Up(dbmap, 0); err != nil {
+		t.Fatalf("Unable to migrate the test database, %v", err)
+	}
+
+	a, b := newTestCustomer(t, dbmap), newTestCustomer(t, dbmap)
+	defer a.remove(dbmap)
+	defer b.remove(dbmap)
+
+	// B's file can be downloaded, by B
+	store, removeStore := newTestStore(t)
+	defer removeStore()
+	if err = store.Put(storage.HashKey(b.targets().sha256), strings.NewReader(b.tag), int64(len(b.tag)), nil); err != nil {
+		t.Fatalf("Unable to store B's file, %v", err)
+	}
+
+	bRows := b.rows(t)
+	for _, table := range tenant.ScopedTables() {
+		if len(bRows[table]) == 0 {
+			t.Errorf("B has no rows in %s, so it isn't checked", table)
+		}
+	}
+
+	server := newTestServer(dbmap, store, *a.user)
+	for _, request := range crossCustomerRequests(a.targets(), b.targets()) {
+		response := serve(server, request)
+		if strings.Contains(response.Body.String(), b.tag) {
+			t.Errorf("%s %s: A was shown B's data, %s", request.method, request.path, response.Body.String())
+		}
+	}
+
+	after := b.rows(t)
+	for _, table := range tenant.ScopedTables() {
+		if !reflect.DeepEqual(bRows[table], after[table]) {
+			t.Errorf("A changed B's %s, from %v to %v", table, bRows[table], after[table])
+		}
+	}
+
+	// The same requests for B's own rows do reach them, so the checks above aren't passing because nothing is found
+	bServer := newTestServer(dbmap, store, *b.user)
+	for _, request := range []testRequest{
+		{method: "GET", path: "/download/file/" + b.targets().sha256},
+		{method: "GET", path: "/api/systems.json"},
+		{method: "GET", path: "/api/systeminfo.json?uuid=" + b.systemUUID},
+		{method: "GET", path: "/api/systemhistory.json?uuid=" + b.systemUUID},
+		{method: "GET", path: "/api/processes.json?system=" + b.systemUUID},
+		{method: "GET", path: "/api/files.json"},
+		{method: "GET", path: "/api/fileinfo.json?sha256=" + b.targets().sha256},
+		{method: "GET", path: "/api/systemsets.json"},
+		{method: "GET", path: "/api/rules.json?systemset=" + strconv.FormatInt(b.systemSet.ID, 10)},
+	} {
+		response := serve(bServer, request)
+		if response.Code != http.StatusOK || !bytes.Contains(response.Body.Bytes(), []byte(b.tag)) {
+			t.Errorf("%s %s: B wasn't shown their own data, %d %s", request.method, request.path, response.Code, response.Body.String())
+		}
+	}
+}
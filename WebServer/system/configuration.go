@@ -13,6 +13,7 @@ import (
 	"encoding/json"
 	"io/ioutil"
 
+	"qdserver/lib/storage"
 	"qdserver/lib/utils"
 )
 
@@ -26,16 +27,37 @@ type ConfigurationAWS struct {
 	Ses utils.AwsSes `json:"ses"`
 }
 
+// ConfigurationStorage is a sub-element of Configuration and says where uploaded files are kept
+type ConfigurationStorage struct {
+	ExeUpload storage.Config `json:"exe_upload"` // Leave out to turn off downloading samples
+	Archive   storage.Config `json:"archive"`    // Where expired process events are archived, leave out to turn off archiving
+}
+
+// ConfigurationAlerts is a sub-element of Configuration and controls the check for systems that have stopped checking in
+type ConfigurationAlerts struct {
+	CheckInterval int64 `json:"check_interval"` // Seconds between checks
+}
+
+// ConfigurationRetention is a sub-element of Configuration and controls how long process events are kept
+type ConfigurationRetention struct {
+	CheckInterval int64 `json:"check_interval"` // Seconds between removing expired events
+	DefaultDays   int64 `json:"default_days"`   // Days to keep events for customers that haven't chosen, 0 to keep them forever
+}
+
 // Configuration is the main structure of our config.json file
 type Configuration struct {
-	Environment   string                `json:"environment"`
-	ListeningPort string                `json:"listening_port"`
-	Secret        string                `json:"secret"`        // Secret value for crypto of cookies.  Change this periodically.
-	PublicPath    string                `json:"public_path"`   // Public web files
-	TemplatePath  string                `json:"template_path"` // Template directory (the views)
-	BaseURL       string                `json:"base_url"`      // In production this is "https://app.summitroute.com"
-	Database      ConfigurationDatabase `json:"database"`
-	Aws           ConfigurationAWS      `json:"aws"`
+	Environment   string                 `json:"environment"`
+	ListeningPort string                 `json:"listening_port"`
+	Secret        string                 `json:"secret"`        // Secret value for crypto of cookies.  Change this periodically.
+	PublicPath    string                 `json:"public_path"`   // Public web files
+	TemplatePath  string                 `json:"template_path"` // Template directory (the views)
+	BaseURL       string                 `json:"base_url"`      // In production this is "https://app.summitroute.com"
+	AMQPServer    string                 `json:"amqp_server"`   // Used to wake agents when they are given tasks, leave out to let them wait for their next poll
+	Database      ConfigurationDatabase  `json:"database"`
+	Aws           ConfigurationAWS       `json:"aws"`
+	Storage       ConfigurationStorage   `json:"storage"`
+	Alerts        ConfigurationAlerts    `json:"alerts"`
+	Retention     ConfigurationRetention `json:"retention"`
 }
 
 // Load parses our configuration file
@@ -54,6 +76,17 @@ func (configuration *Configuration) Load(filename string) (err error) {
 // Parse parses the configuration file into a structure
 func (configuration *Configuration) Parse(data []byte) (err error) {
 	err = json.Unmarshal(data, &configuration)
+	if err != nil {
+		return
+	}
+
+	// Defaults for older config files
+	if configuration.Alerts.CheckInterval == 0 {
+		configuration.Alerts.CheckInterval = 60 * 5
+	}
+	if configuration.Retention.CheckInterval == 0 {
+		configuration.Retention.CheckInterval = 60 * 60
+	}
 
 	return
 }
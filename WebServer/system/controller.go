@@ -15,7 +15,13 @@ import (
 
 	"github.com/coopernurse/gorp"
 	"github.com/gorilla/sessions"
+	"github.com/streadway/amqp"
 	"github.com/zenazn/goji/web"
+
+	"qdserver/WebServer/tenant"
+	"qdserver/lib/models"
+	"qdserver/lib/storage"
+	"qdserver/lib/taskqueue"
 )
 
 // Controller blah
@@ -41,6 +47,38 @@ func (controller *Controller) GetDatabase(c web.C) *gorp.DbMap {
 	return nil
 }
 
+// GetTenantDatabase returns the database scoped to the signed in user's customer, or nil if no one is signed in.
+// Handlers use it for everything they look up for the user, so they can only see their own customer's data.
+func (controller *Controller) GetTenantDatabase(c web.C) *tenant.DB {
+	db := controller.GetDatabase(c)
+	user, ok := c.Env["User"].(models.User)
+	if db == nil || !ok {
+		return nil
+	}
+
+	return tenant.New(db, user.CustomerID)
+}
+
+// GetExeStore returns where uploaded executables are kept, or nil if that isn't configured
+func (controller *Controller) GetExeStore(c web.C) storage.Store {
+	if store, ok := c.Env["ExeStore"].(storage.Store); ok {
+		return store
+	}
+
+	return nil
+}
+
+// WakeSystem tells the CallbackServers to hand the system its tasks now, if the system is polling.
+// Does nothing when no queue is configured.
+func (controller *Controller) WakeSystem(c web.C, systemID int64) error {
+	ch, ok := c.Env["QueueChannel"].(*amqp.Channel)
+	if !ok || ch == nil {
+		return nil
+	}
+
+	return TaskQueue.WakeSystem(ch, systemID)
+}
+
 // Parse blah
 func (controller *Controller) Parse(t *template.Template, name string, data interface{}) string {
 	var doc bytes.Buffer
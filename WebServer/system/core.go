@@ -22,9 +22,13 @@ import (
 	"github.com/coopernurse/gorp"
 	"github.com/gorilla/sessions"
 	_ "github.com/lib/pq" // Needed for gorp
+	"github.com/streadway/amqp"
 	"github.com/zenazn/goji/web"
 
+	"qdserver/lib/migrations"
 	"qdserver/lib/models"
+	"qdserver/lib/storage"
+	"qdserver/lib/taskqueue"
 )
 
 // Application holds our app's global variables
@@ -33,6 +37,9 @@ type Application struct {
 	Template      *template.Template
 	Store         *sessions.CookieStore
 	DBSession     *gorp.DbMap
+	ExeStore      storage.Store // nil when no storage is configured
+	ArchiveStore  storage.Store // nil when no archive is configured
+	QueueChannel  *amqp.Channel // nil when no queue is configured
 }
 
 const (
@@ -89,14 +96,70 @@ func (application *Application) ConnectToDatabase() {
 		panic(err)
 	}
 
+	// Don't run against a schema we don't understand
+	if err = migrations.CheckCurrent(dbmap); err != nil {
+		log.Fatalf("%v", err)
+		panic(err)
+	}
+
 	// Store our session
 	application.DBSession = dbmap
 }
 
+// ConnectToStorage sets up access to the uploaded files and the archive, if configured
+func (application *Application) ConnectToStorage() {
+	var err error
+	config := application.Configuration.Storage
+
+	if config.ExeUpload.Type == "" {
+		log.Warning("No storage configured, so samples can't be downloaded")
+	} else if application.ExeStore, err = storage.New(config.ExeUpload); err != nil {
+		log.Fatalf("Unable to set up storage for executables: %v", err)
+		panic(err)
+	}
+
+	if config.Archive.Type != "" {
+		if application.ArchiveStore, err = storage.New(config.Archive); err != nil {
+			log.Fatalf("Unable to set up storage for the archive: %v", err)
+			panic(err)
+		}
+	}
+}
+
+// ConnectToQueues connects to the queue used to wake agents, if configured
+func (application *Application) ConnectToQueues() {
+	if application.Configuration.AMQPServer == "" {
+		log.Warning("No queue configured, so agents will get their tasks on their next poll instead of right away")
+		return
+	}
+
+	conn, err := amqp.Dial(application.Configuration.AMQPServer)
+	if err != nil {
+		log.Fatalf("Failed to connect to RabbitMQ: %v", err)
+		panic(err)
+	}
+
+	ch, err := conn.Channel()
+	if err != nil {
+		log.Fatalf("Failed to open a channel: %v", err)
+		panic(err)
+	}
+
+	if err = TaskQueue.DeclareWakeExchange(ch); err != nil {
+		log.Fatalf("Failed to declare wake exchange: %v", err)
+		panic(err)
+	}
+
+	application.QueueChannel = ch
+}
+
 // Close cleans up anything nicely before exiting the process
 func (application *Application) Close() {
 	log.Info("Bye!")
 	application.DBSession.Db.Close()
+	if application.QueueChannel != nil {
+		application.QueueChannel.Close()
+	}
 }
 
 // Route defines a web route
@@ -130,6 +193,9 @@ func (application *Application) Route(controller interface{}, route string, prot
 			if _, exists := c.Env["Content-Length"]; exists {
 				w.Header().Set("Content-Length", c.Env["Content-Length"].(string))
 			}
+			if _, exists := c.Env["Content-Disposition"]; exists {
+				w.Header().Set("Content-Disposition", c.Env["Content-Disposition"].(string))
+			}
 			io.WriteString(w, body)
 		case http.StatusSeeOther, http.StatusFound:
 			http.Redirect(w, r, body, code)
@@ -49,6 +49,8 @@ func (application *Application) ApplyDatabase(c *web.C, h http.Handler) http.Han
 	fn := func(w http.ResponseWriter, r *http.Request) {
 		c.Env["DBSession"] = application.DBSession
 		c.Env["Config"] = application.Configuration
+		c.Env["ExeStore"] = application.ExeStore
+		c.Env["QueueChannel"] = application.QueueChannel
 
 		h.ServeHTTP(w, r)
 	}
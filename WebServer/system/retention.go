@@ -0,0 +1,37 @@
+////////////////////////////////////////////////////////////////////////////
+//
+// Summit Route End Point Protection
+//
+// This source code is licensed under the BSD-style license found in the
+// LICENSE file in the root directory of this source tree.
+//
+/////////////////////////////////////////////////////////////////////////////
+
+package system
+
+import (
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+
+	"qdserver/lib/retention"
+	"qdserver/lib/utils"
+)
+
+// ExpireProcessEvents periodically creates the partitions for upcoming process events, and rolls up, archives, and
+// removes the events each customer no longer wants to keep.
+// This never returns, so run it in its own goroutine.
+func (application *Application) ExpireProcessEvents() {
+	config := retention.Config{
+		DefaultDays:  application.Configuration.Retention.DefaultDays,
+		ArchiveStore: application.ArchiveStore,
+	}
+
+	for {
+		if err := retention.Run(application.DBSession, config, utils.DBTimeNow()); err != nil {
+			log.Errorf("Unable to expire process events, %v", err)
+		}
+
+		time.Sleep(time.Duration(application.Configuration.Retention.CheckInterval) * time.Second)
+	}
+}
@@ -0,0 +1,120 @@
+////////////////////////////////////////////////////////////////////////////
+//
+// Summit Route End Point Protection
+//
+// This source code is licensed under the BSD-style license found in the
+// LICENSE file in the root directory of this source tree.
+//
+/////////////////////////////////////////////////////////////////////////////
+
+package system
+
+import (
+	"fmt"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+
+	"qdserver/lib/models"
+	"qdserver/lib/utils"
+)
+
+// staleSystem is what the stale system check needs to know about each system
+type staleSystem struct {
+	ID           int64
+	SystemUUID   []byte
+	MachineName  string
+	Comment      string
+	LastSeen     int64
+	RetiredDate  int64
+	Status       string
+	LateAfter    int64
+	OfflineAfter int64
+	CustomerID   int64
+}
+
+// WatchForStaleSystems periodically works out the status of every system, and emails the customer's users
+// when one goes offline, as a killed agent is the first thing an attacker would want.
+// This never returns, so run it in its own goroutine.
+func (application *Application) WatchForStaleSystems() {
+	for {
+		if err := application.checkStaleSystems(); err != nil {
+			log.Errorf("Unable to check for stale systems, %v", err)
+		}
+
+		time.Sleep(time.Duration(application.Configuration.Alerts.CheckInterval) * time.Second)
+	}
+}
+
+// checkStaleSystems records the status of every system, and alerts on the ones that have gone offline
+func (application *Application) checkStaleSystems() error {
+	db := application.DBSession
+
+	var systems []staleSystem
+	_, err := db.Select(&systems, `SELECT
+		s.ID, s.SystemUUID, s.MachineName, s.Comment, s.LastSeen, s.RetiredDate, s.Status, ss.LateAfter, ss.OfflineAfter, ss.CustomerID
+		FROM systemSets ss, systems s
+		WHERE ss.ID = s.SystemSetID`)
+	if err != nil {
+		return err
+	}
+
+	now := utils.DBTimeNow()
+	for _, system := range systems {
+		status := utils.GetSystemStatus(system.LastSeen, system.RetiredDate, system.LateAfter, system.OfflineAfter, now)
+		if status == system.Status {
+			continue
+		}
+
+		// Only one WebServer gets to record the change, so only one alert is sent
+		result, err := db.Exec("UPDATE systems SET Status=$1 WHERE ID=$2 and Status=$3", status, system.ID, system.Status)
+		if err != nil {
+			return err
+		}
+		if updated, err := result.RowsAffected(); err != nil || updated == 0 {
+			continue
+		}
+
+		log.Infof("System %d is now %s", system.ID, status)
+
+		// Systems that were already offline when we first looked at them aren't news
+		if status == models.SystemStatusOffline && system.Status != "" {
+			if err = application.sendOfflineAlerts(&system); err != nil {
+				log.Errorf("Unable to alert on system %d going offline, %v", system.ID, err)
+			}
+		}
+	}
+
+	return nil
+}
+
+// sendOfflineAlerts emails every user of the customer about the system going offline
+func (application *Application) sendOfflineAlerts(system *staleSystem) error {
+	var users []models.User
+	_, err := application.DBSession.Select(&users, "select * from users where CustomerID=:customerID",
+		map[string]interface{}{
+			"customerID": system.CustomerID,
+		})
+	if err != nil {
+		return err
+	}
+
+	systemUUID, err := utils.ByteArrayToUUIDString(system.SystemUUID)
+	if err != nil {
+		return err
+	}
+	url := fmt.Sprintf("%s/systeminfo?uuid=%s", application.Configuration.BaseURL, systemUUID)
+
+	name := system.MachineName
+	if system.Comment != "" {
+		name = fmt.Sprintf("%s (%s)", system.MachineName, system.Comment)
+	}
+
+	for _, user := range users {
+		if err = utils.SendSystemOfflineEmail(application.Configuration.Aws.Ses, user.Email, name, system.LastSeen, url); err != nil {
+			log.Errorf("Unable to email %s about system %d, %v", user.Email, system.ID, err)
+		}
+	}
+
+	return nil
+}
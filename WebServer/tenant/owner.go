@@ -0,0 +1,161 @@
+////////////////////////////////////////////////////////////////////////////
+//
+// Summit Route End Point Protection
+//
+// This source code is licensed under the BSD-style license found in the
+// LICENSE file in the root directory of this source tree.
+//
+/////////////////////////////////////////////////////////////////////////////
+
+package tenant
+
+import (
+	"fmt"
+
+	"qdserver/lib/models"
+)
+
+// ownsSystemSet returns true if the system set is the customer's.  0, for no system set, is allowed if allowNone.
+func (db *DB) ownsSystemSet(systemSetID int64, allowNone bool) (bool, error) {
+	if systemSetID == 0 {
+		return allowNone, nil
+	}
+	count, err := db.SelectInt("SELECT count(*) FROM {systemsets} ss WHERE ss.ID=:id", map[string]interface{}{"id": systemSetID})
+	return count != 0, err
+}
+
+// ownsSystem returns true if the system is the customer's
+func (db *DB) ownsSystem(systemID int64) (bool, error) {
+	count, err := db.SelectInt("SELECT count(*) FROM {systems} s WHERE s.ID=:id", map[string]interface{}{"id": systemID})
+	return count != 0, err
+}
+
+// ownsRuleSet returns true if one of the customer's system sets uses the rule set, or it was inserted through the DB
+// and no system set uses it yet.  Rule sets don't record their customer, so one that no system set uses can only be
+// claimed by the request that made it.
+func (db *DB) ownsRuleSet(ruleSetID int64) (bool, error) {
+	count, err := db.SelectInt("SELECT count(*) FROM {rulesets} rs WHERE rs.ID=:id", map[string]interface{}{"id": ruleSetID})
+	if err != nil || count != 0 {
+		return count != 0, err
+	}
+
+	if !db.createdRuleSets[ruleSetID] {
+		return false, nil
+	}
+	count, err = db.executor.SelectInt("SELECT count(*) FROM systemsets WHERE RuleSetID=$1", ruleSetID)
+	return count == 0, err
+}
+
+// canUseRuleSet returns true if a system set of the customer's may use the rule set.  0, for no rule set, is allowed.
+func (db *DB) canUseRuleSet(ruleSetID int64) (bool, error) {
+	if ruleSetID == 0 {
+		return true, nil
+	}
+	return db.ownsRuleSet(ruleSetID)
+}
+
+// checkOwned returns ErrOtherCustomer unless the row, both as stored and as it will be written, is the customer's.
+// A row that is new isn't stored yet, so only what will be written is checked.
+func (db *DB) checkOwned(row interface{}, isNew bool) error {
+	var owned bool
+	var err error
+
+	switch r := row.(type) {
+	case *models.Customer:
+		owned = r.ID == db.CustomerID && !isNew
+
+	case *models.User:
+		owned = r.CustomerID == db.CustomerID
+		if owned && !isNew {
+			var count int64
+			count, err = db.SelectInt("SELECT count(*) FROM {users} u WHERE u.ID=:id", map[string]interface{}{"id": r.ID})
+			owned = count != 0
+		}
+
+	case *models.SystemSet:
+		owned = r.CustomerID == db.CustomerID
+		if owned && !isNew {
+			owned, err = db.ownsSystemSet(r.ID, false)
+		}
+		if owned && err == nil {
+			owned, err = db.ownsSystemSet(r.SystemSetID, true)
+		}
+		if owned && err == nil {
+			owned, err = db.canUseRuleSet(r.RuleSetID)
+		}
+
+	case *models.System:
+		owned, err = db.ownsSystemSet(r.SystemSetID, false)
+		if owned && err == nil && !isNew {
+			owned, err = db.ownsSystem(r.ID)
+		}
+		if owned && err == nil && r.PredecessorID != 0 {
+			owned, err = db.ownsSystem(r.PredecessorID)
+		}
+
+	case *models.RuleSet:
+		// A new rule set belongs to the customer that inserts it, until a system set uses it
+		owned = isNew
+		if !isNew {
+			owned, err = db.ownsRuleSet(r.ID)
+		}
+
+	case *models.AgentCertificate:
+		owned, err = db.ownsSystem(r.SystemID)
+		if owned && err == nil && !isNew {
+			var count int64
+			count, err = db.SelectInt("SELECT count(*) FROM {agentcertificates} ac WHERE ac.ID=:id", map[string]interface{}{"id": r.ID})
+			owned = count != 0
+		}
+
+	default:
+		return fmt.Errorf("tenant: can't check who owns a %T", row)
+	}
+
+	if err != nil {
+		return err
+	}
+	if !owned {
+		return ErrOtherCustomer
+	}
+	return nil
+}
+
+// Insert adds the rows, which must be the customer's, as gorp's Insert
+func (db *DB) Insert(list ...interface{}) error {
+	for _, row := range list {
+		if err := db.checkOwned(row, true); err != nil {
+			return err
+		}
+	}
+	if err := db.executor.Insert(list...); err != nil {
+		return err
+	}
+
+	for _, row := range list {
+		if ruleSet, ok := row.(*models.RuleSet); ok {
+			db.createdRuleSets[ruleSet.ID] = true
+		}
+	}
+	return nil
+}
+
+// Update writes the rows, which must be the customer's, as gorp's Update
+func (db *DB) Update(list ...interface{}) (int64, error) {
+	for _, row := range list {
+		if err := db.checkOwned(row, false); err != nil {
+			return 0, err
+		}
+	}
+	return db.executor.Update(list...)
+}
+
+// Delete removes the rows, which must be the customer's, as gorp's Delete
+func (db *DB) Delete(list ...interface{}) (int64, error) {
+	for _, row := range list {
+		if err := db.checkOwned(row, false); err != nil {
+			return 0, err
+		}
+	}
+	return db.executor.Delete(list...)
+}
@@ -0,0 +1,332 @@
+////////////////////////////////////////////////////////////////////////////
+//
+// Summit Route End Point Protection
+//
+// This source code is licensed under the BSD-style license found in the
+// LICENSE file in the root directory of this source tree.
+//
+/////////////////////////////////////////////////////////////////////////////
+
+// Package tenant scopes the WebServer's queries to the customer of the user making the request, so a missed
+// CustomerID clause can't show one customer another's data.
+//
+// Queries name the tables that belong to customers in braces, such as "SELECT s.* FROM {systems} s", and each is
+// replaced by a subquery of only the customer's rows.  A query that names one of those tables without braces is
+// refused with ErrUnscoped, so it has to be written the scoped way.  Writes go through Insert, Update, and Delete,
+// which check the rows belong to the customer, or through Exec, which ANDs the WHERE clause of an UPDATE or DELETE of
+// a table keyed by system with the customer's systems.
+package tenant
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/coopernurse/gorp"
+	_ "github.com/lib/pq" // Needed for gorp
+)
+
+// customerParam is the named parameter the scoped tables use for the customer's ID
+const customerParam = "tenantCustomerID"
+
+// systemIDs selects the IDs of the customer's systems
+const systemIDs = `(SELECT tenant_s.ID FROM systems tenant_s, systemsets tenant_ss
+	WHERE tenant_s.SystemSetID = tenant_ss.ID and tenant_ss.CustomerID = :` + customerParam + `)`
+
+// ruleSetIDs selects the IDs of the rule sets the customer's system sets use
+const ruleSetIDs = "(SELECT RuleSetID FROM systemsets WHERE CustomerID = :" + customerParam + ")"
+
+// bySystem returns the subquery of a table's rows that belong to the customer's systems
+func bySystem(table string) string {
+	return fmt.Sprintf("(SELECT * FROM %s WHERE SystemID IN %s)", table, systemIDs)
+}
+
+// scopedTables are the tables that belong to customers, and the subquery each is replaced with.  Tables that aren't
+// listed are shared by every customer, such as executable files' signers and the interned paths, or are only used
+// outside of requests, such as sessions.
+var scopedTables = map[string]string{
+	"customers":  "(SELECT * FROM customers WHERE ID = :" + customerParam + ")",
+	"users":      "(SELECT * FROM users WHERE CustomerID = :" + customerParam + ")",
+	"systemsets": "(SELECT * FROM systemsets WHERE CustomerID = :" + customerParam + ")",
+	"systems":    "(SELECT * FROM systems WHERE ID IN " + systemIDs + ")",
+	"rulesets":   "(SELECT * FROM rulesets WHERE ID IN " + ruleSetIDs + ")",
+
+	// Rules don't record their rule set, so follow each of the customer's rule sets from its first rule
+	"rules": `(WITH RECURSIVE tenant_r AS (
+			SELECT * FROM rules WHERE ID IN (SELECT FirstRule FROM rulesets WHERE ID IN ` + ruleSetIDs + `)
+			UNION SELECT rules.* FROM rules, tenant_r WHERE rules.ID = tenant_r.NextRule)
+		SELECT * FROM tenant_r)`,
+
+	// Files are shared, but each customer only sees those that have been on their systems
+	"executablefiles": "(SELECT * FROM executablefiles WHERE ID IN (SELECT FileID FROM filetosystemmap WHERE SystemID IN " +
+		systemIDs + "))",
+
+	"processevents":       bySystem("processevents"),
+	"processeventrollups": bySystem("processeventrollups"),
+	"moduleloadevents":    bySystem("moduleloadevents"),
+	"driverloadevents":    bySystem("driverloadevents"),
+	"filetosystemmap":     bySystem("filetosystemmap"),
+	"tasks":               bySystem("tasks"),
+	"systemhistory":       bySystem("systemhistory"),
+	"agentcertificates":   bySystem("agentcertificates"),
+	"fileuploads":         bySystem("fileuploads"),
+	"requestnonces":       bySystem("requestnonces"),
+}
+
+// writableTables are the tables that belong to customers which Exec may write, and the column that holds the system
+var writableTables = map[string]string{
+	"systems":             "ID",
+	"processevents":       "SystemID",
+	"processeventrollups": "SystemID",
+	"moduleloadevents":    "SystemID",
+	"driverloadevents":    "SystemID",
+	"filetosystemmap":     "SystemID",
+	"tasks":               "SystemID",
+	"systemhistory":       "SystemID",
+	"agentcertificates":   "SystemID",
+	"fileuploads":         "SystemID",
+	"requestnonces":       "SystemID",
+}
+
+var (
+	placeholderRegexp = regexp.MustCompile(`\{[a-z]+\}`)
+	identifierRegexp  = regexp.MustCompile(`[.A-Za-z_][A-Za-z0-9_]*`)
+	namedParamRegexp  = regexp.MustCompile(`:[A-Za-z_][A-Za-z0-9_]*`)
+	writeRegexp       = regexp.MustCompile(`(?i)^\s*(UPDATE\s+([A-Za-z_]+)\s+SET|DELETE\s+FROM\s+([A-Za-z_]+))(\s|$)`)
+	whereRegexp       = regexp.MustCompile(`(?i)\bWHERE\b`)
+)
+
+// ErrUnscoped is returned for a query that names a table that belongs to customers without braces
+type ErrUnscoped struct {
+	Table string
+}
+
+func (err ErrUnscoped) Error() string {
+	return fmt.Sprintf("tenant: %s must be queried as {%s}", err.Table, strings.ToLower(err.Table))
+}
+
+// ErrOtherCustomer is returned when writing a row that doesn't belong to the customer
+var ErrOtherCustomer = errors.New("tenant: row belongs to another customer")
+
+// ErrUnscopedWrite is returned by Exec for a write it can't limit to the customer's systems
+var ErrUnscopedWrite = errors.New("tenant: write can't be limited to the customer's systems")
+
+// DB runs queries for one customer
+type DB struct {
+	CustomerID int64
+	dbmap      *gorp.DbMap
+	executor   gorp.SqlExecutor // The dbmap, or the transaction of a Tx
+
+	createdRuleSets map[int64]bool // Rule sets inserted through the DB, which it may give to a system set
+}
+
+// Tx is a DB in a transaction
+type Tx struct {
+	*DB
+	tx *gorp.Transaction
+}
+
+// New returns a DB for the customer
+func New(dbmap *gorp.DbMap, customerID int64) *DB {
+	return &DB{CustomerID: customerID, dbmap: dbmap, executor: dbmap, createdRuleSets: make(map[int64]bool)}
+}
+
+// Begin starts a transaction
+func (db *DB) Begin() (*Tx, error) {
+	tx, err := db.dbmap.Begin()
+	if err != nil {
+		return nil, err
+	}
+	return &Tx{DB: &DB{CustomerID: db.CustomerID, dbmap: db.dbmap, executor: tx, createdRuleSets: db.createdRuleSets}, tx: tx}, nil
+}
+
+// Commit commits the transaction
+func (tx *Tx) Commit() error {
+	return tx.tx.Commit()
+}
+
+// Rollback rolls back the transaction
+func (tx *Tx) Rollback() error {
+	return tx.tx.Rollback()
+}
+
+// Unscoped returns the database, or the transaction of a Tx, without any scoping.  It is for library code, such as
+// lib/retention, that is given systems already found through the DB.
+func (db *DB) Unscoped() gorp.SqlExecutor {
+	return db.executor
+}
+
+// DbMap returns the database without any scoping, for library code such as lib/rules that needs a *gorp.DbMap and is
+// given system sets already found through the DB.  It doesn't take part in a Tx.
+func (db *DB) DbMap() *gorp.DbMap {
+	return db.dbmap
+}
+
+// ScopedTables returns the tables that belong to customers, which queries name in braces, in order
+func ScopedTables() []string {
+	var tables []string
+	for table := range scopedTables {
+		tables = append(tables, table)
+	}
+	sort.Strings(tables)
+	return tables
+}
+
+// checkUnscoped returns ErrUnscoped if the query names a table that belongs to customers
+func checkUnscoped(query string) error {
+	for _, identifier := range identifierRegexp.FindAllString(placeholderRegexp.ReplaceAllString(query, ""), -1) {
+		// Skip columns qualified by a table alias
+		if strings.HasPrefix(identifier, ".") {
+			continue
+		}
+		table := strings.ToLower(identifier)
+		if _, ok := scopedTables[table]; ok {
+			return ErrUnscoped{Table: identifier}
+		}
+	}
+	return nil
+}
+
+// expand checks the query, replaces the placeholders with the customer's rows, and adds the customer to the params
+func (db *DB) expand(query string, params map[string]interface{}) (string, map[string]interface{}, error) {
+	if err := checkUnscoped(query); err != nil {
+		return "", nil, err
+	}
+
+	var err error
+	query = placeholderRegexp.ReplaceAllStringFunc(query, func(placeholder string) string {
+		subquery, ok := scopedTables[strings.Trim(placeholder, "{}")]
+		if !ok {
+			err = fmt.Errorf("tenant: unknown table %s", placeholder)
+		}
+		return subquery
+	})
+	if err != nil {
+		return "", nil, err
+	}
+
+	scopedParams := make(map[string]interface{})
+	for name, value := range params {
+		scopedParams[name] = value
+	}
+	scopedParams[customerParam] = db.CustomerID
+	return query, scopedParams, nil
+}
+
+// Select runs the scoped query, as gorp's Select
+func (db *DB) Select(i interface{}, query string, params map[string]interface{}) ([]interface{}, error) {
+	query, params, err := db.expand(query, params)
+	if err != nil {
+		return nil, err
+	}
+	return db.executor.Select(i, query, params)
+}
+
+// SelectOne runs the scoped query, as gorp's SelectOne
+func (db *DB) SelectOne(holder interface{}, query string, params map[string]interface{}) error {
+	query, params, err := db.expand(query, params)
+	if err != nil {
+		return err
+	}
+	return db.executor.SelectOne(holder, query, params)
+}
+
+// SelectInt runs the scoped query, as gorp's SelectInt
+func (db *DB) SelectInt(query string, params map[string]interface{}) (int64, error) {
+	query, params, err := db.expand(query, params)
+	if err != nil {
+		return 0, err
+	}
+	return db.executor.SelectInt(query, params)
+}
+
+// limitToSystems ANDs the WHERE clause in the rest of an UPDATE or DELETE, after its table, with the column being one
+// of the customer's systems.  The clause is parenthesized so it can't OR its way around the limit, so it mustn't
+// have unbalanced parentheses, or quotes, comments, or further statements that could hide them.
+func limitToSystems(statement string, column string) (string, error) {
+	if strings.ContainsAny(statement, `'";`) || strings.Contains(statement, "--") || strings.Contains(statement, "/*") {
+		return "", ErrUnscopedWrite
+	}
+
+	wheres := make(map[int]int)
+	for _, match := range whereRegexp.FindAllStringIndex(statement, -1) {
+		wheres[match[0]] = match[1]
+	}
+
+	// Find the WHERE that isn't in a subquery
+	where, depth := -1, 0
+	for i, c := range statement {
+		if end, ok := wheres[i]; ok && depth == 0 && where < 0 {
+			where = end
+		}
+		if c == '(' {
+			depth++
+		} else if c == ')' {
+			depth--
+			if depth < 0 {
+				return "", ErrUnscopedWrite
+			}
+		}
+	}
+	if depth != 0 {
+		return "", ErrUnscopedWrite
+	}
+
+	limit := column + " IN " + systemIDs
+	if where < 0 {
+		return statement + " WHERE " + limit, nil
+	}
+	return statement[:where] + " (" + strings.TrimSpace(statement[where:]) + "\n) AND " + limit, nil
+}
+
+// Exec runs a statement, such as an UPDATE or DELETE.  The table an UPDATE or DELETE writes is named without braces,
+// and if it belongs to customers, the statement is limited to the customer's systems, so "DELETE FROM tasks WHERE
+// SystemID=:id" only deletes the task if :id is one of the customer's systems.
+func (db *DB) Exec(query string, params map[string]interface{}) (int64, error) {
+	// The rest of the statement is checked as any other query
+	head, column := "", ""
+	if match := writeRegexp.FindStringSubmatch(query); match != nil {
+		table := strings.ToLower(match[2] + match[3])
+		if _, ok := scopedTables[table]; ok {
+			if column, ok = writableTables[table]; !ok {
+				return 0, ErrUnscopedWrite
+			}
+			head, query = match[0], query[len(match[0]):]
+		}
+	}
+
+	query, params, err := db.expand(query, params)
+	if err != nil {
+		return 0, err
+	}
+	if column != "" {
+		if query, err = limitToSystems(query, column); err != nil {
+			return 0, err
+		}
+	}
+	query = head + query
+
+	// Exec doesn't take named params, so number them
+	var args []interface{}
+	numbers := make(map[string]int)
+	query = namedParamRegexp.ReplaceAllStringFunc(query, func(param string) string {
+		name := param[1:]
+		value, ok := params[name]
+		if !ok {
+			return param
+		}
+		if _, ok = numbers[name]; !ok {
+			args = append(args, value)
+			numbers[name] = len(args)
+		}
+		return fmt.Sprintf("$%d", numbers[name])
+	})
+
+	result, err := db.executor.Exec(query, args...)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
@@ -0,0 +1,351 @@
+////////////////////////////////////////////////////////////////////////////
+//
+// Summit Route End Point Protection
+//
+// This source code is licensed under the BSD-style license found in the
+// LICENSE file in the root directory of this source tree.
+//
+/////////////////////////////////////////////////////////////////////////////
+
+package tenant
+
+import (
+	"crypto/rand"
+	"database/sql"
+	"database/sql/driver"
+	"io"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/coopernurse/gorp"
+
+	"qdserver/lib/migrations"
+	"qdserver/lib/models"
+	"qdserver/lib/utils"
+)
+
+// testDBEnv names the environment variable with the connection string of a database the cross-customer tests may
+// write to.  They are skipped without it.
+const testDBEnv = "SREPP_TEST_DB"
+
+func TestCheckUnscoped(t *testing.T) {
+	for table := range scopedTables {
+		for _, query := range []string{
+			"SELECT * FROM " + table,
+			"SELECT x.* FROM " + strings.ToUpper(table) + " x",
+			"SELECT * FROM {systems} s, " + table + " t WHERE t.ID = s.ID",
+		} {
+			if _, ok := checkUnscoped(query).(ErrUnscoped); !ok {
+				t.Errorf("checkUnscoped(%q) allowed the query", query)
+			}
+		}
+
+		query := "SELECT t.* FROM {" + table + "} t WHERE t.ID=:id"
+		if err := checkUnscoped(query); err != nil {
+			t.Errorf("checkUnscoped(%q) = %v", query, err)
+		}
+	}
+
+	// Shared tables don't need scoping
+	if err := checkUnscoped("SELECT * FROM policies p, signers sg"); err != nil {
+		t.Errorf("checkUnscoped of shared tables = %v", err)
+	}
+}
+
+func TestExpand(t *testing.T) {
+	db := New(nil, 7)
+
+	for table := range scopedTables {
+		query, params, err := db.expand("SELECT t.ID FROM {"+table+"} t WHERE t.ID=:id", map[string]interface{}{"id": 3})
+		if err != nil {
+			t.Errorf("%s: expand failed, %v", table, err)
+			continue
+		}
+		if strings.Contains(query, "{") {
+			t.Errorf("%s: placeholder left in %s", table, query)
+		}
+		if params["id"] != 3 || params[customerParam] != int64(7) {
+			t.Errorf("%s: params = %v", table, params)
+		}
+
+		// Every scoped table is limited to the customer
+		if !strings.Contains(query, ":"+customerParam) {
+			t.Errorf("%s: %s isn't limited to the customer", table, query)
+		}
+	}
+
+	if _, _, err := db.expand("SELECT * FROM {nothing}", nil); err == nil {
+		t.Errorf("expand of an unknown table succeeded")
+	}
+	if _, _, err := db.expand("SELECT * FROM rules", nil); err == nil {
+		t.Errorf("expand of unscoped rules succeeded")
+	}
+}
+
+// fakeExecutor records the statements Exec runs.  Calls other than Exec panic.
+type fakeExecutor struct {
+	gorp.SqlExecutor
+	query string
+	args  []interface{}
+}
+
+func (executor *fakeExecutor) Exec(query string, args ...interface{}) (sql.Result, error) {
+	executor.query, executor.args = query, args
+	return driver.RowsAffected(1), nil
+}
+
+func TestExec(t *testing.T) {
+	limit := "\n) AND SystemID IN " + strings.Replace(systemIDs, ":"+customerParam, "$2", -1)
+	tests := []struct {
+		name  string
+		query string
+		want  string // Statement run, or empty if Exec refuses it
+	}{
+		{"delete", "DELETE FROM tasks WHERE SystemID=:id", "DELETE FROM tasks WHERE (SystemID=$1" + limit},
+		{"update", "UPDATE tasks SET State=:id WHERE ID=:id", "UPDATE tasks SET State=$1 WHERE (ID=$1" + limit},
+		{"no where", "DELETE FROM tasks", "DELETE FROM tasks WHERE SystemID IN " + strings.Replace(systemIDs, ":"+customerParam, "$1", -1)},
+		{"or", "DELETE FROM tasks WHERE SystemID=:id OR true", "DELETE FROM tasks WHERE (SystemID=$1 OR true" + limit},
+		{"where in a subquery", "UPDATE tasks SET State=(SELECT :id WHERE true) WHERE ID=:id",
+			"UPDATE tasks SET State=(SELECT $1 WHERE true) WHERE (ID=$1" + limit},
+		{"systems", "UPDATE systems SET PredecessorID=:id WHERE PredecessorID=:id",
+			"UPDATE systems SET PredecessorID=$1 WHERE (PredecessorID=$1\n) AND ID IN " + strings.Replace(systemIDs, ":"+customerParam, "$2", -1)},
+		{"shared table", "UPDATE signers SET Name=:id WHERE ID=:id", "UPDATE signers SET Name=$1 WHERE ID=$1"},
+
+		// Statements that would escape the limit
+		{"old placeholder", "DELETE FROM tasks WHERE SystemID IN {systemids} OR true", ""},
+		{"closing parenthesis", "DELETE FROM tasks WHERE true) OR (true", ""},
+		{"quoted parenthesis", "DELETE FROM tasks WHERE ')' = ')' OR true", ""},
+		{"comment", "DELETE FROM tasks WHERE true --", ""},
+		{"block comment", "DELETE FROM tasks WHERE true /*", ""},
+		{"second statement", "DELETE FROM tasks WHERE true; DELETE FROM tasks", ""},
+		{"unscoped subquery", "UPDATE tasks SET Command=(SELECT Command FROM tasks) WHERE ID=:id", ""},
+		{"not keyed by system", "DELETE FROM customers WHERE ID=:id", ""},
+		{"shared files", "UPDATE executablefiles SET Size=0 WHERE ID=:id", ""},
+	}
+
+	for _, test := range tests {
+		executor := &fakeExecutor{}
+		db := &DB{CustomerID: 7, executor: executor}
+		_, err := db.Exec(test.query, map[string]interface{}{"id": 3})
+		if test.want == "" {
+			if err == nil {
+				t.Errorf("%s: Exec ran %q", test.name, executor.query)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: Exec failed, %v", test.name, err)
+		} else if executor.query != test.want {
+			t.Errorf("%s: Exec ran %q, want %q", test.name, executor.query, test.want)
+		}
+	}
+}
+
+// testCustomer is a customer made for the cross-customer tests, with one of everything
+type testCustomer struct {
+	db        *DB
+	customer  *models.Customer
+	systemSet *models.SystemSet
+	system    *models.System
+	ruleSet   *models.RuleSet
+	rule      *models.Rule
+	event     *models.ProcessEvent
+}
+
+// randomBytes returns 16 random bytes, for UUIDs
+func randomBytes(t *testing.T) []byte {
+	b := make([]byte, 16)
+	if _, err := io.ReadFull(rand.Reader, b); err != nil {
+		t.Fatalf("Unable to read random data, %v", err)
+	}
+	return b
+}
+
+// openTestDB connects to the test database and brings its schema up to date, or skips the test
+func openTestDB(t *testing.T) *gorp.DbMap {
+	connectionString := os.Getenv(testDBEnv)
+	if connectionString == "" {
+		t.Skipf("Set %s to a database the tests may write to", testDBEnv)
+	}
+
+	dbmap, err := models.InitDB(connectionString)
+	if err != nil {
+		t.Fatalf("Unable to connect to the test database, %v", err)
+	}
+	if _, err = migrations.Up(dbmap, 0); err != nil {
+		t.Fatalf("Unable to migrate the test database, %v", err)
+	}
+	return dbmap
+}
+
+// newTestCustomer adds a customer with a system set, system, rule set, rule, and process event
+func newTestCustomer(t *testing.T, dbmap *gorp.DbMap) *testCustomer {
+	c := &testCustomer{
+		customer: &models.Customer{UUID: randomBytes(t), Active: true, CreationDate: utils.DBTimeNow()},
+		rule:     &models.Rule{Description: "test", AttributeType: models.RuleAttributeCompanyName, AttributeValue: "Example Corp"},
+	}
+	if err := dbmap.Insert(c.customer, c.rule); err != nil {
+		t.Fatalf("Unable to insert customer, %v", err)
+	}
+
+	c.ruleSet = &models.RuleSet{FirstRule: c.rule.ID, DefaultAllow: true}
+	if err := dbmap.Insert(c.ruleSet); err != nil {
+		t.Fatalf("Unable to insert rule set, %v", err)
+	}
+
+	c.systemSet = &models.SystemSet{CustomerID: c.customer.ID, Name: "Default", RuleSetID: c.ruleSet.ID, CreationDate: utils.DBTimeNow()}
+	if err := dbmap.Insert(c.systemSet); err != nil {
+		t.Fatalf("Unable to insert system set, %v", err)
+	}
+
+	c.system = &models.System{SystemSetID: c.systemSet.ID, SystemUUID: randomBytes(t), FirstSeen: utils.DBTimeNow()}
+	if err := dbmap.Insert(c.system); err != nil {
+		t.Fatalf("Unable to insert system, %v", err)
+	}
+
+	c.event = &models.ProcessEvent{SystemID: c.system.ID, EventTime: utils.DBTimeNow()}
+	if err := dbmap.Insert(c.event); err != nil {
+		t.Fatalf("Unable to insert process event, %v", err)
+	}
+
+	c.db = New(dbmap, c.customer.ID)
+	return c
+}
+
+// remove deletes what newTestCustomer added
+func (c *testCustomer) remove(dbmap *gorp.DbMap) {
+	dbmap.Exec("DELETE FROM processevents WHERE SystemID=$1", c.system.ID)
+	dbmap.Exec("DELETE FROM systems WHERE SystemSetID=$1", c.systemSet.ID)
+	dbmap.Exec("DELETE FROM systemsets WHERE CustomerID=$1", c.customer.ID)
+	dbmap.Delete(c.ruleSet, c.rule, c.customer)
+}
+
+func TestCrossCustomerReads(t *testing.T) {
+	dbmap := openTestDB(t)
+	a, b := newTestCustomer(t, dbmap), newTestCustomer(t, dbmap)
+	defer a.remove(dbmap)
+	defer b.remove(dbmap)
+
+	reads := []struct {
+		name  string
+		query string
+		own   int64
+		other int64
+	}{
+		{"system", "SELECT count(*) FROM {systems} s WHERE s.ID=:id", a.system.ID, b.system.ID},
+		{"system set", "SELECT count(*) FROM {systemsets} ss WHERE ss.ID=:id", a.systemSet.ID, b.systemSet.ID},
+		{"rule set", "SELECT count(*) FROM {rulesets} rs WHERE rs.ID=:id", a.ruleSet.ID, b.ruleSet.ID},
+		{"rule", "SELECT count(*) FROM {rules} r WHERE r.ID=:id", a.rule.ID, b.rule.ID},
+		{"process event", "SELECT count(*) FROM {processevents} pe WHERE pe.ID=:id", a.event.ID, b.event.ID},
+	}
+
+	for _, read := range reads {
+		count, err := a.db.SelectInt(read.query, map[string]interface{}{"id": read.other})
+		if err != nil {
+			t.Errorf("%s: SelectInt failed, %v", read.name, err)
+		} else if count != 0 {
+			t.Errorf("%s: customer %d can read customer %d's", read.name, a.customer.ID, b.customer.ID)
+		}
+
+		if count, err = a.db.SelectInt(read.query, map[string]interface{}{"id": read.own}); err != nil || count != 1 {
+			t.Errorf("%s: customer can't read their own, %d, %v", read.name, count, err)
+		}
+	}
+}
+
+func TestCrossCustomerWrites(t *testing.T) {
+	dbmap := openTestDB(t)
+	a, b := newTestCustomer(t, dbmap), newTestCustomer(t, dbmap)
+	defer a.remove(dbmap)
+	defer b.remove(dbmap)
+
+	otherSystem := *b.system
+	otherSystem.Comment = "changed"
+	if _, err := a.db.Update(&otherSystem); err != ErrOtherCustomer {
+		t.Errorf("Update of another customer's system = %v", err)
+	}
+
+	movedSystem := *a.system
+	movedSystem.SystemSetID = b.systemSet.ID
+	if _, err := a.db.Update(&movedSystem); err != ErrOtherCustomer {
+		t.Errorf("Update of a system into another customer's set = %v", err)
+	}
+
+	otherSet := *b.systemSet
+	otherSet.Name = "changed"
+	if _, err := a.db.Update(&otherSet); err != ErrOtherCustomer {
+		t.Errorf("Update of another customer's system set = %v", err)
+	}
+	if _, err := a.db.Delete(&otherSet); err != ErrOtherCustomer {
+		t.Errorf("Delete of another customer's system set = %v", err)
+	}
+
+	stolenSet := *a.systemSet
+	stolenSet.RuleSetID = b.ruleSet.ID
+	if _, err := a.db.Update(&stolenSet); err != ErrOtherCustomer {
+		t.Errorf("Update of a system set to another customer's rule set = %v", err)
+	}
+
+	otherRuleSet := *b.ruleSet
+	otherRuleSet.DefaultAllow = false
+	if _, err := a.db.Update(&otherRuleSet); err != ErrOtherCustomer {
+		t.Errorf("Update of another customer's rule set = %v", err)
+	}
+
+	affected, err := a.db.Exec("DELETE FROM processevents WHERE SystemID=:id", map[string]interface{}{"id": b.system.ID})
+	if err != nil || affected != 0 {
+		t.Errorf("Exec deleted %d of another customer's events, %v", affected, err)
+	}
+
+	// Nothing of b's was changed
+	count, err := dbmap.SelectInt("SELECT count(*) FROM processevents WHERE ID=$1", b.event.ID)
+	if err != nil || count != 1 {
+		t.Errorf("Another customer's event is gone, %d, %v", count, err)
+	}
+}
+
+func TestUnusedRuleSets(t *testing.T) {
+	dbmap := openTestDB(t)
+	a, b := newTestCustomer(t, dbmap), newTestCustomer(t, dbmap)
+	defer a.remove(dbmap)
+	defer b.remove(dbmap)
+
+	// b makes a rule set, but hasn't given it to a system set yet
+	ruleSet := &models.RuleSet{DefaultAllow: true}
+	if err := b.db.Insert(ruleSet); err != nil {
+		t.Fatalf("Insert of rule set failed, %v", err)
+	}
+	defer dbmap.Delete(ruleSet)
+
+	stolenSet := *a.systemSet
+	stolenSet.RuleSetID = ruleSet.ID
+	if _, err := a.db.Update(&stolenSet); err != ErrOtherCustomer {
+		t.Errorf("Update of a system set to another customer's unused rule set = %v", err)
+	}
+
+	// A rule set created through a transaction can still be used once it commits
+	tx, err := b.db.Begin()
+	if err != nil {
+		t.Fatalf("Begin failed, %v", err)
+	}
+	ownSet := *b.systemSet
+	ownSet.RuleSetID = ruleSet.ID
+	if _, err = tx.Update(&ownSet); err != nil {
+		t.Errorf("Update of a system set to the customer's new rule set = %v", err)
+	}
+	if err = tx.Commit(); err != nil {
+		t.Fatalf("Commit failed, %v", err)
+	}
+
+	// Once it is used, it is b's
+	if _, err = a.db.Update(&stolenSet); err != ErrOtherCustomer {
+		t.Errorf("Update of a system set to another customer's rule set = %v", err)
+	}
+
+	// b's old rule set is no longer used by anyone, but it wasn't made through a's DB, so a can't claim it
+	stolenSet.RuleSetID = b.ruleSet.ID
+	if _, err = a.db.Update(&stolenSet); err != ErrOtherCustomer {
+		t.Errorf("Update of a system set to an abandoned rule set = %v", err)
+	}
+}
@@ -8,6 +8,7 @@ var Systems = require('./systems/app-systems.jsx');
 var SystemInfo = require('./systems/app-systeminfo.jsx');
 
 var ProcessEvents = require('./process_events/app-process_events.jsx');
+var ProcessTree = require('./process_events/app-process_tree.jsx');
 
 var File = require('./file/app-file.jsx');
 var Executables = require('./executables/app-executables.jsx');
@@ -34,6 +35,7 @@ var APP =
             <Location path="/systems" handler={Systems} />
             <Location path="/systeminfo*" handler={SystemInfo} />
             <Location path="/process_events" handler={ProcessEvents} />
+            <Location path="/process_tree*" handler={ProcessTree} />
             <Location path="/file*" handler={File} />
             <Location path="/executables" handler={Executables} />
             <Location path="/profile" handler={Profile} />
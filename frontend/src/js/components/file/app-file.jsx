@@ -1,6 +1,7 @@
 var React = require('react');
 var Reqwest = require("reqwest");
 var qs = require('querystring');
+var Link = require('react-router-component').Link;
 
 var File =
   React.createClass({
@@ -8,10 +9,13 @@ var File =
       return {
         sha256: '', sha1: '', md5: '',
         size: '',
+        uploaded: false,
         filepath: '',
         firstseen: '',
         lastseen: '',
         numsystems: '',
+        loadedas: [],
+        loads: [],
 
         companyname: '',
         productversion: '',
@@ -47,8 +51,11 @@ var File =
              firstseen: resp.FirstSeen,
              lastseen: resp.LastSeen,
              numsystems: resp.NumSystems,
+             loadedas: resp.LoadedAs,
+             loads: resp.Loads,
 
              size: resp.Size,
+             uploaded: resp.Uploaded,
              companyname: resp.CompanyName,
              productversion: resp.ProductVersion,
              productname: resp.ProductName,
@@ -57,6 +64,7 @@ var File =
              fileversion: resp.FileVersion,
              originalfilename: resp.OriginalFilename,
 
+             signaturestatus: resp.SignatureStatus,
              subjectshortname: resp.SubjectShortName,
              subject: resp.Subject,
              serialnumber: resp.SerialNumber,
@@ -68,6 +76,34 @@ var File =
       });
     },
 
+    showLoads: function() {
+      if (this.state.loads.length == 0) {
+        return null;
+      }
+
+      var rows = this.state.loads.map(function(load, index) {
+        return (
+          <tr key={index}>
+            <td>{load.EventTime}</td>
+            <td>{load.Type}</td>
+            <td><Link href={"/systeminfo?uuid="+load.SystemUUID}>{load.SystemName}</Link></td>
+            <td>{load.FilePath}</td>
+            <td>{load.ProcessPath}</td>
+          </tr>
+        )
+      });
+
+      return (
+        <div>
+          <h3>Recent loads</h3>
+          <table className="table">
+            <thead><tr><th>Time</th><th>Type</th><th>System</th><th>File path</th><th>Loaded into</th></tr></thead>
+            <tbody>{rows}</tbody>
+          </table>
+        </div>
+      )
+    },
+
     render:function(){
       return (
           <div>
@@ -79,8 +115,11 @@ var File =
                 <tr><th>First seen</th><td>{this.state.firstseen}</td></tr>
                 <tr><th>Last seen</th><td>{this.state.lastseen}</td></tr>
                 <tr><th>Number of systems</th><td>{this.state.numsystems}</td></tr>
+                <tr><th>Loaded as</th><td>{this.state.loadedas.join(", ")}</td></tr>
               </table>
 
+              {this.showLoads()}
+
               <h3>File Data</h3>
               <div className="row">
                 <div className="col-md-7">
@@ -90,6 +129,7 @@ var File =
                     <tr><th>Sha1</th><td>{this.state.sha1}</td></tr>
                     <tr><th>Md5</th><td>{this.state.md5}</td></tr>
                     <tr><th>Size</th><td>{this.state.size}</td></tr>
+                    <tr><th>Sample</th><td>{this.state.uploaded ? <a href={'/download/file/'+this.state.sha256}>Download</a> : 'Not uploaded'}</td></tr>
                   </table>
                 </div>
 
@@ -109,6 +149,7 @@ var File =
 
               <h3>Signature information</h3>
               <table className="data_listing">
+                <tr><th>Status</th><td>{this.state.signaturestatus}</td></tr>
                 <tr><th>Subject</th><td>{this.state.subject}</td></tr>
                 <tr><th>Serial Number</th><td>{this.state.serialnumber}</td></tr>
                 <tr><th>Digest algorithm</th><td>{this.state.digestalgorithm}</td></tr>
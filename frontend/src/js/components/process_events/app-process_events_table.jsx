@@ -16,7 +16,9 @@ var ProcessEventsTable = React.createClass({
           results[i] = {
             "Path" : Link({href:"/fileinfo?sha256="+resp.aaData[i]["Sha256"], children:resp.aaData[i]["FilePath"]}),
             "Command" : resp.aaData[i]["CommandLine"],
-            "Time": resp.aaData[i]["EventTime"]
+            "Time": Link({href:"/process_tree?event="+resp.aaData[i]["ID"], children:resp.aaData[i]["EventTime"]}),
+            "State": resp.aaData[i]["State"],
+            "Duration": resp.aaData[i]["State"] == "unknown" ? "" : resp.aaData[i]["Duration"] + "s"
           };
         }
 
@@ -0,0 +1,105 @@
+var React = require('react');
+var Reqwest = require("reqwest");
+var QS = require('querystring');
+var Link = require('react-router-component').Link;
+
+var ProcessTree =
+  React.createClass({
+    getInitialState: function() {
+      return {
+        loaded: false,
+        Ancestors: [],
+        Processes: [],
+        Truncated: false
+      };
+    },
+
+    componentDidMount:function(){
+      var thisComponent = this;
+      var query = QS.parse(window.location.search.slice(1));
+
+      var url = '/api/processtree.json?';
+      if (query["event"]) {
+        url += 'event='+query["event"];
+      } else {
+        url += 'system='+query["system"];
+      }
+
+      Reqwest({
+        url: url,
+        type: 'json',
+        success: function (resp) {
+          if (thisComponent.isMounted()) {
+            thisComponent.setState({
+              loaded: true,
+              Ancestors: resp.Ancestors || [],
+              Processes: resp.Processes || [],
+              Truncated: resp.Truncated
+            });
+          }
+        }
+      });
+    },
+
+    showProcess: function(process) {
+      var details = [process.StartTime];
+      if (process.State == "exited") {
+        details.push("exited " + process.EndTime + " with " + process.ExitCode);
+      }
+      if (process.CompanyName) {
+        details.push(process.CompanyName);
+      }
+      if (process.SignatureStatus) {
+        details.push(process.SignatureStatus);
+      }
+
+      return (
+        <span>
+          <Link href={"/fileinfo?sha256="+process.Sha256}>{process.FilePath}</Link>
+          {" (PID "+process.PID+") "}
+          <small>{details.join(", ")}</small>
+          <br/>
+          <small>{process.CommandLine}</small>
+        </span>
+      )
+    },
+
+    showTree: function(processes) {
+      if (!processes || processes.length == 0) {
+        return null;
+      }
+
+      var thisComponent = this;
+      var items = processes.map(function(process) {
+        return (
+          <li key={process.ID}>
+            {thisComponent.showProcess(process)}
+            {thisComponent.showTree(process.Children)}
+          </li>
+        )
+      });
+
+      return (<ul>{items}</ul>)
+    },
+
+    render:function(){
+      if (!this.state.loaded) {
+        return (<div><h2>Process Tree</h2>Loading data...</div>)
+      }
+
+      var thisComponent = this;
+      var ancestors = this.state.Ancestors.map(function(process) {
+        return (<li key={process.ID}>{thisComponent.showProcess(process)}</li>)
+      });
+
+      return (
+        <div>
+          <h2>Process Tree</h2>
+          {ancestors.length != 0 ? (<div><h3>Started by</h3><ol>{ancestors}</ol></div>) : null}
+          {this.state.Truncated ? (<p>Too many processes to show them all.</p>) : null}
+          {this.showTree(this.state.Processes)}
+        </div>
+      )
+    }
+  });
+module.exports = ProcessTree;
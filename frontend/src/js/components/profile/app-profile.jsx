@@ -5,6 +5,7 @@ var Link = require('react-router-component').Link;
 var FormInput = require('../form_input.jsx');
 var Flash = require('../flash.jsx');
 var CSRF = require('../csrf.jsx');
+var Retention = require('./app-retention.jsx');
 
 var Profile =
   React.createClass({
@@ -127,6 +128,8 @@ var Profile =
 
               </fieldset>
             </form>
+
+            <Retention />
           </div>
         )
     }
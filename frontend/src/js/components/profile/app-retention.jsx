@@ -0,0 +1,129 @@
+var React = require('react');
+var Reqwest = require("reqwest");
+
+var FormInput = require('../form_input.jsx');
+var Flash = require('../flash.jsx');
+var CSRF = require('../csrf.jsx');
+
+// Retention lets the user choose how long their process events are kept, and whether they are archived
+var Retention =
+  React.createClass({
+    getInitialState: function() {
+      return {
+        receivedJson: false,
+        isSaving: false,
+        hasChanges: false,
+
+        retention: "0",
+        archive: false,
+        defaultRetention: 0,
+        archiveAvailable: false
+      }
+    },
+
+    handleChange: function() {
+      this.setState({hasChanges: true});
+    },
+
+    handleArchiveChange: function(e) {
+      this.setState({archive: e.target.checked, hasChanges: true});
+    },
+
+    handleSubmit: function(e) {
+      e.preventDefault();
+      if (this.state.isSaving == true) { return; }
+
+      this.setState({isSaving: true, hasChanges: false});
+
+      var thisComponent = this;
+
+      Reqwest({
+        url: '/api/customer_settings.json',
+        type: 'json',
+        method: 'post',
+        headers: {
+          'X-CSRF-Token': CSRF()
+        },
+        data: {
+          ProcessEventRetention: thisComponent.refs.retention.getInput(),
+          ArchiveProcessEvents: thisComponent.state.archive ? "true" : "false"
+        },
+        success:function(resp){
+          thisComponent.refs.retention.Reset();
+          thisComponent.setState({isSaving: false});
+
+          thisComponent.refs.flash.Show("success", "Changes saved");
+        },
+        error: function (err) {
+          var msg = "Server error, try again later";
+          if (err.response == "bad retention") {
+            msg = "Enter a number of days, or 0 for the default.";
+            thisComponent.refs.retention.SetBad();
+          }
+          thisComponent.setState({isSaving: false});
+          thisComponent.refs.flash.Show("danger", msg);
+        }
+      })
+    },
+
+    componentWillMount: function() {
+      var thisComponent = this;
+      Reqwest({
+        url: '/api/customer_settings.json',
+        type: 'json',
+        success:function(resp){
+          thisComponent.setState({
+            receivedJson: true,
+            retention: String(resp.ProcessEventRetention),
+            archive: resp.ArchiveProcessEvents,
+            defaultRetention: resp.DefaultRetention,
+            archiveAvailable: resp.ArchiveAvailable
+          });
+        },
+        error: function (err) {
+          thisComponent.refs.flash.Show("danger", "The server is experiencing problems right now");
+        }
+      })
+    },
+
+    render:function(){
+      if (this.state.receivedJson === false) {
+        return (
+            <Flash ref="flash"/>
+        );
+      }
+
+      var defaultRetention = this.state.defaultRetention == 0 ? "forever" : this.state.defaultRetention + " days";
+
+      return (
+          <div>
+            <Flash ref="flash"/>
+            <form>
+              <fieldset>
+                <legend>Data retention</legend>
+
+                <p>Process events older than this many days are removed, and only a daily count of each file run on each system is kept.  Use 0 for the default ({defaultRetention}).</p>
+                <div className="form-group">
+                  <FormInput label="Days to keep process events" defaultVal={this.state.retention} whenChanged={this.handleChange} ref="retention" />
+                </div>
+
+                <div className="checkbox">
+                  <label>
+                    <input type="checkbox" checked={this.state.archive} disabled={!this.state.archiveAvailable} onChange={this.handleArchiveChange} />
+                    Archive process events before they are removed
+                  </label>
+                </div>
+
+                <div className="form-group">
+                  <button className="btn btn-primary"
+                    disabled={this.state.isSaving || !this.state.hasChanges}
+                    onClick={this.handleSubmit}>
+                    {this.state.isSaving ? 'Saving...' : 'Save'}</button>
+                </div>
+              </fieldset>
+            </form>
+          </div>
+        )
+    }
+  });
+module.exports = Retention;
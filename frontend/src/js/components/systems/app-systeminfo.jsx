@@ -33,6 +33,14 @@ var SystemInfo =
         LastSeen: '',
         FirstSeen: '',
         MachineGUID: '',
+        Certificate: '',
+        isRevoking: false,
+        IPAddresses: '',
+        LoggedOnUser: '',
+        LastBootTime: '',
+        History: [],
+        Status: '',
+        isRetiring: false,
 
         Comment: '',
       };
@@ -89,6 +97,66 @@ var SystemInfo =
       return true;
     },
 
+    handleRevoke: function() {
+      // Called when the user clicks the button to cut off a compromised agent
+      if (this.state.isRevoking == true) { return; }
+      if (!window.confirm("Revoke this agent's certificate?  It will no longer be able to contact the server until it is reinstalled.")) { return; }
+
+      this.setState({isRevoking: true});
+
+      var thisComponent = this;
+
+      Reqwest({
+        url: '/api/revoke_system_certificate.json',
+        method: 'post',
+        headers: {
+          'X-CSRF-Token': CSRF()
+        },
+        data: {
+          SystemUUID: thisComponent.state.UUID,
+        },
+        success:function(resp){
+          thisComponent.setState({isRevoking: false, Certificate: 'Revoked'});
+          thisComponent.refs.flash.Show("success", "Certificate revoked");
+        },
+        error: function (err) {
+          thisComponent.setState({isRevoking: false});
+          thisComponent.refs.flash.Show("danger", "Server error, try again later");
+        }
+      })
+    },
+
+    handleRetire: function() {
+      // Called when the user clicks the button to retire a system, or put a retired one back in use
+      if (this.state.isRetiring == true) { return; }
+
+      var retire = this.state.Status != 'retired';
+      this.setState({isRetiring: true});
+
+      var thisComponent = this;
+
+      Reqwest({
+        url: '/api/retire_system.json',
+        method: 'post',
+        headers: {
+          'X-CSRF-Token': CSRF()
+        },
+        data: {
+          SystemUUID: thisComponent.state.UUID,
+          Retired: retire ? 'true' : 'false',
+        },
+        success:function(resp){
+          // Whether an unretired system is online is worked out by the server the next time the page loads
+          thisComponent.setState({isRetiring: false, Status: retire ? 'retired' : ''});
+          thisComponent.refs.flash.Show("success", retire ? "System retired" : "System back in use");
+        },
+        error: function (err) {
+          thisComponent.setState({isRetiring: false});
+          thisComponent.refs.flash.Show("danger", "Server error, try again later");
+        }
+      })
+    },
+
     handleForget: function() {
       // Called when the user clicks the button to forget an agent
       this.handleToggle();
@@ -113,11 +181,52 @@ var SystemInfo =
              Manufacturer: resp.Manufacturer,
              Model: resp.Model,
              LastSeen: resp.LastSeen,
-             FirstSeen: resp.FirstSeen
+             FirstSeen: resp.FirstSeen,
+             Certificate: resp.Certificate,
+             IPAddresses: resp.IPAddresses,
+             LoggedOnUser: resp.LoggedOnUser,
+             LastBootTime: resp.LastBootTime,
+             Status: resp.Status
             });
           }
         }
       });
+
+      Reqwest({
+        url: '/api/systemhistory.json?uuid='+query["uuid"],
+        type: 'json',
+        success: function (resp) {
+          if (thisComponent.isMounted()) {
+            thisComponent.setState({History: resp});
+          }
+        }
+      });
+    },
+
+    showHistory: function() {
+      if (this.state.History.length == 0) {
+        return <span/>;
+      }
+
+      var rows = this.state.History.map(function(change, index) {
+        return (
+          <tr key={index}><td>{change.ChangeTime}</td><td>{change.Field}</td><td>{change.OldValue}</td><td>{change.NewValue}</td></tr>
+        );
+      });
+
+      return (
+        <fieldset>
+          <legend>History</legend>
+          <table className="table table-condensed">
+            <thead>
+              <tr><th>Time</th><th>Field</th><th>Old value</th><th>New value</th></tr>
+            </thead>
+            <tbody>
+              {rows}
+            </tbody>
+          </table>
+        </fieldset>
+      );
     },
 
 
@@ -193,8 +302,15 @@ var SystemInfo =
                 <tr><td className="datalabel">OS</td><td className="datafield">{this.state.OS}</td></tr>
                 <tr><td className="datalabel">Manufacturer</td><td className="datafield">{this.state.Manufacturer}</td></tr>
                 <tr><td className="datalabel">Model</td><td className="datafield">{this.state.Model}</td></tr>
+                <tr><td className="datalabel">IP Addresses</td><td className="datafield">{this.state.IPAddresses}</td></tr>
+                <tr><td className="datalabel">Logged On User</td><td className="datafield">{this.state.LoggedOnUser}</td></tr>
+                <tr><td className="datalabel">Last Boot</td><td className="datafield">{this.state.LastBootTime}</td></tr>
                 <tr><td className="datalabel">First Seen</td><td className="datafield">{this.state.FirstSeen}</td></tr>
                 <tr><td className="datalabel">Last Seen</td><td className="datafield">{this.state.LastSeen}</td></tr>
+                <tr><td className="datalabel">Status</td><td className="datafield">{this.state.Status}
+                  <Button bsStyle="link" disabled={this.state.isRetiring} onClick={this.handleRetire}>{this.state.Status == 'retired' ? 'Put back in use' : 'Retire'}</Button></td></tr>
+                <tr><td className="datalabel">Certificate</td><td className="datafield">{this.state.Certificate}
+                  <Button bsStyle="link" disabled={this.state.isRevoking} onClick={this.handleRevoke}>Revoke</Button></td></tr>
               </table>
 
               <Flash ref="flash"/>
@@ -202,6 +318,8 @@ var SystemInfo =
               <form>
                   {this.showUserData()}
               </form>
+
+              {this.showHistory()}
           </div>
         )
     },
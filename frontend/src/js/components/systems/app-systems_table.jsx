@@ -32,6 +32,7 @@ var SystemsTable = React.createClass({
           results[i] = {
             "Machine Name" : Link({href:"/systeminfo?uuid="+resp.aaData[i]["System"], children:resp.aaData[i]["MachineName"]}),
             "Comment": resp.aaData[i]["Comment"],
+            "Status": resp.aaData[i]["Status"],
             "Agent Version": resp.aaData[i]["AgentVersion"],
             "OS": resp.aaData[i]["OSHumanName"],
             "Manufacturer": resp.aaData[i]["Manufacturer"],
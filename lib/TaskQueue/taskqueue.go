@@ -45,6 +45,13 @@ func CreateTaskToAnalyzeFile(ch *amqp.Channel, fileID int64) (err error) {
 	return nil
 }
 
+// ParseAnalyzeFileMessage returns the file ID from a message on the analyzefile queue
+func ParseAnalyzeFileMessage(msg []byte) (int64, error) {
+	var task analyzeFile
+	err := json.Unmarshal(msg, &task)
+	return task.FileID, err
+}
+
 // analyzeCatalog used for creating a task to analyze a catalog
 type analyzeCatalog struct {
 	CatalogID int64
@@ -73,6 +80,60 @@ func CreateTaskToAnalyzeCatalog(ch *amqp.Channel, catalogID int64) (err error) {
 	return nil
 }
 
+// ParseAnalyzeCatalogMessage returns the catalog ID from a message on the analyzecatalog queue
+func ParseAnalyzeCatalogMessage(msg []byte) (int64, error) {
+	var task analyzeCatalog
+	err := json.Unmarshal(msg, &task)
+	return task.CatalogID, err
+}
+
+// WakeExchange is the fanout exchange every CallbackServer listens on, so whichever one is holding
+// an agent's poll can answer it
+const WakeExchange = "wakeagent"
+
+// wakeAgent used for telling the CallbackServers an agent has new tasks
+type wakeAgent struct {
+	SystemID int64
+}
+
+// DeclareWakeExchange declares the exchange wake messages are sent through
+func DeclareWakeExchange(ch *amqp.Channel) error {
+	return ch.ExchangeDeclare(
+		WakeExchange, // name
+		"fanout",     // type
+		true,         // durable
+		false,        // delete when unused
+		false,        // internal
+		false,        // no-wait
+		nil,          // arguments
+	)
+}
+
+// WakeSystem tells the CallbackServers to answer the system's poll now, instead of waiting for it to time out
+func WakeSystem(ch *amqp.Channel, systemID int64) error {
+	msg, err := json.Marshal(wakeAgent{SystemID: systemID})
+	if err != nil {
+		return err
+	}
+
+	return ch.Publish(
+		WakeExchange, // exchange
+		"",           // routing key
+		false,        // mandatory
+		false,        // immediate
+		amqp.Publishing{
+			ContentType: "text/plain",
+			Body:        msg,
+		})
+}
+
+// ParseWakeMessage returns the system ID from a message on the wake exchange
+func ParseWakeMessage(msg []byte) (int64, error) {
+	var wake wakeAgent
+	err := json.Unmarshal(msg, &wake)
+	return wake.SystemID, err
+}
+
 // QueueTask sends the message to the queueing server
 func QueueTask(ch *amqp.Channel, channelName string, msg []byte) error {
 	err := ch.Publish(
@@ -0,0 +1,127 @@
+////////////////////////////////////////////////////////////////////////////
+//
+// Summit Route End Point Protection
+//
+// This source code is licensed under the BSD-style license found in the
+// LICENSE file in the root directory of this source tree.
+//
+/////////////////////////////////////////////////////////////////////////////
+
+package authenticode
+
+import (
+	"bytes"
+	"encoding/asn1"
+	"encoding/binary"
+	"fmt"
+	"time"
+
+	"qdserver/lib/peinfo"
+)
+
+// winCertTypePKCSSignedData is the WIN_CERTIFICATE type holding an Authenticode signature
+const winCertTypePKCSSignedData = 0x0002
+
+// maxNestingDepth limits how deep we follow nested signatures
+const maxNestingDepth = 4
+
+// VerifyFile checks every Authenticode signature in the file, including nested signatures
+// from files that are signed multiple times (ex. dual sha1 and sha256 signatures).
+// Signatures that can't be parsed are returned as invalid, and those whose chain doesn't lead to one of the roots
+// are returned as valid but not trusted.
+func VerifyFile(info *peinfo.Info, roots *Roots, now time.Time) []*Signature {
+	var signatures []*Signature
+
+	table := info.Certificates
+	for len(table) >= 8 {
+		// WIN_CERTIFICATE: dwLength, wRevision, wCertificateType, bCertificate
+		length := int(binary.LittleEndian.Uint32(table[0:]))
+		certificateType := binary.LittleEndian.Uint16(table[6:])
+		if length < 8 || length > len(table) {
+			signatures = append(signatures, &Signature{Problem: "Certificate table entry has a bad length"})
+			break
+		}
+
+		if certificateType == winCertTypePKCSSignedData {
+			signatures = append(signatures, verifyAuthenticode(table[8:length], info, roots, now, 0)...)
+		}
+
+		// Entries are 8 byte aligned
+		length = (length + 7) &^ 7
+		if length >= len(table) {
+			break
+		}
+		table = table[length:]
+	}
+
+	return signatures
+}
+
+// verifyAuthenticode checks the signature holds the Authenticode hash of the file and is correctly signed
+func verifyAuthenticode(der []byte, info *peinfo.Info, roots *Roots, now time.Time, depth int) []*Signature {
+	sd, err := ParseSignedData(der)
+	if err != nil {
+		return []*Signature{{Problem: err.Error()}}
+	}
+
+	problem := checkIndirectData(sd, info)
+
+	signatures := sd.Verify(roots, now)
+	for _, signature := range signatures {
+		if problem != "" {
+			signature.Valid = false
+			signature.Problem = problem
+		}
+	}
+
+	if depth >= maxNestingDepth {
+		return signatures
+	}
+
+	for _, si := range sd.signerInfos {
+		for _, attr := range si.UnauthenticatedAttributes {
+			if !attr.Type.Equal(oidAttributeNestedSignature) {
+				continue
+			}
+			// Each value is a ContentInfo holding another SignedData
+			rest := attr.Values.Bytes
+			for len(rest) != 0 {
+				var nested asn1.RawValue
+				if rest, err = asn1.Unmarshal(rest, &nested); err != nil {
+					break
+				}
+				signatures = append(signatures, verifyAuthenticode(nested.FullBytes, info, roots, now, depth+1)...)
+			}
+		}
+	}
+
+	return signatures
+}
+
+// checkIndirectData compares the Authenticode hash in the signed content to the hash of the file.
+// It returns why they don't match, or an empty string if they do.
+func checkIndirectData(sd *SignedData, info *peinfo.Info) string {
+	if !sd.ContentType.Equal(oidSpcIndirectDataContent) {
+		return fmt.Sprintf("Content type %s is not SpcIndirectDataContent", sd.ContentType)
+	}
+
+	var indirectData spcIndirectDataContent
+	if _, err := asn1.Unmarshal(sd.contentFullBytes, &indirectData); err != nil {
+		return fmt.Sprintf("Unable to parse SpcIndirectDataContent: %v", err)
+	}
+
+	hash := algorithmHash(indirectData.MessageDigest.DigestAlgorithm.Algorithm)
+	if hash == 0 {
+		return fmt.Sprintf("Unsupported Authenticode digest algorithm %s", indirectData.MessageDigest.DigestAlgorithm.Algorithm)
+	}
+
+	fileHash := info.AuthenticodeHash(hash)
+	if fileHash == nil {
+		return fmt.Sprintf("Unable to compute Authenticode hash with %s", algorithmName(indirectData.MessageDigest.DigestAlgorithm.Algorithm))
+	}
+	if !bytes.Equal(fileHash, indirectData.MessageDigest.Digest) {
+		return "Authenticode hash does not match the file"
+	}
+
+	return ""
+}
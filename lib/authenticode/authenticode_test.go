@@ -0,0 +1,262 @@
+////////////////////////////////////////////////////////////////////////////
+//
+// Summit Route End Point Protection
+//
+// This source code is licensed under the BSD-style license found in the
+// LICENSE file in the root directory of this source tree.
+//
+/////////////////////////////////////////////////////////////////////////////
+
+package authenticode
+
+import (
+	"encoding/binary"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"qdserver/lib/peinfo"
+)
+
+// The files in testdata are made by testdata/generate.go, which signs peinfo's tiny.exe with the test CA in
+// testdata/roots.pem.  Every certificate is valid from 2000 to 2099, except the old publisher's, which expired in 2011.
+var (
+	testNow         = time.Date(2030, 1, 1, 0, 0, 0, 0, time.UTC)
+	testStamped     = time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	testWhileOld    = time.Date(2010, 6, 1, 0, 0, 0, 0, time.UTC)
+	testAfterExpiry = time.Date(2100, 1, 1, 0, 0, 0, 0, time.UTC)
+)
+
+const (
+	textOffset        = 0x200 // Start of tiny.exe's code
+	winCertHeaderSize = 8     // Size of a WIN_CERTIFICATE header
+)
+
+// readTestFile returns the contents of the file in testdata
+func readTestFile(t *testing.T, name string) []byte {
+	contents, err := ioutil.ReadFile(filepath.Join("testdata", name))
+	if err != nil {
+		t.Fatalf("Unable to read %s, %v", name, err)
+	}
+	return contents
+}
+
+// loadTestRoots returns the test CA
+func loadTestRoots(t *testing.T) *Roots {
+	roots, err := LoadRoots(filepath.Join("testdata", "roots.pem"))
+	if err != nil {
+		t.Fatalf("LoadRoots failed, %v", err)
+	}
+	return roots
+}
+
+// signatureBytes returns the signature in the first entry of the file's certificate table
+func signatureBytes(t *testing.T, contents []byte) []byte {
+	info, err := peinfo.Parse(contents)
+	if err != nil {
+		t.Fatalf("peinfo.Parse failed, %v", err)
+	}
+	length := binary.LittleEndian.Uint32(info.Certificates)
+	return info.Certificates[winCertHeaderSize:length]
+}
+
+// wantSignature is what we expect VerifyFile to find for one signature
+type wantSignature struct {
+	digestAlgorithm string
+	valid           bool
+	trusted         bool
+	expired         bool
+	problem         string
+	timestamp       time.Time // Zero if there is no counter signature
+	timestampValid  bool
+}
+
+// checkSignature compares the signature to what we expect
+func checkSignature(t *testing.T, name string, signature *Signature, want wantSignature) {
+	if signature.DigestAlgorithm != want.digestAlgorithm {
+		t.Errorf("%s: DigestAlgorithm = %s, want %s", name, signature.DigestAlgorithm, want.digestAlgorithm)
+	}
+	if signature.Valid != want.valid || signature.Trusted != want.trusted || signature.Expired != want.expired {
+		t.Errorf("%s: Valid, Trusted, Expired = %v, %v, %v, want %v, %v, %v", name,
+			signature.Valid, signature.Trusted, signature.Expired, want.valid, want.trusted, want.expired)
+	}
+	if signature.Problem != want.problem {
+		t.Errorf("%s: Problem = %q, want %q", name, signature.Problem, want.problem)
+	}
+
+	if want.timestamp.IsZero() {
+		if signature.CounterSignature != nil {
+			t.Errorf("%s: unexpected counter signature", name)
+		}
+		return
+	}
+	if signature.CounterSignature == nil {
+		t.Errorf("%s: no counter signature", name)
+		return
+	}
+	if !signature.Timestamp.Equal(want.timestamp) {
+		t.Errorf("%s: Timestamp = %v, want %v", name, signature.Timestamp, want.timestamp)
+	}
+	counterSignature := signature.CounterSignature
+	if counterSignature.Valid != want.timestampValid || counterSignature.Trusted != want.timestampValid || counterSignature.Expired {
+		t.Errorf("%s: counter signature Valid, Trusted, Expired = %v, %v, %v (%s), want valid %v", name,
+			counterSignature.Valid, counterSignature.Trusted, counterSignature.Expired, counterSignature.Problem, want.timestampValid)
+	}
+}
+
+func TestVerifyFile(t *testing.T) {
+	roots := loadTestRoots(t)
+
+	tests := []struct {
+		name   string
+		file   string
+		change func([]byte)
+		want   []wantSignature
+	}{
+		{"signed", "signed.exe", nil, []wantSignature{
+			{digestAlgorithm: "sha256", valid: true, trusted: true, timestamp: testStamped, timestampValid: true},
+		}},
+		// The chain still leads to a root when the file doesn't match, but the signature isn't valid
+		{"tampered code", "signed.exe", func(contents []byte) {
+			contents[textOffset] ^= 1
+		}, []wantSignature{
+			{digestAlgorithm: "sha256", trusted: true, problem: "Authenticode hash does not match the file", timestamp: testStamped, timestampValid: true},
+		}},
+		{"tampered time stamp", "signed.exe", func(contents []byte) {
+			// The time stamp is the last unauthenticated attribute, and ends with the time stamp authority's signature
+			signature := signatureBytes(t, contents)
+			signature[len(signature)-1] ^= 1
+		}, []wantSignature{
+			{digestAlgorithm: "sha256", valid: true, trusted: true, timestamp: testStamped},
+		}},
+		{"expired", "expired.exe", nil, []wantSignature{
+			{digestAlgorithm: "sha256", valid: true, trusted: true, expired: true,
+				problem: "Certificate SREPP Test Old Publisher was not valid at 2030-01-01T00:00:00Z"},
+		}},
+		{"expired with an RFC 3161 time stamp", "expired_rfc3161.exe", nil, []wantSignature{
+			{digestAlgorithm: "sha256", valid: true, trusted: true, timestamp: testWhileOld, timestampValid: true},
+		}},
+		{"expired with a legacy counter signature", "expired_legacy.exe", nil, []wantSignature{
+			{digestAlgorithm: "sha1", valid: true, trusted: true, timestamp: testWhileOld, timestampValid: true},
+		}},
+		{"not for code signing", "server_eku.exe", nil, []wantSignature{
+			{digestAlgorithm: "sha256", problem: "Certificate SREPP Test Server is not allowed to be used for code signing"},
+		}},
+		{"untrusted", "untrusted.exe", nil, []wantSignature{
+			{digestAlgorithm: "sha256", valid: true, problem: "Certificate chain does not lead to a trusted root"},
+		}},
+		{"nested", "nested.exe", nil, []wantSignature{
+			{digestAlgorithm: "sha1", valid: true, trusted: true},
+			{digestAlgorithm: "sha256", valid: true, trusted: true, timestamp: testStamped, timestampValid: true},
+		}},
+		{"tampered nested", "nested.exe", func(contents []byte) {
+			contents[textOffset] ^= 1
+		}, []wantSignature{
+			{digestAlgorithm: "sha1", trusted: true, problem: "Authenticode hash does not match the file"},
+			{digestAlgorithm: "sha256", trusted: true, problem: "Authenticode hash does not match the file", timestamp: testStamped, timestampValid: true},
+		}},
+	}
+
+	for _, test := range tests {
+		contents := readTestFile(t, test.file)
+		if test.change != nil {
+			test.change(contents)
+		}
+		info, err := peinfo.Parse(contents)
+		if err != nil {
+			t.Fatalf("%s: peinfo.Parse failed, %v", test.name, err)
+		}
+
+		signatures := VerifyFile(info, roots, testNow)
+		if len(signatures) != len(test.want) {
+			t.Errorf("%s: VerifyFile returned %d signatures, want %d", test.name, len(signatures), len(test.want))
+			continue
+		}
+		for i, signature := range signatures {
+			checkSignature(t, test.name, signature, test.want[i])
+		}
+	}
+}
+
+func TestVerifyFileUntrustedRoots(t *testing.T) {
+	info, err := peinfo.Parse(readTestFile(t, "signed.exe"))
+	if err != nil {
+		t.Fatalf("peinfo.Parse failed, %v", err)
+	}
+
+	// Without roots, neither the signature nor its time stamp is trusted, so expiry is checked at now
+	signatures := VerifyFile(info, nil, testAfterExpiry)
+	if len(signatures) != 1 {
+		t.Fatalf("VerifyFile returned %d signatures, want 1", len(signatures))
+	}
+	signature := signatures[0]
+	if !signature.Valid || signature.Trusted || !signature.Expired {
+		t.Errorf("Valid, Trusted, Expired = %v, %v, %v, want true, false, true", signature.Valid, signature.Trusted, signature.Expired)
+	}
+	if signature.CounterSignature == nil || !signature.CounterSignature.Valid || signature.CounterSignature.Trusted {
+		t.Errorf("Counter signature = %+v, want valid and untrusted", signature.CounterSignature)
+	}
+}
+
+func TestVerifyFileBadTable(t *testing.T) {
+	contents := readTestFile(t, "signed.exe")
+	info, err := peinfo.Parse(contents)
+	if err != nil {
+		t.Fatalf("peinfo.Parse failed, %v", err)
+	}
+
+	table := append([]byte{}, info.Certificates...)
+	binary.LittleEndian.PutUint32(table, uint32(len(table)+1))
+	info.Certificates = table
+	signatures := VerifyFile(info, nil, testNow)
+	if len(signatures) != 1 || signatures[0].Problem != "Certificate table entry has a bad length" {
+		t.Errorf("VerifyFile of a bad length = %+v", signatures)
+	}
+
+	// Entries that aren't PKCS#7 are skipped
+	table = append([]byte{}, info.Certificates...)
+	binary.LittleEndian.PutUint32(table, uint32(len(table)))
+	binary.LittleEndian.PutUint16(table[6:], 0x0001)
+	info.Certificates = table
+	if signatures = VerifyFile(info, nil, testNow); len(signatures) != 0 {
+		t.Errorf("VerifyFile of an X.509 entry = %+v", signatures)
+	}
+}
+
+func TestParseSignedData(t *testing.T) {
+	signature := signatureBytes(t, readTestFile(t, "signed.exe"))
+
+	sd, err := ParseSignedData(signature)
+	if err != nil {
+		t.Fatalf("ParseSignedData failed, %v", err)
+	}
+	if !sd.ContentType.Equal(oidSpcIndirectDataContent) {
+		t.Errorf("ContentType = %s", sd.ContentType)
+	}
+	if len(sd.Certificates) != 2 || sd.Certificates[0].Subject.CommonName != "SREPP Test Publisher" {
+		t.Errorf("Certificates = %d, want the publisher and its CA", len(sd.Certificates))
+	}
+	if len(sd.Content) == 0 || len(sd.contentFullBytes) <= len(sd.Content) {
+		t.Errorf("Content is %d bytes, %d with its tag", len(sd.Content), len(sd.contentFullBytes))
+	}
+
+	signatures := sd.Verify(loadTestRoots(t), testNow)
+	if len(signatures) != 1 || !signatures[0].Valid || !signatures[0].Trusted {
+		t.Errorf("Verify = %+v", signatures)
+	} else if len(signatures[0].Chain) != 2 || signatures[0].Chain[1].Subject.CommonName != "SREPP Test Code Signing CA" {
+		t.Errorf("Chain = %v", signatures[0].Chain)
+	}
+
+	// A changed signature no longer checks out
+	sd.signerInfos[0].EncryptedDigest[0] ^= 1
+	if signatures = sd.Verify(loadTestRoots(t), testNow); len(signatures) != 1 || signatures[0].Valid {
+		t.Errorf("Verify of a changed signature = %+v", signatures)
+	}
+
+	for _, bad := range [][]byte{nil, []byte("not DER"), signature[:len(signature)/2]} {
+		if _, err = ParseSignedData(bad); err == nil {
+			t.Errorf("ParseSignedData(%x) succeeded", bad)
+		}
+	}
+}
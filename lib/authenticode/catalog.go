@@ -0,0 +1,140 @@
+////////////////////////////////////////////////////////////////////////////
+//
+// Summit Route End Point Protection
+//
+// This source code is licensed under the BSD-style license found in the
+// LICENSE file in the root directory of this source tree.
+//
+/////////////////////////////////////////////////////////////////////////////
+
+package authenticode
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"fmt"
+	"math/big"
+	"time"
+
+	"qdserver/lib/peinfo"
+)
+
+// oidSpcIndirectData is the attribute of a catalog member that holds its Authenticode hash
+var oidSpcIndirectData = asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 311, 2, 1, 4}
+
+// certificateTrustList is the signed content of a catalog file
+type certificateTrustList struct {
+	Version          int `asn1:"optional"`
+	SubjectUsage     []asn1.ObjectIdentifier
+	ListIdentifier   []byte   `asn1:"optional"`
+	SequenceNumber   *big.Int `asn1:"optional"`
+	ThisUpdate       time.Time
+	NextUpdate       time.Time `asn1:"optional"`
+	SubjectAlgorithm pkix.AlgorithmIdentifier
+	TrustedSubjects  []trustedSubject `asn1:"optional"`
+}
+
+type trustedSubject struct {
+	SubjectIdentifier []byte
+	SubjectAttributes []attribute `asn1:"optional,set"`
+}
+
+// CatalogEntry is the Authenticode hash of a file trusted by a catalog
+type CatalogEntry struct {
+	Hash     []byte
+	HashType string // md5, sha1, or sha256
+}
+
+// Catalog is a parsed .cat file
+type Catalog struct {
+	Entries    []CatalogEntry
+	Signatures []*Signature
+}
+
+// catalogHashes are the Authenticode hashes a catalog may list members by
+var catalogHashes = map[string]crypto.Hash{
+	"md5":    crypto.MD5,
+	"sha1":   crypto.SHA1,
+	"sha256": crypto.SHA256,
+}
+
+// ParseCatalog reads the certificate trust list from a catalog file and checks its signatures against the roots.
+// Duplicate hashes, which do show up in real catalogs, are only returned once.
+func ParseCatalog(contents []byte, roots *Roots, now time.Time) (*Catalog, error) {
+	sd, err := ParseSignedData(contents)
+	if err != nil {
+		return nil, err
+	}
+	if !sd.ContentType.Equal(oidCertificateTrustList) {
+		return nil, fmt.Errorf("Catalog does not have a Certificate Trust List, content type was %s", sd.ContentType)
+	}
+
+	var ctl certificateTrustList
+	if _, err = asn1.Unmarshal(sd.contentFullBytes, &ctl); err != nil {
+		return nil, fmt.Errorf("Unable to parse Certificate Trust List: %v", err)
+	}
+
+	catalog := &Catalog{
+		Signatures: sd.Verify(roots, now),
+	}
+
+	seen := map[string]bool{}
+	for _, subject := range ctl.TrustedSubjects {
+		for _, attr := range subject.SubjectAttributes {
+			if !attr.Type.Equal(oidSpcIndirectData) {
+				continue
+			}
+
+			var indirectData spcIndirectDataContent
+			if _, err = asn1.Unmarshal(attr.Values.Bytes, &indirectData); err != nil {
+				return nil, fmt.Errorf("Unable to parse catalog member: %v", err)
+			}
+
+			hashType := algorithmName(indirectData.MessageDigest.DigestAlgorithm.Algorithm)
+			if _, ok := catalogHashes[hashType]; !ok {
+				continue
+			}
+
+			key := hashType + string(indirectData.MessageDigest.Digest)
+			if seen[key] {
+				continue
+			}
+			seen[key] = true
+
+			catalog.Entries = append(catalog.Entries, CatalogEntry{
+				Hash:     indirectData.MessageDigest.Digest,
+				HashType: hashType,
+			})
+		}
+	}
+
+	return catalog, nil
+}
+
+// Signer returns the first signature that is valid, trusted, and unexpired, which vouches for the catalog's members.
+// It returns nil if there is none.
+func (catalog *Catalog) Signer() *Signature {
+	for _, signature := range catalog.Signatures {
+		if signature.Valid && signature.Trusted && !signature.Expired {
+			return signature
+		}
+	}
+	return nil
+}
+
+// SignerOf returns the catalog's signer if the file is a member, or nil if it isn't or nothing vouches for the catalog
+func (catalog *Catalog) SignerOf(info *peinfo.Info) *Signature {
+	signer := catalog.Signer()
+	if signer == nil {
+		return nil
+	}
+
+	for _, entry := range catalog.Entries {
+		if bytes.Equal(entry.Hash, info.AuthenticodeHash(catalogHashes[entry.HashType])) {
+			return signer
+		}
+	}
+	return nil
+}
@@ -0,0 +1,107 @@
+////////////////////////////////////////////////////////////////////////////
+//
+// Summit Route End Point Protection
+//
+// This source code is licensed under the BSD-style license found in the
+// LICENSE file in the root directory of this source tree.
+//
+/////////////////////////////////////////////////////////////////////////////
+
+package authenticode
+
+import (
+	"bytes"
+	"testing"
+
+	"qdserver/lib/peinfo"
+)
+
+// testdata/member.cat lists tiny.exe by its sha1 and sha256 Authenticode hashes, plus one other file
+func TestParseCatalog(t *testing.T) {
+	contents := readTestFile(t, "member.cat")
+	catalog, err := ParseCatalog(contents, loadTestRoots(t), testNow)
+	if err != nil {
+		t.Fatalf("ParseCatalog failed, %v", err)
+	}
+
+	if len(catalog.Signatures) != 1 {
+		t.Fatalf("ParseCatalog returned %d signatures, want 1", len(catalog.Signatures))
+	}
+	checkSignature(t, "catalog", catalog.Signatures[0], wantSignature{digestAlgorithm: "sha256", valid: true, trusted: true})
+
+	member, err := peinfo.Parse(readTestFile(t, "signed.exe"))
+	if err != nil {
+		t.Fatalf("peinfo.Parse failed, %v", err)
+	}
+	wantEntries := []CatalogEntry{
+		{Hash: member.AuthenticodeSha1, HashType: "sha1"},
+		{Hash: member.AuthenticodeSha256, HashType: "sha256"},
+	}
+	if len(catalog.Entries) != 3 {
+		t.Fatalf("ParseCatalog returned %d entries, want 3", len(catalog.Entries))
+	}
+	for _, want := range wantEntries {
+		found := false
+		for _, entry := range catalog.Entries {
+			found = found || (entry.HashType == want.HashType && bytes.Equal(entry.Hash, want.Hash))
+		}
+		if !found {
+			t.Errorf("No %s entry for %x", want.HashType, want.Hash)
+		}
+	}
+
+	if _, err = ParseCatalog(readTestFile(t, "signed.exe"), nil, testNow); err == nil {
+		t.Errorf("ParseCatalog of an executable succeeded")
+	}
+	if _, err = ParseCatalog(signatureBytes(t, readTestFile(t, "signed.exe")), nil, testNow); err == nil {
+		t.Errorf("ParseCatalog of an Authenticode signature succeeded")
+	}
+}
+
+func TestCatalogSignerOf(t *testing.T) {
+	contents := readTestFile(t, "member.cat")
+
+	member, err := peinfo.Parse(readTestFile(t, "signed.exe"))
+	if err != nil {
+		t.Fatalf("peinfo.Parse failed, %v", err)
+	}
+	changed := readTestFile(t, "signed.exe")
+	changed[textOffset] ^= 1
+	nonMember, err := peinfo.Parse(changed)
+	if err != nil {
+		t.Fatalf("peinfo.Parse failed, %v", err)
+	}
+
+	catalog, err := ParseCatalog(contents, loadTestRoots(t), testNow)
+	if err != nil {
+		t.Fatalf("ParseCatalog failed, %v", err)
+	}
+	signer := catalog.SignerOf(member)
+	if signer == nil || signer != catalog.Signer() {
+		t.Fatalf("SignerOf a member = %+v, want the catalog's signer", signer)
+	}
+	if signer.Chain[0].Subject.CommonName != "SREPP Test Publisher" {
+		t.Errorf("SignerOf a member = %s, want SREPP Test Publisher", signer.Chain[0].Subject.CommonName)
+	}
+	if signer = catalog.SignerOf(nonMember); signer != nil {
+		t.Errorf("SignerOf a non-member = %+v, want nil", signer)
+	}
+
+	// A catalog nothing vouches for doesn't vouch for its members
+	untrusted, err := ParseCatalog(contents, nil, testNow)
+	if err != nil {
+		t.Fatalf("ParseCatalog failed, %v", err)
+	}
+	if untrusted.Signer() != nil || untrusted.SignerOf(member) != nil {
+		t.Errorf("Untrusted catalog has a signer")
+	}
+
+	// Nor does an expired one
+	expired, err := ParseCatalog(contents, loadTestRoots(t), testAfterExpiry)
+	if err != nil {
+		t.Fatalf("ParseCatalog failed, %v", err)
+	}
+	if expired.Signer() != nil || expired.SignerOf(member) != nil {
+		t.Errorf("Expired catalog has a signer")
+	}
+}
@@ -0,0 +1,170 @@
+////////////////////////////////////////////////////////////////////////////
+//
+// Summit Route End Point Protection
+//
+// This source code is licensed under the BSD-style license found in the
+// LICENSE file in the root directory of this source tree.
+//
+/////////////////////////////////////////////////////////////////////////////
+
+package authenticode
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	_ "crypto/md5" // Registers the hashes signatures may use
+	"crypto/rsa"
+	_ "crypto/sha1"
+	_ "crypto/sha256"
+	_ "crypto/sha512"
+	"crypto/x509"
+	"fmt"
+)
+
+// buildChain walks from the certificate up through its issuers in the pool.
+// The root is usually not included in a signature, so the chain stops when no issuer is found, and Roots.trusts
+// checks whether a root issued the top of the chain.
+// An error is returned if an issuer is found but its signature on the certificate does not check out.
+func buildChain(cert *x509.Certificate, pool []*x509.Certificate) ([]*x509.Certificate, error) {
+	chain := []*x509.Certificate{cert}
+
+	for len(chain) < maxChainLength {
+		current := chain[len(chain)-1]
+		if bytes.Equal(current.RawIssuer, current.RawSubject) {
+			// Self-signed
+			if err := checkCertificateSignature(current, current); err != nil {
+				return chain, fmt.Errorf("Bad signature on self-signed certificate %s: %v", current.Subject.CommonName, err)
+			}
+			break
+		}
+
+		var issuer *x509.Certificate
+		var issuerErr error
+		for _, candidate := range pool {
+			if !bytes.Equal(candidate.RawSubject, current.RawIssuer) || inChain(chain, candidate) {
+				continue
+			}
+			if issuerErr = checkCertificateSignature(current, candidate); issuerErr == nil {
+				issuer = candidate
+				break
+			}
+		}
+
+		if issuer == nil {
+			if issuerErr != nil {
+				return chain, fmt.Errorf("Bad signature on certificate %s: %v", current.Subject.CommonName, issuerErr)
+			}
+			break
+		}
+		chain = append(chain, issuer)
+	}
+
+	return chain, nil
+}
+
+// inChain returns true if the certificate is already in the chain
+func inChain(chain []*x509.Certificate, cert *x509.Certificate) bool {
+	for _, c := range chain {
+		if c.Equal(cert) {
+			return true
+		}
+	}
+	return false
+}
+
+// certificateSignatureHash returns the hash used by the certificate's signature, or 0 if it isn't one we check ourselves
+func certificateSignatureHash(algorithm x509.SignatureAlgorithm) crypto.Hash {
+	switch algorithm {
+	case x509.MD5WithRSA:
+		return crypto.MD5
+	case x509.SHA1WithRSA, x509.ECDSAWithSHA1:
+		return crypto.SHA1
+	case x509.SHA256WithRSA, x509.ECDSAWithSHA256:
+		return crypto.SHA256
+	case x509.SHA384WithRSA, x509.ECDSAWithSHA384:
+		return crypto.SHA384
+	case x509.SHA512WithRSA, x509.ECDSAWithSHA512:
+		return crypto.SHA512
+	}
+	return 0
+}
+
+// checkCertificateSignature checks the issuer signed the certificate.
+// The x509 package refuses md5 and sha1 signatures, which are still common on code signing certificates,
+// so those are checked by hand.
+func checkCertificateSignature(cert, issuer *x509.Certificate) error {
+	hash := certificateSignatureHash(cert.SignatureAlgorithm)
+	if hash == 0 {
+		return cert.CheckSignatureFrom(issuer)
+	}
+	return verifySignature(issuer.PublicKey, hash, cert.RawTBSCertificate, cert.Signature)
+}
+
+// verifySignature checks the signature over the signed bytes
+func verifySignature(publicKey interface{}, hash crypto.Hash, signed, signature []byte) error {
+	hasher := hash.New()
+	hasher.Write(signed)
+	digest := hasher.Sum(nil)
+
+	switch key := publicKey.(type) {
+	case *rsa.PublicKey:
+		return rsa.VerifyPKCS1v15(key, hash, digest, signature)
+	case *ecdsa.PublicKey:
+		if !ecdsa.VerifyASN1(key, digest, signature) {
+			return fmt.Errorf("ECDSA verification failure")
+		}
+		return nil
+	}
+	return fmt.Errorf("Unsupported public key type %T", publicKey)
+}
+
+// KeySize returns the size in bits of the certificate's public key, or 0 if unknown
+func KeySize(cert *x509.Certificate) int {
+	switch key := cert.PublicKey.(type) {
+	case *rsa.PublicKey:
+		return key.N.BitLen()
+	case *ecdsa.PublicKey:
+		return key.Curve.Params().BitSize
+	}
+	return 0
+}
+
+// ShortName returns the most human friendly name for the certificate's subject
+func ShortName(cert *x509.Certificate) string {
+	if cert.Subject.CommonName != "" {
+		return cert.Subject.CommonName
+	}
+	if len(cert.Subject.OrganizationalUnit) != 0 {
+		return cert.Subject.OrganizationalUnit[0]
+	}
+	if len(cert.Subject.Organization) != 0 {
+		return cert.Subject.Organization[0]
+	}
+	return cert.Subject.String()
+}
+
+// IssuerAlgorithms returns the names of the digest and encryption algorithms the issuer used to sign the certificate
+func IssuerAlgorithms(cert *x509.Certificate) (digestAlgorithm, encryptionAlgorithm string) {
+	switch cert.SignatureAlgorithm {
+	case x509.MD5WithRSA:
+		return "md5", "rsaEncryption"
+	case x509.SHA1WithRSA:
+		return "sha1", "rsaEncryption"
+	case x509.SHA256WithRSA:
+		return "sha256", "rsaEncryption"
+	case x509.SHA384WithRSA:
+		return "sha384", "rsaEncryption"
+	case x509.SHA512WithRSA:
+		return "sha512", "rsaEncryption"
+	case x509.ECDSAWithSHA1:
+		return "sha1", "ecPublicKey"
+	case x509.ECDSAWithSHA256:
+		return "sha256", "ecPublicKey"
+	case x509.ECDSAWithSHA384:
+		return "sha384", "ecPublicKey"
+	case x509.ECDSAWithSHA512:
+		return "sha512", "ecPublicKey"
+	}
+	return cert.SignatureAlgorithm.String(), ""
+}
@@ -0,0 +1,304 @@
+////////////////////////////////////////////////////////////////////////////
+//
+// Summit Route End Point Protection
+//
+// This source code is licensed under the BSD-style license found in the
+// LICENSE file in the root directory of this source tree.
+//
+/////////////////////////////////////////////////////////////////////////////
+
+package authenticode
+
+import (
+	"bytes"
+	"crypto/x509"
+	"encoding/asn1"
+	"fmt"
+	"time"
+)
+
+// SignedData is a parsed PKCS#7 SignedData structure
+type SignedData struct {
+	ContentType  asn1.ObjectIdentifier
+	Content      []byte // The signed content, without the outer tag and length
+	Certificates []*x509.Certificate
+
+	contentFullBytes []byte // The signed content, including the outer tag and length
+	signerInfos      []signerInfo
+}
+
+// Signature is the result of checking one signer of a SignedData
+type Signature struct {
+	Version                   int
+	DigestAlgorithm           string
+	DigestEncryptionAlgorithm string
+
+	// Chain has the signing certificate first, followed by each of its issuers that were included in the SignedData.
+	// It is empty if the signing certificate was not included.
+	Chain []*x509.Certificate
+
+	Valid   bool   // The digest, signature, and each link in the chain check out, and the chain may be used to sign
+	Trusted bool   // The chain leads to one of the trusted roots
+	Expired bool   // A certificate in the chain was not valid at the signing time
+	Problem string // Why the signature is not valid, or is untrusted or expired
+
+	// CounterSignature is the time stamp of the signature, or nil if there was none
+	CounterSignature *Signature
+	Timestamp        time.Time
+}
+
+// maxChainLength limits how far we walk up the issuers
+const maxChainLength = 10
+
+// ParseSignedData parses the DER encoded ContentInfo that holds a SignedData
+func ParseSignedData(der []byte) (*SignedData, error) {
+	var info contentInfo
+	if _, err := asn1.Unmarshal(der, &info); err != nil {
+		return nil, fmt.Errorf("Unable to parse ContentInfo: %v", err)
+	}
+	if !info.ContentType.Equal(oidSignedData) {
+		return nil, fmt.Errorf("Content type %s is not SignedData", info.ContentType)
+	}
+
+	var sd signedData
+	if _, err := asn1.Unmarshal(info.Content.Bytes, &sd); err != nil {
+		return nil, fmt.Errorf("Unable to parse SignedData: %v", err)
+	}
+
+	signed := &SignedData{
+		ContentType: sd.ContentInfo.ContentType,
+		signerInfos: sd.SignerInfos,
+	}
+
+	// The explicitly tagged content holds a single element, whose contents are what gets signed
+	if len(sd.ContentInfo.Content.Bytes) != 0 {
+		var content asn1.RawValue
+		if _, err := asn1.Unmarshal(sd.ContentInfo.Content.Bytes, &content); err != nil {
+			return nil, fmt.Errorf("Unable to parse content: %v", err)
+		}
+		signed.Content = content.Bytes
+		signed.contentFullBytes = content.FullBytes
+	}
+
+	if len(sd.Certificates.Raw) != 0 {
+		var certificateSet asn1.RawValue
+		if _, err := asn1.Unmarshal(sd.Certificates.Raw, &certificateSet); err != nil {
+			return nil, fmt.Errorf("Unable to parse certificates: %v", err)
+		}
+		rest := certificateSet.Bytes
+		for len(rest) != 0 {
+			var certificate asn1.RawValue
+			var err error
+			rest, err = asn1.Unmarshal(rest, &certificate)
+			if err != nil {
+				return nil, fmt.Errorf("Unable to parse certificate: %v", err)
+			}
+			// Skip certificates Go can't parse, the chain will just come up short
+			if cert, err := x509.ParseCertificate(certificate.FullBytes); err == nil {
+				signed.Certificates = append(signed.Certificates, cert)
+			}
+		}
+	}
+
+	return signed, nil
+}
+
+// Verify checks every signer of the content, which must be allowed to sign code, along with their counter signatures.
+// Certificates are checked for expiry at the time stamp if there is one we trust, else at now.
+func (sd *SignedData) Verify(roots *Roots, now time.Time) []*Signature {
+	signatures := make([]*Signature, 0, len(sd.signerInfos))
+	for i := range sd.signerInfos {
+		si := &sd.signerInfos[i]
+		signature := sd.verifySigner(si, sd.Content, roots, x509.ExtKeyUsageCodeSigning)
+
+		sd.verifyCounterSignature(si, signature, roots)
+
+		if signature.CounterSignature != nil && signature.CounterSignature.Valid && signature.CounterSignature.Trusted {
+			checkExpiry(signature.CounterSignature, signature.Timestamp)
+			checkExpiry(signature, signature.Timestamp)
+		} else {
+			checkExpiry(signature, now)
+		}
+
+		signatures = append(signatures, signature)
+	}
+	return signatures
+}
+
+// signerCertificate finds the certificate that matches the signer's issuer and serial number
+func (sd *SignedData) signerCertificate(si *signerInfo) *x509.Certificate {
+	for _, cert := range sd.Certificates {
+		if bytes.Equal(cert.RawIssuer, si.IssuerAndSerialNumber.Issuer.FullBytes) &&
+			cert.SerialNumber.Cmp(si.IssuerAndSerialNumber.SerialNumber) == 0 {
+			return cert
+		}
+	}
+	return nil
+}
+
+// verifySigner checks the signer's digest of the content and its signature, that its chain may be used for the purpose,
+// and whether the chain leads to one of the roots
+func (sd *SignedData) verifySigner(si *signerInfo, content []byte, roots *Roots, usage x509.ExtKeyUsage) *Signature {
+	signature := &Signature{
+		Version:                   si.Version,
+		DigestAlgorithm:           algorithmName(si.DigestAlgorithm.Algorithm),
+		DigestEncryptionAlgorithm: algorithmName(si.DigestEncryptionAlgorithm.Algorithm),
+	}
+
+	cert := sd.signerCertificate(si)
+	if cert == nil {
+		signature.Problem = "Signing certificate not found"
+		return signature
+	}
+
+	chain, err := buildChain(cert, sd.Certificates)
+	signature.Chain = chain
+	if err != nil {
+		signature.Problem = err.Error()
+		return signature
+	}
+
+	if err = checkKeyUsage(chain, usage); err != nil {
+		signature.Problem = err.Error()
+		return signature
+	}
+
+	hash := algorithmHash(si.DigestAlgorithm.Algorithm)
+	if hash == 0 || !hash.Available() {
+		signature.Problem = fmt.Sprintf("Unsupported digest algorithm %s", signature.DigestAlgorithm)
+		return signature
+	}
+
+	signed := content
+	if len(si.AuthenticatedAttributes.Raw) != 0 {
+		// The signature covers the attributes, which must in turn hold the digest of the content
+		attributes, signedAttributes, err := parseAuthenticatedAttributes(si)
+		if err != nil {
+			signature.Problem = err.Error()
+			return signature
+		}
+
+		var messageDigest []byte
+		if value := findAttribute(attributes, oidAttributeMessageDigest); value != nil {
+			asn1.Unmarshal(value, &messageDigest)
+		}
+		hasher := hash.New()
+		hasher.Write(content)
+		if !bytes.Equal(messageDigest, hasher.Sum(nil)) {
+			signature.Problem = "Message digest does not match the content"
+			return signature
+		}
+
+		signed = signedAttributes
+	}
+
+	if err = verifySignature(cert.PublicKey, hash, signed, si.EncryptedDigest); err != nil {
+		signature.Problem = fmt.Sprintf("Bad signature: %v", err)
+		return signature
+	}
+
+	signature.Valid = true
+	signature.Trusted = roots.trusts(chain)
+	if !signature.Trusted {
+		signature.Problem = "Certificate chain does not lead to a trusted root"
+	}
+	return signature
+}
+
+// verifyCounterSignature looks for a legacy or RFC 3161 counter signature on the signer
+func (sd *SignedData) verifyCounterSignature(si *signerInfo, signature *Signature, roots *Roots) {
+	for _, attr := range si.UnauthenticatedAttributes {
+		if attr.Type.Equal(oidAttributeCounterSignature) {
+			var counterSignerInfo signerInfo
+			if _, err := asn1.Unmarshal(attr.Values.Bytes, &counterSignerInfo); err != nil {
+				continue
+			}
+
+			// The counter signer signs the encrypted digest using certificates from the outer SignedData
+			signature.CounterSignature = sd.verifySigner(&counterSignerInfo, si.EncryptedDigest, roots, x509.ExtKeyUsageTimeStamping)
+
+			if attributes, _, err := parseAuthenticatedAttributes(&counterSignerInfo); err == nil {
+				if value := findAttribute(attributes, oidAttributeSigningTime); value != nil {
+					asn1.Unmarshal(value, &signature.Timestamp)
+				}
+			}
+			return
+		}
+
+		if attr.Type.Equal(oidAttributeRFC3161Timestamp) {
+			token, err := ParseSignedData(attr.Values.Bytes)
+			if err != nil || !token.ContentType.Equal(oidTSTInfo) || len(token.signerInfos) == 0 {
+				continue
+			}
+
+			var info tstInfo
+			if _, err = asn1.Unmarshal(token.Content, &info); err != nil {
+				continue
+			}
+			signature.Timestamp = info.GenTime
+
+			counterSignature := token.verifySigner(&token.signerInfos[0], token.Content, roots, x509.ExtKeyUsageTimeStamping)
+			hash := algorithmHash(info.MessageImprint.DigestAlgorithm.Algorithm)
+			if counterSignature.Valid {
+				if hash == 0 || !hash.Available() {
+					counterSignature.Valid = false
+					counterSignature.Problem = "Unsupported time stamp digest algorithm"
+				} else {
+					hasher := hash.New()
+					hasher.Write(si.EncryptedDigest)
+					if !bytes.Equal(hasher.Sum(nil), info.MessageImprint.Digest) {
+						counterSignature.Valid = false
+						counterSignature.Problem = "Time stamp does not match the signature"
+					}
+				}
+			}
+			signature.CounterSignature = counterSignature
+			return
+		}
+	}
+}
+
+// parseAuthenticatedAttributes returns the attributes and the bytes that were signed.
+// The signature is over the DER of the attributes as a SET, not the implicitly tagged form that is in the SignerInfo.
+func parseAuthenticatedAttributes(si *signerInfo) ([]attribute, []byte, error) {
+	if len(si.AuthenticatedAttributes.Raw) == 0 {
+		return nil, nil, nil
+	}
+
+	signed := make([]byte, len(si.AuthenticatedAttributes.Raw))
+	copy(signed, si.AuthenticatedAttributes.Raw)
+	signed[0] = 0x31 // SET
+
+	var attributes []attribute
+	if _, err := asn1.UnmarshalWithParams(signed, &attributes, "set"); err != nil {
+		return nil, nil, fmt.Errorf("Unable to parse authenticated attributes: %v", err)
+	}
+	return attributes, signed, nil
+}
+
+// findAttribute returns the DER of the first value of the attribute, or nil
+func findAttribute(attributes []attribute, oid asn1.ObjectIdentifier) []byte {
+	for _, attr := range attributes {
+		if attr.Type.Equal(oid) {
+			var value asn1.RawValue
+			if _, err := asn1.Unmarshal(attr.Values.Bytes, &value); err != nil {
+				return nil
+			}
+			return value.FullBytes
+		}
+	}
+	return nil
+}
+
+// checkExpiry flags the signature as expired if any certificate in the chain was not valid at the time
+func checkExpiry(signature *Signature, at time.Time) {
+	for _, cert := range signature.Chain {
+		if at.Before(cert.NotBefore) || at.After(cert.NotAfter) {
+			signature.Expired = true
+			if signature.Problem == "" {
+				signature.Problem = fmt.Sprintf("Certificate %s was not valid at %s", cert.Subject.CommonName, at.UTC().Format(time.RFC3339))
+			}
+			return
+		}
+	}
+}
@@ -0,0 +1,119 @@
+////////////////////////////////////////////////////////////////////////////
+//
+// Summit Route End Point Protection
+//
+// This source code is licensed under the BSD-style license found in the
+// LICENSE file in the root directory of this source tree.
+//
+/////////////////////////////////////////////////////////////////////////////
+
+package authenticode
+
+import (
+	"bytes"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+)
+
+// Roots are the certificates that a signature's chain must lead to for it to be trusted, such as the roots Windows
+// trusts for code signing.  A nil Roots trusts nothing.
+type Roots struct {
+	certificates []*x509.Certificate
+}
+
+// NewRoots returns Roots that trust the certificates
+func NewRoots(certificates ...*x509.Certificate) *Roots {
+	return &Roots{certificates: certificates}
+}
+
+// LoadRoots reads a file of PEM encoded certificates
+func LoadRoots(filename string) (*Roots, error) {
+	data, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+
+	roots := &Roots{}
+	for {
+		var block *pem.Block
+		block, data = pem.Decode(data)
+		if block == nil {
+			break
+		}
+		if block.Type != "CERTIFICATE" {
+			continue
+		}
+
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("Unable to parse root certificate in %s: %v", filename, err)
+		}
+		roots.certificates = append(roots.certificates, cert)
+	}
+
+	if len(roots.certificates) == 0 {
+		return nil, fmt.Errorf("No certificates found in %s", filename)
+	}
+	return roots, nil
+}
+
+// Len returns the number of trusted roots
+func (roots *Roots) Len() int {
+	if roots == nil {
+		return 0
+	}
+	return len(roots.certificates)
+}
+
+// trusts returns true if the top of the chain is one of the roots, or was issued by one of them
+func (roots *Roots) trusts(chain []*x509.Certificate) bool {
+	if roots == nil || len(chain) == 0 {
+		return false
+	}
+
+	top := chain[len(chain)-1]
+	for _, root := range roots.certificates {
+		if root.Equal(top) {
+			return true
+		}
+		if bytes.Equal(top.RawIssuer, root.RawSubject) && checkCertificateSignature(top, root) == nil {
+			return true
+		}
+	}
+	return false
+}
+
+// checkKeyUsage returns an error unless every certificate in the chain may be used for the purpose.  Certificates
+// without an extended key usage may be used for anything.
+func checkKeyUsage(chain []*x509.Certificate, usage x509.ExtKeyUsage) error {
+	for _, cert := range chain {
+		if len(cert.ExtKeyUsage) == 0 && len(cert.UnknownExtKeyUsage) == 0 {
+			continue
+		}
+
+		allowed := false
+		for _, certUsage := range cert.ExtKeyUsage {
+			if certUsage == usage || certUsage == x509.ExtKeyUsageAny {
+				allowed = true
+				break
+			}
+		}
+		if !allowed {
+			return fmt.Errorf("Certificate %s is not allowed to be used for %s", cert.Subject.CommonName, keyUsageName(usage))
+		}
+	}
+	return nil
+}
+
+// keyUsageName describes the extended key usages we check for
+func keyUsageName(usage x509.ExtKeyUsage) string {
+	switch usage {
+	case x509.ExtKeyUsageCodeSigning:
+		return "code signing"
+	case x509.ExtKeyUsageTimeStamping:
+		return "time stamping"
+	}
+	return fmt.Sprintf("extended key usage %d", usage)
+}
@@ -0,0 +1,160 @@
+////////////////////////////////////////////////////////////////////////////
+//
+// Summit Route End Point Protection
+//
+// This source code is licensed under the BSD-style license found in the
+// LICENSE file in the root directory of this source tree.
+//
+/////////////////////////////////////////////////////////////////////////////
+
+package authenticode
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"testing"
+	"time"
+)
+
+// testCertificate is a certificate made for a test, along with its key
+type testCertificate struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+}
+
+// newTestCertificate makes a certificate for the name, signed by the issuer, or self-signed if the issuer is nil
+func newTestCertificate(t *testing.T, name string, issuer *testCertificate, usage ...x509.ExtKeyUsage) *testCertificate {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("Unable to generate key, %v", err)
+	}
+
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: name},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		ExtKeyUsage:           usage,
+		BasicConstraintsValid: true,
+		IsCA:                  issuer == nil,
+	}
+
+	parent, signer := template, key
+	if issuer != nil {
+		parent, signer = issuer.cert, issuer.key
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, parent, &key.PublicKey, signer)
+	if err != nil {
+		t.Fatalf("Unable to create certificate, %v", err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatalf("Unable to parse certificate, %v", err)
+	}
+	return &testCertificate{cert: cert, key: key}
+}
+
+func TestRootsTrusts(t *testing.T) {
+	root := newTestCertificate(t, "Root", nil)
+	leaf := newTestCertificate(t, "Leaf", root, x509.ExtKeyUsageCodeSigning)
+
+	// Same name as the root, but a different key
+	impostor := newTestCertificate(t, "Root", nil)
+	impostorLeaf := newTestCertificate(t, "Leaf", impostor, x509.ExtKeyUsageCodeSigning)
+
+	roots := NewRoots(root.cert)
+
+	tests := []struct {
+		name    string
+		roots   *Roots
+		chain   []*x509.Certificate
+		trusted bool
+	}{
+		{"issued by a root", roots, []*x509.Certificate{leaf.cert}, true},
+		{"chain includes the root", roots, []*x509.Certificate{leaf.cert, root.cert}, true},
+		{"issued by an impostor", roots, []*x509.Certificate{impostorLeaf.cert}, false},
+		{"chain includes an impostor", roots, []*x509.Certificate{impostorLeaf.cert, impostor.cert}, false},
+		{"no roots", nil, []*x509.Certificate{leaf.cert, root.cert}, false},
+		{"empty chain", roots, nil, false},
+	}
+
+	for _, test := range tests {
+		if trusted := test.roots.trusts(test.chain); trusted != test.trusted {
+			t.Errorf("%s: trusts = %v, want %v", test.name, trusted, test.trusted)
+		}
+	}
+}
+
+func TestCheckKeyUsage(t *testing.T) {
+	root := newTestCertificate(t, "Root", nil)
+
+	tests := []struct {
+		name    string
+		usage   []x509.ExtKeyUsage
+		check   x509.ExtKeyUsage
+		allowed bool
+	}{
+		{"code signing", []x509.ExtKeyUsage{x509.ExtKeyUsageCodeSigning}, x509.ExtKeyUsageCodeSigning, true},
+		{"any", []x509.ExtKeyUsage{x509.ExtKeyUsageAny}, x509.ExtKeyUsageCodeSigning, true},
+		{"no extended key usage", nil, x509.ExtKeyUsageCodeSigning, true},
+		{"server only", []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth}, x509.ExtKeyUsageCodeSigning, false},
+		{"code signing for time stamps", []x509.ExtKeyUsage{x509.ExtKeyUsageCodeSigning}, x509.ExtKeyUsageTimeStamping, false},
+		{"time stamping", []x509.ExtKeyUsage{x509.ExtKeyUsageTimeStamping}, x509.ExtKeyUsageTimeStamping, true},
+	}
+
+	for _, test := range tests {
+		leaf := newTestCertificate(t, "Leaf", root, test.usage...)
+		err := checkKeyUsage([]*x509.Certificate{leaf.cert, root.cert}, test.check)
+		if (err == nil) != test.allowed {
+			t.Errorf("%s: checkKeyUsage = %v, want allowed %v", test.name, err, test.allowed)
+		}
+	}
+
+	// An issuer restricted to other uses can't issue code signing certificates
+	restricted := newTestCertificate(t, "Intermediate", root, x509.ExtKeyUsageServerAuth)
+	leaf := newTestCertificate(t, "Leaf", restricted, x509.ExtKeyUsageCodeSigning)
+	if err := checkKeyUsage([]*x509.Certificate{leaf.cert, restricted.cert, root.cert}, x509.ExtKeyUsageCodeSigning); err == nil {
+		t.Errorf("checkKeyUsage allowed a chain through a restricted issuer")
+	}
+}
+
+func TestLoadRoots(t *testing.T) {
+	root := newTestCertificate(t, "Root", nil)
+
+	file, err := ioutil.TempFile("", "roots")
+	if err != nil {
+		t.Fatalf("Unable to create temporary file, %v", err)
+	}
+	defer os.Remove(file.Name())
+
+	pem.Encode(file, &pem.Block{Type: "PUBLIC KEY", Bytes: []byte("skipped")})
+	pem.Encode(file, &pem.Block{Type: "CERTIFICATE", Bytes: root.cert.Raw})
+	file.Close()
+
+	roots, err := LoadRoots(file.Name())
+	if err != nil {
+		t.Fatalf("LoadRoots failed, %v", err)
+	}
+	if roots.Len() != 1 || !roots.certificates[0].Equal(root.cert) {
+		t.Errorf("LoadRoots = %v, want the root", roots.certificates)
+	}
+
+	empty, err := ioutil.TempFile("", "roots")
+	if err != nil {
+		t.Fatalf("Unable to create temporary file, %v", err)
+	}
+	defer os.Remove(empty.Name())
+	empty.Close()
+
+	if _, err = LoadRoots(empty.Name()); err == nil {
+		t.Errorf("LoadRoots of an empty file succeeded")
+	}
+}
@@ -0,0 +1,417 @@
+////////////////////////////////////////////////////////////////////////////
+//
+// Summit Route End Point Protection
+//
+// This source code is licensed under the BSD-style license found in the
+// LICENSE file in the root directory of this source tree.
+//
+/////////////////////////////////////////////////////////////////////////////
+
+//go:build ignore
+// +build ignore
+
+// generate writes the signed files the authenticode tests check.  It signs peinfo's tiny.exe with a test CA, building
+// the PKCS#7 structures by hand rather than with the package under test.  Run it from this directory with
+//
+//	go run generate.go
+package main
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha1"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/binary"
+	"encoding/pem"
+	"io/ioutil"
+	"log"
+	"math/big"
+	"sort"
+	"time"
+
+	"qdserver/lib/peinfo"
+)
+
+var (
+	oidData                   = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 7, 1}
+	oidSignedData             = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 7, 2}
+	oidRSA                    = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 1, 1}
+	oidSHA1                   = asn1.ObjectIdentifier{1, 3, 14, 3, 2, 26}
+	oidSHA256                 = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 2, 1}
+	oidContentType            = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 3}
+	oidMessageDigest          = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 4}
+	oidSigningTime            = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 5}
+	oidCounterSignature       = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 6}
+	oidTSTInfo                = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 16, 1, 4}
+	oidSpcIndirectDataContent = asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 311, 2, 1, 4}
+	oidSpcPEImageData         = asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 311, 2, 1, 15}
+	oidNestedSignature        = asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 311, 2, 4, 1}
+	oidRFC3161Timestamp       = asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 311, 3, 3, 1}
+	oidCertificateTrustList   = asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 311, 10, 1}
+	oidCatalogList            = asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 311, 12, 1, 1}
+	oidCatalogListMember      = asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 311, 12, 1, 2}
+	oidTimestampPolicy        = asn1.ObjectIdentifier{1, 2, 3, 4}
+)
+
+// spcPEImageData is an empty SpcPeImageData: no flags, and an empty file link
+var spcPEImageData = asn1.RawValue{FullBytes: []byte{0x30, 0x09, 0x03, 0x01, 0x00, 0xa0, 0x04, 0xa2, 0x02, 0x80, 0x00}}
+
+// certificatesOffset is where tiny.exe's certificate table starts, the end of the file once it is removed
+const certificatesOffset = 0x600
+
+// securityDirectoryOffset is the file offset of tiny.exe's security data directory entry
+const securityDirectoryOffset = 0xd8
+
+type issuer struct {
+	cert *x509.Certificate
+	key  *rsa.PrivateKey
+}
+
+type contentInfo struct {
+	ContentType asn1.ObjectIdentifier
+	Content     asn1.RawValue `asn1:"explicit,optional,tag:0"`
+}
+
+type algorithmIdentifier struct {
+	Algorithm  asn1.ObjectIdentifier
+	Parameters asn1.RawValue
+}
+
+type issuerAndSerialNumber struct {
+	Issuer       asn1.RawValue
+	SerialNumber *big.Int
+}
+
+type signerInfo struct {
+	Version                   int
+	IssuerAndSerialNumber     issuerAndSerialNumber
+	DigestAlgorithm           algorithmIdentifier
+	AuthenticatedAttributes   asn1.RawValue `asn1:"optional"`
+	DigestEncryptionAlgorithm algorithmIdentifier
+	EncryptedDigest           []byte
+	UnauthenticatedAttributes asn1.RawValue `asn1:"optional"`
+}
+
+type signedData struct {
+	Version          int
+	DigestAlgorithms asn1.RawValue
+	ContentInfo      contentInfo
+	Certificates     asn1.RawValue `asn1:"optional"`
+	SignerInfos      asn1.RawValue
+}
+
+type digestInfo struct {
+	DigestAlgorithm algorithmIdentifier
+	Digest          []byte
+}
+
+type spcAttributeTypeAndOptionalValue struct {
+	Type  asn1.ObjectIdentifier
+	Value asn1.RawValue
+}
+
+type spcIndirectDataContent struct {
+	Data          spcAttributeTypeAndOptionalValue
+	MessageDigest digestInfo
+}
+
+type tstInfo struct {
+	Version        int
+	Policy         asn1.ObjectIdentifier
+	MessageImprint digestInfo
+	SerialNumber   *big.Int
+	GenTime        time.Time `asn1:"generalized"`
+}
+
+type trustedSubject struct {
+	SubjectIdentifier []byte
+	SubjectAttributes asn1.RawValue
+}
+
+type certificateTrustList struct {
+	SubjectUsage     []asn1.ObjectIdentifier
+	ListIdentifier   []byte
+	ThisUpdate       time.Time `asn1:"utc"`
+	SubjectAlgorithm algorithmIdentifier
+	TrustedSubjects  []trustedSubject
+}
+
+var serial int64
+
+func must(err error) {
+	if err != nil {
+		log.Fatal(err)
+	}
+}
+
+func mustMarshal(v interface{}) []byte {
+	der, err := asn1.Marshal(v)
+	must(err)
+	return der
+}
+
+// newCertificate makes an RSA certificate valid between the times, self-signed if parent is nil
+func newCertificate(name string, parent *issuer, notBefore, notAfter time.Time, usage ...x509.ExtKeyUsage) *issuer {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	must(err)
+
+	serial++
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(serial),
+		Subject:               pkix.Name{CommonName: name, Organization: []string{"SREPP Test"}},
+		NotBefore:             notBefore,
+		NotAfter:              notAfter,
+		KeyUsage:              x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:           usage,
+		BasicConstraintsValid: true,
+		IsCA:                  len(usage) == 0,
+	}
+	if template.IsCA {
+		template.KeyUsage |= x509.KeyUsageCertSign
+	}
+
+	parentCert, signer := template, key
+	if parent != nil {
+		parentCert, signer = parent.cert, parent.key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, parentCert, &key.PublicKey, signer)
+	must(err)
+	cert, err := x509.ParseCertificate(der)
+	must(err)
+	return &issuer{cert: cert, key: key}
+}
+
+func algorithm(hash crypto.Hash) algorithmIdentifier {
+	null := asn1.RawValue{Tag: asn1.TagNull}
+	if hash == crypto.SHA1 {
+		return algorithmIdentifier{Algorithm: oidSHA1, Parameters: null}
+	}
+	return algorithmIdentifier{Algorithm: oidSHA256, Parameters: null}
+}
+
+func digest(hash crypto.Hash, data []byte) []byte {
+	h := hash.New()
+	h.Write(data)
+	return h.Sum(nil)
+}
+
+// attribute returns the DER of an Attribute with a single value
+func attribute(oid asn1.ObjectIdentifier, value []byte) []byte {
+	return mustMarshal(struct {
+		Type   asn1.ObjectIdentifier
+		Values asn1.RawValue
+	}{oid, asn1.RawValue{Class: asn1.ClassUniversal, Tag: asn1.TagSet, IsCompound: true, Bytes: value}})
+}
+
+// set returns the elements sorted as DER requires for a SET OF
+func set(elements [][]byte) []byte {
+	sort.Slice(elements, func(i, j int) bool { return bytes.Compare(elements[i], elements[j]) < 0 })
+	return bytes.Join(elements, nil)
+}
+
+// signer signs content with authenticated attributes, adding the unauthenticated attributes
+func signer(by *issuer, hash crypto.Hash, contentType asn1.ObjectIdentifier, content []byte, extra [][]byte,
+	unauthenticated func(encryptedDigest []byte) [][]byte) signerInfo {
+	attributes := set(append([][]byte{
+		attribute(oidContentType, mustMarshal(contentType)),
+		attribute(oidMessageDigest, mustMarshal(digest(hash, content))),
+	}, extra...))
+
+	signed := mustMarshal(asn1.RawValue{Class: asn1.ClassUniversal, Tag: asn1.TagSet, IsCompound: true, Bytes: attributes})
+	encryptedDigest, err := rsa.SignPKCS1v15(rand.Reader, by.key, hash, digest(hash, signed))
+	must(err)
+
+	si := signerInfo{
+		Version:                   1,
+		IssuerAndSerialNumber:     issuerAndSerialNumber{asn1.RawValue{FullBytes: by.cert.RawIssuer}, by.cert.SerialNumber},
+		DigestAlgorithm:           algorithm(hash),
+		AuthenticatedAttributes:   asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 0, IsCompound: true, Bytes: attributes},
+		DigestEncryptionAlgorithm: algorithmIdentifier{Algorithm: oidRSA, Parameters: asn1.RawValue{Tag: asn1.TagNull}},
+		EncryptedDigest:           encryptedDigest,
+	}
+	if unauthenticated != nil {
+		si.UnauthenticatedAttributes = asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 1, IsCompound: true,
+			Bytes: set(unauthenticated(encryptedDigest))}
+	}
+	return si
+}
+
+// signedDataContentInfo wraps the signer in a SignedData ContentInfo.  content is the full DER of the signed content.
+func signedDataContentInfo(hash crypto.Hash, contentType asn1.ObjectIdentifier, content []byte, certificates []*x509.Certificate, si signerInfo) []byte {
+	var rawCertificates [][]byte
+	for _, cert := range certificates {
+		rawCertificates = append(rawCertificates, cert.Raw)
+	}
+
+	sd := signedData{
+		Version:          1,
+		DigestAlgorithms: asn1.RawValue{Class: asn1.ClassUniversal, Tag: asn1.TagSet, IsCompound: true, Bytes: mustMarshal(algorithm(hash))},
+		ContentInfo: contentInfo{
+			ContentType: contentType,
+			Content:     asn1.RawValue{FullBytes: mustMarshal(asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 0, IsCompound: true, Bytes: content})},
+		},
+		Certificates: asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 0, IsCompound: true, Bytes: bytes.Join(rawCertificates, nil)},
+		SignerInfos:  asn1.RawValue{Class: asn1.ClassUniversal, Tag: asn1.TagSet, IsCompound: true, Bytes: mustMarshal(si)},
+	}
+	sdBytes := mustMarshal(sd)
+	return mustMarshal(contentInfo{
+		ContentType: oidSignedData,
+		Content:     asn1.RawValue{FullBytes: mustMarshal(asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 0, IsCompound: true, Bytes: sdBytes})},
+	})
+}
+
+// contentBytes returns the contents of the DER element, without its tag and length
+func contentBytes(der []byte) []byte {
+	var raw asn1.RawValue
+	_, err := asn1.Unmarshal(der, &raw)
+	must(err)
+	return raw.Bytes
+}
+
+// timestamp is how the signature is time stamped
+type timestamp int
+
+const (
+	noTimestamp timestamp = iota
+	legacyTimestamp
+	rfc3161Timestamp
+)
+
+// authenticode signs the Authenticode hash of the file, adding the time stamp and any nested signatures
+func authenticode(info *peinfo.Info, by *issuer, chain []*x509.Certificate, hash crypto.Hash, tsa *issuer, stamp timestamp, at time.Time, nested ...[]byte) []byte {
+	indirectData := mustMarshal(spcIndirectDataContent{
+		Data:          spcAttributeTypeAndOptionalValue{Type: oidSpcPEImageData, Value: spcPEImageData},
+		MessageDigest: digestInfo{DigestAlgorithm: algorithm(hash), Digest: info.AuthenticodeHash(hash)},
+	})
+
+	certificates := chain
+	if stamp == legacyTimestamp {
+		// The legacy counter signer's certificate is in the outer SignedData
+		certificates = append(append([]*x509.Certificate{}, chain...), tsa.cert)
+	}
+
+	si := signer(by, hash, oidSpcIndirectDataContent, contentBytes(indirectData), nil, func(encryptedDigest []byte) [][]byte {
+		var attributes [][]byte
+		switch stamp {
+		case legacyTimestamp:
+			signingTime := attribute(oidSigningTime, mustMarshal(at.UTC()))
+			counter := signer(tsa, crypto.SHA256, oidData, encryptedDigest, [][]byte{signingTime}, nil)
+			attributes = append(attributes, attribute(oidCounterSignature, mustMarshal(counter)))
+		case rfc3161Timestamp:
+			info := mustMarshal(tstInfo{
+				Version:        1,
+				Policy:         oidTimestampPolicy,
+				MessageImprint: digestInfo{DigestAlgorithm: algorithm(crypto.SHA256), Digest: digest(crypto.SHA256, encryptedDigest)},
+				SerialNumber:   big.NewInt(1),
+				GenTime:        at.UTC(),
+			})
+			counter := signer(tsa, crypto.SHA256, oidTSTInfo, info, nil, nil)
+			token := signedDataContentInfo(crypto.SHA256, oidTSTInfo, mustMarshal(info), []*x509.Certificate{tsa.cert}, counter)
+			attributes = append(attributes, attribute(oidRFC3161Timestamp, token))
+		}
+		for _, signature := range nested {
+			attributes = append(attributes, attribute(oidNestedSignature, signature))
+		}
+		return attributes
+	})
+
+	return signedDataContentInfo(hash, oidSpcIndirectDataContent, indirectData, certificates, si)
+}
+
+// signFile replaces the certificate table with one holding the signature
+func signFile(unsigned []byte, signature []byte) []byte {
+	length := 8 + len(signature)
+	entry := make([]byte, (length+7)&^7)
+	binary.LittleEndian.PutUint32(entry[0:], uint32(length))
+	binary.LittleEndian.PutUint16(entry[4:], 0x0200) // WIN_CERT_REVISION_2_0
+	binary.LittleEndian.PutUint16(entry[6:], 0x0002) // WIN_CERT_TYPE_PKCS_SIGNED_DATA
+	copy(entry[8:], signature)
+
+	signed := append(append([]byte{}, unsigned...), entry...)
+	binary.LittleEndian.PutUint32(signed[securityDirectoryOffset:], certificatesOffset)
+	binary.LittleEndian.PutUint32(signed[securityDirectoryOffset+4:], uint32(len(entry)))
+	return signed
+}
+
+// catalog signs a catalog listing the Authenticode hashes
+func catalog(by *issuer, chain []*x509.Certificate, members [][]byte) []byte {
+	var subjects []trustedSubject
+	for _, member := range members {
+		hash := crypto.SHA256
+		if len(member) == sha1.Size {
+			hash = crypto.SHA1
+		}
+		indirectData := mustMarshal(spcIndirectDataContent{
+			Data:          spcAttributeTypeAndOptionalValue{Type: oidSpcPEImageData, Value: spcPEImageData},
+			MessageDigest: digestInfo{DigestAlgorithm: algorithm(hash), Digest: member},
+		})
+		subjects = append(subjects, trustedSubject{
+			SubjectIdentifier: member,
+			SubjectAttributes: asn1.RawValue{Class: asn1.ClassUniversal, Tag: asn1.TagSet, IsCompound: true,
+				Bytes: attribute(oidSpcIndirectDataContent, indirectData)},
+		})
+	}
+
+	ctl := mustMarshal(certificateTrustList{
+		SubjectUsage:     []asn1.ObjectIdentifier{oidCatalogList},
+		ListIdentifier:   []byte("SREPP Test Catalog"),
+		ThisUpdate:       time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC),
+		SubjectAlgorithm: algorithmIdentifier{Algorithm: oidCatalogListMember, Parameters: asn1.RawValue{Tag: asn1.TagNull}},
+		TrustedSubjects:  subjects,
+	})
+
+	si := signer(by, crypto.SHA256, oidCertificateTrustList, contentBytes(ctl), nil, nil)
+	return signedDataContentInfo(crypto.SHA256, oidCertificateTrustList, ctl, chain, si)
+}
+
+func main() {
+	tiny, err := ioutil.ReadFile("../../peinfo/testdata/tiny.exe")
+	must(err)
+	unsigned := append([]byte{}, tiny[:certificatesOffset]...)
+	binary.LittleEndian.PutUint64(unsigned[securityDirectoryOffset:], 0)
+	info, err := peinfo.Parse(unsigned)
+	must(err)
+
+	always, never := time.Date(2000, 1, 1, 0, 0, 0, 0, time.UTC), time.Date(2099, 1, 1, 0, 0, 0, 0, time.UTC)
+	root := newCertificate("SREPP Test Root", nil, always, never)
+	ca := newCertificate("SREPP Test Code Signing CA", root, always, never)
+	publisher := newCertificate("SREPP Test Publisher", ca, always, never, x509.ExtKeyUsageCodeSigning)
+	oldPublisher := newCertificate("SREPP Test Old Publisher", ca, time.Date(2010, 1, 1, 0, 0, 0, 0, time.UTC),
+		time.Date(2011, 1, 1, 0, 0, 0, 0, time.UTC), x509.ExtKeyUsageCodeSigning)
+	server := newCertificate("SREPP Test Server", ca, always, never, x509.ExtKeyUsageServerAuth)
+	tsa := newCertificate("SREPP Test Time Stamping", root, always, never, x509.ExtKeyUsageTimeStamping)
+	otherRoot := newCertificate("SREPP Test Other Root", nil, always, never)
+	otherPublisher := newCertificate("SREPP Test Other Publisher", otherRoot, always, never, x509.ExtKeyUsageCodeSigning)
+
+	stamped := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	whileValid := time.Date(2010, 6, 1, 0, 0, 0, 0, time.UTC)
+
+	files := map[string][]byte{
+		"signed.exe": signFile(unsigned, authenticode(info, publisher, []*x509.Certificate{publisher.cert, ca.cert},
+			crypto.SHA256, tsa, rfc3161Timestamp, stamped)),
+		"expired.exe": signFile(unsigned, authenticode(info, oldPublisher, []*x509.Certificate{oldPublisher.cert, ca.cert},
+			crypto.SHA256, nil, noTimestamp, time.Time{})),
+		"expired_rfc3161.exe": signFile(unsigned, authenticode(info, oldPublisher, []*x509.Certificate{oldPublisher.cert, ca.cert},
+			crypto.SHA256, tsa, rfc3161Timestamp, whileValid)),
+		"expired_legacy.exe": signFile(unsigned, authenticode(info, oldPublisher, []*x509.Certificate{oldPublisher.cert, ca.cert},
+			crypto.SHA1, tsa, legacyTimestamp, whileValid)),
+		"server_eku.exe": signFile(unsigned, authenticode(info, server, []*x509.Certificate{server.cert, ca.cert},
+			crypto.SHA256, nil, noTimestamp, time.Time{})),
+		"untrusted.exe": signFile(unsigned, authenticode(info, otherPublisher, []*x509.Certificate{otherPublisher.cert, otherRoot.cert},
+			crypto.SHA256, nil, noTimestamp, time.Time{})),
+		"nested.exe": signFile(unsigned, authenticode(info, publisher, []*x509.Certificate{publisher.cert, ca.cert},
+			crypto.SHA1, nil, noTimestamp, time.Time{},
+			authenticode(info, publisher, []*x509.Certificate{publisher.cert, ca.cert}, crypto.SHA256, tsa, rfc3161Timestamp, stamped))),
+		"member.cat": catalog(publisher, []*x509.Certificate{publisher.cert, ca.cert},
+			[][]byte{info.AuthenticodeHash(crypto.SHA1), info.AuthenticodeHash(crypto.SHA256), digest(crypto.SHA256, []byte("another file"))}),
+		"roots.pem": pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: root.cert.Raw}),
+	}
+
+	for name, contents := range files {
+		must(ioutil.WriteFile(name, contents, 0644))
+	}
+}
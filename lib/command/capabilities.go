@@ -0,0 +1,144 @@
+////////////////////////////////////////////////////////////////////////////
+//
+// Summit Route End Point Protection
+//
+// This source code is licensed under the BSD-style license found in the
+// LICENSE file in the root directory of this source tree.
+//
+/////////////////////////////////////////////////////////////////////////////
+
+package command
+
+import (
+	"errors"
+	"sort"
+	"strings"
+
+	"github.com/coopernurse/gorp"
+
+	"qdserver/lib/models"
+)
+
+// Protocol versions spoken between agents and the CallbackServer
+const (
+	ProtocolVersion1 = 1 // Agents from before versioning, which don't send a version
+	ProtocolVersion2 = 2 // Adds signed requests, task results, policies, and batched events
+	ProtocolVersion3 = 3 // Adds polling, and handing out all pending tasks at once
+
+	CurrentProtocolVersion = ProtocolVersion3
+)
+
+// ErrUnsupportedCommand is returned when the agent can't handle a command and it has no fallback
+var ErrUnsupportedCommand = errors.New("Command is not supported by the agent")
+
+// defaultCommands are the commands an agent is assumed to handle when it gives its protocol version but doesn't list them
+var defaultCommands = map[int][]string{
+	ProtocolVersion1: {"SetSystemUUID", "GetFileByHash", "GetCatalogFileByHash", "Update", "Stall", "NOP", "Success"},
+	ProtocolVersion2: {"SetSystemUUID", "GetFileByHash", "GetCatalogFileByHash", "Update", "Stall", "NOP", "Success",
+		"RotateSecret", "SetPolicy"},
+	ProtocolVersion3: {"SetSystemUUID", "GetFileByHash", "GetCatalogFileByHash", "Update", "Stall", "NOP", "Success",
+		"RotateSecret", "SetPolicy", "Tasks"},
+}
+
+// fallbacks replace a command with one an agent that doesn't support it can handle
+var fallbacks = map[string]func(ResponseToAgent) ResponseToAgent{
+	"Stall": func(ResponseToAgent) ResponseToAgent { return Nop() },
+}
+
+// AgentCapabilities is what an agent told us it can do
+type AgentCapabilities struct {
+	ProtocolVersion int
+	Commands        map[string]bool
+}
+
+// NewAgentCapabilities normalizes what the agent sent us.
+// Agents that don't send a version are protocol version 1, and agents that don't list their commands get the defaults for their version.
+func NewAgentCapabilities(protocolVersion int, commands []string) *AgentCapabilities {
+	if protocolVersion < ProtocolVersion1 {
+		protocolVersion = ProtocolVersion1
+	}
+
+	if len(commands) == 0 {
+		version := protocolVersion
+		if version > CurrentProtocolVersion {
+			version = CurrentProtocolVersion
+		}
+		commands = defaultCommands[version]
+	}
+
+	capabilities := &AgentCapabilities{
+		ProtocolVersion: protocolVersion,
+		Commands:        make(map[string]bool),
+	}
+	for _, command := range commands {
+		capabilities.Commands[strings.TrimSpace(command)] = true
+	}
+
+	return capabilities
+}
+
+// CapabilitiesForSystem returns the capabilities recorded for the system
+func CapabilitiesForSystem(system *models.System) *AgentCapabilities {
+	var commands []string
+	if system.Capabilities != "" {
+		commands = strings.Split(system.Capabilities, ",")
+	}
+	return NewAgentCapabilities(system.ProtocolVersion, commands)
+}
+
+// GetAgentCapabilities looks up the capabilities recorded for the system
+func GetAgentCapabilities(db gorp.SqlExecutor, systemID int64) (*AgentCapabilities, error) {
+	var system models.System
+	err := db.SelectOne(&system, "select * from systems where ID=:id",
+		map[string]interface{}{
+			"id": systemID,
+		})
+	if err != nil {
+		return nil, err
+	}
+
+	return CapabilitiesForSystem(&system), nil
+}
+
+// Record stores the capabilities on the system.  Returns true if they changed and the system needs to be saved.
+func (capabilities *AgentCapabilities) Record(system *models.System) bool {
+	var commands []string
+	for command := range capabilities.Commands {
+		commands = append(commands, command)
+	}
+	sort.Strings(commands)
+	commandList := strings.Join(commands, ",")
+
+	if system.ProtocolVersion == capabilities.ProtocolVersion && system.Capabilities == commandList {
+		return false
+	}
+
+	system.ProtocolVersion = capabilities.ProtocolVersion
+	system.Capabilities = commandList
+	return true
+}
+
+// Supports returns true if the agent can handle the command
+func (capabilities *AgentCapabilities) Supports(command string) bool {
+	return capabilities.Commands[command]
+}
+
+// Negotiate returns the response in a form the agent can handle.  Commands the agent doesn't
+// support are replaced with their fallback, or ErrUnsupportedCommand is returned if there isn't one.
+func (capabilities *AgentCapabilities) Negotiate(response ResponseToAgent) (ResponseToAgent, error) {
+	if capabilities.Supports(response.Command) {
+		return response, nil
+	}
+
+	fallback, ok := fallbacks[response.Command]
+	if !ok {
+		return response, ErrUnsupportedCommand
+	}
+
+	downConverted := fallback(response)
+	downConverted.TaskID = response.TaskID
+	if !capabilities.Supports(downConverted.Command) {
+		return response, ErrUnsupportedCommand
+	}
+	return downConverted, nil
+}
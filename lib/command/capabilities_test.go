@@ -0,0 +1,128 @@
+////////////////////////////////////////////////////////////////////////////
+//
+// Summit Route End Point Protection
+//
+// This source code is licensed under the BSD-style license found in the
+// LICENSE file in the root directory of this source tree.
+//
+/////////////////////////////////////////////////////////////////////////////
+
+package command
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/coopernurse/gorp"
+
+	"qdserver/lib/models"
+)
+
+// fakeSystemDB is a database holding one system, which records the tasks added for it.
+// Calls other than SelectOne and Insert panic.
+type fakeSystemDB struct {
+	gorp.SqlExecutor
+	system models.System
+	tasks  []*models.Task
+}
+
+func (db *fakeSystemDB) SelectOne(holder interface{}, query string, args ...interface{}) error {
+	*holder.(*models.System) = db.system
+	return nil
+}
+
+func (db *fakeSystemDB) Insert(list ...interface{}) error {
+	for _, item := range list {
+		db.tasks = append(db.tasks, item.(*models.Task))
+	}
+	return nil
+}
+
+func TestNegotiate(t *testing.T) {
+	tests := []struct {
+		name            string
+		protocolVersion int
+		capabilities    string
+		response        ResponseToAgent
+		command         string // Command sent to the agent, or empty if it is refused
+	}{
+		{"supported", ProtocolVersion3, "", GetFileByHash("00"), "GetFileByHash"},
+		{"supported in the list", ProtocolVersion3, "NOP,Stall", Stall(), "Stall"},
+		{"fallback", ProtocolVersion3, "NOP,Success", Stall(), "NOP"},
+		{"fallback unsupported", ProtocolVersion3, "Success", Stall(), ""},
+		{"unsupported", ProtocolVersion1, "", RotateSecret("secret"), ""},
+		{"unsupported in the list", ProtocolVersion3, "NOP,Stall", GetFileByHash("00"), ""},
+		{"no capabilities", 0, "", GetFileByHash("00"), "GetFileByHash"},
+		{"no capabilities, newer command", 0, "", Tasks(nil), ""},
+	}
+
+	for _, test := range tests {
+		capabilities := CapabilitiesForSystem(&models.System{ProtocolVersion: test.protocolVersion, Capabilities: test.capabilities})
+
+		test.response.TaskID = 7
+		negotiated, err := capabilities.Negotiate(test.response)
+		if test.command == "" {
+			if err != ErrUnsupportedCommand {
+				t.Errorf("%s: Negotiate = %s, %v, want ErrUnsupportedCommand", test.name, negotiated.Command, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: Negotiate failed, %v", test.name, err)
+			continue
+		}
+		if negotiated.Command != test.command || negotiated.TaskID != 7 {
+			t.Errorf("%s: Negotiate = %s task %d, want %s task 7", test.name, negotiated.Command, negotiated.TaskID, test.command)
+		}
+	}
+
+	// Capabilities that list nothing support nothing
+	empty := &AgentCapabilities{ProtocolVersion: CurrentProtocolVersion, Commands: map[string]bool{}}
+	if _, err := empty.Negotiate(Nop()); err != ErrUnsupportedCommand {
+		t.Errorf("Negotiate with no commands = %v, want ErrUnsupportedCommand", err)
+	}
+}
+
+func TestAddTask(t *testing.T) {
+	tests := []struct {
+		name        string
+		system      models.System
+		response    ResponseToAgent
+		wantErr     error
+		wantCommand string // Command stored in the task, which is negotiated again when handed out
+	}{
+		{"supported", models.System{ID: 1, ProtocolVersion: ProtocolVersion3}, GetFileByHash("00"), nil, "GetFileByHash"},
+		{"fallback", models.System{ID: 1, ProtocolVersion: ProtocolVersion3, Capabilities: "NOP"}, Stall(), nil, "Stall"},
+		{"unsupported", models.System{ID: 1, ProtocolVersion: ProtocolVersion1}, RotateSecret("secret"), ErrUnsupportedCommand, ""},
+		{"no capabilities", models.System{ID: 1}, GetCatalogFileByHash("00"), nil, "GetCatalogFileByHash"},
+	}
+
+	for _, test := range tests {
+		db := &fakeSystemDB{system: test.system}
+		err := AddTask(db, test.system.ID, test.response)
+		if err != test.wantErr {
+			t.Errorf("%s: AddTask = %v, want %v", test.name, err, test.wantErr)
+			continue
+		}
+
+		if test.wantErr != nil {
+			if len(db.tasks) != 0 {
+				t.Errorf("%s: AddTask stored a task the agent can't handle", test.name)
+			}
+			continue
+		}
+		if len(db.tasks) != 1 {
+			t.Errorf("%s: AddTask stored %d tasks, want 1", test.name, len(db.tasks))
+			continue
+		}
+
+		task := db.tasks[0]
+		var stored ResponseToAgent
+		if err = json.Unmarshal([]byte(task.Command), &stored); err != nil {
+			t.Errorf("%s: Unable to parse stored command, %v", test.name, err)
+		}
+		if task.SystemID != test.system.ID || task.State != models.TaskStatePending || stored.Command != test.wantCommand {
+			t.Errorf("%s: stored task %+v, want a pending %s", test.name, task, test.wantCommand)
+		}
+	}
+}
@@ -0,0 +1,218 @@
+////////////////////////////////////////////////////////////////////////////
+//
+// Summit Route End Point Protection
+//
+// This source code is licensed under the BSD-style license found in the
+// LICENSE file in the root directory of this source tree.
+//
+/////////////////////////////////////////////////////////////////////////////
+
+
+package command
+
+import (
+	"encoding/hex"
+	"encoding/json"
+
+	"github.com/coopernurse/gorp"
+
+	"qdserver/lib/models"
+	"qdserver/lib/rules"
+	"qdserver/lib/utils"
+)
+
+// ResponseToAgent struct
+type ResponseToAgent struct {
+	Command   string
+	Arguments interface{}
+	TaskID    int64 `json:",omitempty"` // Set when the command came from the Tasks table, so the agent can report back on it
+}
+
+// SetSystemUUID command gives a newly registered agent its ID, and the secret to sign its requests with.
+// If the agent sent a certificate request, the PEM encoded client certificate and CA certificate are included.
+func SetSystemUUID(systemUUID string, secret string, certificate string, caCertificate string) ResponseToAgent {
+	response := ResponseToAgent{
+		Command: "SetSystemUUID",
+		Arguments: struct {
+			SystemUUID    string
+			Secret        string
+			Certificate   string `json:",omitempty"`
+			CACertificate string `json:",omitempty"`
+		}{
+			systemUUID,
+			secret,
+			certificate,
+			caCertificate,
+		}}
+	return response
+}
+
+// RotateSecret command tells the agent to sign its requests with a new secret
+func RotateSecret(secret string) ResponseToAgent {
+	response := ResponseToAgent{
+		Command: "RotateSecret",
+		Arguments: struct {
+			Secret string
+		}{
+			secret,
+		}}
+	return response
+}
+
+// GetFileByHash command
+func GetFileByHash(sha256 string) ResponseToAgent {
+	response := ResponseToAgent{
+		Command: "GetFileByHash",
+		Arguments: struct {
+			Sha256 string
+		}{
+			sha256,
+		}}
+	return response
+}
+
+// GetCatalogFileByHash command
+func GetCatalogFileByHash(sha256 string) ResponseToAgent {
+	response := ResponseToAgent{
+		Command: "GetCatalogFileByHash",
+		Arguments: struct {
+			Sha256 string
+		}{
+			sha256,
+		}}
+	return response
+}
+
+// SetPolicy command tells the agent what rules it should be enforcing
+func SetPolicy(version int64, hash string, policy rules.CompiledPolicy) ResponseToAgent {
+	response := ResponseToAgent{
+		Command: "SetPolicy",
+		Arguments: struct {
+			Version int64
+			Hash    string
+			Policy  rules.CompiledPolicy
+		}{
+			version,
+			hash,
+			policy,
+		}}
+	return response
+}
+
+// Update command
+func Update(newVersion string) ResponseToAgent {
+	response := ResponseToAgent{
+		Command: "Update",
+		Arguments: struct {
+			NewVersion string
+		}{
+			newVersion,
+		}}
+	return response
+}
+
+// Stall command is used when something has gone wrong on the server, so we delay the client so I have time to hopefully fix it
+func Stall() ResponseToAgent {
+	response := ResponseToAgent{
+		Command:   "Stall",
+		Arguments: nil}
+	return response
+}
+
+// Nop command
+func Nop() ResponseToAgent {
+	response := ResponseToAgent{
+		Command:   "NOP",
+		Arguments: nil}
+	return response
+}
+
+// Success command tells the agent it was successful for times when process events are sent
+func Success() ResponseToAgent {
+	response := ResponseToAgent{
+		Command:   "Success",
+		Arguments: nil}
+	return response
+}
+
+// Tasks command hands the agent several tasks at once, to be run in order.  Each has its own TaskID.
+func Tasks(tasks []ResponseToAgent) ResponseToAgent {
+	response := ResponseToAgent{
+		Command: "Tasks",
+		Arguments: struct {
+			Tasks []ResponseToAgent
+		}{
+			tasks,
+		}}
+	return response
+}
+
+// BatchSuccess command tells the agent a batch of events was processed, with the result of each event in order
+func BatchSuccess(results interface{}) ResponseToAgent {
+	response := ResponseToAgent{
+		Command: "Success",
+		Arguments: struct {
+			Results interface{}
+		}{
+			results,
+		}}
+	return response
+}
+
+// AddTask stores a task to be sent to a system next time it calls in.
+// Returns ErrUnsupportedCommand if the agent can't handle the command.  The db may be a transaction.
+func AddTask(db gorp.SqlExecutor, systemID int64, agentCommand ResponseToAgent) (err error) {
+	// The command is converted for the agent when it is handed out, as the agent may have been updated by then
+	capabilities, err := GetAgentCapabilities(db, systemID)
+	if err != nil {
+		return err
+	}
+	if _, err = capabilities.Negotiate(agentCommand); err != nil {
+		return err
+	}
+
+	// Convert command to json
+	jsonCommand, err := json.Marshal(agentCommand)
+	if err != nil {
+		return err
+	}
+
+	task := &models.Task{
+		SystemID:     systemID,
+		CreationDate: utils.DBTimeNow(),
+		Command:      string(jsonCommand),
+		State:        models.TaskStatePending,
+	}
+
+	// Save it
+	if err = db.Insert(task); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// QueueSecretRotation gives the system a new secret, which is used in place of the old one once the agent signs a
+// request with it.  Also used to give a secret to agents registered before secrets were handed out.
+func QueueSecretRotation(db *gorp.DbMap, systemID int64) error {
+	var system models.System
+	err := db.SelectOne(&system, "select * from systems where ID=:id",
+		map[string]interface{}{
+			"id": systemID,
+		})
+	if err != nil {
+		return err
+	}
+
+	secret, err := utils.GenerateSecret()
+	if err != nil {
+		return err
+	}
+
+	system.PendingSecret = secret
+	if _, err = db.Update(&system); err != nil {
+		return err
+	}
+
+	return AddTask(db, systemID, RotateSecret(hex.EncodeToString(secret)))
+}
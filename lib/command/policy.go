@@ -0,0 +1,204 @@
+////////////////////////////////////////////////////////////////////////////
+//
+// Summit Route End Point Protection
+//
+// This source code is licensed under the BSD-style license found in the
+// LICENSE file in the root directory of this source tree.
+//
+/////////////////////////////////////////////////////////////////////////////
+
+package command
+
+import (
+	"encoding/hex"
+	"encoding/json"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/coopernurse/gorp"
+
+	"qdserver/lib/models"
+	"qdserver/lib/rules"
+)
+
+// QueuePolicyForSystem compiles the policy the system should be running, and if it has changed,
+// queues a SetPolicy task for the agent.  Any older SetPolicy tasks that are still outstanding are expired.
+func QueuePolicyForSystem(db *gorp.DbMap, systemID int64) error {
+	compiled, err := rules.CompileForSystem(db, systemID)
+	if err != nil {
+		return err
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+
+	if err = queuePolicy(tx, systemID, compiled); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// queuePolicy stores the compiled policy, and if it isn't the system's policy already, makes it so and queues it
+func queuePolicy(tx *gorp.Transaction, systemID int64, compiled rules.CompiledPolicy) error {
+	policy, err := rules.StorePolicy(tx, compiled)
+	if err != nil {
+		return err
+	}
+
+	// Lock the system so policies queued at the same time are applied one after the other
+	var system models.System
+	err = tx.SelectOne(&system, "select * from systems where ID=:id for update",
+		map[string]interface{}{
+			"id": systemID,
+		})
+	if err != nil {
+		return err
+	}
+
+	if system.PolicyID == policy.ID {
+		// Nothing changed
+		return nil
+	}
+
+	log.Infof("System %d moving from policy %d to %d", systemID, system.PolicyID, policy.ID)
+
+	if _, err = tx.Exec("UPDATE systems SET PolicyID=$1 WHERE ID=$2", policy.ID, systemID); err != nil {
+		return err
+	}
+
+	return queueSetPolicy(tx, systemID, policy)
+}
+
+// QueuePolicyForSystemSet calls QueuePolicyForSystem for every system in the set, and in the sets below it
+func QueuePolicyForSystemSet(db *gorp.DbMap, systemSetID int64) error {
+	systemSetIDs, err := rules.GetDescendantSystemSets(db, systemSetID)
+	if err != nil {
+		return err
+	}
+
+	for _, id := range systemSetIDs {
+		var systemIDs []int64
+		_, err := db.Select(&systemIDs, "select ID from systems where SystemSetID=:systemSetID",
+			map[string]interface{}{
+				"systemSetID": id,
+			})
+		if err != nil {
+			return err
+		}
+
+		for _, systemID := range systemIDs {
+			if err = QueuePolicyForSystem(db, systemID); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// QueuePolicyForRuleSet calls QueuePolicyForSystemSet for every system set using the rule set
+func QueuePolicyForRuleSet(db *gorp.DbMap, ruleSetID int64) error {
+	var systemSetIDs []int64
+	_, err := db.Select(&systemSetIDs, "select ID from systemSets where RuleSetID=:ruleSetID",
+		map[string]interface{}{
+			"ruleSetID": ruleSetID,
+		})
+	if err != nil {
+		return err
+	}
+
+	for _, systemSetID := range systemSetIDs {
+		if err = QueuePolicyForSystemSet(db, systemSetID); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// CheckAgentPolicy records the policy version the agent says it is running, and resends
+// the policy if the agent has fallen behind and there is no SetPolicy task on the way to it
+func CheckAgentPolicy(db *gorp.DbMap, system *models.System, agentPolicyID int64) error {
+	if system.AgentPolicyID != agentPolicyID {
+		system.AgentPolicyID = agentPolicyID
+		if _, err := db.Exec("UPDATE systems SET AgentPolicyID=$1 WHERE ID=$2", agentPolicyID, system.ID); err != nil {
+			return err
+		}
+	}
+
+	if system.PolicyID == 0 || system.PolicyID == agentPolicyID {
+		return nil
+	}
+
+	outstanding, err := db.SelectInt(`SELECT count(*)
+		FROM Tasks
+		WHERE SystemID=:systemID and (State=:pending or State=:deployed) and Command LIKE :command`,
+		map[string]interface{}{
+			"systemID": system.ID,
+			"pending":  models.TaskStatePending,
+			"deployed": models.TaskStateDeployed,
+			"command":  `{"Command":"SetPolicy"%`,
+		})
+	if err != nil {
+		return err
+	}
+	if outstanding != 0 {
+		return nil
+	}
+
+	var policy models.Policy
+	err = db.SelectOne(&policy, "select * from policies where ID=:id",
+		map[string]interface{}{
+			"id": system.PolicyID,
+		})
+	if err != nil {
+		return err
+	}
+
+	log.Infof("System %d is running policy %d instead of %d, resending", system.ID, agentPolicyID, system.PolicyID)
+	return queueSetPolicy(db, system.ID, &policy)
+}
+
+// queueSetPolicy expires any outstanding SetPolicy tasks and adds a new one.
+// Agents that can't take policies are skipped, and are sent the policy by CheckAgentPolicy once they are updated.
+func queueSetPolicy(db gorp.SqlExecutor, systemID int64, policy *models.Policy) error {
+	capabilities, err := GetAgentCapabilities(db, systemID)
+	if err != nil {
+		return err
+	}
+	if !capabilities.Supports("SetPolicy") {
+		log.Infof("System %d does not support policies, not sending policy %d", systemID, policy.ID)
+		return nil
+	}
+
+	var tasks []models.Task
+	_, err = db.Select(&tasks, `SELECT *
+		FROM Tasks
+		WHERE SystemID=:systemID and (State=:pending or State=:deployed) and Command LIKE :command`,
+		map[string]interface{}{
+			"systemID": systemID,
+			"pending":  models.TaskStatePending,
+			"deployed": models.TaskStateDeployed,
+			"command":  `{"Command":"SetPolicy"%`,
+		})
+	if err != nil {
+		return err
+	}
+
+	for _, task := range tasks {
+		task.State = models.TaskStateExpired
+		if _, err = db.Update(&task); err != nil {
+			return err
+		}
+	}
+
+	var compiled rules.CompiledPolicy
+	if err = json.Unmarshal([]byte(policy.Contents), &compiled); err != nil {
+		return err
+	}
+
+	return AddTask(db, systemID, SetPolicy(policy.ID, hex.EncodeToString(policy.Hash), compiled))
+}
@@ -0,0 +1,230 @@
+////////////////////////////////////////////////////////////////////////////
+//
+// Summit Route End Point Protection
+//
+// This source code is licensed under the BSD-style license found in the
+// LICENSE file in the root directory of this source tree.
+//
+/////////////////////////////////////////////////////////////////////////////
+
+// Package migrations keeps the database schema up to date.  Each Migration has a version, and the versions that
+// have been applied are recorded in the schemamigrations table.  Migrations are applied in order, each in its own
+// transaction, and can be rolled back in reverse order.
+package migrations
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/coopernurse/gorp"
+	_ "github.com/lib/pq" // Needed for gorp
+)
+
+// lockID is the Postgres advisory lock held while migrating, so two servers or admins can't migrate at once
+const lockID = 0x53524550 // "SREP"
+
+// Migration is one change to the schema
+type Migration struct {
+	Version     int
+	Description string
+	Up          func(tx gorp.SqlExecutor) error
+	Down        func(tx gorp.SqlExecutor) error // nil if the migration can't be rolled back
+}
+
+// MigrationStatus is a migration and whether it has been applied
+type MigrationStatus struct {
+	Migration   *Migration
+	AppliedDate int64 // 0 if it hasn't been applied
+}
+
+// ErrSchemaOutOfDate is returned by CheckCurrent when migrations need to be applied
+type ErrSchemaOutOfDate struct {
+	Pending int
+}
+
+func (err ErrSchemaOutOfDate) Error() string {
+	return fmt.Sprintf("The database schema is out of date, %d migrations need to be applied with utilities/migrate", err.Pending)
+}
+
+// Statements returns a step that runs the SQL statements in order
+func Statements(statements ...string) func(tx gorp.SqlExecutor) error {
+	return func(tx gorp.SqlExecutor) error {
+		for _, statement := range statements {
+			if _, err := tx.Exec(statement); err != nil {
+				return fmt.Errorf("%v, in: %s", err, statement)
+			}
+		}
+		return nil
+	}
+}
+
+// ensureSchemaTable creates the table that records which migrations have been applied
+func ensureSchemaTable(db gorp.SqlExecutor) error {
+	_, err := db.Exec(`CREATE TABLE IF NOT EXISTS schemamigrations (
+		version integer not null primary key,
+		description text,
+		applieddate bigint)`)
+	return err
+}
+
+// applied returns when each applied migration was applied, by version
+func applied(db gorp.SqlExecutor) (map[int]int64, error) {
+	if err := ensureSchemaTable(db); err != nil {
+		return nil, err
+	}
+
+	type appliedMigration struct {
+		Version     int
+		AppliedDate int64
+	}
+
+	var rows []appliedMigration
+	if _, err := db.Select(&rows, "SELECT Version, AppliedDate FROM schemamigrations"); err != nil {
+		return nil, err
+	}
+
+	versions := make(map[int]int64)
+	for _, row := range rows {
+		versions[row.Version] = row.AppliedDate
+	}
+	return versions, nil
+}
+
+// Status returns every migration in order, and when it was applied
+func Status(db gorp.SqlExecutor) ([]MigrationStatus, error) {
+	versions, err := applied(db)
+	if err != nil {
+		return nil, err
+	}
+
+	statuses := make([]MigrationStatus, len(migrations))
+	for i := range migrations {
+		statuses[i] = MigrationStatus{Migration: &migrations[i], AppliedDate: versions[migrations[i].Version]}
+	}
+	return statuses, nil
+}
+
+// CheckCurrent returns ErrSchemaOutOfDate if any migration hasn't been applied
+func CheckCurrent(db gorp.SqlExecutor) error {
+	statuses, err := Status(db)
+	if err != nil {
+		return err
+	}
+
+	pending := 0
+	for _, status := range statuses {
+		if status.AppliedDate == 0 {
+			pending++
+		}
+	}
+	if pending != 0 {
+		return ErrSchemaOutOfDate{Pending: pending}
+	}
+	return nil
+}
+
+// run applies or rolls back a single migration in a transaction, under the lock.  It does nothing if another process
+// got to it first.
+func run(db *gorp.DbMap, migration *Migration, up bool) (bool, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return false, err
+	}
+
+	ran, err := runInTransaction(tx, migration, up)
+	if err != nil {
+		tx.Rollback()
+		return false, err
+	}
+
+	return ran, tx.Commit()
+}
+
+func runInTransaction(tx *gorp.Transaction, migration *Migration, up bool) (bool, error) {
+	if _, err := tx.Exec("SELECT pg_advisory_xact_lock($1)", lockID); err != nil {
+		return false, err
+	}
+
+	// Check again now that we have the lock
+	versions, err := applied(tx)
+	if err != nil {
+		return false, err
+	}
+	if _, isApplied := versions[migration.Version]; isApplied == up {
+		return false, nil
+	}
+
+	if up {
+		if err = migration.Up(tx); err != nil {
+			return false, err
+		}
+		_, err = tx.Exec("INSERT INTO schemamigrations (version, description, applieddate) VALUES ($1, $2, $3)",
+			migration.Version, migration.Description, time.Now().Unix())
+	} else {
+		if err = migration.Down(tx); err != nil {
+			return false, err
+		}
+		_, err = tx.Exec("DELETE FROM schemamigrations WHERE version=$1", migration.Version)
+	}
+
+	return err == nil, err
+}
+
+// Up applies the migrations that haven't been applied, in order, up to and including the target version.  A target
+// of 0 applies them all.  Returns the number applied, which may be short if one fails.
+func Up(db *gorp.DbMap, target int) (int, error) {
+	statuses, err := Status(db)
+	if err != nil {
+		return 0, err
+	}
+
+	count := 0
+	for _, status := range statuses {
+		if target != 0 && status.Migration.Version > target {
+			break
+		}
+		if status.AppliedDate != 0 {
+			continue
+		}
+
+		ran, err := run(db, status.Migration, true)
+		if err != nil {
+			return count, fmt.Errorf("Unable to apply migration %d (%s): %v", status.Migration.Version, status.Migration.Description, err)
+		}
+		if ran {
+			count++
+		}
+	}
+
+	return count, nil
+}
+
+// Down rolls back the given number of the most recently applied migrations, in reverse order.  Returns the number
+// rolled back, which may be short if one fails or can't be rolled back.
+func Down(db *gorp.DbMap, steps int) (int, error) {
+	statuses, err := Status(db)
+	if err != nil {
+		return 0, err
+	}
+
+	count := 0
+	for i := len(statuses) - 1; i >= 0 && count < steps; i-- {
+		migration := statuses[i].Migration
+		if statuses[i].AppliedDate == 0 {
+			continue
+		}
+		if migration.Down == nil {
+			return count, fmt.Errorf("Migration %d (%s) can't be rolled back", migration.Version, migration.Description)
+		}
+
+		ran, err := run(db, migration, false)
+		if err != nil {
+			return count, fmt.Errorf("Unable to roll back migration %d (%s): %v", migration.Version, migration.Description, err)
+		}
+		if ran {
+			count++
+		}
+	}
+
+	return count, nil
+}
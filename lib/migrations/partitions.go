@@ -0,0 +1,131 @@
+////////////////////////////////////////////////////////////////////////////
+//
+// Summit Route End Point Protection
+//
+// This source code is licensed under the BSD-style license found in the
+// LICENSE file in the root directory of this source tree.
+//
+/////////////////////////////////////////////////////////////////////////////
+
+package migrations
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/coopernurse/gorp"
+)
+
+// processEventColumns are the columns of processevents, in order
+const processEventColumns = "id, systemid, executablefileid, pid, ppid, filepathid, commandlineid, eventtime, state, endtime, exitcode"
+
+// earliestPartition is the earliest month existing events get a partition for, anything before it is a bad clock
+const earliestPartition = 946684800 // 2000-01-01
+
+// Partitions are named as lib/retention names them, and it takes over creating them once this migration has run
+const (
+	defaultPartition    = "processevents_default"
+	monthPartitionNames = "processevents_y%04dm%02d"
+)
+
+// processEventsSequence returns the name of the sequence the IDs of processevents come from
+func processEventsSequence(tx gorp.SqlExecutor) (string, error) {
+	return tx.SelectStr("SELECT pg_get_serial_sequence('processevents', 'id')")
+}
+
+// partitionProcessEvents replaces processevents with a table partitioned by month of EventTime, and copies the
+// existing events into it
+func partitionProcessEvents(tx gorp.SqlExecutor) error {
+	partitioned, err := tx.SelectInt(`SELECT count(*) FROM pg_partitioned_table pt
+		JOIN pg_class c ON c.oid = pt.partrelid
+		WHERE c.relname = 'processevents'`)
+	if err != nil || partitioned != 0 {
+		return err
+	}
+
+	sequence, err := processEventsSequence(tx)
+	if err != nil {
+		return err
+	}
+
+	err = Statements(
+		`ALTER TABLE processevents RENAME TO processevents_unpartitioned`,
+		`ALTER INDEX IF EXISTS processevents_pkey RENAME TO processevents_unpartitioned_pkey`,
+		fmt.Sprintf("ALTER SEQUENCE %s OWNED BY NONE", sequence),
+		// The key has to include EventTime, but IDs still come from the sequence so stay unique
+		fmt.Sprintf(`CREATE TABLE processevents (
+				id bigint not null default nextval('%s'),
+				systemid bigint not null default 0,
+				executablefileid bigint not null default 0,
+				pid bigint not null default 0,
+				ppid bigint not null default 0,
+				filepathid bigint not null default 0,
+				commandlineid bigint not null default 0,
+				eventtime bigint not null default 0,
+				state integer not null default 0,
+				endtime bigint not null default 0,
+				exitcode bigint not null default 0,
+				primary key (id, eventtime))
+			PARTITION BY RANGE (eventtime)`, sequence),
+		fmt.Sprintf("ALTER SEQUENCE %s OWNED BY processevents.id", sequence),
+		`CREATE INDEX processevents_systemid_eventtime_idx ON processevents (systemid, eventtime)`,
+		fmt.Sprintf("CREATE TABLE %s PARTITION OF processevents DEFAULT", defaultPartition),
+	)(tx)
+	if err != nil {
+		return err
+	}
+
+	// Give every month with events a partition, as well as this month and next
+	now := time.Now().UTC().Unix()
+	first, err := tx.SelectInt("SELECT coalesce(min(eventtime), $1) FROM processevents_unpartitioned WHERE eventtime >= $2", now, earliestPartition)
+	if err != nil {
+		return err
+	}
+	start := time.Unix(first, 0).UTC()
+	last := time.Unix(now, 0).UTC().AddDate(0, 1, 0)
+	for month := time.Date(start.Year(), start.Month(), 1, 0, 0, 0, 0, time.UTC); !month.After(last); month = month.AddDate(0, 1, 0) {
+		_, err = tx.Exec(fmt.Sprintf("CREATE TABLE %s PARTITION OF processevents FOR VALUES FROM (%d) TO (%d)",
+			fmt.Sprintf(monthPartitionNames, month.Year(), int(month.Month())), month.Unix(), month.AddDate(0, 1, 0).Unix()))
+		if err != nil {
+			return err
+		}
+	}
+
+	return Statements(
+		fmt.Sprintf(`INSERT INTO processevents (%s)
+			SELECT id, coalesce(systemid, 0), coalesce(executablefileid, 0), coalesce(pid, 0), coalesce(ppid, 0),
+				filepathid, commandlineid, coalesce(eventtime, 0), coalesce(state, 0), endtime, exitcode
+			FROM processevents_unpartitioned`, processEventColumns),
+		`DROP TABLE processevents_unpartitioned`,
+	)(tx)
+}
+
+// unpartitionProcessEvents puts the events back in a single table.  Events that have been rolled up are gone.
+func unpartitionProcessEvents(tx gorp.SqlExecutor) error {
+	sequence, err := processEventsSequence(tx)
+	if err != nil {
+		return err
+	}
+
+	return Statements(
+		fmt.Sprintf(`CREATE TABLE processevents_unpartitioned (
+				id bigint not null default nextval('%s'),
+				systemid bigint,
+				executablefileid bigint,
+				pid bigint,
+				ppid bigint,
+				filepathid bigint not null default 0,
+				commandlineid bigint not null default 0,
+				eventtime bigint,
+				state integer,
+				endtime bigint not null default 0,
+				exitcode bigint not null default 0,
+				CONSTRAINT processevents_unpartitioned_pkey primary key (id))`, sequence),
+		fmt.Sprintf("INSERT INTO processevents_unpartitioned (%s) SELECT %s FROM processevents", processEventColumns, processEventColumns),
+		fmt.Sprintf("ALTER SEQUENCE %s OWNED BY NONE", sequence),
+		`DROP TABLE processevents`,
+		`ALTER TABLE processevents_unpartitioned RENAME TO processevents`,
+		`ALTER INDEX processevents_unpartitioned_pkey RENAME TO processevents_pkey`,
+		fmt.Sprintf("ALTER SEQUENCE %s OWNED BY processevents.id", sequence),
+	)(tx)
+}
@@ -0,0 +1,157 @@
+////////////////////////////////////////////////////////////////////////////
+//
+// Summit Route End Point Protection
+//
+// This source code is licensed under the BSD-style license found in the
+// LICENSE file in the root directory of this source tree.
+//
+/////////////////////////////////////////////////////////////////////////////
+
+package migrations
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/coopernurse/gorp"
+
+	"qdserver/lib/utils"
+)
+
+// valuesPerChunk is how many distinct values are interned at once
+const valuesPerChunk = 1000
+
+// pathConversion is a text column that is replaced by the ID of the value in an interned table
+type pathConversion struct {
+	table       string
+	oldColumn   string
+	newColumn   string
+	internTable string
+	internValue string
+	intern      func(db gorp.SqlExecutor, values []string) (map[string]int64, error)
+}
+
+var pathConversions = []pathConversion{
+	{"processevents", "filepath", "filepathid", "filepaths", "path", utils.InternFilePaths},
+	{"processevents", "commandline", "commandlineid", "commandlines", "commandline", utils.InternCommandLines},
+	{"filetosystemmap", "filepath", "filepathid", "filepaths", "path", utils.InternFilePaths},
+	{"moduleloadevents", "filepath", "filepathid", "filepaths", "path", utils.InternFilePaths},
+	{"driverloadevents", "filepath", "filepathid", "filepaths", "path", utils.InternFilePaths},
+}
+
+// hasColumn returns true if the table has the column
+func hasColumn(tx gorp.SqlExecutor, table string, column string) (bool, error) {
+	count, err := tx.SelectInt("SELECT count(*) FROM information_schema.columns WHERE table_name=$1 and column_name=$2", table, column)
+	return count != 0, err
+}
+
+// normalizePaths creates the filepaths and commandlines tables, interns every value of the old text columns, sets the
+// new ID columns, and drops the old columns
+func normalizePaths(tx gorp.SqlExecutor) error {
+	err := Statements(
+		`CREATE TABLE IF NOT EXISTS filepaths (
+			id bigserial not null primary key,
+			hash bytea unique,
+			path text)`,
+		`CREATE TABLE IF NOT EXISTS commandlines (
+			id bigserial not null primary key,
+			hash bytea unique,
+			commandline text)`,
+		// Maps each value to its ID, so each table is updated in one pass
+		`CREATE TEMP TABLE internmap (value text PRIMARY KEY, id bigint) ON COMMIT DROP`,
+	)(tx)
+	if err != nil {
+		return err
+	}
+
+	for _, c := range pathConversions {
+		if err = convertPaths(tx, c); err != nil {
+			return fmt.Errorf("Unable to convert %s.%s: %v", c.table, c.oldColumn, err)
+		}
+	}
+	return nil
+}
+
+func convertPaths(tx gorp.SqlExecutor, c pathConversion) error {
+	// Tables created by gorp since the change may already have the new column, and not the old one
+	_, err := tx.Exec(fmt.Sprintf("ALTER TABLE %s ADD COLUMN IF NOT EXISTS %s bigint not null default 0", c.table, c.newColumn))
+	if err != nil {
+		return err
+	}
+
+	exists, err := hasColumn(tx, c.table, c.oldColumn)
+	if err != nil || !exists {
+		return err
+	}
+
+	if _, err = tx.Exec("TRUNCATE internmap"); err != nil {
+		return err
+	}
+
+	type valueRow struct {
+		Value string
+	}
+
+	last := ""
+	for {
+		var rows []valueRow
+		_, err = tx.Select(&rows, fmt.Sprintf(`SELECT DISTINCT %s as Value
+			FROM %s
+			WHERE %s > $1
+			ORDER BY Value
+			LIMIT %d`, c.oldColumn, c.table, c.oldColumn, valuesPerChunk), last)
+		if err != nil {
+			return err
+		}
+		if len(rows) == 0 {
+			break
+		}
+
+		values := make([]string, len(rows))
+		for i, row := range rows {
+			values[i] = row.Value
+		}
+		last = values[len(values)-1]
+
+		ids, err := c.intern(tx, values)
+		if err != nil {
+			return err
+		}
+
+		var placeholders []string
+		var args []interface{}
+		for _, value := range values {
+			placeholders = append(placeholders, fmt.Sprintf("($%d, $%d)", len(args)+1, len(args)+2))
+			args = append(args, value, ids[value])
+		}
+		if _, err = tx.Exec("INSERT INTO internmap (value, id) VALUES "+strings.Join(placeholders, ","), args...); err != nil {
+			return err
+		}
+	}
+
+	return Statements(
+		fmt.Sprintf("UPDATE %s t SET %s = m.id FROM internmap m WHERE t.%s = m.value", c.table, c.newColumn, c.oldColumn),
+		fmt.Sprintf("ALTER TABLE %s DROP COLUMN %s", c.table, c.oldColumn),
+	)(tx)
+}
+
+// denormalizePaths puts the paths and command lines back in the tables that use them, and drops the filepaths and
+// commandlines tables.  Paths stay in their canonical form.
+func denormalizePaths(tx gorp.SqlExecutor) error {
+	for _, c := range pathConversions {
+		err := Statements(
+			fmt.Sprintf("ALTER TABLE %s ADD COLUMN IF NOT EXISTS %s text not null default ''", c.table, c.oldColumn),
+			fmt.Sprintf("UPDATE %s t SET %s = i.%s FROM %s i WHERE t.%s = i.id",
+				c.table, c.oldColumn, c.internValue, c.internTable, c.newColumn),
+			fmt.Sprintf("ALTER TABLE %s DROP COLUMN %s", c.table, c.newColumn),
+		)(tx)
+		if err != nil {
+			return err
+		}
+	}
+
+	return Statements(
+		`DROP TABLE IF EXISTS filepaths`,
+		`DROP TABLE IF EXISTS commandlines`,
+	)(tx)
+}
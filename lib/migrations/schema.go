@@ -0,0 +1,662 @@
+////////////////////////////////////////////////////////////////////////////
+//
+// Summit Route End Point Protection
+//
+// This source code is licensed under the BSD-style license found in the
+// LICENSE file in the root directory of this source tree.
+//
+/////////////////////////////////////////////////////////////////////////////
+
+package migrations
+
+import (
+	"fmt"
+
+	"github.com/coopernurse/gorp"
+
+	"qdserver/lib/models"
+)
+
+// migrations is every change to the schema, in the order they are applied.  Never change or reorder a migration that
+// has been released, add a new one instead.
+//
+// Databases from before migrations were created by gorp's CreateTablesIfNotExists, and may already have some of the
+// tables and columns below, so tables and columns are only added if they don't exist.  Added columns are NOT NULL
+// with a default, as gorp can't read NULLs into the model's fields.
+var migrations = []Migration{
+	{
+		Version:     1,
+		Description: "Initial schema",
+		Up: Statements(
+			`CREATE TABLE IF NOT EXISTS systemsets (
+				id bigserial not null primary key,
+				customerid bigint,
+				name text,
+				rulesetid bigint,
+				mode integer,
+				systemsetid bigint,
+				creationdate bigint)`,
+			`CREATE TABLE IF NOT EXISTS systems (
+				id bigserial not null primary key,
+				systemsetid bigint,
+				systemuuid bytea,
+				agentversion text,
+				comment text,
+				oshumanname text,
+				osversion text,
+				manufacturer text,
+				model text,
+				machineguid text,
+				arch text,
+				machinename text,
+				firstseen bigint,
+				lastseen bigint)`,
+			`CREATE TABLE IF NOT EXISTS rulesets (
+				id bigserial not null primary key,
+				firstrule bigint)`,
+			`CREATE TABLE IF NOT EXISTS rules (
+				id bigserial not null primary key,
+				description text,
+				attributetype text,
+				attributevalue text,
+				allowdeny boolean,
+				nextrule bigint,
+				previousrule bigint)`,
+			`CREATE TABLE IF NOT EXISTS executablefiles (
+				id bigserial not null primary key,
+				md5 bytea,
+				sha1 bytea,
+				sha256 bytea,
+				codesectionsha256 bytea,
+				size integer,
+				issigned boolean,
+				firstseen bigint,
+				executiontype integer,
+				uploaddate bigint,
+				analysisdate bigint,
+				authenticodemd5 bytea,
+				authenticodesha1 bytea,
+				authenticodesha256 bytea,
+				companyname text,
+				productversion text,
+				productname text,
+				filedescription text,
+				internalname text,
+				fileversion text,
+				originalfilename text,
+				architecture integer)`,
+			`CREATE TABLE IF NOT EXISTS filetosignermap (
+				fileid bigint not null,
+				signerid bigint not null,
+				primary key (fileid, signerid))`,
+			`CREATE TABLE IF NOT EXISTS filetocountersignermap (
+				fileid bigint not null,
+				"timestamp" bigint,
+				signerid bigint not null,
+				primary key (fileid, signerid))`,
+			`CREATE TABLE IF NOT EXISTS signers (
+				id bigserial not null primary key,
+				version integer,
+				subject text,
+				subjectshortname text,
+				serialnumber bytea,
+				digestalgorithm text,
+				digestencryptionalgorithm text,
+				digestencryptionalgorithmkeysize integer,
+				issuerid bigint)`,
+			`CREATE TABLE IF NOT EXISTS catalogfiles (
+				id bigserial not null primary key,
+				filepath text,
+				sha256 bytea,
+				size integer,
+				firstseen bigint,
+				uploaddate bigint,
+				analysisdate bigint,
+				signerid bigint)`,
+			`CREATE TABLE IF NOT EXISTS certificatetrustlist (
+				catalogid bigint not null,
+				hash bytea not null,
+				hashtype text,
+				fileid bigint,
+				primary key (catalogid, hash))`,
+			`CREATE TABLE IF NOT EXISTS processevents (
+				id bigserial not null primary key,
+				systemid bigint,
+				executablefileid bigint,
+				pid bigint,
+				ppid bigint,
+				filepath text,
+				commandline text,
+				eventtime bigint,
+				state integer)`,
+			`CREATE TABLE IF NOT EXISTS filetosystemmap (
+				fileid bigint not null,
+				systemid bigint not null,
+				filepath text,
+				firstseen bigint,
+				lastseen bigint,
+				primary key (fileid, systemid))`,
+			`CREATE TABLE IF NOT EXISTS customers (
+				id bigserial not null primary key,
+				uuid bytea unique,
+				active boolean,
+				creationdate bigint)`,
+			`CREATE TABLE IF NOT EXISTS users (
+				id bigserial not null primary key,
+				customerid bigint,
+				firstname text,
+				lastname text,
+				email text,
+				passwordhash bytea,
+				verified boolean,
+				active boolean,
+				mustsetpassword boolean,
+				lastpasswordresetemaildate bigint,
+				creationdate bigint,
+				lastlogin bigint)`,
+			`CREATE TABLE IF NOT EXISTS browsersessions (
+				id bigserial not null primary key,
+				noncehash bytea,
+				userid bigint,
+				creationdate bigint,
+				lastactive bigint,
+				ip bytea,
+				useragent bytea)`,
+			`CREATE TABLE IF NOT EXISTS passwordresets (
+				id bigserial not null primary key,
+				nonce bytea,
+				userid bigint,
+				creationdate bigint,
+				valid boolean)`,
+			`CREATE TABLE IF NOT EXISTS tasks (
+				id bigserial not null primary key,
+				systemid bigint,
+				creationdate bigint,
+				deployedtoagentdate bigint,
+				command text)`,
+			`CREATE TABLE IF NOT EXISTS updates (
+				id bigserial not null primary key,
+				versionfrom text,
+				versionto text)`,
+		),
+		Down: nil, // Would drop everything
+	},
+	{
+		Version:     2,
+		Description: "Track the state of tasks",
+		Up: Statements(
+			`ALTER TABLE tasks
+				ADD COLUMN IF NOT EXISTS state integer not null default 0,
+				ADD COLUMN IF NOT EXISTS attempts integer not null default 0,
+				ADD COLUMN IF NOT EXISTS completiondate bigint not null default 0,
+				ADD COLUMN IF NOT EXISTS result text not null default ''`,
+			// Tasks used to be done once they were handed to the agent
+			fmt.Sprintf(`UPDATE tasks SET state=%d, attempts=1, completiondate=deployedtoagentdate
+				WHERE deployedtoagentdate != 0 and state=%d`, models.TaskStateAcknowledged, models.TaskStatePending),
+		),
+		Down: Statements(
+			`ALTER TABLE tasks
+				DROP COLUMN IF EXISTS state,
+				DROP COLUMN IF EXISTS attempts,
+				DROP COLUMN IF EXISTS completiondate,
+				DROP COLUMN IF EXISTS result`,
+		),
+	},
+	{
+		Version:     3,
+		Description: "Add the default action of rule sets",
+		Up: Statements(
+			`ALTER TABLE rulesets ADD COLUMN IF NOT EXISTS defaultallow boolean not null default true`,
+		),
+		Down: Statements(
+			`ALTER TABLE rulesets DROP COLUMN IF EXISTS defaultallow`,
+		),
+	},
+	{
+		Version:     4,
+		Description: "Add policies",
+		Up: Statements(
+			`CREATE TABLE IF NOT EXISTS policies (
+				id bigserial not null primary key,
+				hash bytea unique,
+				contents text,
+				creationdate bigint)`,
+			`ALTER TABLE systems
+				ADD COLUMN IF NOT EXISTS policyid bigint not null default 0,
+				ADD COLUMN IF NOT EXISTS agentpolicyid bigint not null default 0`,
+		),
+		Down: Statements(
+			`ALTER TABLE systems
+				DROP COLUMN IF EXISTS policyid,
+				DROP COLUMN IF EXISTS agentpolicyid`,
+			`DROP TABLE IF EXISTS policies`,
+		),
+	},
+	{
+		Version:     5,
+		Description: "Add inheritance of system set settings",
+		Up: Statements(
+			`ALTER TABLE systemsets
+				ADD COLUMN IF NOT EXISTS inheritmode boolean not null default false,
+				ADD COLUMN IF NOT EXISTS ruleinheritance integer not null default 0`,
+		),
+		Down: Statements(
+			`ALTER TABLE systemsets
+				DROP COLUMN IF EXISTS inheritmode,
+				DROP COLUMN IF EXISTS ruleinheritance`,
+		),
+	},
+	{
+		Version:     6,
+		Description: "Record Authenticode signature checks",
+		Up: Statements(
+			`ALTER TABLE executablefiles ADD COLUMN IF NOT EXISTS signaturestatus integer not null default 0`,
+			`ALTER TABLE signers
+				ADD COLUMN IF NOT EXISTS issuer text not null default '',
+				ADD COLUMN IF NOT EXISTS notbefore bigint not null default 0,
+				ADD COLUMN IF NOT EXISTS notafter bigint not null default 0`,
+		),
+		Down: Statements(
+			`ALTER TABLE executablefiles DROP COLUMN IF EXISTS signaturestatus`,
+			`ALTER TABLE signers
+				DROP COLUMN IF EXISTS issuer,
+				DROP COLUMN IF EXISTS notbefore,
+				DROP COLUMN IF EXISTS notafter`,
+		),
+	},
+	{
+		Version:     7,
+		Description: "Record catalog signature checks",
+		Up: Statements(
+			`ALTER TABLE catalogfiles ADD COLUMN IF NOT EXISTS signaturestatus integer not null default 0`,
+		),
+		Down: Statements(
+			`ALTER TABLE catalogfiles DROP COLUMN IF EXISTS signaturestatus`,
+		),
+	},
+	{
+		Version:     8,
+		Description: "Add resumable uploads",
+		Up: Statements(
+			`CREATE TABLE IF NOT EXISTS fileuploads (
+				id bigserial not null primary key,
+				systemid bigint,
+				sha256 bytea,
+				size bigint,
+				filetype text,
+				"offset" bigint,
+				hashstate bytea,
+				creationdate bigint,
+				lastupdate bigint)`,
+		),
+		Down: Statements(
+			`DROP TABLE IF EXISTS fileuploads`,
+		),
+	},
+	{
+		Version:     9,
+		Description: "Add agent secrets and request nonces",
+		Up: Statements(
+			`ALTER TABLE systems
+				ADD COLUMN IF NOT EXISTS secret bytea,
+				ADD COLUMN IF NOT EXISTS pendingsecret bytea`,
+			`CREATE TABLE IF NOT EXISTS requestnonces (
+				systemid bigint not null,
+				nonce varchar(64) not null,
+				"timestamp" bigint,
+				primary key (systemid, nonce))`,
+		),
+		Down: Statements(
+			`DROP TABLE IF EXISTS requestnonces`,
+			`ALTER TABLE systems
+				DROP COLUMN IF EXISTS secret,
+				DROP COLUMN IF EXISTS pendingsecret`,
+		),
+	},
+	{
+		Version:     10,
+		Description: "Add agent certificates",
+		Up: Statements(
+			`CREATE TABLE IF NOT EXISTS agentcertificates (
+				id bigserial not null primary key,
+				systemid bigint,
+				serialnumber bytea,
+				fingerprint bytea unique,
+				notbefore bigint,
+				notafter bigint,
+				creationdate bigint,
+				revocationdate bigint)`,
+		),
+		Down: Statements(
+			`DROP TABLE IF EXISTS agentcertificates`,
+		),
+	},
+	{
+		Version:     11,
+		Description: "Record the protocol version and commands of agents",
+		Up: Statements(
+			`ALTER TABLE systems
+				ADD COLUMN IF NOT EXISTS protocolversion integer not null default 0,
+				ADD COLUMN IF NOT EXISTS capabilities text not null default ''`,
+		),
+		Down: Statements(
+			`ALTER TABLE systems
+				DROP COLUMN IF EXISTS protocolversion,
+				DROP COLUMN IF EXISTS capabilities`,
+		),
+	},
+	{
+		Version:     12,
+		Description: "Record the predecessors of re-registered systems",
+		Up: Statements(
+			`ALTER TABLE systems ADD COLUMN IF NOT EXISTS predecessorid bigint not null default 0`,
+		),
+		Down: Statements(
+			`ALTER TABLE systems DROP COLUMN IF EXISTS predecessorid`,
+		),
+	},
+	{
+		Version:     13,
+		Description: "Add system inventory and its history",
+		Up: Statements(
+			`ALTER TABLE systems
+				ADD COLUMN IF NOT EXISTS ipaddresses text not null default '',
+				ADD COLUMN IF NOT EXISTS loggedonuser text not null default '',
+				ADD COLUMN IF NOT EXISTS lastboottime bigint not null default 0`,
+			`CREATE TABLE IF NOT EXISTS systemhistory (
+				id bigserial not null primary key,
+				systemid bigint,
+				changetime bigint,
+				field text,
+				oldvalue text,
+				newvalue text)`,
+		),
+		Down: Statements(
+			`DROP TABLE IF EXISTS systemhistory`,
+			`ALTER TABLE systems
+				DROP COLUMN IF EXISTS ipaddresses,
+				DROP COLUMN IF EXISTS loggedonuser,
+				DROP COLUMN IF EXISTS lastboottime`,
+		),
+	},
+	{
+		Version:     14,
+		Description: "Track systems that stop checking in",
+		Up: Statements(
+			`ALTER TABLE systems
+				ADD COLUMN IF NOT EXISTS retireddate bigint not null default 0,
+				ADD COLUMN IF NOT EXISTS status text not null default ''`,
+			`ALTER TABLE systemsets
+				ADD COLUMN IF NOT EXISTS lateafter bigint not null default 0,
+				ADD COLUMN IF NOT EXISTS offlineafter bigint not null default 0`,
+		),
+		Down: Statements(
+			`ALTER TABLE systems
+				DROP COLUMN IF EXISTS retireddate,
+				DROP COLUMN IF EXISTS status`,
+			`ALTER TABLE systemsets
+				DROP COLUMN IF EXISTS lateafter,
+				DROP COLUMN IF EXISTS offlineafter`,
+		),
+	},
+	{
+		Version:     15,
+		Description: "Record process exits",
+		Up: Statements(
+			`ALTER TABLE processevents
+				ADD COLUMN IF NOT EXISTS endtime bigint not null default 0,
+				ADD COLUMN IF NOT EXISTS exitcode bigint not null default 0`,
+		),
+		Down: Statements(
+			`ALTER TABLE processevents
+				DROP COLUMN IF EXISTS endtime,
+				DROP COLUMN IF EXISTS exitcode`,
+		),
+	},
+	{
+		Version:     16,
+		Description: "Add module and driver load events",
+		Up: Statements(
+			`CREATE TABLE IF NOT EXISTS moduleloadevents (
+				id bigserial not null primary key,
+				systemid bigint,
+				executablefileid bigint,
+				processeventid bigint,
+				pid bigint,
+				filepath text,
+				eventtime bigint)`,
+			`CREATE TABLE IF NOT EXISTS driverloadevents (
+				id bigserial not null primary key,
+				systemid bigint,
+				executablefileid bigint,
+				filepath text,
+				eventtime bigint)`,
+		),
+		Down: Statements(
+			`DROP TABLE IF EXISTS moduleloadevents`,
+			`DROP TABLE IF EXISTS driverloadevents`,
+		),
+	},
+	{
+		Version:     17,
+		Description: "Store paths and command lines in their own tables",
+		Up:          normalizePaths,
+		Down:        denormalizePaths,
+	},
+	{
+		Version:     18,
+		Description: "Make files unique per system in filetosystemmap",
+		Up:          uniqueFileToSystemMap,
+		Down: Statements(
+			`ALTER TABLE filetosystemmap DROP CONSTRAINT IF EXISTS filetosystemmap_fileid_systemid_key`,
+		),
+	},
+	{
+		Version:     19,
+		Description: "Index customers by UUID",
+		Up: func(tx gorp.SqlExecutor) error {
+			return createIndex(tx, "customers", "uuid", "CREATE UNIQUE INDEX customers_uuid_idx ON customers (uuid)")
+		},
+		Down: Statements(
+			`DROP INDEX IF EXISTS customers_uuid_idx`,
+		),
+	},
+	{
+		Version:     20,
+		Description: "Index executable files by sha256",
+		Up: func(tx gorp.SqlExecutor) error {
+			return createIndex(tx, "executablefiles", "sha256", "CREATE INDEX executablefiles_sha256_idx ON executablefiles (sha256)")
+		},
+		Down: Statements(
+			`DROP INDEX IF EXISTS executablefiles_sha256_idx`,
+		),
+	},
+	{
+		Version:     21,
+		Description: "Partition process events by month, and add retention and daily roll-ups",
+		Up: func(tx gorp.SqlExecutor) error {
+			err := Statements(
+				`ALTER TABLE customers
+					ADD COLUMN IF NOT EXISTS processeventretention bigint not null default 0,
+					ADD COLUMN IF NOT EXISTS archiveprocessevents boolean not null default false`,
+				`CREATE TABLE IF NOT EXISTS processeventrollups (
+					day bigint not null,
+					systemid bigint not null,
+					executablefileid bigint not null,
+					events bigint not null default 0,
+					firstseen bigint not null default 0,
+					lastseen bigint not null default 0,
+					primary key (day, systemid, executablefileid))`,
+			)(tx)
+			if err != nil {
+				return err
+			}
+			return partitionProcessEvents(tx)
+		},
+		Down: func(tx gorp.SqlExecutor) error {
+			if err := unpartitionProcessEvents(tx); err != nil {
+				return err
+			}
+			return Statements(
+				`DROP TABLE IF EXISTS processeventrollups`,
+				`ALTER TABLE customers
+					DROP COLUMN IF EXISTS processeventretention,
+					DROP COLUMN IF EXISTS archiveprocessevents`,
+			)(tx)
+		},
+	},
+	{
+		Version:     22,
+		Description: "Make system set names unique for each customer",
+		Up: Statements(
+			// Number any duplicates, so the first keeps its name
+			`UPDATE systemsets ss SET name = ss.name || ' (' || ss.id || ')'
+				WHERE EXISTS (SELECT 1 FROM systemsets o
+					WHERE o.customerid = ss.customerid and lower(o.name) = lower(ss.name) and o.id < ss.id)`,
+			`CREATE UNIQUE INDEX IF NOT EXISTS systemsets_customerid_name_idx ON systemsets (customerid, lower(name))`,
+		),
+		Down: Statements(
+			`DROP INDEX IF EXISTS systemsets_customerid_name_idx`,
+		),
+	},
+	{
+		Version:     23,
+		Description: "Identify signers by the fingerprint of their certificate",
+		Up: Statements(
+			`ALTER TABLE signers ADD COLUMN IF NOT EXISTS fingerprint bytea`,
+			`CREATE UNIQUE INDEX IF NOT EXISTS signers_fingerprint_idx ON signers (fingerprint)`,
+			// Files whose every signature was invalid were mapped to their signers anyway
+			`DELETE FROM filetosignermap WHERE fileid IN (SELECT id FROM executablefiles WHERE signaturestatus = 3)`,
+		),
+		Down: Statements(
+			`DROP INDEX IF EXISTS signers_fingerprint_idx`,
+			`ALTER TABLE signers DROP COLUMN IF EXISTS fingerprint`,
+		),
+	},
+	{
+		Version:     24,
+		Description: "Make executable and catalog files unique by sha256",
+		Up:          uniqueFileHashes,
+		Down: Statements(
+			`DROP INDEX IF EXISTS catalogfiles_sha256_key`,
+			`DROP INDEX IF EXISTS executablefiles_sha256_key`,
+			`CREATE INDEX IF NOT EXISTS executablefiles_sha256_idx ON executablefiles (sha256)`,
+		),
+	},
+}
+
+// hasIndex returns true if the table has an index on exactly the columns, such as "fileid, systemid"
+func hasIndex(tx gorp.SqlExecutor, table string, columns string) (bool, error) {
+	count, err := tx.SelectInt("SELECT count(*) FROM pg_indexes WHERE tablename=$1 and indexdef LIKE $2",
+		table, "%("+columns+")")
+	return count != 0, err
+}
+
+// createIndex runs the statement to create an index, unless the table already has an index on the columns.
+// gorp made unique columns and composite keys indexes on tables it created.
+func createIndex(tx gorp.SqlExecutor, table string, columns string, statement string) error {
+	exists, err := hasIndex(tx, table, columns)
+	if err != nil || exists {
+		return err
+	}
+	_, err = tx.Exec(statement)
+	return err
+}
+
+// uniqueFileToSystemMap combines any rows for the same file and system, then makes them unique
+func uniqueFileToSystemMap(tx gorp.SqlExecutor) error {
+	exists, err := hasIndex(tx, "filetosystemmap", "fileid, systemid")
+	if err != nil || exists {
+		return err
+	}
+
+	duplicates, err := tx.SelectInt(`SELECT count(*) FROM (
+		SELECT 1 FROM filetosystemmap GROUP BY fileid, systemid HAVING count(*) > 1) d`)
+	if err != nil {
+		return err
+	}
+
+	if duplicates != 0 {
+		// Keep the path of the latest sighting, and the earliest and latest times
+		err = Statements(
+			`CREATE TEMP TABLE filetosystemmapcombined ON COMMIT DROP AS
+				SELECT DISTINCT ON (fileid, systemid) fileid, systemid, filepathid,
+					min(firstseen) OVER files AS firstseen, max(lastseen) OVER files AS lastseen
+				FROM filetosystemmap
+				WINDOW files AS (PARTITION BY fileid, systemid)
+				ORDER BY fileid, systemid, lastseen DESC`,
+			`DELETE FROM filetosystemmap`,
+			`INSERT INTO filetosystemmap (fileid, systemid, filepathid, firstseen, lastseen)
+				SELECT fileid, systemid, filepathid, firstseen, lastseen FROM filetosystemmapcombined`,
+		)(tx)
+		if err != nil {
+			return err
+		}
+	}
+
+	_, err = tx.Exec("ALTER TABLE filetosystemmap ADD CONSTRAINT filetosystemmap_fileid_systemid_key UNIQUE (fileid, systemid)")
+	return err
+}
+
+// uniqueFileHashes merges executable and catalog files that were added more than once for the same sha256 into the
+// first of them, then makes sha256 unique so new files can be added with ON CONFLICT
+func uniqueFileHashes(tx gorp.SqlExecutor) error {
+	return Statements(
+		`CREATE TEMP TABLE duplicatefiles ON COMMIT DROP AS
+			SELECT id, keepid FROM (
+				SELECT id, min(id) OVER (PARTITION BY sha256) AS keepid FROM executablefiles WHERE sha256 IS NOT NULL) f
+			WHERE id <> keepid`,
+		`CREATE TEMP TABLE duplicatecatalogs ON COMMIT DROP AS
+			SELECT id, keepid FROM (
+				SELECT id, min(id) OVER (PARTITION BY sha256) AS keepid FROM catalogfiles WHERE sha256 IS NOT NULL) c
+			WHERE id <> keepid`,
+
+		// Events just point at the file that is kept
+		`UPDATE processevents SET executablefileid = d.keepid FROM duplicatefiles d WHERE executablefileid = d.id`,
+		`UPDATE moduleloadevents SET executablefileid = d.keepid FROM duplicatefiles d WHERE executablefileid = d.id`,
+		`UPDATE driverloadevents SET executablefileid = d.keepid FROM duplicatefiles d WHERE executablefileid = d.id`,
+		`UPDATE certificatetrustlist SET fileid = d.keepid FROM duplicatefiles d WHERE fileid = d.id`,
+
+		// Tables keyed by the file are combined with what the kept file already has
+		`INSERT INTO filetosignermap (fileid, signerid)
+			SELECT DISTINCT d.keepid, m.signerid FROM filetosignermap m JOIN duplicatefiles d ON m.fileid = d.id
+			ON CONFLICT DO NOTHING`,
+		`DELETE FROM filetosignermap WHERE fileid IN (SELECT id FROM duplicatefiles)`,
+		`INSERT INTO filetocountersignermap (fileid, "timestamp", signerid)
+			SELECT DISTINCT ON (d.keepid, m.signerid) d.keepid, m."timestamp", m.signerid
+			FROM filetocountersignermap m JOIN duplicatefiles d ON m.fileid = d.id
+			ON CONFLICT DO NOTHING`,
+		`DELETE FROM filetocountersignermap WHERE fileid IN (SELECT id FROM duplicatefiles)`,
+		`INSERT INTO filetosystemmap (fileid, systemid, filepathid, firstseen, lastseen)
+			SELECT d.keepid, m.systemid, (array_agg(m.filepathid ORDER BY m.lastseen DESC))[1], min(m.firstseen), max(m.lastseen)
+			FROM filetosystemmap m JOIN duplicatefiles d ON m.fileid = d.id
+			GROUP BY d.keepid, m.systemid
+			ON CONFLICT (fileid, systemid) DO UPDATE SET
+				filepathid = CASE WHEN excluded.lastseen > filetosystemmap.lastseen THEN excluded.filepathid ELSE filetosystemmap.filepathid END,
+				firstseen = least(filetosystemmap.firstseen, excluded.firstseen),
+				lastseen = greatest(filetosystemmap.lastseen, excluded.lastseen)`,
+		`DELETE FROM filetosystemmap WHERE fileid IN (SELECT id FROM duplicatefiles)`,
+		`INSERT INTO processeventrollups (day, systemid, executablefileid, events, firstseen, lastseen)
+			SELECT r.day, r.systemid, d.keepid, sum(r.events), min(r.firstseen), max(r.lastseen)
+			FROM processeventrollups r JOIN duplicatefiles d ON r.executablefileid = d.id
+			GROUP BY r.day, r.systemid, d.keepid
+			ON CONFLICT (day, systemid, executablefileid) DO UPDATE SET
+				events = processeventrollups.events + excluded.events,
+				firstseen = least(processeventrollups.firstseen, excluded.firstseen),
+				lastseen = greatest(processeventrollups.lastseen, excluded.lastseen)`,
+		`DELETE FROM processeventrollups WHERE executablefileid IN (SELECT id FROM duplicatefiles)`,
+		`DELETE FROM executablefiles WHERE id IN (SELECT id FROM duplicatefiles)`,
+
+		// Catalog entries are keyed by the catalog and hash
+		`INSERT INTO certificatetrustlist (catalogid, hash, hashtype, fileid)
+			SELECT DISTINCT ON (d.keepid, l.hash) d.keepid, l.hash, l.hashtype, l.fileid
+			FROM certificatetrustlist l JOIN duplicatecatalogs d ON l.catalogid = d.id
+			ON CONFLICT DO NOTHING`,
+		`DELETE FROM certificatetrustlist WHERE catalogid IN (SELECT id FROM duplicatecatalogs)`,
+		`DELETE FROM catalogfiles WHERE id IN (SELECT id FROM duplicatecatalogs)`,
+
+		`DROP INDEX IF EXISTS executablefiles_sha256_idx`,
+		`CREATE UNIQUE INDEX IF NOT EXISTS executablefiles_sha256_key ON executablefiles (sha256)`,
+		`CREATE UNIQUE INDEX IF NOT EXISTS catalogfiles_sha256_key ON catalogfiles (sha256)`,
+	)(tx)
+}
@@ -17,7 +17,8 @@ import (
 	"github.com/coopernurse/gorp"
 )
 
-// InitDB initialize the database by creating the needed tables
+// InitDB connects to the database and maps the models to their tables.  The tables are created and kept up to date
+// by lib/migrations.
 func InitDB(ConnectionString string) (*gorp.DbMap, error) {
 	// Connect to db
 	db, err := sql.Open("postgres", ConnectionString)
@@ -25,16 +26,26 @@ func InitDB(ConnectionString string) (*gorp.DbMap, error) {
 		return nil, err
 	}
 
+	return NewDbMap(db), nil
+}
+
+// NewDbMap maps the models to their tables in the Postgres database
+func NewDbMap(db *sql.DB) *gorp.DbMap {
 	// Construct a gorp DbMap
 	dbmap := &gorp.DbMap{Db: db, Dialect: gorp.PostgresDialect{}}
 
 	// Add a table, setting the table
 	dbmap.AddTableWithName(SystemSet{}, "systemsets").SetKeys(true, "ID")
 	dbmap.AddTableWithName(System{}, "systems").SetKeys(true, "ID")
+	dbmap.AddTableWithName(SystemHistory{}, "systemhistory").SetKeys(true, "ID")
 	dbmap.AddTableWithName(RuleSet{}, "rulesets").SetKeys(true, "ID")
 	dbmap.AddTableWithName(Rule{}, "rules").SetKeys(true, "ID")
 
-	tbl := dbmap.AddTableWithName(ExecutableFile{}, "executablefiles").SetKeys(true, "ID")
+	tbl := dbmap.AddTableWithName(Policy{}, "policies").SetKeys(true, "ID")
+	tbl.ColMap("Hash").SetMaxSize(32)
+	tbl.ColMap("Hash").SetUnique(true)
+
+	tbl = dbmap.AddTableWithName(ExecutableFile{}, "executablefiles").SetKeys(true, "ID")
 	tbl.ColMap("Md5").SetMaxSize(32)
 	tbl.ColMap("Sha1").SetMaxSize(40)
 	tbl.ColMap("Sha256").SetMaxSize(64)
@@ -50,8 +61,19 @@ func InitDB(ConnectionString string) (*gorp.DbMap, error) {
 	dbmap.AddTableWithName(CertificateTrustList{}, "certificatetrustlist").SetKeys(false, "CatalogID", "Hash")
 
 	dbmap.AddTableWithName(ProcessEvent{}, "processevents").SetKeys(true, "ID")
+	dbmap.AddTableWithName(ProcessEventRollup{}, "processeventrollups").SetKeys(false, "Day", "SystemID", "ExecutableFileID")
+	dbmap.AddTableWithName(ModuleLoadEvent{}, "moduleloadevents").SetKeys(true, "ID")
+	dbmap.AddTableWithName(DriverLoadEvent{}, "driverloadevents").SetKeys(true, "ID")
 	dbmap.AddTableWithName(FileToSystemMap{}, "filetosystemmap").SetKeys(false, "FileID", "SystemID")
 
+	tbl = dbmap.AddTableWithName(FilePath{}, "filepaths").SetKeys(true, "ID")
+	tbl.ColMap("Hash").SetMaxSize(32)
+	tbl.ColMap("Hash").SetUnique(true)
+
+	tbl = dbmap.AddTableWithName(CommandLine{}, "commandlines").SetKeys(true, "ID")
+	tbl.ColMap("Hash").SetMaxSize(32)
+	tbl.ColMap("Hash").SetUnique(true)
+
 	tbl = dbmap.AddTableWithName(Customer{}, "customers").SetKeys(true, "ID")
 	tbl.ColMap("UUID").SetMaxSize(16)
 	tbl.ColMap("UUID").SetUnique(true)
@@ -66,13 +88,17 @@ func InitDB(ConnectionString string) (*gorp.DbMap, error) {
 
 	dbmap.AddTableWithName(Task{}, "tasks").SetKeys(true, "ID")
 
+	tbl = dbmap.AddTableWithName(AgentCertificate{}, "agentcertificates").SetKeys(true, "ID")
+	tbl.ColMap("Fingerprint").SetMaxSize(32)
+	tbl.ColMap("Fingerprint").SetUnique(true)
+
+	tbl = dbmap.AddTableWithName(RequestNonce{}, "requestnonces").SetKeys(false, "SystemID", "Nonce")
+	tbl.ColMap("Nonce").SetMaxSize(64)
+
 	dbmap.AddTableWithName(Updates{}, "updates").SetKeys(true, "ID")
 
-	// Create the tables
-	err = dbmap.CreateTablesIfNotExists()
-	if err != nil {
-		return nil, err
-	}
+	tbl = dbmap.AddTableWithName(FileUpload{}, "fileuploads").SetKeys(true, "ID")
+	tbl.ColMap("Sha256").SetMaxSize(64)
 
-	return dbmap, nil
+	return dbmap
 }
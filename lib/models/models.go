@@ -22,9 +22,28 @@ type SystemSet struct {
 	// One day other modes such as enforce but allow via prompt
 	SystemSetID int64 // Allows recursion
 
+	InheritMode     bool // Use the parent's Mode instead of our own
+	RuleInheritance int  // How our RuleSet is combined with the parent's, see RuleInheritance constants
+
+	LateAfter    int64 // Seconds without a check-in before a system is late, 0 for DefaultLateAfter
+	OfflineAfter int64 // Seconds without a check-in before a system is offline, 0 for DefaultOfflineAfter
+
 	CreationDate int64
 }
 
+// Defaults for how long a system may go without checking in
+const (
+	DefaultLateAfter    = 60 * 60      // An hour
+	DefaultOfflineAfter = 60 * 60 * 24 // A day
+)
+
+// RuleInheritance options for a SystemSet with a parent
+const (
+	RuleInheritancePrepend  = 0 // Our rules are checked first, then the parent's
+	RuleInheritanceOverride = 1 // Only our rules are used
+	RuleInheritanceInherit  = 2 // Only the parent's rules are used
+)
+
 // System is a computer with SREPP installed on it
 type System struct {
 	ID           int64
@@ -41,25 +60,112 @@ type System struct {
 	Arch         string
 	MachineName  string
 
+	IPAddresses  string // Comma separated, as last reported by the agent
+	LoggedOnUser string
+	LastBootTime int64
+
 	FirstSeen int64
 	LastSeen  int64
+
+	PolicyID      int64 // Policy the system should be running
+	AgentPolicyID int64 // Policy the agent last told us it is running
+
+	Secret        []byte // Key the agent signs its requests with, given out at registration
+	PendingSecret []byte // Key sent with RotateSecret, which replaces Secret once the agent signs with it
+
+	ProtocolVersion int    // Protocol version the agent last told us it speaks
+	Capabilities    string // Comma separated commands the agent last told us it supports
+
+	PredecessorID int64 // System this one replaced when the machine was re-imaged or the agent reinstalled, 0 if none
+	RetiredDate   int64 // When the system was replaced or retired by the user, 0 if it is in use
+
+	Status string // Status when the stale system check last looked at it, so we only alert when it changes
+}
+
+// System statuses, worked out from when we last heard from the system
+const (
+	SystemStatusOnline  = "online"
+	SystemStatusLate    = "late"
+	SystemStatusOffline = "offline"
+	SystemStatusRetired = "retired"
+)
+
+// SystemHistory records a change to a System's inventory, such as the agent being upgraded
+type SystemHistory struct {
+	ID         int64
+	SystemID   int64
+	ChangeTime int64
+	Field      string // Name of the System field that changed
+	OldValue   string
+	NewValue   string
+}
+
+// AgentCertificate is a client certificate our CA issued to an agent
+type AgentCertificate struct {
+	ID             int64
+	SystemID       int64
+	SerialNumber   []byte
+	Fingerprint    []byte // sha256 of the certificate, which is how it is found on each request
+	NotBefore      int64
+	NotAfter       int64
+	CreationDate   int64
+	RevocationDate int64 // 0 unless revoked
+}
+
+// RequestNonce remembers the nonces of signed agent requests so they can't be replayed
+type RequestNonce struct {
+	SystemID  int64
+	Nonce     string
+	Timestamp int64
 }
 
+// Task states
+const (
+	TaskStatePending      = 0 // Waiting to be handed to the agent
+	TaskStateDeployed     = 1 // Handed to the agent, waiting on a result
+	TaskStateAcknowledged = 2 // Agent reported success
+	TaskStateFailed       = 3 // Agent reported failure and we ran out of retries
+	TaskStateExpired      = 4 // Agent never responded, or the task was cancelled
+)
+
 // Task records commands for an agent
 type Task struct {
 	ID                  int64
 	SystemID            int64
 	CreationDate        int64
-	DeployedToAgentDate int64
+	DeployedToAgentDate int64 // Last time this was handed to the agent
 	Command             string
+
+	State          int
+	Attempts       int    // Number of times this has been handed to the agent
+	CompletionDate int64  // Time the agent reported back
+	Result         string // Result payload from the agent (json)
 }
 
 // RuleSet points to a linked list of Rules
 type RuleSet struct {
-	ID        int64
-	FirstRule int64
+	ID           int64
+	FirstRule    int64
+	DefaultAllow bool // Action taken when no rule matches
 }
 
+// Policy is a compiled RuleSet that is sent to agents.  The ID is used as the version.
+type Policy struct {
+	ID           int64
+	Hash         []byte // sha256 of Contents
+	Contents     string // json of the rules.CompiledPolicy
+	CreationDate int64
+}
+
+// Rule attribute types
+const (
+	RuleAttributeSha256        = "sha256"        // Hex encoded sha256 of the file
+	RuleAttributeSignerSubject = "signersubject" // Subject or short name of any signer of the file
+	RuleAttributeCompanyName   = "companyname"   // CompanyName from the file's version info
+	RuleAttributeProductName   = "productname"   // ProductName from the file's version info
+	RuleAttributePath          = "path"          // Glob of the path the process was started from
+)
+
 // Rule is member of the RuleSet
 type Rule struct {
 	ID             int64
@@ -84,11 +190,11 @@ type ExecutableFile struct {
 	Sha1   []byte
 	Sha256 []byte
 
-	CodeSectionSha256 []byte // TODO
+	CodeSectionSha256 []byte // Filled in by the worker, sha256 of the sections marked as code
 	Size              int    // Size in bytes
 	IsSigned          bool
 	FirstSeen         int64 // Time first seen anywhere
-	ExecutionType     int   // 1 = exe, 2 = dll, 4 = sys
+	ExecutionType     int   // ExecutionType flags of the ways it has been seen loaded
 
 	UploadDate int64 // 0 if we don't have a copy
 
@@ -111,9 +217,29 @@ type ExecutableFile struct {
 	FileVersion      string
 	OriginalFilename string
 
-	Architecture int // TODO 32, 64, or 1 (arm)
+	Architecture int // 32, 64, or 1 (arm)
+
+	SignatureStatus int // Result of checking the Authenticode signatures, see SignatureStatus constants
 }
 
+// ExecutionType flags of an ExecutableFile, as a file may be loaded more than one way
+const (
+	ExecutionTypeExe = 1 // Started as a process
+	ExecutionTypeDll = 2 // Loaded into a process
+	ExecutionTypeSys = 4 // Loaded as a driver
+)
+
+// SignatureStatus values of an ExecutableFile
+const (
+	SignatureStatusUnknown   = 0 // Not analyzed yet
+	SignatureStatusUnsigned  = 1 // No Authenticode signature in the file
+	SignatureStatusValid     = 2 // At least one signature is valid, trusted, and was made while its certificates were valid
+	SignatureStatusInvalid   = 3 // Signed, but no signature matches the file or checks out
+	SignatureStatusExpired   = 4 // Signature is valid and trusted, but was not time stamped while its certificates were valid
+	SignatureStatusCatalog   = 5 // No valid embedded signature, but the file is in a catalog with a valid signature
+	SignatureStatusUntrusted = 6 // Signature is valid, but its chain doesn't lead to a trusted root
+)
+
 // ProcessEvent is tied to a system
 type ProcessEvent struct {
 	ID               int64
@@ -121,20 +247,72 @@ type ProcessEvent struct {
 	ExecutableFileID int64
 	PID              int64
 	PPID             int64
-	FilePath         string // TODO MAYBE Normalize into own table
-	CommandLine      string // TODO MAYBE Normalize into own table
+	FilePathID       int64 // 0 if the agent didn't send a path
+	CommandLineID    int64 // 0 if the agent didn't send a command line
+	EventTime        int64 // When the process started
+	State            int   // See ProcessState constants
+	EndTime          int64 // When the process exited, 0 if it hasn't
+	ExitCode         int64
+}
+
+// ProcessState values of a ProcessEvent
+const (
+	ProcessStateUnknown = 0 // Recorded before agents reported process exits
+	ProcessStateRunning = 1
+	ProcessStateExited  = 2
+)
+
+// ProcessEventRollup counts the times a file ran on a system in a day (UTC), for process events that have expired
+type ProcessEventRollup struct {
+	Day              int64 // Unix time of the start of the day
+	SystemID         int64
+	ExecutableFileID int64
+	Events           int64
+	FirstSeen        int64
+	LastSeen         int64
+}
+
+// ModuleLoadEvent is a DLL being loaded into a process
+type ModuleLoadEvent struct {
+	ID               int64
+	SystemID         int64
+	ExecutableFileID int64 // The DLL
+	ProcessEventID   int64 // Process it was loaded into, 0 if we don't have its ProcessEvent
+	PID              int64
+	FilePathID       int64
 	EventTime        int64
-	State            int
+}
+
+// DriverLoadEvent is a driver being loaded into the kernel
+type DriverLoadEvent struct {
+	ID               int64
+	SystemID         int64
+	ExecutableFileID int64
+	FilePathID       int64
+	EventTime        int64
+}
+
+// FilePath is a canonical path (see utils.CanonicalizePath), which is stored once and referred to by its ID
+type FilePath struct {
+	ID   int64
+	Hash []byte // sha256 of the Path, which is how it is looked up
+	Path string
+}
+
+// CommandLine is a process's command line, which is stored once and referred to by its ID
+type CommandLine struct {
+	ID          int64
+	Hash        []byte // sha256 of the CommandLine, which is how it is looked up
+	CommandLine string
 }
 
 // FileToSystemMap maps executables to systems so we don't need to search through the ProcessEvent table
 type FileToSystemMap struct {
-	FileID   int64 // TODO Need to set unique on (FileID, SystemID)
-	SystemID int64
-	FilePath string // TODO MAYBE Normalize and match this up with ProcessEvent
-	// FilePath is the path where it was last seen
-	FirstSeen int64
-	LastSeen  int64
+	FileID     int64 // Unique with SystemID
+	SystemID   int64
+	FilePathID int64 // Path where it was last seen
+	FirstSeen  int64
+	LastSeen   int64
 }
 
 // FileToSignerMap is for the one to many relationship
@@ -162,7 +340,11 @@ type Signer struct {
 	DigestAlgorithm                  string
 	DigestEncryptionAlgorithm        string
 	DigestEncryptionAlgorithmKeySize int
-	IssuerID                         int64 // Parent in trust chain
+	IssuerID                         int64  // Parent in trust chain
+	Issuer                           string // Issuer's name
+	NotBefore                        int64
+	NotAfter                         int64
+	Fingerprint                      []byte // sha256 of the certificate, which identifies it.  Signers recorded before it was kept have none.
 }
 
 // CatalogFile is catalog file that authenticates executables
@@ -180,8 +362,9 @@ type CatalogFile struct {
 	//
 	// Data inserted by worker
 	//
-	AnalysisDate int64 // 0 if we haven't analyzed it yet
-	SignerID     int64
+	AnalysisDate    int64 // 0 if we haven't analyzed it yet
+	SignerID        int64
+	SignatureStatus int // Result of checking the catalog's signature, see SignatureStatus constants
 }
 
 // CertificateTrustList is a mapping that is extracted from catalog files of SignerID's to hashes.
@@ -193,6 +376,19 @@ type CertificateTrustList struct {
 	FileID    int64  // Will be 0 until a match is found
 }
 
+// FileUpload tracks a chunked upload from an agent so it can be resumed after a dropped connection
+type FileUpload struct {
+	ID           int64
+	SystemID     int64
+	Sha256       []byte
+	Size         int64
+	FileType     string // "exe" or "catalog"
+	Offset       int64  // Bytes received and committed to disk
+	HashState    []byte // Marshaled sha256 state after Offset bytes, so hashing can continue where it left off
+	CreationDate int64
+	LastUpdate   int64
+}
+
 // Updates is a mapping of what versions agents can update to
 type Updates struct {
 	ID          int64
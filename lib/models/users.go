@@ -23,6 +23,9 @@ type Customer struct {
 
 	Active       bool // In case we want to disable the customer
 	CreationDate int64
+
+	ProcessEventRetention int64 // Days process events are kept, 0 to use the server's default
+	ArchiveProcessEvents  bool  // Write process events to the archive store before they are removed
 }
 
 // User of the webapp
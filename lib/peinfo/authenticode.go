@@ -0,0 +1,71 @@
+////////////////////////////////////////////////////////////////////////////
+//
+// Summit Route End Point Protection
+//
+// This source code is licensed under the BSD-style license found in the
+// LICENSE file in the root directory of this source tree.
+//
+/////////////////////////////////////////////////////////////////////////////
+
+package peinfo
+
+import (
+	"crypto"
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"hash"
+	"io"
+)
+
+// authenticodeHash hashes the file the way Authenticode does, which is the whole file
+// except for the CheckSum, the security directory entry, and the certificate table itself.
+func authenticodeHash(contents []byte, fileLayout *layout, hashers ...hash.Hash) {
+	writers := make([]io.Writer, len(hashers))
+	for i, hasher := range hashers {
+		writers[i] = hasher
+	}
+	writer := io.MultiWriter(writers...)
+
+	end := int64(len(contents))
+	if fileLayout.certificatesOffset != 0 {
+		end = fileLayout.certificatesOffset
+	}
+
+	writer.Write(contents[:fileLayout.checksumOffset])
+	writer.Write(contents[fileLayout.checksumOffset+4 : fileLayout.securityDirOffset])
+	writer.Write(contents[fileLayout.securityDirOffset+8 : end])
+	if fileLayout.certificatesOffset != 0 {
+		writer.Write(contents[fileLayout.certificatesOffset+fileLayout.certificatesSize:])
+	}
+}
+
+// authenticodeHashes returns the md5, sha1, and sha256 Authenticode hashes
+func authenticodeHashes(contents []byte, fileLayout *layout) (md5Hash, sha1Hash, sha256Hash []byte) {
+	md5Hasher := md5.New()
+	sha1Hasher := sha1.New()
+	sha256Hasher := sha256.New()
+	authenticodeHash(contents, fileLayout, md5Hasher, sha1Hasher, sha256Hasher)
+
+	return md5Hasher.Sum(nil), sha1Hasher.Sum(nil), sha256Hasher.Sum(nil)
+}
+
+// AuthenticodeHash returns the Authenticode hash using the given algorithm, or nil if the algorithm is not available.
+// Signatures may use algorithms other than the three we store.
+func (info *Info) AuthenticodeHash(algorithm crypto.Hash) []byte {
+	switch algorithm {
+	case crypto.MD5:
+		return info.AuthenticodeMd5
+	case crypto.SHA1:
+		return info.AuthenticodeSha1
+	case crypto.SHA256:
+		return info.AuthenticodeSha256
+	}
+
+	if !algorithm.Available() || info.contents == nil {
+		return nil
+	}
+	hasher := algorithm.New()
+	authenticodeHash(info.contents, info.layout, hasher)
+	return hasher.Sum(nil)
+}
@@ -0,0 +1,203 @@
+////////////////////////////////////////////////////////////////////////////
+//
+// Summit Route End Point Protection
+//
+// This source code is licensed under the BSD-style license found in the
+// LICENSE file in the root directory of this source tree.
+//
+/////////////////////////////////////////////////////////////////////////////
+
+package peinfo
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"debug/pe"
+	"encoding/binary"
+	"fmt"
+)
+
+// Architecture values stored on models.ExecutableFile
+const (
+	ArchitectureUnknown = 0
+	ArchitectureARM     = 1
+	Architecture32      = 32
+	Architecture64      = 64
+)
+
+// Data directory indexes we care about
+const (
+	directoryResource = 2
+	directorySecurity = 4
+)
+
+// sectionCode is IMAGE_SCN_CNT_CODE
+const sectionCode = 0x00000020
+
+// Info is what we learn from parsing a PE file
+type Info struct {
+	Architecture      int
+	CodeSectionSha256 []byte
+
+	// Authenticode hashes
+	AuthenticodeMd5    []byte
+	AuthenticodeSha1   []byte
+	AuthenticodeSha256 []byte
+
+	// Strings from the VERSIONINFO resource, keyed by their name such as "CompanyName"
+	VersionInfo map[string]string
+
+	// Certificates is the raw certificate table (WIN_CERTIFICATE entries) from the security directory.
+	// It is nil if the file is not signed.
+	Certificates []byte
+
+	// Kept so other Authenticode hash algorithms can be computed
+	contents []byte
+	layout   *layout
+}
+
+// layout records where the fields that Authenticode skips are located in the file
+type layout struct {
+	checksumOffset     int64 // Offset of the CheckSum field in the optional header
+	securityDirOffset  int64 // Offset of the security data directory entry
+	certificatesOffset int64 // File offset of the certificate table, 0 if there isn't one
+	certificatesSize   int64
+}
+
+// Parse reads the PE file contents
+func Parse(contents []byte) (*Info, error) {
+	f, err := pe.NewFile(bytes.NewReader(contents))
+	if err != nil {
+		return nil, fmt.Errorf("Unable to parse PE: %v", err)
+	}
+	defer f.Close()
+
+	info := &Info{
+		Architecture: getArchitecture(f.FileHeader.Machine),
+		VersionInfo:  map[string]string{},
+	}
+
+	fileLayout, err := getLayout(contents, f)
+	if err != nil {
+		return nil, err
+	}
+
+	info.contents = contents
+	info.layout = fileLayout
+	info.AuthenticodeMd5, info.AuthenticodeSha1, info.AuthenticodeSha256 = authenticodeHashes(contents, fileLayout)
+
+	if fileLayout.certificatesOffset != 0 {
+		info.Certificates = contents[fileLayout.certificatesOffset : fileLayout.certificatesOffset+fileLayout.certificatesSize]
+	}
+
+	info.CodeSectionSha256, err = codeSectionSha256(f)
+	if err != nil {
+		return nil, err
+	}
+
+	resources, err := getResourceDirectory(f)
+	if err != nil {
+		return nil, err
+	}
+	if resources != nil {
+		// Bad version info shouldn't stop us from recording everything else
+		versionInfo, err := readVersionInfo(resources.data, resources.virtualAddress)
+		if err == nil {
+			info.VersionInfo = versionInfo
+		}
+	}
+
+	return info, nil
+}
+
+// getArchitecture converts the machine type from the file header
+func getArchitecture(machine uint16) int {
+	switch machine {
+	case pe.IMAGE_FILE_MACHINE_I386:
+		return Architecture32
+	case pe.IMAGE_FILE_MACHINE_AMD64:
+		return Architecture64
+	case pe.IMAGE_FILE_MACHINE_ARM, pe.IMAGE_FILE_MACHINE_ARMNT, 0xaa64: // 0xaa64 is ARM64
+		return ArchitectureARM
+	}
+	return ArchitectureUnknown
+}
+
+// getDataDirectory returns the data directory entry at the index
+func getDataDirectory(f *pe.File, index int) (pe.DataDirectory, bool) {
+	switch header := f.OptionalHeader.(type) {
+	case *pe.OptionalHeader32:
+		if uint32(index) < header.NumberOfRvaAndSizes {
+			return header.DataDirectory[index], true
+		}
+	case *pe.OptionalHeader64:
+		if uint32(index) < header.NumberOfRvaAndSizes {
+			return header.DataDirectory[index], true
+		}
+	}
+	return pe.DataDirectory{}, false
+}
+
+// getLayout finds the offsets of the fields that are skipped when computing the Authenticode hash
+func getLayout(contents []byte, f *pe.File) (*layout, error) {
+	if len(contents) < 0x40 {
+		return nil, fmt.Errorf("File too small to be a PE")
+	}
+
+	// The optional header follows the "PE\0\0" signature and the file header
+	optionalHeaderOffset := int64(binary.LittleEndian.Uint32(contents[0x3c:])) + 4 + 20
+
+	var dataDirectoryOffset int64
+	switch f.OptionalHeader.(type) {
+	case *pe.OptionalHeader32:
+		dataDirectoryOffset = optionalHeaderOffset + 96
+	case *pe.OptionalHeader64:
+		dataDirectoryOffset = optionalHeaderOffset + 112
+	default:
+		return nil, fmt.Errorf("PE has no optional header")
+	}
+
+	fileLayout := &layout{
+		checksumOffset:    optionalHeaderOffset + 64,
+		securityDirOffset: dataDirectoryOffset + directorySecurity*8,
+	}
+	if fileLayout.securityDirOffset+8 > int64(len(contents)) {
+		return nil, fmt.Errorf("PE headers are truncated")
+	}
+
+	// The security directory uses a file offset, not an RVA
+	security, ok := getDataDirectory(f, directorySecurity)
+	if ok && security.VirtualAddress != 0 && security.Size != 0 {
+		start := int64(security.VirtualAddress)
+		end := start + int64(security.Size)
+		if start < fileLayout.securityDirOffset+8 || end > int64(len(contents)) {
+			return nil, fmt.Errorf("Security directory is outside of the file")
+		}
+		fileLayout.certificatesOffset = start
+		fileLayout.certificatesSize = int64(security.Size)
+	}
+
+	return fileLayout, nil
+}
+
+// codeSectionSha256 hashes the raw data of every section marked as containing code
+func codeSectionSha256(f *pe.File) ([]byte, error) {
+	hasher := sha256.New()
+	found := false
+	for _, section := range f.Sections {
+		if section.Characteristics&sectionCode == 0 {
+			continue
+		}
+		data, err := section.Data()
+		if err != nil {
+			return nil, fmt.Errorf("Unable to read section %s: %v", section.Name, err)
+		}
+		hasher.Write(data)
+		found = true
+	}
+
+	if !found {
+		return nil, nil
+	}
+	return hasher.Sum(nil), nil
+}
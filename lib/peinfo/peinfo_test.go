@@ -0,0 +1,201 @@
+////////////////////////////////////////////////////////////////////////////
+//
+// Summit Route End Point Protection
+//
+// This source code is licensed under the BSD-style license found in the
+// LICENSE file in the root directory of this source tree.
+//
+/////////////////////////////////////////////////////////////////////////////
+
+package peinfo
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/sha256"
+	_ "crypto/sha512" // For the hash that isn't stored
+	"encoding/binary"
+	"io/ioutil"
+	"testing"
+)
+
+// tiny.exe is a hand built 32 bit PE with a .text section holding "xor eax, eax; ret", a .rsrc section holding a
+// VERSIONINFO, and a certificate table that isn't a real signature.  These are where its parts are.
+const (
+	tinyChecksumOffset     = 0x98
+	tinySecurityDirOffset  = 0xd8
+	tinyTextOffset         = 0x200
+	tinyTextSize           = 0x200
+	tinyResourceOffset     = 0x400
+	tinyVersionInfoOffset  = 0x458
+	tinyCertificatesOffset = 0x600
+)
+
+// readTiny returns a copy of tiny.exe, which the test may change
+func readTiny(t *testing.T) []byte {
+	contents, err := ioutil.ReadFile("testdata/tiny.exe")
+	if err != nil {
+		t.Fatalf("Unable to read test file, %v", err)
+	}
+	return contents
+}
+
+func TestParse(t *testing.T) {
+	contents := readTiny(t)
+
+	info, err := Parse(contents)
+	if err != nil {
+		t.Fatalf("Parse failed, %v", err)
+	}
+
+	if info.Architecture != Architecture32 {
+		t.Errorf("Architecture = %d, want %d", info.Architecture, Architecture32)
+	}
+
+	codeHash := sha256.Sum256(contents[tinyTextOffset : tinyTextOffset+tinyTextSize])
+	if !bytes.Equal(info.CodeSectionSha256, codeHash[:]) {
+		t.Errorf("CodeSectionSha256 = %x, want %x", info.CodeSectionSha256, codeHash)
+	}
+
+	if !bytes.Equal(info.Certificates, contents[tinyCertificatesOffset:]) {
+		t.Errorf("Certificates = %x, want %x", info.Certificates, contents[tinyCertificatesOffset:])
+	}
+
+	if len(info.AuthenticodeMd5) != 16 || len(info.AuthenticodeSha1) != 20 || len(info.AuthenticodeSha256) != 32 {
+		t.Errorf("Authenticode hashes have the wrong lengths")
+	}
+
+	want := map[string]string{
+		"CompanyName":     "Summit Route Test",
+		"ProductName":     "Tiny",
+		"FileDescription": "Test file",
+		"FileVersion":     "1.2.3.4",
+	}
+	for key, value := range want {
+		if info.VersionInfo[key] != value {
+			t.Errorf("VersionInfo[%s] = %q, want %q", key, info.VersionInfo[key], value)
+		}
+	}
+	if len(info.VersionInfo) != len(want) {
+		t.Errorf("VersionInfo = %v, want %v", info.VersionInfo, want)
+	}
+}
+
+func TestAuthenticodeHash(t *testing.T) {
+	contents := readTiny(t)
+	info, err := Parse(contents)
+	if err != nil {
+		t.Fatalf("Parse failed, %v", err)
+	}
+
+	if !bytes.Equal(info.AuthenticodeHash(crypto.SHA256), info.AuthenticodeSha256) {
+		t.Errorf("AuthenticodeHash(SHA256) doesn't match AuthenticodeSha256")
+	}
+	if len(info.AuthenticodeHash(crypto.SHA512)) != 64 {
+		t.Errorf("AuthenticodeHash(SHA512) = %x, want a sha512", info.AuthenticodeHash(crypto.SHA512))
+	}
+
+	// The checksum and the certificates change when a file is signed, so they aren't hashed
+	signed := readTiny(t)
+	binary.LittleEndian.PutUint32(signed[tinyChecksumOffset:], 0xdeadbeef)
+	copy(signed[tinyCertificatesOffset+8:], "OTHERSIG")
+	signedInfo, err := Parse(signed)
+	if err != nil {
+		t.Fatalf("Parse of changed checksum and certificates failed, %v", err)
+	}
+	if !bytes.Equal(signedInfo.AuthenticodeSha256, info.AuthenticodeSha256) {
+		t.Errorf("Authenticode hash changed with the checksum and certificates")
+	}
+
+	// The code is hashed
+	patched := readTiny(t)
+	patched[tinyTextOffset] = 0x90
+	patchedInfo, err := Parse(patched)
+	if err != nil {
+		t.Fatalf("Parse of changed code failed, %v", err)
+	}
+	if bytes.Equal(patchedInfo.AuthenticodeSha256, info.AuthenticodeSha256) {
+		t.Errorf("Authenticode hash didn't change with the code")
+	}
+}
+
+func TestParseMalformed(t *testing.T) {
+	tests := []struct {
+		name   string
+		change func([]byte) []byte
+	}{
+		{"empty", func(contents []byte) []byte { return nil }},
+		{"only the DOS header", func(contents []byte) []byte { return contents[:0x40] }},
+		{"truncated headers", func(contents []byte) []byte { return contents[:0xc0] }},
+		{"truncated code section", func(contents []byte) []byte { return contents[:tinyTextOffset+0x10] }},
+		{"truncated resource section", func(contents []byte) []byte { return contents[:tinyResourceOffset+0x10] }},
+		{"not MZ", func(contents []byte) []byte {
+			contents[0] = 'X'
+			return contents
+		}},
+		{"PE header outside of the file", func(contents []byte) []byte {
+			binary.LittleEndian.PutUint32(contents[0x3c:], 0x7ffffff0)
+			return contents
+		}},
+		{"certificates outside of the file", func(contents []byte) []byte {
+			binary.LittleEndian.PutUint32(contents[tinySecurityDirOffset+4:], 0x1000)
+			return contents
+		}},
+		{"certificates overlapping the headers", func(contents []byte) []byte {
+			binary.LittleEndian.PutUint32(contents[tinySecurityDirOffset:], 0x10)
+			return contents
+		}},
+	}
+
+	for _, test := range tests {
+		if _, err := Parse(test.change(readTiny(t))); err == nil {
+			t.Errorf("%s: Parse succeeded", test.name)
+		}
+	}
+}
+
+func TestParseBadVersionInfo(t *testing.T) {
+	tests := []struct {
+		name   string
+		change func([]byte)
+	}{
+		{"wrong key", func(contents []byte) {
+			contents[tinyVersionInfoOffset+6] = 'X'
+		}},
+		{"bad length", func(contents []byte) {
+			binary.LittleEndian.PutUint16(contents[tinyVersionInfoOffset:], 0xffff)
+		}},
+		{"data entry outside of the section", func(contents []byte) {
+			binary.LittleEndian.PutUint32(contents[tinyResourceOffset+0x48:], 0x9000)
+		}},
+		{"directory loop", func(contents []byte) {
+			binary.LittleEndian.PutUint32(contents[tinyResourceOffset+0x14:], 0x80000000)
+		}},
+	}
+
+	// Bad version info is skipped, so the rest of the file is still recorded
+	for _, test := range tests {
+		contents := readTiny(t)
+		test.change(contents)
+		info, err := Parse(contents)
+		if err != nil {
+			t.Errorf("%s: Parse failed, %v", test.name, err)
+			continue
+		}
+		if len(info.VersionInfo) != 0 {
+			t.Errorf("%s: VersionInfo = %v, want none", test.name, info.VersionInfo)
+		}
+		if info.CodeSectionSha256 == nil {
+			t.Errorf("%s: CodeSectionSha256 missing", test.name)
+		}
+	}
+}
+
+func TestParseTruncated(t *testing.T) {
+	contents := readTiny(t)
+
+	// However the file is cut short, Parse mustn't panic
+	for length := 0; length < len(contents); length++ {
+		Parse(contents[:length])
+	}
+}
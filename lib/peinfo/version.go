@@ -0,0 +1,226 @@
+////////////////////////////////////////////////////////////////////////////
+//
+// Summit Route End Point Protection
+//
+// This source code is licensed under the BSD-style license found in the
+// LICENSE file in the root directory of this source tree.
+//
+/////////////////////////////////////////////////////////////////////////////
+
+package peinfo
+
+import (
+	"debug/pe"
+	"encoding/binary"
+	"fmt"
+	"strings"
+	"unicode/utf16"
+)
+
+// rtVersion is the resource type of VERSIONINFO
+const rtVersion = 16
+
+// maxResourceDepth is the depth of the type, name, language tree
+const maxResourceDepth = 3
+
+// resourceDirectory is the contents of the section holding the resources
+type resourceDirectory struct {
+	data           []byte // Section data, starting at the root resource directory
+	virtualAddress uint32 // RVA of data[0]
+}
+
+// getResourceDirectory returns the resource data, or nil if the file has none
+func getResourceDirectory(f *pe.File) (*resourceDirectory, error) {
+	directory, ok := getDataDirectory(f, directoryResource)
+	if !ok || directory.VirtualAddress == 0 || directory.Size == 0 {
+		return nil, nil
+	}
+
+	for _, section := range f.Sections {
+		if directory.VirtualAddress < section.VirtualAddress ||
+			directory.VirtualAddress >= section.VirtualAddress+section.Size {
+			continue
+		}
+
+		data, err := section.Data()
+		if err != nil {
+			return nil, fmt.Errorf("Unable to read resource section: %v", err)
+		}
+		offset := directory.VirtualAddress - section.VirtualAddress
+		return &resourceDirectory{
+			data:           data[offset:],
+			virtualAddress: directory.VirtualAddress,
+		}, nil
+	}
+
+	return nil, fmt.Errorf("Resource directory is not in any section")
+}
+
+// findVersionResource walks the resource tree to the first VERSIONINFO data entry and returns its contents
+func findVersionResource(data []byte, virtualAddress uint32) ([]byte, error) {
+	offset := uint32(0)
+	for depth := 0; depth < maxResourceDepth; depth++ {
+		if int(offset)+16 > len(data) {
+			return nil, fmt.Errorf("Resource directory is truncated")
+		}
+		numNamed := uint32(binary.LittleEndian.Uint16(data[offset+12:]))
+		numIDs := uint32(binary.LittleEndian.Uint16(data[offset+14:]))
+
+		next := uint32(0)
+		for i := uint32(0); i < numNamed+numIDs; i++ {
+			entry := offset + 16 + i*8
+			if int(entry)+8 > len(data) {
+				return nil, fmt.Errorf("Resource directory entry is truncated")
+			}
+			name := binary.LittleEndian.Uint32(data[entry:])
+			target := binary.LittleEndian.Uint32(data[entry+4:])
+
+			// At the top level only the VERSIONINFO type is of interest, below it take the first entry
+			if depth == 0 && (i < numNamed || name != rtVersion) {
+				continue
+			}
+			next = target
+			break
+		}
+
+		if next == 0 {
+			return nil, nil
+		}
+
+		if next&0x80000000 == 0 {
+			// Data entry: RVA, Size, CodePage, Reserved
+			if int(next)+8 > len(data) {
+				return nil, fmt.Errorf("Resource data entry is truncated")
+			}
+			rva := binary.LittleEndian.Uint32(data[next:])
+			size := binary.LittleEndian.Uint32(data[next+4:])
+			if rva < virtualAddress || uint64(rva-virtualAddress)+uint64(size) > uint64(len(data)) {
+				return nil, fmt.Errorf("Version resource is outside of the resource section")
+			}
+			return data[rva-virtualAddress : rva-virtualAddress+size], nil
+		}
+		offset = next & 0x7fffffff
+	}
+
+	return nil, fmt.Errorf("Resource directory is too deep")
+}
+
+// versionBlock is one of the nested structures in a VERSIONINFO resource
+type versionBlock struct {
+	key      string
+	value    []byte
+	children []byte
+}
+
+// align4 rounds up to a multiple of 4
+func align4(n int) int {
+	return (n + 3) &^ 3
+}
+
+// decodeUTF16 converts little endian UTF-16 to a string, stopping at the first NUL
+func decodeUTF16(data []byte) string {
+	chars := make([]uint16, 0, len(data)/2)
+	for i := 0; i+1 < len(data); i += 2 {
+		c := binary.LittleEndian.Uint16(data[i:])
+		if c == 0 {
+			break
+		}
+		chars = append(chars, c)
+	}
+	return string(utf16.Decode(chars))
+}
+
+// readVersionBlock parses the header of a block: wLength, wValueLength, wType, szKey, Value, Children
+func readVersionBlock(data []byte) (*versionBlock, int, error) {
+	if len(data) < 6 {
+		return nil, 0, fmt.Errorf("Version block is truncated")
+	}
+	length := int(binary.LittleEndian.Uint16(data[0:]))
+	valueLength := int(binary.LittleEndian.Uint16(data[2:]))
+	valueType := binary.LittleEndian.Uint16(data[4:])
+	if length < 6 || length > len(data) {
+		return nil, 0, fmt.Errorf("Version block has a bad length")
+	}
+	data = data[:length]
+
+	// Key is a NUL terminated UTF-16 string
+	pos := 6
+	for pos+1 < len(data) && (data[pos] != 0 || data[pos+1] != 0) {
+		pos += 2
+	}
+	block := &versionBlock{key: decodeUTF16(data[6:pos])}
+	pos = align4(pos + 2)
+
+	// Text values have their length given in characters
+	if valueType == 1 {
+		valueLength *= 2
+	}
+	if pos+valueLength > len(data) {
+		valueLength = len(data) - pos
+	}
+	if valueLength > 0 {
+		block.value = data[pos : pos+valueLength]
+		pos = align4(pos + valueLength)
+	}
+
+	if pos < len(data) {
+		block.children = data[pos:]
+	}
+	return block, length, nil
+}
+
+// eachVersionBlock calls fn on each of the blocks in the children data
+func eachVersionBlock(data []byte, fn func(*versionBlock)) error {
+	for len(data) >= 6 {
+		block, length, err := readVersionBlock(data)
+		if err != nil {
+			return err
+		}
+		fn(block)
+
+		length = align4(length)
+		if length >= len(data) {
+			break
+		}
+		data = data[length:]
+	}
+	return nil
+}
+
+// readVersionInfo returns the strings from the StringFileInfo of the VERSIONINFO resource
+func readVersionInfo(data []byte, virtualAddress uint32) (map[string]string, error) {
+	versionInfo := map[string]string{}
+
+	resource, err := findVersionResource(data, virtualAddress)
+	if err != nil || resource == nil {
+		return versionInfo, err
+	}
+
+	root, _, err := readVersionBlock(resource)
+	if err != nil {
+		return versionInfo, err
+	}
+	if root.key != "VS_VERSION_INFO" {
+		return versionInfo, fmt.Errorf("Unexpected version info key %s", root.key)
+	}
+
+	var blockErr error
+	err = eachVersionBlock(root.children, func(fileInfo *versionBlock) {
+		if fileInfo.key != "StringFileInfo" {
+			return
+		}
+		// StringFileInfo holds a StringTable per language, which holds the strings
+		blockErr = eachVersionBlock(fileInfo.children, func(table *versionBlock) {
+			eachVersionBlock(table.children, func(str *versionBlock) {
+				if _, exists := versionInfo[str.key]; !exists {
+					versionInfo[str.key] = strings.TrimSpace(decodeUTF16(str.value))
+				}
+			})
+		})
+	})
+	if err == nil {
+		err = blockErr
+	}
+
+	return versionInfo, err
+}
@@ -0,0 +1,162 @@
+////////////////////////////////////////////////////////////////////////////
+//
+// Summit Route End Point Protection
+//
+// This source code is licensed under the BSD-style license found in the
+// LICENSE file in the root directory of this source tree.
+//
+/////////////////////////////////////////////////////////////////////////////
+
+package retention
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/coopernurse/gorp"
+
+	"qdserver/lib/storage"
+	"qdserver/lib/utils"
+)
+
+// ArchivedProcessEvent is one line of an archive, with the IDs of other tables replaced by what they refer to
+type ArchivedProcessEvent struct {
+	ID          int64
+	SystemUUID  string
+	MachineName string
+	Sha256      string
+	FilePath    string
+	CommandLine string
+	PID         int64
+	PPID        int64
+	EventTime   int64
+	State       int
+	EndTime     int64
+	ExitCode    int64
+}
+
+// archiveRow is what is read from the database for each ArchivedProcessEvent
+type archiveRow struct {
+	ID          int64
+	SystemUUID  []byte
+	MachineName string
+	Sha256      []byte
+	FilePath    string
+	CommandLine string
+	PID         int64
+	PPID        int64
+	EventTime   int64
+	State       int
+	EndTime     int64
+	ExitCode    int64
+}
+
+// ArchiveKey returns the key an archive of a customer's process events for a day is stored under.  The time it was
+// written is included, as events that arrive late are archived separately.
+func ArchiveKey(customerUUID string, day int64, written int64) string {
+	date := time.Unix(day, 0).UTC()
+	return fmt.Sprintf("processevents/%s/%s/%s-%d.json.gz", customerUUID, date.Format("2006/01"), date.Format("2006-01-02"), written)
+}
+
+// archiveDays returns the start of each day the customer has process events for in the table
+func archiveDays(tx gorp.SqlExecutor, table string, customerID int64) ([]int64, error) {
+	type dayRow struct {
+		Day int64
+	}
+
+	var rows []dayRow
+	_, err := tx.Select(&rows, fmt.Sprintf(`SELECT DISTINCT pe.EventTime - pe.EventTime %% %d as Day
+		FROM %s pe, systems s, systemsets ss
+		WHERE pe.SystemID = s.ID and s.SystemSetID = ss.ID and ss.CustomerID = $1
+		ORDER BY Day`, SecondsPerDay, table), customerID)
+	if err != nil {
+		return nil, err
+	}
+
+	days := make([]int64, len(rows))
+	for i, row := range rows {
+		days[i] = row.Day
+	}
+	return days, nil
+}
+
+// archiveDay writes the customer's process events for the day in the table to the store, as gzipped JSON, one event
+// per line
+func archiveDay(tx gorp.SqlExecutor, store storage.Store, table string, customer *customerRetention, day int64, now int64) error {
+	var rows []archiveRow
+	_, err := tx.Select(&rows, fmt.Sprintf(`SELECT
+		pe.ID, s.SystemUUID, s.MachineName, e.Sha256,
+		coalesce(fp.Path, '') as FilePath, coalesce(cl.CommandLine, '') as CommandLine,
+		pe.PID, pe.PPID, pe.EventTime, pe.State, pe.EndTime, pe.ExitCode
+		FROM %s pe
+		JOIN systems s ON s.ID = pe.SystemID
+		JOIN systemsets ss ON ss.ID = s.SystemSetID
+		LEFT JOIN executablefiles e ON e.ID = pe.ExecutableFileID
+		LEFT JOIN filepaths fp ON fp.ID = pe.FilePathID
+		LEFT JOIN commandlines cl ON cl.ID = pe.CommandLineID
+		WHERE ss.CustomerID = $1 and pe.EventTime >= $2 and pe.EventTime < $3
+		ORDER BY pe.EventTime, pe.ID`, table), customer.ID, day, day+SecondsPerDay)
+	if err != nil {
+		return err
+	}
+	if len(rows) == 0 {
+		return nil
+	}
+
+	var buffer bytes.Buffer
+	writer := gzip.NewWriter(&buffer)
+	encoder := json.NewEncoder(writer)
+	for _, row := range rows {
+		systemUUID, err := utils.ByteArrayToUUIDString(row.SystemUUID)
+		if err != nil {
+			return err
+		}
+
+		err = encoder.Encode(ArchivedProcessEvent{
+			ID:          row.ID,
+			SystemUUID:  systemUUID,
+			MachineName: row.MachineName,
+			Sha256:      hex.EncodeToString(row.Sha256),
+			FilePath:    row.FilePath,
+			CommandLine: row.CommandLine,
+			PID:         row.PID,
+			PPID:        row.PPID,
+			EventTime:   row.EventTime,
+			State:       row.State,
+			EndTime:     row.EndTime,
+			ExitCode:    row.ExitCode,
+		})
+		if err != nil {
+			return err
+		}
+	}
+	if err = writer.Close(); err != nil {
+		return err
+	}
+
+	customerUUID, err := utils.ByteArrayToUUIDString(customer.UUID)
+	if err != nil {
+		return err
+	}
+
+	return store.Put(ArchiveKey(customerUUID, day, now), &buffer, int64(buffer.Len()), nil)
+}
+
+// archiveTable archives every day of the customer's process events in the table
+func archiveTable(tx gorp.SqlExecutor, store storage.Store, table string, customer *customerRetention, now int64) error {
+	days, err := archiveDays(tx, table, customer.ID)
+	if err != nil {
+		return err
+	}
+
+	for _, day := range days {
+		if err = archiveDay(tx, store, table, customer, day, now); err != nil {
+			return fmt.Errorf("Unable to archive %s, %v", time.Unix(day, 0).UTC().Format("2006-01-02"), err)
+		}
+	}
+	return nil
+}
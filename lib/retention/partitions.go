@@ -0,0 +1,131 @@
+////////////////////////////////////////////////////////////////////////////
+//
+// Summit Route End Point Protection
+//
+// This source code is licensed under the BSD-style license found in the
+// LICENSE file in the root directory of this source tree.
+//
+/////////////////////////////////////////////////////////////////////////////
+
+package retention
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/coopernurse/gorp"
+
+	"qdserver/lib/migrations"
+)
+
+// DefaultPartition holds process events outside every monthly partition, such as those from agents with a bad clock
+const DefaultPartition = "processevents_default"
+
+// partition is one month of the processevents table, holding events with From <= EventTime < To
+type partition struct {
+	Name string
+	From int64
+	To   int64
+}
+
+// monthStart returns the start of the month the unix time is in, in UTC
+func monthStart(t int64) time.Time {
+	utc := time.Unix(t, 0).UTC()
+	return time.Date(utc.Year(), utc.Month(), 1, 0, 0, 0, 0, time.UTC)
+}
+
+// monthPartition returns the partition for the month starting at the given time
+func monthPartition(month time.Time) partition {
+	return partition{
+		Name: fmt.Sprintf("processevents_y%04dm%02d", month.Year(), int(month.Month())),
+		From: month.Unix(),
+		To:   month.AddDate(0, 1, 0).Unix(),
+	}
+}
+
+// listPartitions returns the monthly partitions of processevents, oldest first
+func listPartitions(db gorp.SqlExecutor) ([]partition, error) {
+	type partitionName struct {
+		Name string
+	}
+
+	var names []partitionName
+	_, err := db.Select(&names, `SELECT c.relname as Name
+		FROM pg_inherits i
+		JOIN pg_class c ON c.oid = i.inhrelid
+		JOIN pg_class p ON p.oid = i.inhparent
+		WHERE p.relname = 'processevents'
+		ORDER BY c.relname`)
+	if err != nil {
+		return nil, err
+	}
+
+	var partitions []partition
+	for _, name := range names {
+		var year, month int
+		if _, err := fmt.Sscanf(name.Name, "processevents_y%04dm%02d", &year, &month); err != nil {
+			continue // The default partition
+		}
+		partitions = append(partitions, monthPartition(time.Date(year, time.Month(month), 1, 0, 0, 0, 0, time.UTC)))
+	}
+	return partitions, nil
+}
+
+// partitionExists returns true if the table is there
+func partitionExists(db gorp.SqlExecutor, name string) (bool, error) {
+	count, err := db.SelectInt("SELECT count(*) FROM pg_class WHERE relname=$1 and relkind='r'", name)
+	return count != 0, err
+}
+
+// CreatePartition adds the partition for the month the unix time is in, if it doesn't exist.  Events for that month
+// that were put in the default partition are moved into it.
+func CreatePartition(tx gorp.SqlExecutor, t int64) error {
+	p := monthPartition(monthStart(t))
+
+	exists, err := partitionExists(tx, p.Name)
+	if err != nil || exists {
+		return err
+	}
+
+	// Postgres won't attach a partition while the default partition has rows that belong in it
+	return migrations.Statements(
+		fmt.Sprintf("CREATE TABLE %s (LIKE processevents INCLUDING DEFAULTS INCLUDING CONSTRAINTS)", p.Name),
+		fmt.Sprintf("INSERT INTO %s SELECT * FROM %s WHERE EventTime >= %d and EventTime < %d", p.Name, DefaultPartition, p.From, p.To),
+		fmt.Sprintf("DELETE FROM %s WHERE EventTime >= %d and EventTime < %d", DefaultPartition, p.From, p.To),
+		fmt.Sprintf("ALTER TABLE processevents ATTACH PARTITION %s FOR VALUES FROM (%d) TO (%d)", p.Name, p.From, p.To),
+	)(tx)
+}
+
+// EnsurePartitions creates the partitions for this month and next month, so events always have a partition to go to
+func EnsurePartitions(db *gorp.DbMap, now int64) error {
+	thisMonth := monthStart(now)
+	for _, month := range []time.Time{thisMonth, thisMonth.AddDate(0, 1, 0)} {
+		err := inTransaction(db, func(tx *gorp.Transaction) error {
+			return CreatePartition(tx, month.Unix())
+		})
+		if err != nil {
+			return fmt.Errorf("Unable to create the partition for %s, %v", month.Format("2006-01"), err)
+		}
+	}
+	return nil
+}
+
+// inTransaction runs f in a transaction holding the retention lock, so only one server changes the partitions at once
+func inTransaction(db *gorp.DbMap, f func(tx *gorp.Transaction) error) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+
+	if _, err = tx.Exec("SELECT pg_advisory_xact_lock($1)", lockID); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	if err = f(tx); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	return tx.Commit()
+}
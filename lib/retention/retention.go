@@ -0,0 +1,197 @@
+////////////////////////////////////////////////////////////////////////////
+//
+// Summit Route End Point Protection
+//
+// This source code is licensed under the BSD-style license found in the
+// LICENSE file in the root directory of this source tree.
+//
+/////////////////////////////////////////////////////////////////////////////
+
+// Package retention expires old process events.  The processevents table is partitioned by month of EventTime, so
+// a month that every customer is done with is dropped in one go, while customers that keep events for less time have
+// theirs deleted a day at a time.  Either way, the events are added to the daily roll-ups in processeventrollups as
+// they are removed, and written to the archive store first for customers that want them kept.
+package retention
+
+import (
+	"fmt"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/coopernurse/gorp"
+
+	"qdserver/lib/migrations"
+	"qdserver/lib/storage"
+)
+
+// lockID is the Postgres advisory lock held while changing partitions or expiring events, so that only one server
+// does so at a time
+const lockID = 0x53524551
+
+// Config says how long events are kept when a customer hasn't chosen, and where they are archived
+type Config struct {
+	DefaultDays  int64         // Days to keep process events, 0 to keep them forever
+	ArchiveStore storage.Store // nil if archiving isn't set up
+}
+
+// customerRetention is how long a customer keeps their process events
+type customerRetention struct {
+	ID                    int64
+	UUID                  []byte
+	ProcessEventRetention int64
+	ArchiveProcessEvents  bool
+}
+
+// cutoff returns the time before which the customer's events have expired, or 0 if they are kept forever
+func (customer *customerRetention) cutoff(config Config, now int64) int64 {
+	days := customer.ProcessEventRetention
+	if days == 0 {
+		days = config.DefaultDays
+	}
+	if days <= 0 {
+		return 0
+	}
+
+	// Whole days are expired, so the roll-ups of a day are made at once
+	today := now - now%SecondsPerDay
+	return today - days*SecondsPerDay
+}
+
+// Run creates the partitions for upcoming events, then removes every process event that has expired.  It is safe
+// to run from more than one server at once.
+func Run(db *gorp.DbMap, config Config, now int64) error {
+	if err := EnsurePartitions(db, now); err != nil {
+		return err
+	}
+
+	var customers []customerRetention
+	_, err := db.Select(&customers, "SELECT ID, UUID, ProcessEventRetention, ArchiveProcessEvents FROM customers")
+	if err != nil {
+		return err
+	}
+
+	// A month can only be dropped once every customer is done with it
+	dropBefore := int64(-1)
+	cutoffs := make(map[int64]int64)
+	for i := range customers {
+		customer := &customers[i]
+
+		cutoff := customer.cutoff(config, now)
+		if customer.ArchiveProcessEvents && config.ArchiveStore == nil && cutoff != 0 {
+			log.Warningf("Customer %d wants process events archived, but no archive store is configured, so they are being kept", customer.ID)
+			cutoff = 0
+		}
+		cutoffs[customer.ID] = cutoff
+
+		if dropBefore == -1 || cutoff < dropBefore {
+			dropBefore = cutoff
+		}
+	}
+	if dropBefore == -1 {
+		dropBefore = (&customerRetention{}).cutoff(config, now)
+	}
+
+	partitions, err := listPartitions(db)
+	if err != nil {
+		return err
+	}
+
+	for _, p := range partitions {
+		if p.To > dropBefore {
+			break
+		}
+		if err = dropPartition(db, config, p, customers, now); err != nil {
+			return fmt.Errorf("Unable to drop %s, %v", p.Name, err)
+		}
+		log.Infof("Dropped process events partition %s", p.Name)
+	}
+
+	for i := range customers {
+		customer := &customers[i]
+		if cutoffs[customer.ID] == 0 {
+			continue
+		}
+		if err = expireCustomerEvents(db, config, customer, cutoffs[customer.ID], now); err != nil {
+			return fmt.Errorf("Unable to expire the process events of customer %d, %v", customer.ID, err)
+		}
+	}
+
+	return nil
+}
+
+// dropPartition archives the events in the partition for the customers that want them, rolls them up, and drops it
+func dropPartition(db *gorp.DbMap, config Config, p partition, customers []customerRetention, now int64) error {
+	return inTransaction(db, func(tx *gorp.Transaction) error {
+		exists, err := partitionExists(tx, p.Name)
+		if err != nil || !exists {
+			return err
+		}
+
+		// Hold off late events for the month until it is gone, so none are missed by the archive
+		if _, err = tx.Exec(fmt.Sprintf("LOCK TABLE %s IN SHARE MODE", p.Name)); err != nil {
+			return err
+		}
+
+		for i := range customers {
+			if !customers[i].ArchiveProcessEvents {
+				continue
+			}
+			if err = archiveTable(tx, config.ArchiveStore, p.Name, &customers[i], now); err != nil {
+				return err
+			}
+		}
+
+		if err = rollUp(tx, p.Name); err != nil {
+			return err
+		}
+
+		_, err = tx.Exec(fmt.Sprintf("DROP TABLE %s", p.Name))
+		return err
+	})
+}
+
+// expireCustomerEvents removes the customer's events from before the cutoff, a day at a time.  Those in months that
+// have been dropped are in the default partition.
+func expireCustomerEvents(db *gorp.DbMap, config Config, customer *customerRetention, cutoff int64, now int64) error {
+	type dayRow struct {
+		Day int64
+	}
+
+	var days []dayRow
+	_, err := db.Select(&days, fmt.Sprintf(`SELECT DISTINCT pe.EventTime - pe.EventTime %% %d as Day
+		FROM processevents pe, systems s, systemsets ss
+		WHERE pe.SystemID = s.ID and s.SystemSetID = ss.ID and ss.CustomerID = $1 and pe.EventTime < $2
+		ORDER BY Day`, SecondsPerDay), customer.ID, cutoff)
+	if err != nil {
+		return err
+	}
+
+	for _, day := range days {
+		err = inTransaction(db, func(tx *gorp.Transaction) error {
+			err := migrations.Statements(
+				"CREATE TEMP TABLE expiredprocessevents (LIKE processevents) ON COMMIT DROP",
+				fmt.Sprintf(`WITH expired AS (
+						DELETE FROM processevents
+						WHERE EventTime >= %d and EventTime < %d and SystemID IN (
+							SELECT s.ID FROM systems s, systemsets ss WHERE s.SystemSetID = ss.ID and ss.CustomerID = %d)
+						RETURNING *)
+					INSERT INTO expiredprocessevents SELECT * FROM expired`, day.Day, day.Day+SecondsPerDay, customer.ID),
+			)(tx)
+			if err != nil {
+				return err
+			}
+
+			if customer.ArchiveProcessEvents {
+				if err = archiveDay(tx, config.ArchiveStore, "expiredprocessevents", customer, day.Day, now); err != nil {
+					return err
+				}
+			}
+
+			return rollUp(tx, "expiredprocessevents")
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
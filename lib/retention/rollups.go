@@ -0,0 +1,74 @@
+////////////////////////////////////////////////////////////////////////////
+//
+// Summit Route End Point Protection
+//
+// This source code is licensed under the BSD-style license found in the
+// LICENSE file in the root directory of this source tree.
+//
+/////////////////////////////////////////////////////////////////////////////
+
+package retention
+
+import (
+	"fmt"
+
+	"github.com/coopernurse/gorp"
+)
+
+// SecondsPerDay is the length of the days process events are rolled up by, which start at midnight UTC
+const SecondsPerDay = 24 * 60 * 60
+
+// addToRollups is the end of an INSERT into processeventrollups that adds to the counts already there
+const addToRollups = `ON CONFLICT (Day, SystemID, ExecutableFileID) DO UPDATE SET
+	Events = processeventrollups.Events + excluded.Events,
+	FirstSeen = least(processeventrollups.FirstSeen, excluded.FirstSeen),
+	LastSeen = greatest(processeventrollups.LastSeen, excluded.LastSeen)`
+
+// rollUp adds every process event in the table, which has the columns of processevents, to the daily roll-ups.
+// Roll-ups are only made from events as they are removed, so each event is counted once, either in processevents
+// or in processeventrollups.
+func rollUp(tx gorp.SqlExecutor, table string) error {
+	_, err := tx.Exec(fmt.Sprintf(`INSERT INTO processeventrollups
+		(Day, SystemID, ExecutableFileID, Events, FirstSeen, LastSeen)
+		SELECT EventTime - EventTime %% %d, SystemID, ExecutableFileID, count(*), min(EventTime), max(EventTime)
+		FROM %s
+		GROUP BY 1, 2, 3
+		%s`, SecondsPerDay, table, addToRollups))
+	return err
+}
+
+// MoveRollups gives the roll-ups of one system to another, such as when merging systems.  The db may be a transaction.
+func MoveRollups(tx gorp.SqlExecutor, fromSystemID int64, intoSystemID int64) error {
+	_, err := tx.Exec(`INSERT INTO processeventrollups
+		(Day, SystemID, ExecutableFileID, Events, FirstSeen, LastSeen)
+		SELECT Day, $1, ExecutableFileID, Events, FirstSeen, LastSeen
+		FROM processeventrollups
+		WHERE SystemID=$2
+		`+addToRollups, intoSystemID, fromSystemID)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec("DELETE FROM processeventrollups WHERE SystemID=$1", fromSystemID)
+	return err
+}
+
+// DailyActivitySelect combines the roll-ups with the events that haven't expired yet, giving the number of times
+// each file ran on each system each day.  It needs the "from" and "to" params (unix times), and the where clause is
+// applied to both, with its columns prefixed by "a." (SystemID, ExecutableFileID).  The roll-ups and events are read
+// from rollupsTable and eventsTable, usually "processeventrollups" and "processevents", but they can be subqueries that
+// limit the rows.
+func DailyActivitySelect(rollupsTable string, eventsTable string, where string) string {
+	return fmt.Sprintf(`SELECT Day, SystemID, ExecutableFileID, sum(Events) as Events, min(FirstSeen) as FirstSeen, max(LastSeen) as LastSeen
+		FROM (
+			SELECT a.Day, a.SystemID, a.ExecutableFileID, a.Events, a.FirstSeen, a.LastSeen
+			FROM %s a
+			WHERE a.Day >= :from and a.Day < :to %s
+			UNION ALL
+			SELECT a.EventTime - a.EventTime %% %d, a.SystemID, a.ExecutableFileID, count(*), min(a.EventTime), max(a.EventTime)
+			FROM %s a
+			WHERE a.EventTime >= :from and a.EventTime < :to %s
+			GROUP BY 1, 2, 3
+		) activity
+		GROUP BY Day, SystemID, ExecutableFileID`, rollupsTable, where, SecondsPerDay, eventsTable, where)
+}
@@ -0,0 +1,161 @@
+////////////////////////////////////////////////////////////////////////////
+//
+// Summit Route End Point Protection
+//
+// This source code is licensed under the BSD-style license found in the
+// LICENSE file in the root directory of this source tree.
+//
+/////////////////////////////////////////////////////////////////////////////
+
+package rules
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/coopernurse/gorp"
+
+	"qdserver/lib/models"
+)
+
+// ValidAttributeType returns true if the attribute type is one we know how to evaluate
+func ValidAttributeType(attributeType string) bool {
+	switch strings.ToLower(attributeType) {
+	case models.RuleAttributeSha256,
+		models.RuleAttributeSignerSubject,
+		models.RuleAttributeCompanyName,
+		models.RuleAttributeProductName,
+		models.RuleAttributePath:
+		return true
+	}
+	return false
+}
+
+// lockRuleSet re-reads the rule set in the transaction, locking it so its rules are edited one change at a time
+func lockRuleSet(tx *gorp.Transaction, ruleSet *models.RuleSet) error {
+	return tx.SelectOne(ruleSet, "select * from rulesets where ID=:id for update",
+		map[string]interface{}{
+			"id": ruleSet.ID,
+		})
+}
+
+// inTransaction runs edit in a transaction, committing it if edit succeeds
+func inTransaction(db *gorp.DbMap, edit func(tx *gorp.Transaction) error) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+
+	if err = edit(tx); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// AppendRule adds the rule to the end of the rule set
+func AppendRule(db *gorp.DbMap, ruleSet *models.RuleSet, rule *models.Rule) error {
+	return inTransaction(db, func(tx *gorp.Transaction) error {
+		if err := lockRuleSet(tx, ruleSet); err != nil {
+			return err
+		}
+
+		ruleList, err := LoadRules(tx, ruleSet)
+		if err != nil {
+			return err
+		}
+
+		rule.NextRule = 0
+		rule.PreviousRule = 0
+		if len(ruleList) != 0 {
+			rule.PreviousRule = ruleList[len(ruleList)-1].ID
+		}
+
+		if err = tx.Insert(rule); err != nil {
+			return err
+		}
+
+		if len(ruleList) == 0 {
+			ruleSet.FirstRule = rule.ID
+			_, err = tx.Update(ruleSet)
+			return err
+		}
+
+		last := ruleList[len(ruleList)-1]
+		last.NextRule = rule.ID
+		_, err = tx.Update(&last)
+		return err
+	})
+}
+
+// RemoveRule unlinks the rule from the rule set and deletes it
+func RemoveRule(db *gorp.DbMap, ruleSet *models.RuleSet, ruleID int64) error {
+	return inTransaction(db, func(tx *gorp.Transaction) error {
+		if err := lockRuleSet(tx, ruleSet); err != nil {
+			return err
+		}
+
+		ruleList, err := LoadRules(tx, ruleSet)
+		if err != nil {
+			return err
+		}
+
+		for i, rule := range ruleList {
+			if rule.ID != ruleID {
+				continue
+			}
+
+			if i == 0 {
+				ruleSet.FirstRule = rule.NextRule
+				if _, err = tx.Update(ruleSet); err != nil {
+					return err
+				}
+			} else {
+				previous := ruleList[i-1]
+				previous.NextRule = rule.NextRule
+				if _, err = tx.Update(&previous); err != nil {
+					return err
+				}
+			}
+
+			if i+1 < len(ruleList) {
+				next := ruleList[i+1]
+				next.PreviousRule = rule.PreviousRule
+				if _, err = tx.Update(&next); err != nil {
+					return err
+				}
+			}
+
+			_, err = tx.Delete(&rule)
+			return err
+		}
+
+		return fmt.Errorf("Rule %d is not in rule set %d", ruleID, ruleSet.ID)
+	})
+}
+
+// DeleteRuleSet deletes the rule set and its rules, unless a system set still uses it
+func DeleteRuleSet(db gorp.SqlExecutor, ruleSetID int64) error {
+	used, err := db.SelectInt("select count(*) from systemsets where RuleSetID=:id",
+		map[string]interface{}{
+			"id": ruleSetID,
+		})
+	if err != nil || used != 0 {
+		return err
+	}
+
+	ruleSet, ruleList, err := LoadRuleSet(db, ruleSetID)
+	if err != nil {
+		return err
+	}
+
+	for _, rule := range ruleList {
+		if _, err = db.Delete(&rule); err != nil {
+			return err
+		}
+	}
+
+	_, err = db.Delete(ruleSet)
+	return err
+}
@@ -0,0 +1,120 @@
+////////////////////////////////////////////////////////////////////////////
+//
+// Summit Route End Point Protection
+//
+// This source code is licensed under the BSD-style license found in the
+// LICENSE file in the root directory of this source tree.
+//
+/////////////////////////////////////////////////////////////////////////////
+
+package rules
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+
+	"github.com/coopernurse/gorp"
+
+	"qdserver/lib/models"
+	"qdserver/lib/utils"
+)
+
+// CompiledRule is the form of a Rule that is sent to agents
+type CompiledRule struct {
+	RuleID         int64
+	AttributeType  string
+	AttributeValue string
+	Allow          bool
+}
+
+// CompiledPolicy is everything an agent needs to know to enforce a RuleSet.
+// It is marshaled to json to be hashed and stored, so field order matters.
+type CompiledPolicy struct {
+	Mode         int
+	DefaultAllow bool
+	Rules        []CompiledRule
+}
+
+// Compile flattens the rules into a CompiledPolicy
+func Compile(mode int, defaultAllow bool, ruleList []models.Rule) CompiledPolicy {
+	policy := CompiledPolicy{
+		Mode:         mode,
+		DefaultAllow: defaultAllow,
+		Rules:        make([]CompiledRule, 0, len(ruleList)),
+	}
+
+	for _, rule := range ruleList {
+		policy.Rules = append(policy.Rules, CompiledRule{
+			RuleID:         rule.ID,
+			AttributeType:  rule.AttributeType,
+			AttributeValue: rule.AttributeValue,
+			Allow:          rule.AllowDeny,
+		})
+	}
+
+	return policy
+}
+
+// Marshal returns the json form of the policy and its sha256
+func (policy *CompiledPolicy) Marshal() (contents []byte, hash []byte, err error) {
+	contents, err = json.Marshal(policy)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	hasher := sha256.New()
+	hasher.Write(contents)
+	return contents, hasher.Sum(nil), nil
+}
+
+// StorePolicy saves the compiled policy if we haven't seen it before.
+// The ID of the returned Policy is the version number given to agents.
+func StorePolicy(db gorp.SqlExecutor, compiled CompiledPolicy) (*models.Policy, error) {
+	contents, hash, err := compiled.Marshal()
+	if err != nil {
+		return nil, fmt.Errorf("Unable to marshal policy: %v", err)
+	}
+
+	// Another request may be storing the same policy, so let the unique Hash decide who adds it
+	_, err = db.Exec("INSERT INTO policies (Hash, Contents, CreationDate) VALUES ($1, $2, $3) ON CONFLICT (Hash) DO NOTHING",
+		hash, string(contents), utils.DBTimeNow())
+	if err != nil {
+		return nil, err
+	}
+
+	var policy models.Policy
+	err = db.SelectOne(&policy, "select * from policies where Hash=:hash",
+		map[string]interface{}{
+			"hash": hash,
+		})
+	if err != nil {
+		return nil, err
+	}
+
+	// Sanity check
+	if !bytes.Equal(policy.Hash, hash) {
+		return nil, fmt.Errorf("Policy %d hash mismatch", policy.ID)
+	}
+
+	return &policy, nil
+}
+
+// CompileForSystem returns the policy the system should be running, taking the parents of its system set into account
+func CompileForSystem(db *gorp.DbMap, systemID int64) (CompiledPolicy, error) {
+	systemSetID, err := db.SelectInt("select SystemSetID from systems where ID=:systemID",
+		map[string]interface{}{
+			"systemID": systemID,
+		})
+	if err != nil {
+		return CompiledPolicy{}, fmt.Errorf("Unable to find system set for system %d: %v", systemID, err)
+	}
+
+	effective, err := ResolveSystemSet(db, systemSetID)
+	if err != nil {
+		return CompiledPolicy{}, err
+	}
+
+	return Compile(effective.Mode, effective.DefaultAllow, effective.Rules), nil
+}
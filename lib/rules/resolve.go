@@ -0,0 +1,154 @@
+////////////////////////////////////////////////////////////////////////////
+//
+// Summit Route End Point Protection
+//
+// This source code is licensed under the BSD-style license found in the
+// LICENSE file in the root directory of this source tree.
+//
+/////////////////////////////////////////////////////////////////////////////
+
+package rules
+
+import (
+	"fmt"
+
+	"github.com/coopernurse/gorp"
+
+	"qdserver/lib/models"
+)
+
+// EffectivePolicy is the Mode and rules of a SystemSet after walking its parents
+type EffectivePolicy struct {
+	Mode         int
+	DefaultAllow bool
+	Rules        []models.Rule
+	hasRuleSet   bool // Whether any set in the chain had a RuleSet, so we know who decides DefaultAllow
+}
+
+// GetSystemSetChain returns the system set followed by its parents, up to the root.
+// Returns an error if the parents loop back on themselves.
+func GetSystemSetChain(db *gorp.DbMap, systemSetID int64) ([]models.SystemSet, error) {
+	var chain []models.SystemSet
+	seen := make(map[int64]bool)
+
+	for id := systemSetID; id != 0; {
+		if seen[id] {
+			return nil, fmt.Errorf("Loop found in parents of system set %d at %d", systemSetID, id)
+		}
+		seen[id] = true
+
+		var systemSet models.SystemSet
+		err := db.SelectOne(&systemSet, "select * from systemsets where ID=:id",
+			map[string]interface{}{
+				"id": id,
+			})
+		if err != nil {
+			return nil, fmt.Errorf("Unable to find system set %d: %v", id, err)
+		}
+
+		chain = append(chain, systemSet)
+		id = systemSet.SystemSetID
+	}
+
+	return chain, nil
+}
+
+// ResolveSystemSet computes the effective Mode and rules of the system set from its chain of parents
+func ResolveSystemSet(db *gorp.DbMap, systemSetID int64) (*EffectivePolicy, error) {
+	chain, err := GetSystemSetChain(db, systemSetID)
+	if err != nil {
+		return nil, err
+	}
+
+	// Start at the root and work down to our set
+	var effective *EffectivePolicy
+	for i := len(chain) - 1; i >= 0; i-- {
+		systemSet := chain[i]
+
+		var ruleSet *models.RuleSet
+		var ruleList []models.Rule
+		if systemSet.RuleSetID != 0 {
+			ruleSet, ruleList, err = LoadRuleSet(db, systemSet.RuleSetID)
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		effective = combine(effective, &systemSet, ruleSet, ruleList)
+	}
+
+	return effective, nil
+}
+
+// combine applies a system set on top of its parent's effective policy
+func combine(parent *EffectivePolicy, systemSet *models.SystemSet, ruleSet *models.RuleSet, ruleList []models.Rule) *EffectivePolicy {
+	own := &EffectivePolicy{
+		Mode:         systemSet.Mode,
+		DefaultAllow: true,
+		Rules:        ruleList,
+		hasRuleSet:   ruleSet != nil,
+	}
+	if ruleSet != nil {
+		own.DefaultAllow = ruleSet.DefaultAllow
+	}
+
+	if parent == nil {
+		// Root of the chain so nothing to inherit
+		return own
+	}
+
+	result := &EffectivePolicy{Mode: own.Mode}
+	if systemSet.InheritMode {
+		result.Mode = parent.Mode
+	}
+
+	switch systemSet.RuleInheritance {
+	case models.RuleInheritanceOverride:
+		result.Rules = own.Rules
+		result.DefaultAllow = own.DefaultAllow
+		result.hasRuleSet = own.hasRuleSet
+	case models.RuleInheritanceInherit:
+		result.Rules = parent.Rules
+		result.DefaultAllow = parent.DefaultAllow
+		result.hasRuleSet = parent.hasRuleSet
+	default:
+		// Prepend, the default action comes from the closest set with a RuleSet
+		result.Rules = append(append([]models.Rule{}, own.Rules...), parent.Rules...)
+		if own.hasRuleSet {
+			result.DefaultAllow = own.DefaultAllow
+			result.hasRuleSet = true
+		} else {
+			result.DefaultAllow = parent.DefaultAllow
+			result.hasRuleSet = parent.hasRuleSet
+		}
+	}
+
+	return result
+}
+
+// GetDescendantSystemSets returns the IDs of the system set and every set below it
+func GetDescendantSystemSets(db gorp.SqlExecutor, systemSetID int64) ([]int64, error) {
+	descendants := []int64{systemSetID}
+	seen := map[int64]bool{systemSetID: true}
+
+	for i := 0; i < len(descendants); i++ {
+		var children []int64
+		_, err := db.Select(&children, "select ID from systemsets where SystemSetID=:parentID",
+			map[string]interface{}{
+				"parentID": descendants[i],
+			})
+		if err != nil {
+			return nil, err
+		}
+
+		for _, child := range children {
+			if seen[child] {
+				return nil, fmt.Errorf("Loop found below system set %d at %d", systemSetID, child)
+			}
+			seen[child] = true
+			descendants = append(descendants, child)
+		}
+	}
+
+	return descendants, nil
+}
@@ -0,0 +1,223 @@
+////////////////////////////////////////////////////////////////////////////
+//
+// Summit Route End Point Protection
+//
+// This source code is licensed under the BSD-style license found in the
+// LICENSE file in the root directory of this source tree.
+//
+/////////////////////////////////////////////////////////////////////////////
+
+package rules
+
+import (
+	"encoding/hex"
+	"fmt"
+	"strings"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/coopernurse/gorp"
+
+	"qdserver/lib/models"
+	"qdserver/lib/utils"
+)
+
+// Subject is what the rules are evaluated against
+type Subject struct {
+	File     *models.ExecutableFile
+	FilePath string          // Path the process was started from, empty when there is no process, such as when evaluating a file on its own
+	Signers  []models.Signer // Signer chain of the file, may be empty
+}
+
+// Verdict is the result of evaluating a RuleSet
+type Verdict struct {
+	Allow bool
+	Rule  *models.Rule // Rule that matched, or nil if the default action was used
+}
+
+// Evaluate walks the rules in order and returns the verdict of the first rule that matches.
+// If no rule matches, the default action is returned.
+func Evaluate(ruleList []models.Rule, defaultAllow bool, subject Subject) Verdict {
+	for i := range ruleList {
+		rule := &ruleList[i]
+		if Matches(rule, subject) {
+			return Verdict{Allow: rule.AllowDeny, Rule: rule}
+		}
+	}
+
+	return Verdict{Allow: defaultAllow}
+}
+
+// Matches returns true if the rule applies to the subject
+func Matches(rule *models.Rule, subject Subject) bool {
+	switch strings.ToLower(rule.AttributeType) {
+	case models.RuleAttributeSha256:
+		if subject.File == nil {
+			return false
+		}
+		return strings.EqualFold(hex.EncodeToString(subject.File.Sha256), strings.TrimSpace(rule.AttributeValue))
+	case models.RuleAttributeSignerSubject:
+		// Anyone can put a certificate with any subject on a file, so only signatures that check out count
+		if subject.File == nil || !hasTrustedSignature(subject.File) {
+			return false
+		}
+		for _, signer := range subject.Signers {
+			if strings.EqualFold(signer.Subject, rule.AttributeValue) || strings.EqualFold(signer.SubjectShortName, rule.AttributeValue) {
+				return true
+			}
+		}
+		return false
+	case models.RuleAttributeCompanyName:
+		if subject.File == nil {
+			return false
+		}
+		return strings.EqualFold(subject.File.CompanyName, rule.AttributeValue)
+	case models.RuleAttributeProductName:
+		if subject.File == nil {
+			return false
+		}
+		return strings.EqualFold(subject.File.ProductName, rule.AttributeValue)
+	case models.RuleAttributePath:
+		if subject.FilePath == "" {
+			return false
+		}
+		return MatchPath(rule.AttributeValue, subject.FilePath)
+	}
+
+	log.Warningf("Unknown attribute type %s in rule %d", rule.AttributeType, rule.ID)
+	return false
+}
+
+// hasTrustedSignature returns true if the file's signature, or the catalog it is in, is valid and leads to a trusted root
+func hasTrustedSignature(file *models.ExecutableFile) bool {
+	return file.SignatureStatus == models.SignatureStatusValid || file.SignatureStatus == models.SignatureStatusCatalog
+}
+
+// MatchPath matches a Windows path against a glob pattern.
+// Both are canonicalized the way paths are stored, so matching is case-insensitive, treats / and \ the same, and
+// expands environment variables such as %SystemRoot%.
+// A * matches any run of characters, including path separators, and a ? matches any single character.
+func MatchPath(pattern string, filePath string) bool {
+	return matchGlob([]rune(normalizePath(pattern)), []rune(normalizePath(filePath)))
+}
+
+// normalizePath converts the path to the form paths are stored in
+func normalizePath(filePath string) string {
+	return utils.CanonicalizePath(filePath)
+}
+
+// matchGlob is a simple glob matcher that supports * and ?
+func matchGlob(pattern []rune, name []rune) bool {
+	// Index into the pattern and name of the last * seen, so we can backtrack to it
+	starIndex, starMatch := -1, 0
+	p, n := 0, 0
+
+	for n < len(name) {
+		if p < len(pattern) && (pattern[p] == '?' || pattern[p] == name[n]) {
+			p++
+			n++
+		} else if p < len(pattern) && pattern[p] == '*' {
+			starIndex = p
+			starMatch = n
+			p++
+		} else if starIndex != -1 {
+			// Let the last * eat one more character
+			p = starIndex + 1
+			starMatch++
+			n = starMatch
+		} else {
+			return false
+		}
+	}
+
+	// Any trailing *'s match nothing
+	for p < len(pattern) && pattern[p] == '*' {
+		p++
+	}
+
+	return p == len(pattern)
+}
+
+// LoadRules walks the linked list of the RuleSet and returns the rules in order
+func LoadRules(db gorp.SqlExecutor, ruleSet *models.RuleSet) ([]models.Rule, error) {
+	var ruleList []models.Rule
+	seen := make(map[int64]bool)
+
+	for ruleID := ruleSet.FirstRule; ruleID != 0; {
+		if seen[ruleID] {
+			return nil, fmt.Errorf("Loop found in rule set %d at rule %d", ruleSet.ID, ruleID)
+		}
+		seen[ruleID] = true
+
+		var rule models.Rule
+		err := db.SelectOne(&rule, "select * from rules where ID=:id",
+			map[string]interface{}{
+				"id": ruleID,
+			})
+		if err != nil {
+			return nil, fmt.Errorf("Unable to find rule %d in rule set %d: %v", ruleID, ruleSet.ID, err)
+		}
+
+		ruleList = append(ruleList, rule)
+		ruleID = rule.NextRule
+	}
+
+	return ruleList, nil
+}
+
+// LoadRuleSet returns the RuleSet and its rules in order
+func LoadRuleSet(db gorp.SqlExecutor, ruleSetID int64) (*models.RuleSet, []models.Rule, error) {
+	var ruleSet models.RuleSet
+	err := db.SelectOne(&ruleSet, "select * from rulesets where ID=:id",
+		map[string]interface{}{
+			"id": ruleSetID,
+		})
+	if err != nil {
+		return nil, nil, fmt.Errorf("Unable to find rule set %d: %v", ruleSetID, err)
+	}
+
+	ruleList, err := LoadRules(db, &ruleSet)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return &ruleSet, ruleList, nil
+}
+
+// LoadSigners returns the signers of a file along with the issuers up their trust chains
+func LoadSigners(db *gorp.DbMap, fileID int64) ([]models.Signer, error) {
+	var signers []models.Signer
+	_, err := db.Select(&signers, `SELECT s.*
+		FROM FileToSignerMap ftsm, Signers s
+		WHERE ftsm.FileID=:fileID and ftsm.SignerID = s.ID`,
+		map[string]interface{}{
+			"fileID": fileID,
+		})
+	if err != nil {
+		return nil, err
+	}
+
+	// Walk up each chain
+	seen := make(map[int64]bool)
+	for _, signer := range signers {
+		seen[signer.ID] = true
+	}
+	for i := 0; i < len(signers); i++ {
+		issuerID := signers[i].IssuerID
+		if issuerID == 0 || seen[issuerID] {
+			continue
+		}
+		seen[issuerID] = true
+
+		var issuer models.Signer
+		err = db.SelectOne(&issuer, "select * from signers where ID=:id",
+			map[string]interface{}{
+				"id": issuerID,
+			})
+		if err != nil {
+			return nil, fmt.Errorf("Unable to find issuer %d: %v", issuerID, err)
+		}
+		signers = append(signers, issuer)
+	}
+
+	return signers, nil
+}
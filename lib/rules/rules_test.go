@@ -0,0 +1,188 @@
+////////////////////////////////////////////////////////////////////////////
+//
+// Summit Route End Point Protection
+//
+// This source code is licensed under the BSD-style license found in the
+// LICENSE file in the root directory of this source tree.
+//
+/////////////////////////////////////////////////////////////////////////////
+
+package rules
+
+import (
+	"encoding/hex"
+	"testing"
+
+	"qdserver/lib/models"
+)
+
+func TestMatchGlob(t *testing.T) {
+	tests := []struct {
+		pattern string
+		name    string
+		match   bool
+	}{
+		{"", "", true},
+		{"", "a", false},
+		{"*", "", true},
+		{"*", "anything", true},
+		{"abc", "abc", true},
+		{"abc", "abd", false},
+		{"abc", "abcd", false},
+		{"a?c", "abc", true},
+		{"a?c", "ac", false},
+		{"a*c", "ac", true},
+		{"a*c", "abbbc", true},
+		{"a*c", "abbbd", false},
+		{"*.exe", `c:\dir\file.exe`, true},
+		{"*.exe", `c:\dir\file.exe.txt`, false},
+		{`c:\*\file.exe`, `c:\a\b\file.exe`, true}, // * crosses separators
+		{"a*b*c", "aXbYbZc", true},
+		{"a**c", "abc", true},
+		{"abc*", "abc", true},
+	}
+
+	for _, test := range tests {
+		if match := matchGlob([]rune(test.pattern), []rune(test.name)); match != test.match {
+			t.Errorf("matchGlob(%q, %q) = %v, want %v", test.pattern, test.name, match, test.match)
+		}
+	}
+}
+
+func TestMatchPath(t *testing.T) {
+	tests := []struct {
+		pattern  string
+		filePath string
+		match    bool
+	}{
+		{`C:\Windows\System32\*.exe`, `c:\windows\system32\cmd.exe`, true},
+		{`c:/windows/system32/cmd.exe`, `C:\Windows\System32\cmd.exe`, true},
+		{`%SystemRoot%\system32\cmd.exe`, `C:\Windows\System32\cmd.exe`, true},
+		{`\??\c:\tools\*`, `c:\tools\x.exe`, true},
+		{`c:\program files\*`, `c:\progra~1\app\app.exe`, true},
+		{`c:\windows\*.exe`, `d:\windows\cmd.exe`, false},
+	}
+
+	for _, test := range tests {
+		if match := MatchPath(test.pattern, test.filePath); match != test.match {
+			t.Errorf("MatchPath(%q, %q) = %v, want %v", test.pattern, test.filePath, match, test.match)
+		}
+	}
+}
+
+func TestMatches(t *testing.T) {
+	sha256, _ := hex.DecodeString("9f86d081884c7d659a2feaa0c55ad015a3bf4f1b2b0b822cd15d6c15b0f00a08")
+	file := &models.ExecutableFile{
+		Sha256:          sha256,
+		CompanyName:     "Example Corp",
+		ProductName:     "Example Tool",
+		SignatureStatus: models.SignatureStatusValid,
+	}
+	signers := []models.Signer{{Subject: "CN=Example Corp, O=Example Corp, C=US", SubjectShortName: "Example Corp"}}
+
+	withStatus := func(status int) *models.ExecutableFile {
+		copied := *file
+		copied.SignatureStatus = status
+		return &copied
+	}
+
+	tests := []struct {
+		name    string
+		rule    models.Rule
+		subject Subject
+		match   bool
+	}{
+		{"sha256", models.Rule{AttributeType: models.RuleAttributeSha256, AttributeValue: "9F86D081884C7D659A2FEAA0C55AD015A3BF4F1B2B0B822CD15D6C15B0F00A08"},
+			Subject{File: file}, true},
+		{"sha256 with spaces", models.Rule{AttributeType: models.RuleAttributeSha256, AttributeValue: " 9f86d081884c7d659a2feaa0c55ad015a3bf4f1b2b0b822cd15d6c15b0f00a08 "},
+			Subject{File: file}, true},
+		{"sha256 other", models.Rule{AttributeType: models.RuleAttributeSha256, AttributeValue: "00"},
+			Subject{File: file}, false},
+		{"sha256 no file", models.Rule{AttributeType: models.RuleAttributeSha256, AttributeValue: "00"},
+			Subject{}, false},
+
+		{"signer short name", models.Rule{AttributeType: models.RuleAttributeSignerSubject, AttributeValue: "example corp"},
+			Subject{File: file, Signers: signers}, true},
+		{"signer subject", models.Rule{AttributeType: models.RuleAttributeSignerSubject, AttributeValue: "CN=Example Corp, O=Example Corp, C=US"},
+			Subject{File: file, Signers: signers}, true},
+		{"signer other", models.Rule{AttributeType: models.RuleAttributeSignerSubject, AttributeValue: "Other Corp"},
+			Subject{File: file, Signers: signers}, false},
+		{"signer catalog", models.Rule{AttributeType: models.RuleAttributeSignerSubject, AttributeValue: "Example Corp"},
+			Subject{File: withStatus(models.SignatureStatusCatalog), Signers: signers}, true},
+		{"signer invalid signature", models.Rule{AttributeType: models.RuleAttributeSignerSubject, AttributeValue: "Example Corp"},
+			Subject{File: withStatus(models.SignatureStatusInvalid), Signers: signers}, false},
+		{"signer expired", models.Rule{AttributeType: models.RuleAttributeSignerSubject, AttributeValue: "Example Corp"},
+			Subject{File: withStatus(models.SignatureStatusExpired), Signers: signers}, false},
+		{"signer untrusted root", models.Rule{AttributeType: models.RuleAttributeSignerSubject, AttributeValue: "Example Corp"},
+			Subject{File: withStatus(models.SignatureStatusUntrusted), Signers: signers}, false},
+		{"signer no file", models.Rule{AttributeType: models.RuleAttributeSignerSubject, AttributeValue: "Example Corp"},
+			Subject{Signers: signers}, false},
+
+		{"company name", models.Rule{AttributeType: models.RuleAttributeCompanyName, AttributeValue: "EXAMPLE CORP"},
+			Subject{File: file}, true},
+		{"company name other", models.Rule{AttributeType: models.RuleAttributeCompanyName, AttributeValue: "Other Corp"},
+			Subject{File: file}, false},
+		{"product name", models.Rule{AttributeType: models.RuleAttributeProductName, AttributeValue: "example tool"},
+			Subject{File: file}, true},
+		{"product name no file", models.Rule{AttributeType: models.RuleAttributeProductName, AttributeValue: "example tool"},
+			Subject{}, false},
+
+		{"path", models.Rule{AttributeType: models.RuleAttributePath, AttributeValue: `c:\tools\*.exe`},
+			Subject{File: file, FilePath: `C:\Tools\example.exe`}, true},
+		{"path other", models.Rule{AttributeType: models.RuleAttributePath, AttributeValue: `c:\tools\*.exe`},
+			Subject{File: file, FilePath: `C:\Windows\example.exe`}, false},
+		{"path no process", models.Rule{AttributeType: models.RuleAttributePath, AttributeValue: "*"},
+			Subject{File: file}, false},
+
+		{"attribute type case", models.Rule{AttributeType: "CompanyName", AttributeValue: "Example Corp"},
+			Subject{File: file}, true},
+		{"unknown attribute type", models.Rule{AttributeType: "color", AttributeValue: "blue"},
+			Subject{File: file}, false},
+	}
+
+	for _, test := range tests {
+		if match := Matches(&test.rule, test.subject); match != test.match {
+			t.Errorf("%s: Matches = %v, want %v", test.name, match, test.match)
+		}
+	}
+}
+
+func TestEvaluate(t *testing.T) {
+	file := &models.ExecutableFile{CompanyName: "Example Corp", ProductName: "Example Tool"}
+	subject := Subject{File: file, FilePath: `c:\tools\example.exe`}
+
+	allowCompany := models.Rule{ID: 1, AttributeType: models.RuleAttributeCompanyName, AttributeValue: "Example Corp", AllowDeny: true}
+	denyPath := models.Rule{ID: 2, AttributeType: models.RuleAttributePath, AttributeValue: `c:\tools\*`, AllowDeny: false}
+	denyOther := models.Rule{ID: 3, AttributeType: models.RuleAttributeProductName, AttributeValue: "Other Tool", AllowDeny: false}
+
+	tests := []struct {
+		name         string
+		rules        []models.Rule
+		defaultAllow bool
+		allow        bool
+		ruleID       int64 // 0 if the default should be used
+	}{
+		{"no rules, default allow", nil, true, true, 0},
+		{"no rules, default deny", nil, false, false, 0},
+		{"first match allows", []models.Rule{allowCompany, denyPath}, false, true, 1},
+		{"first match denies", []models.Rule{denyPath, allowCompany}, true, false, 2},
+		{"skips rules that don't match", []models.Rule{denyOther, allowCompany}, false, true, 1},
+		{"nothing matches, default allow", []models.Rule{denyOther}, true, true, 0},
+		{"nothing matches, default deny", []models.Rule{denyOther}, false, false, 0},
+	}
+
+	for _, test := range tests {
+		verdict := Evaluate(test.rules, test.defaultAllow, subject)
+		if verdict.Allow != test.allow {
+			t.Errorf("%s: Allow = %v, want %v", test.name, verdict.Allow, test.allow)
+		}
+
+		var ruleID int64
+		if verdict.Rule != nil {
+			ruleID = verdict.Rule.ID
+		}
+		if ruleID != test.ruleID {
+			t.Errorf("%s: matched rule %d, want %d", test.name, ruleID, test.ruleID)
+		}
+	}
+}
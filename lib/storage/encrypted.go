@@ -0,0 +1,439 @@
+////////////////////////////////////////////////////////////////////////////
+//
+// Summit Route End Point Protection
+//
+// This source code is licensed under the BSD-style license found in the
+// LICENSE file in the root directory of this source tree.
+//
+/////////////////////////////////////////////////////////////////////////////
+
+package storage
+
+import (
+	"bufio"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"strconv"
+
+	log "github.com/Sirupsen/logrus"
+)
+
+// Each object is encrypted with its own random data key, which is wrapped (encrypted) by the master key named in the
+// object's metadata.  Rotating the master key re-wraps each data key without re-encrypting the data, but as a Store
+// can only replace metadata along with its object, every object is still read and written back in full.  Objects
+// without the encryption metadata were stored before encryption was turned on, and are read as they are.
+//
+// The data is split into segments of segmentSize bytes, each sealed with AES-GCM.  A segment's nonce is its number,
+// with the last byte set on the final segment, so segments can't be reordered, dropped, or cut off at the end.
+const (
+	metadataEncryption = "srepp-encryption"  // encryptionScheme if the object is encrypted
+	metadataKeyID      = "srepp-key-id"      // ID of the master key that wrapped the data key
+	metadataWrappedKey = "srepp-wrapped-key" // Hex encoded nonce and sealed data key
+	metadataSize       = "srepp-size"        // Size of the data before it was encrypted
+
+	encryptionScheme = "aes-gcm-segments-1"
+)
+
+// dataKeySize is the size of the AES key generated for each object
+const dataKeySize = 32
+
+// segmentSize is how much data is sealed at a time, so objects can be streamed
+const segmentSize = 64 * 1024
+
+// EncryptionConfig is used in config.json files to encrypt everything in a Store
+type EncryptionConfig struct {
+	KeyID string            `json:"key_id"` // Master key used for new objects
+	Keys  map[string]string `json:"keys"`   // Hex encoded AES master keys by ID.  Keep old keys until they've been rotated out.
+}
+
+// EncryptedStore encrypts objects before they are put in another Store, and decrypts them when read.
+// Objects that were stored before encryption was turned on are read as is.
+type EncryptedStore struct {
+	store      Store
+	keyID      string
+	masterKeys map[string]cipher.AEAD
+}
+
+// NewEncryptedStore wraps the store so everything put in it is encrypted
+func NewEncryptedStore(store Store, config EncryptionConfig) (*EncryptedStore, error) {
+	masterKeys := make(map[string]cipher.AEAD)
+	for keyID, hexKey := range config.Keys {
+		if keyID == "" {
+			return nil, fmt.Errorf("Key IDs can't be empty")
+		}
+		masterKey, err := hex.DecodeString(hexKey)
+		if err != nil {
+			return nil, fmt.Errorf("Unable to decode key %s: %v", keyID, err)
+		}
+		if len(masterKey) != 16 && len(masterKey) != 24 && len(masterKey) != 32 {
+			return nil, fmt.Errorf("Key %s must be 16, 24, or 32 bytes", keyID)
+		}
+		if masterKeys[keyID], err = newGCM(masterKey); err != nil {
+			return nil, err
+		}
+	}
+
+	if _, ok := masterKeys[config.KeyID]; !ok {
+		return nil, fmt.Errorf("Key ID \"%s\" is not one of the keys", config.KeyID)
+	}
+
+	return &EncryptedStore{store: store, keyID: config.KeyID, masterKeys: masterKeys}, nil
+}
+
+// newGCM returns AES-GCM with the key
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// encryptedSize returns the size of size bytes once they are encrypted
+func encryptedSize(size int64) int64 {
+	segments := (size + segmentSize - 1) / segmentSize
+	if segments == 0 {
+		// Even empty objects have a final segment
+		segments = 1
+	}
+	return size + segments*16 // GCM's tag
+}
+
+// segmentNonce returns the nonce of the segment
+func segmentNonce(segment uint64, final bool) []byte {
+	nonce := make([]byte, 12)
+	binary.BigEndian.PutUint64(nonce[3:11], segment)
+	if final {
+		nonce[11] = 1
+	}
+	return nonce
+}
+
+// isEncrypted returns true if the metadata says the object is encrypted
+func isEncrypted(metadata map[string]string) (bool, error) {
+	scheme, ok := metadata[metadataEncryption]
+	if !ok {
+		return false, nil
+	}
+	if scheme != encryptionScheme {
+		return false, fmt.Errorf("Unknown encryption \"%s\"", scheme)
+	}
+	return true, nil
+}
+
+// wrapKey seals the data key with the current master key, and returns the metadata describing it.  The key ID is
+// authenticated along with the data key, so a key can't be passed off as wrapped by another.
+func (store *EncryptedStore) wrapKey(dataKey []byte, size int64) (map[string]string, error) {
+	masterKey := store.masterKeys[store.keyID]
+
+	nonce := make([]byte, masterKey.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return nil, err
+	}
+	wrappedKey := masterKey.Seal(nonce, nonce, dataKey, []byte(store.keyID))
+
+	return map[string]string{
+		metadataEncryption: encryptionScheme,
+		metadataKeyID:      store.keyID,
+		metadataWrappedKey: hex.EncodeToString(wrappedKey),
+		metadataSize:       strconv.FormatInt(size, 10),
+	}, nil
+}
+
+// unwrapKey opens the data key in the metadata.  This fails if the master key isn't the one it was wrapped with.
+func (store *EncryptedStore) unwrapKey(metadata map[string]string) ([]byte, error) {
+	keyID := metadata[metadataKeyID]
+	masterKey, ok := store.masterKeys[keyID]
+	if !ok {
+		return nil, fmt.Errorf("Object is encrypted with unknown key \"%s\"", keyID)
+	}
+
+	wrappedKey, err := hex.DecodeString(metadata[metadataWrappedKey])
+	if err != nil || len(wrappedKey) < masterKey.NonceSize() {
+		return nil, fmt.Errorf("Wrapped data key is malformed")
+	}
+
+	nonceSize := masterKey.NonceSize()
+	dataKey, err := masterKey.Open(nil, wrappedKey[:nonceSize], wrappedKey[nonceSize:], []byte(keyID))
+	if err != nil {
+		return nil, fmt.Errorf("Unable to unwrap data key with key \"%s\": %v", keyID, err)
+	}
+	if len(dataKey) != dataKeySize {
+		return nil, fmt.Errorf("Wrapped data key has the wrong size (%d)", len(dataKey))
+	}
+	return dataKey, nil
+}
+
+// encrypt seals size bytes from r, a segment at a time, writing them to w
+func encrypt(w io.Writer, r io.Reader, size int64, dataKey cipher.AEAD) error {
+	plaintext := make([]byte, segmentSize)
+	ciphertext := make([]byte, 0, segmentSize+dataKey.Overhead())
+
+	remaining := size
+	for segment := uint64(0); ; segment++ {
+		length := int64(segmentSize)
+		if remaining < length {
+			length = remaining
+		}
+		if _, err := io.ReadFull(r, plaintext[:length]); err != nil {
+			return fmt.Errorf("Read %d bytes, expected %d: %v", size-remaining, size, err)
+		}
+		remaining -= length
+
+		final := remaining == 0
+		if _, err := w.Write(dataKey.Seal(ciphertext[:0], segmentNonce(segment, final), plaintext[:length], nil)); err != nil {
+			return err
+		}
+		if final {
+			return nil
+		}
+	}
+}
+
+// decryptingReader opens the segments of an encrypted object as they are read
+type decryptingReader struct {
+	r       io.ReadCloser
+	buffer  *bufio.Reader
+	dataKey cipher.AEAD
+
+	segment    uint64
+	ciphertext []byte
+	plaintext  []byte // What has been opened but not read yet
+	final      bool   // The final segment has been opened
+}
+
+// Read returns the next of the decrypted data, or an error if it has been tampered with
+func (reader *decryptingReader) Read(p []byte) (int, error) {
+	for len(reader.plaintext) == 0 {
+		if reader.final {
+			return 0, io.EOF
+		}
+		if err := reader.openSegment(); err != nil {
+			return 0, err
+		}
+	}
+
+	n := copy(p, reader.plaintext)
+	reader.plaintext = reader.plaintext[n:]
+	return n, nil
+}
+
+// openSegment reads and opens the next segment
+func (reader *decryptingReader) openSegment() error {
+	n, err := io.ReadFull(reader.buffer, reader.ciphertext)
+	if err == io.EOF {
+		return fmt.Errorf("Encrypted object is truncated")
+	} else if err != nil && err != io.ErrUnexpectedEOF {
+		return err
+	}
+
+	// Only the final segment is short, but it may also be full
+	final := err == io.ErrUnexpectedEOF
+	if !final {
+		if _, err = reader.buffer.Peek(1); err == io.EOF {
+			final = true
+		} else if err != nil {
+			return err
+		}
+	}
+
+	reader.plaintext, err = reader.dataKey.Open(reader.ciphertext[:0], segmentNonce(reader.segment, final), reader.ciphertext[:n], nil)
+	if err != nil {
+		return fmt.Errorf("Unable to decrypt segment %d: %v", reader.segment, err)
+	}
+	reader.segment++
+	reader.final = final
+	return nil
+}
+
+// Close closes the underlying object
+func (reader *decryptingReader) Close() error {
+	return reader.r.Close()
+}
+
+// put encrypts size bytes from r with a new data key and stores them, streaming them through a pipe
+func (store *EncryptedStore) put(key string, r io.Reader, size int64) error {
+	rawDataKey := make([]byte, dataKeySize)
+	if _, err := io.ReadFull(rand.Reader, rawDataKey); err != nil {
+		return err
+	}
+	dataKey, err := newGCM(rawDataKey)
+	if err != nil {
+		return err
+	}
+
+	metadata, err := store.wrapKey(rawDataKey, size)
+	if err != nil {
+		return err
+	}
+
+	pipeReader, pipeWriter := io.Pipe()
+	go func() {
+		pipeWriter.CloseWithError(encrypt(pipeWriter, r, size, dataKey))
+	}()
+
+	err = store.store.Put(key, pipeReader, encryptedSize(size), metadata)
+	pipeReader.CloseWithError(err) // Stops the encryption if the store gave up early
+	return err
+}
+
+// Put encrypts the object and stores it.  The metadata is replaced by how it is encrypted.
+func (store *EncryptedStore) Put(key string, r io.Reader, size int64, metadata map[string]string) error {
+	return store.put(key, r, size)
+}
+
+// Get opens the object, decrypting it as it is read
+func (store *EncryptedStore) Get(key string) (io.ReadCloser, error) {
+	objectInfo, err := store.store.Stat(key)
+	if err != nil {
+		return nil, err
+	}
+
+	encrypted, err := isEncrypted(objectInfo.Metadata)
+	if err != nil {
+		return nil, fmt.Errorf("Unable to read %s: %v", key, err)
+	}
+
+	var dataKey cipher.AEAD
+	if encrypted {
+		rawDataKey, err := store.unwrapKey(objectInfo.Metadata)
+		if err != nil {
+			return nil, fmt.Errorf("Unable to decrypt %s: %v", key, err)
+		}
+		if dataKey, err = newGCM(rawDataKey); err != nil {
+			return nil, err
+		}
+	}
+
+	r, err := store.store.Get(key)
+	if err != nil || !encrypted {
+		return r, err
+	}
+
+	return &decryptingReader{
+		r:          r,
+		buffer:     bufio.NewReader(r),
+		dataKey:    dataKey,
+		ciphertext: make([]byte, segmentSize+dataKey.Overhead()),
+	}, nil
+}
+
+// Stat returns the size of the decrypted object, which is kept in its metadata
+func (store *EncryptedStore) Stat(key string) (*ObjectInfo, error) {
+	objectInfo, err := store.store.Stat(key)
+	if err != nil {
+		return nil, err
+	}
+
+	encrypted, err := isEncrypted(objectInfo.Metadata)
+	if err != nil {
+		return nil, fmt.Errorf("Unable to read %s: %v", key, err)
+	}
+	if encrypted {
+		if objectInfo.Size, err = strconv.ParseInt(objectInfo.Metadata[metadataSize], 10, 64); err != nil {
+			return nil, fmt.Errorf("Unable to read size of %s: %v", key, err)
+		}
+		objectInfo.Metadata = nil
+	}
+
+	return objectInfo, nil
+}
+
+// Delete removes the object
+func (store *EncryptedStore) Delete(key string) error {
+	return store.store.Delete(key)
+}
+
+// List returns the keys that start with prefix
+func (store *EncryptedStore) List(prefix string) ([]string, error) {
+	return store.store.List(prefix)
+}
+
+// Rotate re-wraps the data key of every object that isn't using the current master key, and encrypts any
+// objects stored before encryption was turned on.  The data itself is only re-encrypted for those older objects, but
+// every object that changes is downloaded and uploaded again, so this costs as much I/O as copying them.
+// Returns the number of objects that were changed.
+func (store *EncryptedStore) Rotate() (int, error) {
+	keys, err := store.store.List("")
+	if err != nil {
+		return 0, err
+	}
+
+	changed := 0
+	for _, key := range keys {
+		objectInfo, err := store.store.Stat(key)
+		if err != nil {
+			return changed, err
+		}
+
+		encrypted, err := isEncrypted(objectInfo.Metadata)
+		if err != nil {
+			return changed, fmt.Errorf("Unable to read %s: %v", key, err)
+		}
+		if encrypted && objectInfo.Metadata[metadataKeyID] == store.keyID {
+			continue
+		}
+
+		if !encrypted {
+			log.Infof("Encrypting %s", key)
+			err = store.rewrite(key, func(r io.Reader) error {
+				return store.put(key, r, objectInfo.Size)
+			})
+			if err != nil {
+				return changed, fmt.Errorf("Unable to encrypt %s: %v", key, err)
+			}
+			changed++
+			continue
+		}
+
+		log.Infof("Re-wrapping %s from key %s to %s", key, objectInfo.Metadata[metadataKeyID], store.keyID)
+		if err = store.rewrap(key, objectInfo); err != nil {
+			return changed, err
+		}
+		changed++
+	}
+
+	return changed, nil
+}
+
+// rewrite calls put with the stored contents of the object
+func (store *EncryptedStore) rewrite(key string, put func(r io.Reader) error) error {
+	r, err := store.store.Get(key)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+
+	return put(r)
+}
+
+// rewrap wraps the object's data key with the current master key, and stores the object again with it
+func (store *EncryptedStore) rewrap(key string, objectInfo *ObjectInfo) error {
+	rawDataKey, err := store.unwrapKey(objectInfo.Metadata)
+	if err != nil {
+		return fmt.Errorf("Unable to decrypt %s: %v", key, err)
+	}
+
+	size, err := strconv.ParseInt(objectInfo.Metadata[metadataSize], 10, 64)
+	if err != nil {
+		return fmt.Errorf("Unable to read size of %s: %v", key, err)
+	}
+	metadata, err := store.wrapKey(rawDataKey, size)
+	if err != nil {
+		return err
+	}
+
+	// The data is already encrypted with the data key, so it is stored as it is
+	err = store.rewrite(key, func(r io.Reader) error {
+		return store.store.Put(key, r, objectInfo.Size, metadata)
+	})
+	if err != nil {
+		return fmt.Errorf("Unable to store %s: %v", key, err)
+	}
+	return nil
+}
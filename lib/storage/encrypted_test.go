@@ -0,0 +1,305 @@
+////////////////////////////////////////////////////////////////////////////
+//
+// Summit Route End Point Protection
+//
+// This source code is licensed under the BSD-style license found in the
+// LICENSE file in the root directory of this source tree.
+//
+/////////////////////////////////////////////////////////////////////////////
+
+package storage
+
+import (
+	"bytes"
+	"crypto/rand"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const (
+	testKey1 = "000102030405060708090a0b0c0d0e0f101112131415161718191a1b1c1d1e1f"
+	testKey2 = "1f1e1d1c1b1a191817161514131211100f0e0d0c0b0a09080706050403020100"
+)
+
+// newTestStores returns a LocalStore in a temporary directory, and an EncryptedStore wrapping it that uses keyID
+func newTestStores(t *testing.T, keyID string) (string, *LocalStore, *EncryptedStore) {
+	root, err := ioutil.TempDir("", "storage")
+	if err != nil {
+		t.Fatalf("Unable to create temporary directory, %v", err)
+	}
+
+	local, err := NewLocalStore(root)
+	if err != nil {
+		t.Fatalf("NewLocalStore failed, %v", err)
+	}
+	return root, local, newTestEncryptedStore(t, local, keyID)
+}
+
+// newTestEncryptedStore wraps the store with both test keys, using keyID for new objects
+func newTestEncryptedStore(t *testing.T, store Store, keyID string) *EncryptedStore {
+	encrypted, err := NewEncryptedStore(store, EncryptionConfig{
+		KeyID: keyID,
+		Keys:  map[string]string{"key1": testKey1, "key2": testKey2},
+	})
+	if err != nil {
+		t.Fatalf("NewEncryptedStore failed, %v", err)
+	}
+	return encrypted
+}
+
+// randomData returns size random bytes
+func randomData(t *testing.T, size int) []byte {
+	data := make([]byte, size)
+	if _, err := io.ReadFull(rand.Reader, data); err != nil {
+		t.Fatalf("Unable to read random data, %v", err)
+	}
+	return data
+}
+
+// localFile returns where the LocalStore keeps the key
+func localFile(t *testing.T, local *LocalStore, key string) string {
+	path, err := local.filePath(key)
+	if err != nil {
+		t.Fatalf("filePath failed, %v", err)
+	}
+	return path
+}
+
+func TestEncryptedRoundTrip(t *testing.T) {
+	root, local, store := newTestStores(t, "key1")
+	defer os.RemoveAll(root)
+
+	for _, size := range []int{0, 1, segmentSize - 1, segmentSize, segmentSize + 1, 3 * segmentSize} {
+		data := randomData(t, size)
+		if err := store.Put("object", bytes.NewReader(data), int64(size), nil); err != nil {
+			t.Fatalf("%d bytes: Put failed, %v", size, err)
+		}
+
+		stored, err := ioutil.ReadFile(localFile(t, local, "object"))
+		if err != nil {
+			t.Fatalf("%d bytes: Unable to read stored file, %v", size, err)
+		}
+		if int64(len(stored)) != encryptedSize(int64(size)) {
+			t.Errorf("%d bytes: stored %d bytes, want %d", size, len(stored), encryptedSize(int64(size)))
+		}
+		if size > 0 && bytes.Contains(stored, data) {
+			t.Errorf("%d bytes: stored file contains the data", size)
+		}
+
+		read, err := ReadAll(store, "object")
+		if err != nil {
+			t.Fatalf("%d bytes: ReadAll failed, %v", size, err)
+		}
+		if !bytes.Equal(read, data) {
+			t.Errorf("%d bytes: read data doesn't match", size)
+		}
+
+		objectInfo, err := store.Stat("object")
+		if err != nil {
+			t.Fatalf("%d bytes: Stat failed, %v", size, err)
+		}
+		if objectInfo.Size != int64(size) {
+			t.Errorf("%d bytes: Stat size = %d", size, objectInfo.Size)
+		}
+	}
+}
+
+func TestEncryptedShortReader(t *testing.T) {
+	root, _, store := newTestStores(t, "key1")
+	defer os.RemoveAll(root)
+
+	if err := store.Put("object", strings.NewReader("short"), 100, nil); err == nil {
+		t.Errorf("Put of fewer bytes than the size succeeded")
+	}
+}
+
+func TestEncryptedTampering(t *testing.T) {
+	data := randomData(t, 2*segmentSize+100)
+
+	tests := []struct {
+		name   string
+		change func([]byte) []byte
+	}{
+		{"flipped bit", func(stored []byte) []byte {
+			stored[segmentSize+20] ^= 1
+			return stored
+		}},
+		{"truncated at a segment", func(stored []byte) []byte {
+			return stored[:2*(segmentSize+16)]
+		}},
+		{"truncated in a segment", func(stored []byte) []byte {
+			return stored[:len(stored)-10]
+		}},
+		{"extended", func(stored []byte) []byte {
+			return append(stored, stored[:segmentSize+16]...)
+		}},
+		{"segments swapped", func(stored []byte) []byte {
+			swapped := append([]byte{}, stored[segmentSize+16:2*(segmentSize+16)]...)
+			swapped = append(swapped, stored[:segmentSize+16]...)
+			return append(swapped, stored[2*(segmentSize+16):]...)
+		}},
+	}
+
+	for _, test := range tests {
+		root, local, store := newTestStores(t, "key1")
+
+		if err := store.Put("object", bytes.NewReader(data), int64(len(data)), nil); err != nil {
+			t.Fatalf("%s: Put failed, %v", test.name, err)
+		}
+		path := localFile(t, local, "object")
+		stored, err := ioutil.ReadFile(path)
+		if err != nil {
+			t.Fatalf("%s: Unable to read stored file, %v", test.name, err)
+		}
+		if err = ioutil.WriteFile(path, test.change(stored), 0600); err != nil {
+			t.Fatalf("%s: Unable to write stored file, %v", test.name, err)
+		}
+
+		if _, err = ReadAll(store, "object"); err == nil {
+			t.Errorf("%s: ReadAll succeeded", test.name)
+		}
+		os.RemoveAll(root)
+	}
+}
+
+func TestEncryptedWrongKey(t *testing.T) {
+	root, local, store := newTestStores(t, "key1")
+	defer os.RemoveAll(root)
+
+	if err := store.Put("object", strings.NewReader("secret"), 6, nil); err != nil {
+		t.Fatalf("Put failed, %v", err)
+	}
+
+	// Claim the data key was wrapped by the other key
+	objectInfo, err := local.Stat("object")
+	if err != nil {
+		t.Fatalf("Stat failed, %v", err)
+	}
+	objectInfo.Metadata[metadataKeyID] = "key2"
+	if err = local.putMetadata(localFile(t, local, "object"), objectInfo.Metadata); err != nil {
+		t.Fatalf("Unable to change metadata, %v", err)
+	}
+
+	if _, err = store.Get("object"); err == nil {
+		t.Errorf("Get with the wrong key succeeded")
+	}
+
+	// A store without the key can't read it at all
+	other, err := NewEncryptedStore(local, EncryptionConfig{KeyID: "key3", Keys: map[string]string{"key3": testKey1}})
+	if err != nil {
+		t.Fatalf("NewEncryptedStore failed, %v", err)
+	}
+	if _, err = other.Get("object"); err == nil {
+		t.Errorf("Get with an unknown key succeeded")
+	}
+}
+
+func TestEncryptedLegacyPlaintext(t *testing.T) {
+	root, local, store := newTestStores(t, "key1")
+	defer os.RemoveAll(root)
+
+	// Plaintext that happens to look like anything at all is still read as plaintext
+	data := []byte("SRENC\x01 stored before encryption")
+	if err := local.Put("object", bytes.NewReader(data), int64(len(data)), nil); err != nil {
+		t.Fatalf("Put failed, %v", err)
+	}
+
+	read, err := ReadAll(store, "object")
+	if err != nil {
+		t.Fatalf("ReadAll failed, %v", err)
+	}
+	if !bytes.Equal(read, data) {
+		t.Errorf("ReadAll = %q, want %q", read, data)
+	}
+}
+
+func TestEncryptedRotate(t *testing.T) {
+	root, local, oldStore := newTestStores(t, "key1")
+	defer os.RemoveAll(root)
+
+	objects := map[string][]byte{
+		"plaintext": randomData(t, segmentSize+5),
+		"old":       randomData(t, 100),
+	}
+	if err := local.Put("plaintext", bytes.NewReader(objects["plaintext"]), segmentSize+5, nil); err != nil {
+		t.Fatalf("Put failed, %v", err)
+	}
+	if err := oldStore.Put("old", bytes.NewReader(objects["old"]), 100, nil); err != nil {
+		t.Fatalf("Put failed, %v", err)
+	}
+	oldCiphertext, err := ioutil.ReadFile(localFile(t, local, "old"))
+	if err != nil {
+		t.Fatalf("Unable to read stored file, %v", err)
+	}
+
+	store := newTestEncryptedStore(t, local, "key2")
+	objects["new"] = randomData(t, 10)
+	if err = store.Put("new", bytes.NewReader(objects["new"]), 10, nil); err != nil {
+		t.Fatalf("Put failed, %v", err)
+	}
+
+	changed, err := store.Rotate()
+	if err != nil {
+		t.Fatalf("Rotate failed, %v", err)
+	}
+	if changed != 2 {
+		t.Errorf("Rotate changed %d objects, want 2", changed)
+	}
+
+	for key, data := range objects {
+		objectInfo, err := local.Stat(key)
+		if err != nil {
+			t.Fatalf("%s: Stat failed, %v", key, err)
+		}
+		if objectInfo.Metadata[metadataKeyID] != "key2" {
+			t.Errorf("%s: key ID = %q, want key2", key, objectInfo.Metadata[metadataKeyID])
+		}
+
+		read, err := ReadAll(store, key)
+		if err != nil {
+			t.Fatalf("%s: ReadAll failed, %v", key, err)
+		}
+		if !bytes.Equal(read, data) {
+			t.Errorf("%s: read data doesn't match", key)
+		}
+	}
+
+	// Re-wrapping leaves the data as it was
+	newCiphertext, err := ioutil.ReadFile(localFile(t, local, "old"))
+	if err != nil {
+		t.Fatalf("Unable to read stored file, %v", err)
+	}
+	if !bytes.Equal(oldCiphertext, newCiphertext) {
+		t.Errorf("Rotate re-encrypted an object that only needed re-wrapping")
+	}
+
+	// Once the old key is gone, everything is still readable
+	onlyNew, err := NewEncryptedStore(local, EncryptionConfig{KeyID: "key2", Keys: map[string]string{"key2": testKey2}})
+	if err != nil {
+		t.Fatalf("NewEncryptedStore failed, %v", err)
+	}
+	for key := range objects {
+		if _, err = ReadAll(onlyNew, key); err != nil {
+			t.Errorf("%s: ReadAll without the old key failed, %v", key, err)
+		}
+	}
+
+	if changed, err = store.Rotate(); err != nil || changed != 0 {
+		t.Errorf("Second Rotate = %d, %v, want nothing changed", changed, err)
+	}
+
+	// The metadata files aren't objects
+	keys, err := store.List("")
+	if err != nil {
+		t.Fatalf("List failed, %v", err)
+	}
+	for _, key := range keys {
+		if strings.Contains(filepath.Base(key), ".meta-") {
+			t.Errorf("List returned metadata file %s", key)
+		}
+	}
+}
@@ -0,0 +1,247 @@
+////////////////////////////////////////////////////////////////////////////
+//
+// Summit Route End Point Protection
+//
+// This source code is licensed under the BSD-style license found in the
+// LICENSE file in the root directory of this source tree.
+//
+/////////////////////////////////////////////////////////////////////////////
+
+package storage
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// tempPrefix marks files that are still being written
+const tempPrefix = ".tmp-"
+
+// metadataPrefix marks the JSON file that holds the metadata of the object with the rest of its name
+const metadataPrefix = ".meta-"
+
+// LocalStore keeps objects as files under a directory, for deployments without S3
+type LocalStore struct {
+	Root string
+}
+
+// NewLocalStore returns a LocalStore, creating the directory if needed
+func NewLocalStore(root string) (*LocalStore, error) {
+	if err := os.MkdirAll(root, 0700); err != nil {
+		return nil, fmt.Errorf("Unable to create storage directory: %v", err)
+	}
+	return &LocalStore{Root: root}, nil
+}
+
+// filePath returns where the key is kept, making sure it can't escape the root
+func (store *LocalStore) filePath(key string) (string, error) {
+	cleaned := path.Clean("/" + key)
+	if cleaned == "/" || strings.HasPrefix(path.Base(cleaned), tempPrefix) || strings.HasPrefix(path.Base(cleaned), metadataPrefix) {
+		return "", fmt.Errorf("Invalid key \"%s\"", key)
+	}
+	return filepath.Join(store.Root, filepath.FromSlash(cleaned)), nil
+}
+
+// metadataPath returns where the metadata of the file is kept
+func metadataPath(filePath string) string {
+	return filepath.Join(filepath.Dir(filePath), metadataPrefix+filepath.Base(filePath))
+}
+
+// writeTempFile copies r to a new temporary file in the directory and returns its name and size
+func writeTempFile(dir string, r io.Reader) (string, int64, error) {
+	outfile, err := ioutil.TempFile(dir, tempPrefix)
+	if err != nil {
+		return "", 0, err
+	}
+
+	written, err := io.Copy(outfile, r)
+	if err == nil {
+		err = outfile.Sync()
+	}
+	outfile.Close()
+	if err != nil {
+		os.Remove(outfile.Name())
+		return "", 0, err
+	}
+	return outfile.Name(), written, nil
+}
+
+// Put writes the object and its metadata to temporary files, then renames the object into place followed by its
+// metadata, so readers never see a partial object and the metadata never describes an object that isn't there yet.
+// The two renames aren't atomic together: until the second one, or for good if it fails, a reader sees the new object
+// with the old metadata.
+func (store *LocalStore) Put(key string, r io.Reader, size int64, metadata map[string]string) error {
+	filePath, err := store.filePath(key)
+	if err != nil {
+		return err
+	}
+
+	if err = os.MkdirAll(filepath.Dir(filePath), 0700); err != nil {
+		return err
+	}
+
+	tempPath, written, err := writeTempFile(filepath.Dir(filePath), r)
+	if err != nil {
+		return err
+	}
+	if written != size {
+		os.Remove(tempPath)
+		return fmt.Errorf("Wrote %d bytes, expected %d", written, size)
+	}
+
+	metadataTempPath := ""
+	if len(metadata) != 0 {
+		if metadataTempPath, err = writeMetadata(filePath, metadata); err != nil {
+			os.Remove(tempPath)
+			return err
+		}
+	}
+
+	if err = os.Rename(tempPath, filePath); err != nil {
+		os.Remove(tempPath)
+		if metadataTempPath != "" {
+			os.Remove(metadataTempPath)
+		}
+		return err
+	}
+
+	if metadataTempPath == "" {
+		if err = os.Remove(metadataPath(filePath)); os.IsNotExist(err) {
+			err = nil
+		}
+		return err
+	}
+	if err = os.Rename(metadataTempPath, metadataPath(filePath)); err != nil {
+		os.Remove(metadataTempPath)
+		return err
+	}
+	return nil
+}
+
+// writeMetadata writes the metadata of the file to a temporary file beside it, returning the temporary file's path
+func writeMetadata(filePath string, metadata map[string]string) (string, error) {
+	contents, err := json.Marshal(metadata)
+	if err != nil {
+		return "", err
+	}
+
+	tempPath, _, err := writeTempFile(filepath.Dir(filePath), bytes.NewReader(contents))
+	return tempPath, err
+}
+
+// putMetadata replaces the metadata of the file
+func (store *LocalStore) putMetadata(filePath string, metadata map[string]string) error {
+	tempPath, err := writeMetadata(filePath, metadata)
+	if err != nil {
+		return err
+	}
+	if err = os.Rename(tempPath, metadataPath(filePath)); err != nil {
+		os.Remove(tempPath)
+		return err
+	}
+	return nil
+}
+
+// Get opens the file for the key
+func (store *LocalStore) Get(key string) (io.ReadCloser, error) {
+	filePath, err := store.filePath(key)
+	if err != nil {
+		return nil, err
+	}
+
+	f, err := os.Open(filePath)
+	if os.IsNotExist(err) {
+		return nil, ErrNotFound
+	}
+	return f, err
+}
+
+// Stat returns the size and modification time of the file for the key
+func (store *LocalStore) Stat(key string) (*ObjectInfo, error) {
+	filePath, err := store.filePath(key)
+	if err != nil {
+		return nil, err
+	}
+
+	fileInfo, err := os.Stat(filePath)
+	if os.IsNotExist(err) {
+		return nil, ErrNotFound
+	} else if err != nil {
+		return nil, err
+	}
+	if fileInfo.IsDir() {
+		return nil, ErrNotFound
+	}
+
+	var metadata map[string]string
+	contents, err := ioutil.ReadFile(metadataPath(filePath))
+	if err == nil {
+		err = json.Unmarshal(contents, &metadata)
+	} else if os.IsNotExist(err) {
+		err = nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("Unable to read metadata of %s: %v", key, err)
+	}
+
+	return &ObjectInfo{
+		Key:          key,
+		Size:         fileInfo.Size(),
+		LastModified: fileInfo.ModTime().Unix(),
+		Metadata:     metadata,
+	}, nil
+}
+
+// Delete removes the file for the key
+func (store *LocalStore) Delete(key string) error {
+	filePath, err := store.filePath(key)
+	if err != nil {
+		return err
+	}
+
+	err = os.Remove(filePath)
+	if os.IsNotExist(err) {
+		return ErrNotFound
+	} else if err != nil {
+		return err
+	}
+
+	if err = os.Remove(metadataPath(filePath)); os.IsNotExist(err) {
+		err = nil
+	}
+	return err
+}
+
+// List walks the directory for files whose key starts with prefix
+func (store *LocalStore) List(prefix string) ([]string, error) {
+	var keys []string
+
+	err := filepath.Walk(store.Root, func(filePath string, fileInfo os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if fileInfo.IsDir() || strings.HasPrefix(fileInfo.Name(), tempPrefix) || strings.HasPrefix(fileInfo.Name(), metadataPrefix) {
+			return nil
+		}
+
+		relativePath, err := filepath.Rel(store.Root, filePath)
+		if err != nil {
+			return err
+		}
+
+		key := filepath.ToSlash(relativePath)
+		if strings.HasPrefix(key, prefix) {
+			keys = append(keys, key)
+		}
+		return nil
+	})
+
+	return keys, err
+}
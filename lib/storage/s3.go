@@ -0,0 +1,151 @@
+////////////////////////////////////////////////////////////////////////////
+//
+// Summit Route End Point Protection
+//
+// This source code is licensed under the BSD-style license found in the
+// LICENSE file in the root directory of this source tree.
+//
+/////////////////////////////////////////////////////////////////////////////
+
+package storage
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/crowdmob/goamz/aws"
+	"github.com/crowdmob/goamz/s3"
+
+	"qdserver/lib/utils"
+)
+
+// s3ListMax is the number of keys asked for per List request
+const s3ListMax = 1000
+
+// s3MetadataHeader starts the headers S3 keeps an object's metadata in
+const s3MetadataHeader = "X-Amz-Meta-"
+
+// S3Store keeps objects in an S3 bucket, or in a bucket on an S3 compatible server when an Endpoint is given
+type S3Store struct {
+	bucket *s3.Bucket
+}
+
+// NewS3Store returns a S3Store for the bucket
+func NewS3Store(awsS3 utils.AwsS3) *S3Store {
+	auth := aws.Auth{AccessKey: awsS3.AccessKey, SecretKey: awsS3.SecretKey}
+
+	region, ok := aws.Regions[awsS3.Region]
+	if !ok {
+		region = aws.Regions["us-east-1"]
+	}
+	if awsS3.Endpoint != "" {
+		region = aws.Region{Name: awsS3.Region, S3Endpoint: awsS3.Endpoint}
+	}
+
+	s3Service := s3.New(auth, region)
+	return &S3Store{bucket: s3Service.Bucket(awsS3.BucketName)}
+}
+
+// isNotFound checks if S3 told us the key doesn't exist
+func isNotFound(err error) bool {
+	if s3Err, ok := err.(*s3.Error); ok {
+		return s3Err.StatusCode == http.StatusNotFound
+	}
+	return false
+}
+
+// Put uploads the object, with its metadata as x-amz-meta- headers
+func (store *S3Store) Put(key string, r io.Reader, size int64, metadata map[string]string) error {
+	options := s3.Options{
+		ContentDisposition: fmt.Sprintf("attachment; filename=\"%s\"", path.Base(key)),
+		Meta:               make(map[string][]string),
+	}
+	for name, value := range metadata {
+		options.Meta[name] = []string{value}
+	}
+	return store.bucket.PutReader(key, r, size, "binary/octet-stream", s3.Private, options)
+}
+
+// Get downloads the object
+func (store *S3Store) Get(key string) (io.ReadCloser, error) {
+	r, err := store.bucket.GetReader(key)
+	if isNotFound(err) {
+		return nil, ErrNotFound
+	}
+	return r, err
+}
+
+// Stat asks for the object's headers
+func (store *S3Store) Stat(key string) (*ObjectInfo, error) {
+	resp, err := store.bucket.Head(key, nil)
+	if isNotFound(err) {
+		return nil, ErrNotFound
+	} else if err != nil {
+		return nil, err
+	}
+	resp.Body.Close()
+
+	size, err := strconv.ParseInt(resp.Header.Get("Content-Length"), 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("Unable to parse size of %s: %v", key, err)
+	}
+
+	var lastModified int64
+	if modified, err := time.Parse(http.TimeFormat, resp.Header.Get("Last-Modified")); err == nil {
+		lastModified = modified.Unix()
+	}
+
+	metadata := make(map[string]string)
+	for header, values := range resp.Header {
+		if strings.HasPrefix(header, s3MetadataHeader) && len(values) != 0 {
+			metadata[strings.ToLower(header[len(s3MetadataHeader):])] = values[0]
+		}
+	}
+
+	return &ObjectInfo{
+		Key:          key,
+		Size:         size,
+		LastModified: lastModified,
+		Metadata:     metadata,
+	}, nil
+}
+
+// Delete removes the object.  S3 doesn't complain about missing keys, so we check first.
+func (store *S3Store) Delete(key string) error {
+	if _, err := store.Stat(key); err != nil {
+		return err
+	}
+	return store.bucket.Del(key)
+}
+
+// List pages through the keys in the bucket that start with prefix
+func (store *S3Store) List(prefix string) ([]string, error) {
+	var keys []string
+
+	marker := ""
+	for {
+		resp, err := store.bucket.List(prefix, "", marker, s3ListMax)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, key := range resp.Contents {
+			keys = append(keys, key.Key)
+		}
+
+		if !resp.IsTruncated || len(resp.Contents) == 0 {
+			break
+		}
+		marker = resp.NextMarker
+		if marker == "" {
+			marker = resp.Contents[len(resp.Contents)-1].Key
+		}
+	}
+
+	return keys, nil
+}
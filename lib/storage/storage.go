@@ -0,0 +1,121 @@
+////////////////////////////////////////////////////////////////////////////
+//
+// Summit Route End Point Protection
+//
+// This source code is licensed under the BSD-style license found in the
+// LICENSE file in the root directory of this source tree.
+//
+/////////////////////////////////////////////////////////////////////////////
+
+package storage
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+
+	"qdserver/lib/utils"
+)
+
+// ErrNotFound is returned when the key does not exist in the Store
+var ErrNotFound = errors.New("storage: object not found")
+
+// ObjectInfo describes an object in a Store
+type ObjectInfo struct {
+	Key          string
+	Size         int64
+	LastModified int64             // Unix time
+	Metadata     map[string]string // Kept alongside the object, such as how it is encrypted
+}
+
+// Store holds blobs such as uploaded executables, catalogs, and agent updates.
+// Keys are slash separated paths, and files named by their hash are kept under HashKey.
+type Store interface {
+	// Put stores size bytes read from r under key, replacing anything already there.  The metadata, which may be nil,
+	// replaces the object's metadata.  Names are lowercase letters, digits, and dashes, and values are ASCII.
+	Put(key string, r io.Reader, size int64, metadata map[string]string) error
+
+	// Get opens the object for reading.  The caller must close it.
+	Get(key string) (io.ReadCloser, error)
+
+	// Stat returns information about the object, including its metadata, or ErrNotFound
+	Stat(key string) (*ObjectInfo, error)
+
+	// Delete removes the object, or returns ErrNotFound
+	Delete(key string) error
+
+	// List returns the keys that start with prefix
+	List(prefix string) ([]string, error)
+}
+
+// Config is used in config.json files to select a Store
+type Config struct {
+	Type string      `json:"type"` // "local" or "s3"
+	Path string      `json:"path"` // Directory used by the local store
+	S3   utils.AwsS3 `json:"s3"`   // Bucket used by the s3 store
+
+	Encryption *EncryptionConfig `json:"encryption"` // Encrypt everything stored, if given
+}
+
+// New returns the Store described by the config
+func New(config Config) (Store, error) {
+	var store Store
+	var err error
+
+	switch config.Type {
+	case "local":
+		if config.Path == "" {
+			return nil, fmt.Errorf("No path given for local storage")
+		}
+		store, err = NewLocalStore(config.Path)
+		if err != nil {
+			return nil, err
+		}
+	case "s3":
+		if config.S3.BucketName == "" {
+			return nil, fmt.Errorf("No bucket given for s3 storage")
+		}
+		store = NewS3Store(config.S3)
+	default:
+		return nil, fmt.Errorf("Unknown storage type \"%s\"", config.Type)
+	}
+
+	if config.Encryption != nil {
+		return NewEncryptedStore(store, *config.Encryption)
+	}
+	return store, nil
+}
+
+// HashKey returns the key a file named by its hex encoded sha256 is stored under
+func HashKey(sha256HexString string) string {
+	return utils.ExpandSha256HexstringToPath(sha256HexString)
+}
+
+// PutFile stores the contents of f under key
+func PutFile(store Store, key string, f *os.File) error {
+	// Seek to the start of the file
+	offset, err := f.Seek(0, 0)
+	if err != nil || offset != 0 {
+		return fmt.Errorf("Unable to seek to start of file: %v", err)
+	}
+
+	fileInfo, err := f.Stat()
+	if err != nil {
+		return fmt.Errorf("Unable to stat file: %v", err)
+	}
+
+	return store.Put(key, f, fileInfo.Size(), nil)
+}
+
+// ReadAll returns the contents of the object
+func ReadAll(store Store, key string) ([]byte, error) {
+	r, err := store.Get(key)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+
+	return ioutil.ReadAll(r)
+}
@@ -13,8 +13,13 @@ package utils
 import (
 	"crypto/aes"
 	"crypto/cipher"
+	"crypto/hmac"
 	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
 	"errors"
+	"fmt"
+	"hash"
 	"io"
 )
 
@@ -56,3 +61,52 @@ func SymmetricDecrypt(key []byte, input []byte) ([]byte, error) {
 
 	return text, nil
 }
+
+// GenerateSecret returns a random key, such as the one an agent signs its requests with
+func GenerateSecret() ([]byte, error) {
+	secret := make([]byte, 32)
+	if _, err := io.ReadFull(rand.Reader, secret); err != nil {
+		return nil, err
+	}
+	return secret, nil
+}
+
+// SignAgentRequest returns the HMAC-SHA256 of a request from an agent.
+// The signed message is the method, request URI, timestamp, nonce, and hex encoded sha256 of the body, separated by newlines.
+// The agent also sends the body's sha256 in a header, so the signature can be checked before the body is read.
+func SignAgentRequest(secret []byte, method string, requestURI string, timestamp int64, nonce string, bodySha256 []byte) []byte {
+	mac := hmac.New(sha256.New, secret)
+	fmt.Fprintf(mac, "%s\n%s\n%d\n%s\n%s", method, requestURI, timestamp, nonce, hex.EncodeToString(bodySha256))
+	return mac.Sum(nil)
+}
+
+// ErrBodyMismatch is returned at the end of a body read through VerifyBody if it doesn't match its sha256
+var ErrBodyMismatch = errors.New("Body does not match its sha256")
+
+// verifiedBody hashes a body as it is read
+type verifiedBody struct {
+	body       io.ReadCloser
+	hasher     hash.Hash
+	bodySha256 []byte
+}
+
+// VerifyBody returns a reader that hashes the body as it streams through, and returns ErrBodyMismatch instead of
+// io.EOF if it doesn't match bodySha256.  Nothing read from it should be trusted until it has returned io.EOF.
+func VerifyBody(body io.ReadCloser, bodySha256 []byte) io.ReadCloser {
+	return &verifiedBody{body: body, hasher: sha256.New(), bodySha256: bodySha256}
+}
+
+// Read reads from the body, checking its hash at the end
+func (body *verifiedBody) Read(p []byte) (int, error) {
+	n, err := body.body.Read(p)
+	body.hasher.Write(p[:n])
+	if err == io.EOF && !hmac.Equal(body.hasher.Sum(nil), body.bodySha256) {
+		err = ErrBodyMismatch
+	}
+	return n, err
+}
+
+// Close closes the body
+func (body *verifiedBody) Close() error {
+	return body.body.Close()
+}
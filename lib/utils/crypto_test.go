@@ -0,0 +1,43 @@
+////////////////////////////////////////////////////////////////////////////
+//
+// Summit Route End Point Protection
+//
+// This source code is licensed under the BSD-style license found in the
+// LICENSE file in the root directory of this source tree.
+//
+/////////////////////////////////////////////////////////////////////////////
+
+package utils
+
+import (
+	"crypto/sha256"
+	"io/ioutil"
+	"strings"
+	"testing"
+)
+
+func TestVerifyBody(t *testing.T) {
+	bodySha256 := sha256.Sum256([]byte("the body"))
+
+	tests := []struct {
+		name string
+		body string
+		err  error
+	}{
+		{"matching", "the body", nil},
+		{"changed", "the bodY", ErrBodyMismatch},
+		{"truncated", "the bod", ErrBodyMismatch},
+		{"extended", "the body and more", ErrBodyMismatch},
+	}
+
+	for _, test := range tests {
+		body := VerifyBody(ioutil.NopCloser(strings.NewReader(test.body)), bodySha256[:])
+		read, err := ioutil.ReadAll(body)
+		if err != test.err {
+			t.Errorf("%s: ReadAll error = %v, want %v", test.name, err, test.err)
+		}
+		if string(read) != test.body {
+			t.Errorf("%s: read %q, want %q", test.name, read, test.body)
+		}
+	}
+}
@@ -11,7 +11,9 @@ package utils
 
 import (
 	"database/sql"
+	"fmt"
 	"qdserver/lib/models"
+	"strings"
 	"time"
 
 	log "github.com/Sirupsen/logrus"
@@ -22,7 +24,7 @@ import (
 //
 // Inserts or updates the table to show this file has been seen on this system and provide some meta data
 //
-func RecordFileSeenOnSystem(db *gorp.DbMap, fileID int64, systemID int64, timeOfEvent int64, filePath string) (err error) {
+func RecordFileSeenOnSystem(db *gorp.DbMap, fileID int64, systemID int64, timeOfEvent int64, filePathID int64) (err error) {
 	var fileToSystemMap models.FileToSystemMap
 
 	// Check if we have a copy
@@ -36,7 +38,7 @@ func RecordFileSeenOnSystem(db *gorp.DbMap, fileID int64, systemID int64, timeOf
 
 	// Set common values whether we add or update it
 	fileToSystemMap.LastSeen = timeOfEvent
-	fileToSystemMap.FilePath = filePath
+	fileToSystemMap.FilePathID = filePathID
 
 	if err == sql.ErrNoRows {
 		// This file has not been seen on this system, so add it
@@ -55,6 +57,82 @@ func RecordFileSeenOnSystem(db *gorp.DbMap, fileID int64, systemID int64, timeOf
 	return
 }
 
+// FileSighting is when a file was seen on a system, for RecordFilesSeenOnSystem
+type FileSighting struct {
+	FirstSeen  int64
+	LastSeen   int64
+	FilePathID int64 // Path when it was last seen
+}
+
+// RecordFilesSeenOnSystem is RecordFileSeenOnSystem for many files at once, which may have been seen out of order.
+// The db may be a transaction.
+func RecordFilesSeenOnSystem(db gorp.SqlExecutor, systemID int64, sightings map[int64]*FileSighting) error {
+	if len(sightings) == 0 {
+		return nil
+	}
+
+	// Find what we already have
+	params := map[string]interface{}{
+		"systemID": systemID,
+	}
+	var fileIDs []string
+	for fileID := range sightings {
+		name := fmt.Sprintf("fileID%d", len(fileIDs))
+		params[name] = fileID
+		fileIDs = append(fileIDs, ":"+name)
+	}
+
+	var existing []models.FileToSystemMap
+	_, err := db.Select(&existing, fmt.Sprintf(`SELECT *
+      FROM FileToSystemMap
+      WHERE SystemID=:systemID and FileID in (%s)`, strings.Join(fileIDs, ",")),
+		params)
+	if err != nil {
+		return err
+	}
+
+	// Update those
+	found := make(map[int64]bool)
+	for i := range existing {
+		fileToSystemMap := &existing[i]
+		sighting := sightings[fileToSystemMap.FileID]
+		found[fileToSystemMap.FileID] = true
+
+		if sighting.FirstSeen >= fileToSystemMap.FirstSeen && sighting.LastSeen <= fileToSystemMap.LastSeen {
+			continue
+		}
+		if sighting.FirstSeen < fileToSystemMap.FirstSeen {
+			fileToSystemMap.FirstSeen = sighting.FirstSeen
+		}
+		if sighting.LastSeen > fileToSystemMap.LastSeen {
+			fileToSystemMap.LastSeen = sighting.LastSeen
+			fileToSystemMap.FilePathID = sighting.FilePathID
+		}
+		if _, err = db.Update(fileToSystemMap); err != nil {
+			return err
+		}
+	}
+
+	// Add the rest
+	var inserts []interface{}
+	for fileID, sighting := range sightings {
+		if found[fileID] {
+			continue
+		}
+		inserts = append(inserts, &models.FileToSystemMap{
+			FileID:     fileID,
+			SystemID:   systemID,
+			FilePathID: sighting.FilePathID,
+			FirstSeen:  sighting.FirstSeen,
+			LastSeen:   sighting.LastSeen,
+		})
+	}
+	if len(inserts) != 0 {
+		return db.Insert(inserts...)
+	}
+	return nil
+}
+
 // GetNullString returns the string value if valid, else the default value
 func GetNullString(str sql.NullString, defaultStr string) string {
 	if str.Valid != true {
@@ -92,6 +170,47 @@ func GetSystemIDFromUUID(db *gorp.DbMap, SystemUUIDString string, CustomerUUIDSt
 	return SystemID, nil
 }
 
+// RecordSystemChanges adds a SystemHistory row for each inventory field that differs between the
+// before and after copies of a system.  The db may be a transaction.
+func RecordSystemChanges(db gorp.SqlExecutor, before *models.System, after *models.System) error {
+	fields := []struct {
+		name     string
+		oldValue string
+		newValue string
+	}{
+		{"AgentVersion", before.AgentVersion, after.AgentVersion},
+		{"OSHumanName", before.OSHumanName, after.OSHumanName},
+		{"OSVersion", before.OSVersion, after.OSVersion},
+		{"Manufacturer", before.Manufacturer, after.Manufacturer},
+		{"Model", before.Model, after.Model},
+		{"MachineGUID", before.MachineGUID, after.MachineGUID},
+		{"Arch", before.Arch, after.Arch},
+		{"MachineName", before.MachineName, after.MachineName},
+		{"IPAddresses", before.IPAddresses, after.IPAddresses},
+		{"LoggedOnUser", before.LoggedOnUser, after.LoggedOnUser},
+	}
+
+	now := DBTimeNow()
+	var inserts []interface{}
+	for _, field := range fields {
+		if field.oldValue == field.newValue {
+			continue
+		}
+		inserts = append(inserts, &models.SystemHistory{
+			SystemID:   after.ID,
+			ChangeTime: now,
+			Field:      field.name,
+			OldValue:   field.oldValue,
+			NewValue:   field.newValue,
+		})
+	}
+
+	if len(inserts) == 0 {
+		return nil
+	}
+	return db.Insert(inserts...)
+}
+
 // DBTimeNow returns the current unix time as suitable for the database
 func DBTimeNow() int64 {
 	return time.Now().UTC().Unix()
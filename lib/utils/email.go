@@ -127,3 +127,18 @@ func sendMail(awsSes AwsSes, from string, to string, subject string, body string
 	}
 	return resp.SendEmailResult.MessageId, err
 }
+
+// SendSystemOfflineEmail tells a user that one of their systems has stopped checking in
+func SendSystemOfflineEmail(awsSes AwsSes, emailAddress string, systemName string, lastSeen int64, url string) (err error) {
+	log.Infof("System offline email being sent to %s for %s", emailAddress, systemName)
+
+	body := fmt.Sprintf("The system %s has not checked in since %s.\n\n"+
+		"This happens when a system is turned off or loses its network connection, but is also what you would see if an attacker stopped the agent.  "+
+		"If you don't expect this system to be offline, you should look into it:\n\n%s",
+		systemName, Int64ToUnixTimeString(lastSeen, false), url)
+	response, err := sendMail(awsSes, "Summit Route <do_not_reply@summitroute.com>", emailAddress, fmt.Sprintf("System offline: %s", systemName), body)
+
+	log.Infof("System offline email response: %s", response)
+
+	return err
+}
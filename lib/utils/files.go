@@ -58,6 +58,7 @@ type AwsS3 struct {
 	AccessKey  string `json:"access_key"`
 	SecretKey  string `json:"secret_key"`
 	Region     string `json:"region"`
+	Endpoint   string `json:"endpoint"` // Only needed for S3 compatible servers that aren't AWS
 }
 
 // UploadToS3HashPath given a filename that is a hex encoded hash, create a special directory structure for this file
@@ -0,0 +1,228 @@
+////////////////////////////////////////////////////////////////////////////
+//
+// Summit Route End Point Protection
+//
+// This source code is licensed under the BSD-style license found in the
+// LICENSE file in the root directory of this source tree.
+//
+/////////////////////////////////////////////////////////////////////////////
+
+package utils
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"strings"
+
+	"github.com/coopernurse/gorp"
+)
+
+// internQueryLength is the number of hashes looked up per query when interning strings
+const internQueryLength = 500
+
+// pathPrefixes are replaced at the start of a lowercased path.  Environment variables and \SystemRoot are expanded to
+// their usual values, as we don't know where Windows is installed on each system.
+var pathPrefixes = []struct {
+	prefix      string
+	replacement string
+}{
+	{`\??\globalroot\`, `\`},
+	{`\\?\globalroot\`, `\`},
+	{`\??\unc\`, `\\`},
+	{`\\?\unc\`, `\\`},
+	{`\??\`, ``},
+	{`\\?\`, ``},
+	{`\systemroot\`, `c:\windows\`},
+	{`%systemroot%`, `c:\windows`},
+	{`%windir%`, `c:\windows`},
+	{`%systemdrive%`, `c:`},
+	{`%programfiles%`, `c:\program files`},
+	{`%programfiles(x86)%`, `c:\program files (x86)`},
+	{`%programdata%`, `c:\programdata`},
+	{`system32\`, `c:\windows\system32\`}, // Drivers are often loaded relative to SystemRoot
+}
+
+// shortNames are the 8.3 names of common directories.  Other short names can't be expanded without looking at the
+// disk, so are left as they are.
+var shortNames = map[string]string{
+	"progra~1": "program files",
+	"progra~2": "program files (x86)",
+	"progra~3": "programdata",
+	"docume~1": "documents and settings",
+	"common~1": "common files",
+	"locals~1": "local settings",
+	"applic~1": "application data",
+}
+
+// CanonicalizePath converts a Windows path to the form we store, so the same file is always stored with the same path.
+// Paths are case-insensitive, so are lowercased, and only \ is used as a separator.  NT prefixes such as \??\ are
+// removed, common environment variables and 8.3 names are expanded, and repeated or trailing separators are removed.
+// Device paths such as \Device\HarddiskVolume2 can't be mapped to a drive letter without the system's mount points,
+// so are kept as device paths.
+func CanonicalizePath(path string) string {
+	path = strings.ToLower(strings.Trim(strings.TrimSpace(path), `"`))
+	path = strings.Replace(path, "/", `\`, -1)
+
+	for _, prefix := range pathPrefixes {
+		if strings.HasPrefix(path, prefix.prefix) {
+			path = prefix.replacement + path[len(prefix.prefix):]
+			break
+		}
+	}
+
+	// \\.\c:\ is the same as c:\, but leave other devices such as \\.\pipe alone
+	if strings.HasPrefix(path, `\\.\`) && len(path) >= 6 && path[5] == ':' {
+		path = path[4:]
+	}
+
+	// Keep the \\ of a UNC path, and the \ of a path from the root of the current drive or a device
+	start := ""
+	if strings.HasPrefix(path, `\\`) {
+		start = `\\`
+		path = path[2:]
+	} else if strings.HasPrefix(path, `\`) {
+		start = `\`
+	}
+
+	var components []string
+	for _, component := range strings.Split(path, `\`) {
+		if component == "" {
+			continue
+		}
+		if longName, ok := shortNames[component]; ok {
+			component = longName
+		}
+		components = append(components, component)
+	}
+
+	path = start + strings.Join(components, `\`)
+	if len(path) == 2 && path[1] == ':' {
+		// The root of a drive keeps its separator
+		path += `\`
+	}
+
+	return path
+}
+
+// PathFilterValue converts a path a user is filtering by, so it compares the same way as the stored paths.  Exact
+// matches are canonicalized, but partial paths, such as those used with "contains", are only lowercased and have
+// their separators fixed, as canonicalizing may add to them.
+func PathFilterValue(jsonOperator string, value string) string {
+	if jsonOperator == "==" || jsonOperator == "!=" {
+		return CanonicalizePath(value)
+	}
+	return strings.ToLower(strings.Replace(value, "/", `\`, -1))
+}
+
+// idAndHash is used to look up interned strings by their hash
+type idAndHash struct {
+	ID   int64
+	Hash []byte
+}
+
+// internStrings returns the IDs of the values in the column of the table, adding those that aren't there yet.
+// Values are found by the sha256 in the table's Hash column, which is unique.  The empty string has an ID of 0 and
+// isn't stored.  The db may be a transaction.
+func internStrings(db gorp.SqlExecutor, table string, column string, values []string) (map[string]int64, error) {
+	ids := map[string]int64{"": 0}
+
+	// Hash each value once
+	hashes := make(map[string][]byte)
+	var unique []string
+	for _, value := range values {
+		if _, ok := hashes[value]; ok || value == "" {
+			continue
+		}
+		hash := sha256.Sum256([]byte(value))
+		hashes[value] = hash[:]
+		unique = append(unique, value)
+	}
+
+	// Find the ones we have
+	found := make(map[string]int64)
+	for start := 0; start < len(unique); start += internQueryLength {
+		end := start + internQueryLength
+		if end > len(unique) {
+			end = len(unique)
+		}
+
+		params := make(map[string]interface{})
+		var names []string
+		for i, value := range unique[start:end] {
+			name := fmt.Sprintf("hash%d", i)
+			params[name] = hashes[value]
+			names = append(names, ":"+name)
+		}
+
+		var rows []idAndHash
+		_, err := db.Select(&rows, fmt.Sprintf("SELECT ID, Hash FROM %s WHERE Hash in (%s)", table, strings.Join(names, ",")), params)
+		if err != nil {
+			return nil, err
+		}
+		for _, row := range rows {
+			found[hex.EncodeToString(row.Hash)] = row.ID
+		}
+	}
+
+	// Add the rest
+	for _, value := range unique {
+		if id, ok := found[hex.EncodeToString(hashes[value])]; ok {
+			ids[value] = id
+			continue
+		}
+
+		id, err := db.SelectInt(fmt.Sprintf("INSERT INTO %s (Hash, %s) VALUES ($1, $2) RETURNING ID", table, column), hashes[value], value)
+		if err != nil {
+			return nil, err
+		}
+		ids[value] = id
+	}
+
+	return ids, nil
+}
+
+// InternFilePaths returns the IDs in the filepaths table of the canonical forms of the paths, adding those that aren't
+// there yet.  The IDs are keyed by the paths as given, and empty paths have an ID of 0.  The db may be a transaction.
+func InternFilePaths(db gorp.SqlExecutor, paths []string) (map[string]int64, error) {
+	canonicalPaths := make([]string, len(paths))
+	for i, path := range paths {
+		canonicalPaths[i] = CanonicalizePath(path)
+	}
+
+	canonicalIDs, err := internStrings(db, "filepaths", "Path", canonicalPaths)
+	if err != nil {
+		return nil, err
+	}
+
+	ids := make(map[string]int64)
+	for i, path := range paths {
+		ids[path] = canonicalIDs[canonicalPaths[i]]
+	}
+	return ids, nil
+}
+
+// InternFilePath is InternFilePaths for a single path
+func InternFilePath(db gorp.SqlExecutor, path string) (int64, error) {
+	ids, err := InternFilePaths(db, []string{path})
+	if err != nil {
+		return 0, err
+	}
+	return ids[path], nil
+}
+
+// InternCommandLines returns the IDs in the commandlines table of the command lines, adding those that aren't there
+// yet.  Command lines are kept as they are, as their arguments may be case-sensitive.  Empty command lines have an ID
+// of 0.  The db may be a transaction.
+func InternCommandLines(db gorp.SqlExecutor, commandLines []string) (map[string]int64, error) {
+	return internStrings(db, "commandlines", "CommandLine", commandLines)
+}
+
+// InternCommandLine is InternCommandLines for a single command line
+func InternCommandLine(db gorp.SqlExecutor, commandLine string) (int64, error) {
+	ids, err := InternCommandLines(db, []string{commandLine})
+	if err != nil {
+		return 0, err
+	}
+	return ids[commandLine], nil
+}
@@ -0,0 +1,90 @@
+////////////////////////////////////////////////////////////////////////////
+//
+// Summit Route End Point Protection
+//
+// This source code is licensed under the BSD-style license found in the
+// LICENSE file in the root directory of this source tree.
+//
+/////////////////////////////////////////////////////////////////////////////
+
+package utils
+
+import (
+	"testing"
+)
+
+func TestCanonicalizePath(t *testing.T) {
+	tests := []struct {
+		path string
+		want string
+	}{
+		// Case and separators
+		{`C:\Windows\System32\NOTEPAD.EXE`, `c:\windows\system32\notepad.exe`},
+		{`c:/windows/system32/notepad.exe`, `c:\windows\system32\notepad.exe`},
+		{`C:\Windows\\System32\\\notepad.exe`, `c:\windows\system32\notepad.exe`},
+		{`C:\Windows\System32\`, `c:\windows\system32`},
+		{`C:\`, `c:\`},
+		{`C:`, `c:\`},
+		{` "C:\Program Files\App\app.exe" `, `c:\program files\app\app.exe`},
+
+		// NT prefixes
+		{`\??\C:\Windows\notepad.exe`, `c:\windows\notepad.exe`},
+		{`\\?\C:\Windows\notepad.exe`, `c:\windows\notepad.exe`},
+		{`\\.\C:\Windows\notepad.exe`, `c:\windows\notepad.exe`},
+		{`\??\UNC\server\share\app.exe`, `\\server\share\app.exe`},
+		{`\\?\UNC\server\share\app.exe`, `\\server\share\app.exe`},
+		{`\\Server\Share\\app.exe`, `\\server\share\app.exe`},
+		{`\\.\pipe\name`, `\\.\pipe\name`},
+
+		// Device paths are kept, as we don't know which drive they are
+		{`\Device\HarddiskVolume2\Windows\notepad.exe`, `\device\harddiskvolume2\windows\notepad.exe`},
+		{`\\?\GLOBALROOT\Device\HarddiskVolume2\Windows\notepad.exe`, `\device\harddiskvolume2\windows\notepad.exe`},
+		{`\??\GLOBALROOT\Device\HarddiskVolume2\Windows\notepad.exe`, `\device\harddiskvolume2\windows\notepad.exe`},
+
+		// Where Windows is
+		{`%SystemRoot%\System32\notepad.exe`, `c:\windows\system32\notepad.exe`},
+		{`%windir%\notepad.exe`, `c:\windows\notepad.exe`},
+		{`\SystemRoot\System32\drivers\null.sys`, `c:\windows\system32\drivers\null.sys`},
+		{`System32\drivers\null.sys`, `c:\windows\system32\drivers\null.sys`},
+		{`%SystemDrive%\app.exe`, `c:\app.exe`},
+		{`%ProgramFiles(x86)%\App\app.exe`, `c:\program files (x86)\app\app.exe`},
+		{`%ProgramData%\App\app.exe`, `c:\programdata\app\app.exe`},
+
+		// 8.3 names
+		{`C:\PROGRA~1\App\app.exe`, `c:\program files\app\app.exe`},
+		{`C:\PROGRA~2\App\app.exe`, `c:\program files (x86)\app\app.exe`},
+		{`C:\DOCUME~1\User\LOCALS~1\APPLIC~1\app.exe`, `c:\documents and settings\user\local settings\application data\app.exe`},
+		{`C:\Users\LONGUS~1\app.exe`, `c:\users\longus~1\app.exe`},
+
+		// Things that aren't really paths are kept, only lowercased
+		{``, ``},
+		{`""`, ``},
+		{`\`, `\`},
+		{`\Windows\notepad.exe`, `\windows\notepad.exe`},
+		{`\\`, `\\`},
+		{`notepad.exe`, `notepad.exe`},
+		{`%UNKNOWN%\App.exe`, `%unknown%\app.exe`},
+		{`::$DATA`, `::$data`},
+	}
+
+	for _, test := range tests {
+		got := CanonicalizePath(test.path)
+		if got != test.want {
+			t.Errorf("CanonicalizePath(%q) = %q, want %q", test.path, got, test.want)
+		}
+
+		// Canonical paths stay as they are
+		if again := CanonicalizePath(got); again != got {
+			t.Errorf("CanonicalizePath(%q) = %q, isn't canonical", got, again)
+		}
+	}
+}
+
+func TestPathFilterValue(t *testing.T) {
+	if value := PathFilterValue("==", `%SystemRoot%\Notepad.exe`); value != `c:\windows\notepad.exe` {
+		t.Errorf("PathFilterValue of an exact match = %q", value)
+	}
+	if value := PathFilterValue("contains", `System32/Drivers`); value != `system32\drivers` {
+		t.Errorf("PathFilterValue of a partial path = %q", value)
+	}
+}
@@ -0,0 +1,38 @@
+////////////////////////////////////////////////////////////////////////////
+//
+// Summit Route End Point Protection
+//
+// This source code is licensed under the BSD-style license found in the
+// LICENSE file in the root directory of this source tree.
+//
+/////////////////////////////////////////////////////////////////////////////
+
+package utils
+
+import (
+	"qdserver/lib/models"
+)
+
+// GetSystemStatus works out whether a system is online, late, offline, or retired.
+// lateAfter and offlineAfter come from the system's SystemSet, where 0 means the default.
+func GetSystemStatus(lastSeen int64, retiredDate int64, lateAfter int64, offlineAfter int64, now int64) string {
+	if retiredDate != 0 {
+		return models.SystemStatusRetired
+	}
+
+	if lateAfter == 0 {
+		lateAfter = models.DefaultLateAfter
+	}
+	if offlineAfter == 0 {
+		offlineAfter = models.DefaultOfflineAfter
+	}
+
+	silence := now - lastSeen
+	if silence > offlineAfter {
+		return models.SystemStatusOffline
+	}
+	if silence > lateAfter {
+		return models.SystemStatusLate
+	}
+	return models.SystemStatusOnline
+}
@@ -22,9 +22,11 @@ import (
 
 	"github.com/coopernurse/gorp"
 	_ "github.com/lib/pq" // Needed for gorp
+	"github.com/streadway/amqp"
 
-	"qdserver/CallbackServer/command"
+	"qdserver/lib/command"
 	"qdserver/lib/models"
+	"qdserver/lib/taskqueue"
 	"qdserver/lib/utils"
 )
 
@@ -41,6 +43,8 @@ var (
 func PrintUsage() {
 	fmt.Printf("Usage: commander\n")
 	fmt.Printf("Usage: list task (<system_ID>|system_UUID>)\n")
+	fmt.Printf("Usage: add task (<system_ID>|system_UUID>) rotatesecret\n")
+	fmt.Printf("Usage: wake (<system_ID>|system_UUID>)\n")
 	fmt.Printf("Usage: remove task <task_ID>\n")
 }
 
@@ -114,6 +118,35 @@ func MatchString(needle string, haystacks ...string) bool {
 // Configuration is the main structure of our config.json file
 type Configuration struct {
 	DBConnectionString string `json:"db_connection_string"`
+	AMQPServer         string `json:"amqp_server"` // Used to wake agents, leave out to let them wait for their next poll
+}
+
+// WakeSystem tells the CallbackServers to hand the system its tasks now, if the system is polling
+func WakeSystem(config *Configuration, systemID int64) {
+	if config.AMQPServer == "" {
+		fmt.Printf("No amqp_server configured, so the agent will get its tasks on its next poll\n")
+		return
+	}
+
+	conn, err := amqp.Dial(config.AMQPServer)
+	if err != nil {
+		panic(err)
+	}
+	defer conn.Close()
+
+	ch, err := conn.Channel()
+	if err != nil {
+		panic(err)
+	}
+	defer ch.Close()
+
+	if err = TaskQueue.DeclareWakeExchange(ch); err != nil {
+		panic(err)
+	}
+	if err = TaskQueue.WakeSystem(ch, systemID); err != nil {
+		panic(err)
+	}
+	fmt.Printf("Woke system %d\n", systemID)
 }
 
 // Load parses our configuration file
@@ -159,18 +192,22 @@ func main() {
 			fmt.Printf("Listing tasks for system %d (%s)\n", systemID, systemUUID)
 
 			var tasks []*models.Task
-			_, err = DB.Select(&tasks, "select * from tasks where systemid=:systemid and deployedtoagentdate=0",
+			_, err = DB.Select(&tasks, "select * from tasks where systemid=:systemid and (state=:pending or state=:deployed)",
 				map[string]interface{}{
 					"systemid": systemID,
+					"pending":  models.TaskStatePending,
+					"deployed": models.TaskStateDeployed,
 				})
 			if err != nil {
 				panic(err)
 			}
 
 			for _, task := range tasks {
-				fmt.Printf("Task %d (%s): %s\n",
+				fmt.Printf("Task %d (%s, state %d, %d attempts): %s\n",
 					task.ID,
 					utils.Int64ToUnixTimeString(task.CreationDate, true),
+					task.State,
+					task.Attempts,
 					task.Command)
 			}
 
@@ -190,11 +227,27 @@ func main() {
 				if err != nil {
 					panic(err)
 				}
+				WakeSystem(config, systemID)
 				return
 
+			} else if MatchString(GetArg(4), "rotatesecret") {
+				fmt.Printf("Creating task to give the agent a new secret\n")
+
+				err = command.QueueSecretRotation(DB, systemID)
+				if err != nil {
+					panic(err)
+				}
+				WakeSystem(config, systemID)
+				return
 			}
 			panic("Unknown command")
 		}
+	} else if MatchString(GetArg(1), "wake") {
+		systemID, systemUUID := GetSystem(GetArg(2))
+		fmt.Printf("Waking system %d (%s)\n", systemID, systemUUID)
+
+		WakeSystem(config, systemID)
+		return
 	} else if MatchString(GetArg(1), "remove", "rm") {
 		if MatchString(GetArg(2), "task", "tasks") {
 			taskID := GetArg(3)
@@ -215,7 +268,8 @@ func main() {
 				panic(err)
 			}
 
-			task.DeployedToAgentDate = utils.DBTimeNow()
+			// Expire it so it is never sent
+			task.State = models.TaskStateExpired
 
 			_, err = DB.Update(&task)
 			if err != nil {
@@ -228,7 +282,7 @@ func main() {
 	}
 
 	// No commands matched so print Usage
-	fmt.Errorf("Arguments did not match available commands")
+	fmt.Printf("Arguments did not match available commands\n")
 	PrintUsage()
 	os.Exit(-1)
 }
@@ -0,0 +1,105 @@
+////////////////////////////////////////////////////////////////////////////
+//
+// Summit Route End Point Protection
+//
+// This source code is licensed under the BSD-style license found in the
+// LICENSE file in the root directory of this source tree.
+//
+/////////////////////////////////////////////////////////////////////////////
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strconv"
+
+	"github.com/coopernurse/gorp"
+
+	"qdserver/CallbackServer/system"
+	"qdserver/lib/migrations"
+	"qdserver/lib/models"
+	"qdserver/lib/utils"
+)
+
+func usage() {
+	fmt.Printf("Applies and rolls back changes to the database schema.\n")
+	fmt.Printf("Usage: migrate [-config <CallbackServer config.json>] <command>\n")
+	fmt.Printf("  status          Lists the migrations and whether they have been applied\n")
+	fmt.Printf("  up [version]    Applies the pending migrations, up to and including the version if given\n")
+	fmt.Printf("  down [steps]    Rolls back the most recently applied migrations, 1 unless steps is given\n")
+	os.Exit(-1)
+}
+
+// intArg returns the optional number given after the command
+func intArg(defaultValue int) int {
+	if flag.NArg() < 2 {
+		return defaultValue
+	}
+	value, err := strconv.Atoi(flag.Arg(1))
+	if err != nil || value <= 0 {
+		usage()
+	}
+	return value
+}
+
+func status(db *gorp.DbMap) error {
+	statuses, err := migrations.Status(db)
+	if err != nil {
+		return err
+	}
+
+	for _, status := range statuses {
+		applied := "pending"
+		if status.AppliedDate != 0 {
+			applied = "applied " + utils.Int64ToUnixTimeString(status.AppliedDate, false)
+		}
+		fmt.Printf("%4d  %-60s %s\n", status.Migration.Version, status.Migration.Description, applied)
+	}
+	return nil
+}
+
+func main() {
+	configfile := flag.String("config", "../../CallbackServer/config.json", "Path to the CallbackServer's configuration file")
+	flag.Parse()
+
+	if flag.NArg() < 1 || flag.NArg() > 2 {
+		usage()
+	}
+
+	config := &system.Configuration{}
+	if err := config.Load(*configfile); err != nil {
+		fmt.Printf("ERROR: Can't read configuration file: %v\n", err)
+		os.Exit(-1)
+	}
+
+	db, err := models.InitDB(config.Database.ConnectionString)
+	if err != nil {
+		fmt.Printf("ERROR: Unable to initialize the database: %v\n", err)
+		os.Exit(-1)
+	}
+	defer db.Db.Close()
+
+	switch flag.Arg(0) {
+	case "status":
+		err = status(db)
+	case "up":
+		var count int
+		count, err = migrations.Up(db, intArg(0))
+		fmt.Printf("Applied %d migrations\n", count)
+	case "down":
+		var count int
+		count, err = migrations.Down(db, intArg(1))
+		fmt.Printf("Rolled back %d migrations\n", count)
+	default:
+		usage()
+	}
+
+	if err != nil {
+		fmt.Printf("ERROR: %v\n", err)
+		os.Exit(-1)
+	}
+
+	fmt.Printf("Success\n")
+}
@@ -0,0 +1,74 @@
+////////////////////////////////////////////////////////////////////////////
+//
+// Summit Route End Point Protection
+//
+// This source code is licensed under the BSD-style license found in the
+// LICENSE file in the root directory of this source tree.
+//
+/////////////////////////////////////////////////////////////////////////////
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"qdserver/CallbackServer/system"
+	"qdserver/lib/storage"
+)
+
+// rotate re-wraps everything in the store with its current master key
+func rotate(name string, config storage.Config) error {
+	if config.Encryption == nil {
+		fmt.Printf("Skipping %s, it is not encrypted\n", name)
+		return nil
+	}
+
+	store, err := storage.New(config)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("Rotating %s to key %s\n", name, config.Encryption.KeyID)
+	changed, err := store.(*storage.EncryptedStore).Rotate()
+	fmt.Printf("Updated %d objects in %s\n", changed, name)
+	return err
+}
+
+func main() {
+	configfile := flag.String("config", "../../CallbackServer/config.json", "Path to the CallbackServer's configuration file")
+	flag.Parse()
+
+	if flag.NArg() != 0 {
+		fmt.Printf("Re-wraps the data keys of stored files with the current master key (key_id), and encrypts\n")
+		fmt.Printf("files that were stored before encryption was turned on.\n")
+		fmt.Printf("Once this has run, old master keys can be removed from the config files.\n")
+		fmt.Printf("Usage: rotatekeys [-config <CallbackServer config.json>]\n")
+		os.Exit(-1)
+	}
+
+	config := &system.Configuration{}
+	if err := config.Load(*configfile); err != nil {
+		fmt.Printf("ERROR: Can't read configuration file: %v\n", err)
+		os.Exit(-1)
+	}
+
+	stores := []struct {
+		name   string
+		config storage.Config
+	}{
+		{"exe_upload", config.Storage.ExeUpload},
+		{"catalog_upload", config.Storage.CatalogUpload},
+		{"updates", config.Storage.Updates},
+	}
+
+	for _, store := range stores {
+		if err := rotate(store.name, store.config); err != nil {
+			fmt.Printf("ERROR: Unable to rotate %s: %v\n", store.name, err)
+			os.Exit(-1)
+		}
+	}
+
+	fmt.Printf("Success\n")
+}
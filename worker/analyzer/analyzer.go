@@ -0,0 +1,256 @@
+////////////////////////////////////////////////////////////////////////////
+//
+// Summit Route End Point Protection
+//
+// This source code is licensed under the BSD-style license found in the
+// LICENSE file in the root directory of this source tree.
+//
+/////////////////////////////////////////////////////////////////////////////
+
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"io/ioutil"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/coopernurse/gorp"
+	_ "github.com/lib/pq" // Needed for gorp
+	"github.com/streadway/amqp"
+
+	"qdserver/lib/authenticode"
+	"qdserver/lib/migrations"
+	"qdserver/lib/models"
+	"qdserver/lib/storage"
+	"qdserver/lib/taskqueue"
+	"qdserver/lib/utils"
+)
+
+// ConfigurationDatabase is a sub-element of Configuration
+type ConfigurationDatabase struct {
+	ConnectionString string `json:"connection_string"`
+}
+
+// ConfigurationAWS is a sub-element of Configuration, kept so older config files that only list S3 buckets still work
+type ConfigurationAWS struct {
+	ExeUpload     utils.AwsS3 `json:"exe_upload"`
+	CatalogUpload utils.AwsS3 `json:"catalog_upload"`
+}
+
+// ConfigurationStorage is a sub-element of Configuration and says where uploaded files are kept
+type ConfigurationStorage struct {
+	ExeUpload     storage.Config `json:"exe_upload"`
+	CatalogUpload storage.Config `json:"catalog_upload"`
+}
+
+// Configuration is the main structure of our config.json file
+type Configuration struct {
+	AMQPServer   string                `json:"amqp_server"`
+	Database     ConfigurationDatabase `json:"database"`
+	Aws          ConfigurationAWS      `json:"aws"`
+	Storage      ConfigurationStorage  `json:"storage"`
+	TrustedRoots string                `json:"trusted_roots"` // PEM file of the roots signatures must lead to
+}
+
+// Load parses our configuration file
+func (configuration *Configuration) Load(filename string) (err error) {
+	data, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return
+	}
+
+	err = json.Unmarshal(data, &configuration)
+	if err != nil {
+		return
+	}
+
+	// Defaults for older config files
+	if configuration.Storage.ExeUpload.Type == "" {
+		configuration.Storage.ExeUpload = storage.Config{Type: "s3", S3: configuration.Aws.ExeUpload}
+	}
+	if configuration.Storage.CatalogUpload.Type == "" {
+		configuration.Storage.CatalogUpload = storage.Config{Type: "s3", S3: configuration.Aws.CatalogUpload}
+	}
+
+	return
+}
+
+// Analyzer holds what the task handlers need
+type Analyzer struct {
+	Configuration *Configuration
+	DB            *gorp.DbMap
+	ExeStore      storage.Store
+	CatalogStore  storage.Store
+	Roots         *authenticode.Roots
+}
+
+// maxAttempts is how many times a task is tried before it is given up on
+const maxAttempts = 5
+
+// attemptsHeader counts the times a task has failed, as RabbitMQ doesn't count redeliveries on its own
+const attemptsHeader = "x-srepp-attempts"
+
+// queueHandler processes the body of a message from a queue
+type queueHandler func(analyzer *Analyzer, body []byte) error
+
+// consume reads tasks from the queues until the connection is lost
+func (analyzer *Analyzer) consume(handlers map[string]queueHandler) error {
+	conn, err := amqp.Dial(analyzer.Configuration.AMQPServer)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	ch, err := conn.Channel()
+	if err != nil {
+		return err
+	}
+	defer ch.Close()
+
+	// Only take one task at a time, so the other workers get a share
+	if err = ch.Qos(1, 0, false); err != nil {
+		return err
+	}
+
+	type delivery struct {
+		queueName string
+		amqp.Delivery
+	}
+	deliveries := make(chan delivery)
+	closed := conn.NotifyClose(make(chan *amqp.Error, 1))
+
+	for queueName := range handlers {
+		if err = TaskQueue.CreateQueue(ch, queueName); err != nil {
+			return err
+		}
+
+		msgs, err := ch.Consume(queueName, "", false, false, false, false, nil)
+		if err != nil {
+			return err
+		}
+
+		go func(queueName string, msgs <-chan amqp.Delivery) {
+			for msg := range msgs {
+				deliveries <- delivery{queueName, msg}
+			}
+		}(queueName, msgs)
+	}
+
+	log.Infof("Watching queues")
+	for {
+		select {
+		case msg := <-deliveries:
+			err := handlers[msg.queueName](analyzer, msg.Body)
+			if err == nil {
+				msg.Ack(false)
+				continue
+			}
+			log.Errorf("Unable to process task from %s (%s), %v", msg.queueName, msg.Body, err)
+
+			if err = retry(ch, msg.queueName, msg.Delivery); err != nil {
+				// Put it back as it was, so it isn't lost
+				log.Errorf("Unable to requeue task from %s (%s), %v", msg.queueName, msg.Body, err)
+				msg.Nack(false, true)
+			}
+		case err := <-closed:
+			return err
+		}
+	}
+}
+
+// retry puts a failed task back on the end of its queue, so it is tried again after the tasks waiting behind it, unless
+// it has failed maxAttempts times.  Then it is rejected, and dead lettered if the queue has been set up to.
+func retry(ch *amqp.Channel, queueName string, msg amqp.Delivery) error {
+	attempts, _ := msg.Headers[attemptsHeader].(int32)
+	attempts++
+	if attempts >= maxAttempts {
+		log.Errorf("Giving up on task from %s (%s) after %d attempts", queueName, msg.Body, attempts)
+		return msg.Nack(false, false)
+	}
+
+	// Nacking with requeue would put it back at the front without a count, so publish a copy with one instead
+	err := ch.Publish(
+		"",        // exchange
+		queueName, // routing key
+		false,     // mandatory
+		false,     // immediate
+		amqp.Publishing{
+			ContentType: msg.ContentType,
+			Headers:     amqp.Table{attemptsHeader: attempts},
+			Body:        msg.Body,
+		})
+	if err != nil {
+		return err
+	}
+	return msg.Ack(false)
+}
+
+func main() {
+	configfile := flag.String("config", "config.json", "Path to configuration file")
+	exeID := flag.Int64("exe", 0, "Analyze this executable file ID and exit")
+	catalogID := flag.Int64("catalog", 0, "Analyze this catalog file ID and exit")
+	flag.Parse()
+
+	analyzer := &Analyzer{Configuration: &Configuration{}}
+
+	// Load our configuration file
+	err := analyzer.Configuration.Load(*configfile)
+	if err != nil {
+		log.Fatalf("Can't read configuration file: %s", err)
+	}
+
+	analyzer.DB, err = models.InitDB(analyzer.Configuration.Database.ConnectionString)
+	if err != nil {
+		log.Fatalf("Unable to initialize the database: %v", err)
+	}
+	defer analyzer.DB.Db.Close()
+
+	if err = migrations.CheckCurrent(analyzer.DB); err != nil {
+		log.Fatalf("%v", err)
+	}
+
+	analyzer.ExeStore, err = storage.New(analyzer.Configuration.Storage.ExeUpload)
+	if err != nil {
+		log.Fatalf("Unable to set up storage for executables: %v", err)
+	}
+	analyzer.CatalogStore, err = storage.New(analyzer.Configuration.Storage.CatalogUpload)
+	if err != nil {
+		log.Fatalf("Unable to set up storage for catalogs: %v", err)
+	}
+
+	if analyzer.Configuration.TrustedRoots != "" {
+		analyzer.Roots, err = authenticode.LoadRoots(analyzer.Configuration.TrustedRoots)
+		if err != nil {
+			log.Fatalf("Unable to load trusted roots: %v", err)
+		}
+	} else {
+		log.Warningf("No trusted_roots are configured, so no signature will be trusted")
+	}
+
+	// Command-line mode for re-analyzing a single file
+	if *exeID != 0 {
+		if err = analyzer.AnalyzeExecutable(*exeID); err != nil {
+			log.Fatalf("Unable to analyze file %d, %v", *exeID, err)
+		}
+		return
+	}
+	if *catalogID != 0 {
+		if err = analyzer.AnalyzeCatalog(*catalogID); err != nil {
+			log.Fatalf("Unable to analyze catalog %d, %v", *catalogID, err)
+		}
+		return
+	}
+
+	handlers := map[string]queueHandler{
+		"analyzefile":    handleAnalyzeFile,
+		"analyzecatalog": handleAnalyzeCatalog,
+	}
+
+	for {
+		err = analyzer.consume(handlers)
+		log.Errorf("Lost connection to the queue, reconnecting: %v", err)
+		time.Sleep(5 * time.Second)
+	}
+}
@@ -0,0 +1,194 @@
+////////////////////////////////////////////////////////////////////////////
+//
+// Summit Route End Point Protection
+//
+// This source code is licensed under the BSD-style license found in the
+// LICENSE file in the root directory of this source tree.
+//
+/////////////////////////////////////////////////////////////////////////////
+
+package main
+
+import (
+	"database/sql"
+	"encoding/hex"
+	"fmt"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+
+	"qdserver/lib/authenticode"
+	"qdserver/lib/models"
+	"qdserver/lib/storage"
+	"qdserver/lib/taskqueue"
+	"qdserver/lib/utils"
+)
+
+// handleAnalyzeCatalog is called for each task on the analyzecatalog queue
+func handleAnalyzeCatalog(analyzer *Analyzer, body []byte) error {
+	catalogID, err := TaskQueue.ParseAnalyzeCatalogMessage(body)
+	if err != nil {
+		return err
+	}
+	return analyzer.AnalyzeCatalog(catalogID)
+}
+
+// AnalyzeCatalog downloads the uploaded copy of the catalog, records the hashes it trusts and
+// marks any executable files we've already seen that match those hashes as signed by the catalog's signer
+func (analyzer *Analyzer) AnalyzeCatalog(catalogID int64) error {
+	log.Infof("Analyzing catalog %d", catalogID)
+
+	var catalogFile models.CatalogFile
+	err := analyzer.DB.SelectOne(&catalogFile, "select * from catalogfiles where ID=:id",
+		map[string]interface{}{
+			"id": catalogID,
+		})
+	if err != nil {
+		return fmt.Errorf("Catalog ID not found in database: %v", err)
+	}
+
+	contents, err := storage.ReadAll(analyzer.CatalogStore, storage.HashKey(hex.EncodeToString(catalogFile.Sha256)))
+	if err != nil {
+		return fmt.Errorf("Unable to download catalog: %v", err)
+	}
+	if len(contents) != catalogFile.Size {
+		return fmt.Errorf("File sizes did not match (%d != %d)", len(contents), catalogFile.Size)
+	}
+
+	catalog, err := authenticode.ParseCatalog(contents, analyzer.Roots, time.Now())
+	if err != nil {
+		return err
+	}
+
+	//
+	// Get signer for this catalog.  Only a signature that leads to a trusted root vouches for the files in it.
+	//
+	catalogFile.SignatureStatus = getSignatureStatus(catalog.Signatures)
+	catalogFile.SignerID = 0
+	if signer := catalog.Signer(); signer != nil {
+		catalogFile.SignerID, err = analyzer.addSignerChain(signer)
+		if err != nil {
+			return err
+		}
+	} else {
+		for _, signature := range catalog.Signatures {
+			log.Infof("Not using signature on catalog %d: %s", catalogID, signature.Problem)
+		}
+	}
+
+	//
+	// Record the files this catalog says it trusts
+	//
+	log.Infof("Number of CTL members: %d", len(catalog.Entries))
+	for _, entry := range catalog.Entries {
+		ctl := models.CertificateTrustList{
+			CatalogID: catalogID,
+			Hash:      entry.Hash,
+			HashType:  entry.HashType,
+		}
+
+		// We may be re-analyzing this catalog
+		err = analyzer.DB.SelectOne(&ctl, "select * from certificatetrustlist where CatalogID=:catalogID and Hash=:hash",
+			map[string]interface{}{
+				"catalogID": catalogID,
+				"hash":      entry.Hash,
+			})
+		if err == sql.ErrNoRows {
+			err = analyzer.DB.Insert(&ctl)
+		}
+		if err != nil {
+			return fmt.Errorf("Unable to record CTL entry: %v", err)
+		}
+
+		// Look for matching executable files
+		var executableFiles []models.ExecutableFile
+		_, err = analyzer.DB.Select(&executableFiles, fmt.Sprintf("select * from executablefiles where Authenticode%s=:hash", entry.HashType),
+			map[string]interface{}{
+				"hash": entry.Hash,
+			})
+		if err != nil {
+			return err
+		}
+		if len(executableFiles) > 1 {
+			log.Warningf("More than one match found for a hash in catalog %d, that should not happen", catalogID)
+		}
+
+		for _, executableFile := range executableFiles {
+			log.Infof("Match found of catalog %d with file %d", catalogID, executableFile.ID)
+			if err = analyzer.recordCatalogMatch(&executableFile, &ctl, &catalogFile); err != nil {
+				return err
+			}
+		}
+	}
+
+	// Record that we analyzed this catalog
+	catalogFile.AnalysisDate = utils.DBTimeNow()
+	if _, err = analyzer.DB.Update(&catalogFile); err != nil {
+		return fmt.Errorf("Unable to update catalog: %v", err)
+	}
+
+	return nil
+}
+
+// matchCatalogs looks for catalogs that trust the executable file's Authenticode hashes
+func (analyzer *Analyzer) matchCatalogs(executableFile *models.ExecutableFile) error {
+	var ctls []models.CertificateTrustList
+	_, err := analyzer.DB.Select(&ctls, `SELECT *
+		FROM certificatetrustlist
+		WHERE (HashType='md5' and Hash=:md5) or (HashType='sha1' and Hash=:sha1) or (HashType='sha256' and Hash=:sha256)`,
+		map[string]interface{}{
+			"md5":    executableFile.AuthenticodeMd5,
+			"sha1":   executableFile.AuthenticodeSha1,
+			"sha256": executableFile.AuthenticodeSha256,
+		})
+	if err != nil {
+		return err
+	}
+
+	for _, ctl := range ctls {
+		var catalogFile models.CatalogFile
+		err = analyzer.DB.SelectOne(&catalogFile, "select * from catalogfiles where ID=:id",
+			map[string]interface{}{
+				"id": ctl.CatalogID,
+			})
+		if err != nil {
+			return fmt.Errorf("Unable to find catalog %d: %v", ctl.CatalogID, err)
+		}
+
+		log.Infof("Match found in catalog file %d for exe %d", catalogFile.ID, executableFile.ID)
+		if err = analyzer.recordCatalogMatch(executableFile, &ctl, &catalogFile); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// recordCatalogMatch saves the match on the CTL entry.  If the catalog's signature is valid and trusted, it also maps
+// the file to the catalog's signer, and marks the file as catalog signed if it has no valid signature of its own.
+// The executable file is updated in the database.
+func (analyzer *Analyzer) recordCatalogMatch(executableFile *models.ExecutableFile, ctl *models.CertificateTrustList, catalogFile *models.CatalogFile) error {
+	if ctl.FileID != executableFile.ID {
+		ctl.FileID = executableFile.ID
+		if _, err := analyzer.DB.Update(ctl); err != nil {
+			return fmt.Errorf("Unable to update CTL entry: %v", err)
+		}
+	}
+
+	if catalogFile.SignatureStatus != models.SignatureStatusValid || catalogFile.SignerID == 0 {
+		return nil
+	}
+
+	if err := analyzer.mapFileToSigner(executableFile.ID, catalogFile.SignerID); err != nil {
+		return err
+	}
+
+	if executableFile.SignatureStatus != models.SignatureStatusValid {
+		executableFile.SignatureStatus = models.SignatureStatusCatalog
+		if _, err := analyzer.DB.Update(executableFile); err != nil {
+			return fmt.Errorf("Unable to update file: %v", err)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,91 @@
+////////////////////////////////////////////////////////////////////////////
+//
+// Summit Route End Point Protection
+//
+// This source code is licensed under the BSD-style license found in the
+// LICENSE file in the root directory of this source tree.
+//
+/////////////////////////////////////////////////////////////////////////////
+
+package main
+
+import (
+	"encoding/hex"
+	"fmt"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+
+	"qdserver/lib/authenticode"
+	"qdserver/lib/models"
+	"qdserver/lib/peinfo"
+	"qdserver/lib/storage"
+	"qdserver/lib/taskqueue"
+	"qdserver/lib/utils"
+)
+
+// handleAnalyzeFile is called for each task on the analyzefile queue
+func handleAnalyzeFile(analyzer *Analyzer, body []byte) error {
+	fileID, err := TaskQueue.ParseAnalyzeFileMessage(body)
+	if err != nil {
+		return err
+	}
+	return analyzer.AnalyzeExecutable(fileID)
+}
+
+// AnalyzeExecutable downloads the uploaded copy of the file and records what we learn from its PE headers and signatures
+func (analyzer *Analyzer) AnalyzeExecutable(fileID int64) error {
+	log.Infof("Processing executable file %d", fileID)
+
+	var executableFile models.ExecutableFile
+	err := analyzer.DB.SelectOne(&executableFile, "select * from executablefiles where ID=:id",
+		map[string]interface{}{
+			"id": fileID,
+		})
+	if err != nil {
+		return fmt.Errorf("File ID not found in database: %v", err)
+	}
+
+	contents, err := storage.ReadAll(analyzer.ExeStore, storage.HashKey(hex.EncodeToString(executableFile.Sha256)))
+	if err != nil {
+		return fmt.Errorf("Unable to download file: %v", err)
+	}
+	if len(contents) != executableFile.Size {
+		return fmt.Errorf("File sizes did not match (%d != %d)", len(contents), executableFile.Size)
+	}
+
+	info, err := peinfo.Parse(contents)
+	if err != nil {
+		return err
+	}
+
+	executableFile.Architecture = info.Architecture
+	executableFile.CodeSectionSha256 = info.CodeSectionSha256
+
+	executableFile.AuthenticodeMd5 = info.AuthenticodeMd5
+	executableFile.AuthenticodeSha1 = info.AuthenticodeSha1
+	executableFile.AuthenticodeSha256 = info.AuthenticodeSha256
+
+	executableFile.CompanyName = info.VersionInfo["CompanyName"]
+	executableFile.ProductVersion = info.VersionInfo["ProductVersion"]
+	executableFile.ProductName = info.VersionInfo["ProductName"]
+	executableFile.FileDescription = info.VersionInfo["FileDescription"]
+	executableFile.InternalName = info.VersionInfo["InternalName"]
+	executableFile.FileVersion = info.VersionInfo["FileVersion"]
+	executableFile.OriginalFilename = info.VersionInfo["OriginalFilename"]
+
+	signatures := authenticode.VerifyFile(info, analyzer.Roots, time.Now())
+	if err = analyzer.recordSignatures(executableFile.ID, signatures); err != nil {
+		return err
+	}
+	executableFile.SignatureStatus = getSignatureStatus(signatures)
+
+	executableFile.AnalysisDate = utils.DBTimeNow()
+
+	if _, err = analyzer.DB.Update(&executableFile); err != nil {
+		return fmt.Errorf("Unable to update file: %v", err)
+	}
+
+	// Most Windows binaries are only signed through a catalog
+	return analyzer.matchCatalogs(&executableFile)
+}
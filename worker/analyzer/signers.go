@@ -0,0 +1,184 @@
+////////////////////////////////////////////////////////////////////////////
+//
+// Summit Route End Point Protection
+//
+// This source code is licensed under the BSD-style license found in the
+// LICENSE file in the root directory of this source tree.
+//
+/////////////////////////////////////////////////////////////////////////////
+
+package main
+
+import (
+	"crypto/sha256"
+	"database/sql"
+	"fmt"
+
+	log "github.com/Sirupsen/logrus"
+
+	"qdserver/lib/authenticode"
+	"qdserver/lib/models"
+)
+
+// getSignatureStatus summarizes the signatures of a file
+func getSignatureStatus(signatures []*authenticode.Signature) int {
+	if len(signatures) == 0 {
+		return models.SignatureStatusUnsigned
+	}
+
+	status := models.SignatureStatusInvalid
+	for _, signature := range signatures {
+		if !signature.Valid {
+			continue
+		}
+		if !signature.Trusted {
+			if status == models.SignatureStatusInvalid {
+				status = models.SignatureStatusUntrusted
+			}
+			continue
+		}
+		if !signature.Expired {
+			return models.SignatureStatusValid
+		}
+		status = models.SignatureStatusExpired
+	}
+	return status
+}
+
+// addSigner returns the ID of the Signer for the certificate, adding it if it is new.
+// Signers are identified by the sha256 fingerprint of their certificate, as anyone can make a certificate with the
+// issuer and serial number of another.
+func (analyzer *Analyzer) addSigner(signature *authenticode.Signature, index int, issuerID int64) (int64, error) {
+	cert := signature.Chain[index]
+	fingerprint := sha256.Sum256(cert.Raw)
+
+	var signer models.Signer
+	err := analyzer.DB.SelectOne(&signer, "select * from signers where Fingerprint=:fingerprint",
+		map[string]interface{}{
+			"fingerprint": fingerprint[:],
+		})
+	if err == nil {
+		// We may not have known the issuer when this was first seen
+		if signer.IssuerID == 0 && issuerID != 0 {
+			signer.IssuerID = issuerID
+			if _, err = analyzer.DB.Update(&signer); err != nil {
+				return 0, err
+			}
+		}
+		return signer.ID, nil
+	} else if err != sql.ErrNoRows {
+		return 0, err
+	}
+
+	signer = models.Signer{
+		Version:                          cert.Version,
+		Subject:                          cert.Subject.String(),
+		SubjectShortName:                 authenticode.ShortName(cert),
+		SerialNumber:                     cert.SerialNumber.Bytes(),
+		DigestEncryptionAlgorithmKeySize: authenticode.KeySize(cert),
+		IssuerID:                         issuerID,
+		Issuer:                           cert.Issuer.String(),
+		NotBefore:                        cert.NotBefore.Unix(),
+		NotAfter:                         cert.NotAfter.Unix(),
+		Fingerprint:                      fingerprint[:],
+	}
+
+	// The signing certificate gets the algorithms from the signature, the issuers get the algorithms
+	// they used to sign the certificate below them
+	if index == 0 {
+		signer.DigestAlgorithm = signature.DigestAlgorithm
+		signer.DigestEncryptionAlgorithm = signature.DigestEncryptionAlgorithm
+	} else {
+		signer.DigestAlgorithm, signer.DigestEncryptionAlgorithm = authenticode.IssuerAlgorithms(signature.Chain[index-1])
+	}
+
+	if err = analyzer.DB.Insert(&signer); err != nil {
+		return 0, err
+	}
+	return signer.ID, nil
+}
+
+// addSignerChain records each certificate in the chain, starting from the top so the IssuerIDs can be set.
+// Returns the ID of the signing certificate.
+func (analyzer *Analyzer) addSignerChain(signature *authenticode.Signature) (int64, error) {
+	var signerID int64
+	for index := len(signature.Chain) - 1; index >= 0; index-- {
+		var err error
+		signerID, err = analyzer.addSigner(signature, index, signerID)
+		if err != nil {
+			return 0, fmt.Errorf("Unable to add signer: %v", err)
+		}
+	}
+	return signerID, nil
+}
+
+// mapFileToSigner records that the file is signed by the signer, if we don't already know it
+func (analyzer *Analyzer) mapFileToSigner(fileID, signerID int64) error {
+	count, err := analyzer.DB.SelectInt("select count(*) from filetosignermap where FileID=:fileID and SignerID=:signerID",
+		map[string]interface{}{
+			"fileID":   fileID,
+			"signerID": signerID,
+		})
+	if err != nil {
+		return err
+	}
+	if count != 0 {
+		return nil
+	}
+
+	if err = analyzer.DB.Insert(&models.FileToSignerMap{FileID: fileID, SignerID: signerID}); err != nil {
+		return fmt.Errorf("Unable to map file to signer: %v", err)
+	}
+	return nil
+}
+
+// recordSignatures adds the signers of the file, and its counter signers.  Only signatures that are valid and trusted
+// are recorded, as rules match files by their signers.
+func (analyzer *Analyzer) recordSignatures(fileID int64, signatures []*authenticode.Signature) error {
+	for _, signature := range signatures {
+		if !signature.Valid || !signature.Trusted {
+			log.Infof("Not recording signature on file %d: %s", fileID, signature.Problem)
+			continue
+		}
+
+		signerID, err := analyzer.addSignerChain(signature)
+		if err != nil {
+			return err
+		}
+
+		if err = analyzer.mapFileToSigner(fileID, signerID); err != nil {
+			return err
+		}
+
+		counterSignature := signature.CounterSignature
+		if counterSignature == nil || !counterSignature.Valid || !counterSignature.Trusted {
+			continue
+		}
+
+		counterSignerID, err := analyzer.addSignerChain(counterSignature)
+		if err != nil {
+			return err
+		}
+
+		count, err := analyzer.DB.SelectInt("select count(*) from filetocountersignermap where FileID=:fileID and SignerID=:signerID",
+			map[string]interface{}{
+				"fileID":   fileID,
+				"signerID": counterSignerID,
+			})
+		if err != nil {
+			return err
+		}
+		if count == 0 {
+			err = analyzer.DB.Insert(&models.FileToCounterSignerMap{
+				FileID:    fileID,
+				Timestamp: signature.Timestamp.Unix(),
+				SignerID:  counterSignerID,
+			})
+			if err != nil {
+				return fmt.Errorf("Unable to map file to counter signer: %v", err)
+			}
+		}
+	}
+
+	return nil
+}